@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"api.alexmontague.ca/internal/database"
+	"api.alexmontague.ca/internal/nhl/models"
+	"api.alexmontague.ca/internal/nhl/service"
+)
+
+func main() {
+	// Define command-line flags
+	modelID := flag.Int("model", 0, "ID of a registered model to backtest")
+	strategy := flag.String("strategy", string(models.StandardCalculation), "Calculation strategy for -params")
+	paramsPath := flag.String("params", "", "JSON file of ModelParameters to backtest instead of a registered model")
+	startDate := flag.String("start", "", "First date to replay (YYYY-MM-DD)")
+	endDate := flag.String("end", "", "Last date to replay (YYYY-MM-DD)")
+	dbPath := flag.String("db", database.DB_PATH, "Path to SQLite database file")
+
+	flag.Parse()
+
+	if (*modelID == 0) == (*paramsPath == "") || *startDate == "" || *endDate == "" {
+		fmt.Println("Please specify -start, -end and exactly one of -model ID or -params FILE")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	req := service.BacktestRequest{
+		CalculationStrategy: models.CalculationStrategy(*strategy),
+		StartDate:           *startDate,
+		EndDate:             *endDate,
+	}
+	if *modelID != 0 {
+		req.ModelVersionID = modelID
+	} else {
+		data, err := os.ReadFile(*paramsPath)
+		if err != nil {
+			log.Fatalf("Failed to read parameters: %v", err)
+		}
+		var params models.ModelParameters
+		if err := json.Unmarshal(data, &params); err != nil {
+			log.Fatalf("Failed to parse parameters: %v", err)
+		}
+		req.Parameters = &params
+	}
+
+	// Initialize database
+	if err := database.InitDB(*dbPath); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	model, err := req.Model()
+	if err != nil {
+		log.Fatalf("Failed to load model: %v", err)
+	}
+
+	result, err := service.RunBacktest(context.Background(), model, req.StartDate, req.EndDate)
+	if err != nil {
+		log.Fatalf("Failed to run backtest: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+}
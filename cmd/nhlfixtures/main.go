@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"api.alexmontague.ca/helpers"
+	"api.alexmontague.ca/internal/nhl/models"
+	"api.alexmontague.ca/internal/nhl/repository"
+	"api.alexmontague.ca/internal/nhl/service"
+)
+
+// Records every NHL API response needed to predict and validate a date, so the
+// prediction pipeline can be replayed offline with repository.ReplayTransport
+func main() {
+	// Define command-line flags
+	date := flag.String("date", helpers.GetCurrentESTDate(), "Game date to record (YYYY-MM-DD)")
+	dir := flag.String("dir", "", "Directory to write fixtures to (default ./internal/nhl/testdata/DATE)")
+
+	flag.Parse()
+
+	if *dir == "" {
+		*dir = filepath.Join("internal", "nhl", "testdata", *date)
+	}
+
+	// The database isn't opened so every response comes from the API rather than the cache
+	config := repository.DefaultClientConfig()
+	config.Transport = &repository.RecordingTransport{Dir: *dir}
+	repository.SetDefaultClient(repository.NewClient(config))
+
+	ctx := context.Background()
+	model := models.GetDefaultModels()[0]
+	games, err := service.ModelPredictionForGames(ctx, *date, model, nil, nil, nil)
+	if err != nil {
+		log.Fatalf("Failed to record predictions: %v", err)
+	}
+
+	gameIDs := make([]int, 0, len(games))
+	for _, game := range games {
+		gameIDs = append(gameIDs, game.GameID)
+	}
+	if len(gameIDs) > 0 {
+		if _, err := repository.FetchActualGameShots(ctx, gameIDs); err != nil {
+			log.Fatalf("Failed to record boxscores: %v", err)
+		}
+	}
+
+	fmt.Printf("Recorded %d games for %s to %s\n", len(games), *date, *dir)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"api.alexmontague.ca/internal/database"
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+	"api.alexmontague.ca/internal/nhl/models"
+	"api.alexmontague.ca/internal/nhl/service"
+)
+
+// Searches for better ModelParameters using validated predictions and their
+// recorded inputs, printing the best candidate model as JSON
+func main() {
+	// Define command-line flags
+	modelID := flag.Int("model", 0, "ID of a registered model to start from (default the first built-in model for -strategy)")
+	strategy := flag.String("strategy", string(models.StandardCalculation), "Calculation strategy to tune when -model isn't given")
+	params := flag.String("tune", "", "Comma separated parameters to tune (default every parameter the strategy and loss use): "+
+		strings.Join(service.TunableParameterNames(), ", "))
+	search := flag.String("search", string(service.SearchCoordinate), "Search method: grid, random or coordinate")
+	loss := flag.String("loss", string(service.LossMAE), "Loss to minimize: mae, hit_rate, brier or log_loss")
+	line := flag.Float64("line", 2.5, "Shot line players are called over or under for the hit rate")
+	iterations := flag.Int("iterations", 200, "Random search samples or coordinate descent passes")
+	gridPoints := flag.Int("grid-points", 5, "Values tried per parameter by grid search")
+	seed := flag.Int64("seed", 1, "Random search seed")
+	holdout := flag.Float64("holdout", 0.2, "Fraction of the most recent dates scored but not searched")
+	startDate := flag.String("start", "", "First date of validated history (YYYY-MM-DD)")
+	endDate := flag.String("end", "", "Last date of validated history (YYYY-MM-DD)")
+	register := flag.Bool("register", false, "Register the candidate as a new inactive model")
+	dbPath := flag.String("db", database.DB_PATH, "Path to SQLite database file")
+
+	flag.Parse()
+
+	if *startDate == "" || *endDate == "" {
+		fmt.Println("Please specify -start and -end")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Initialize database
+	if err := database.InitDB(*dbPath); err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	start, err := startingModel(*modelID, models.CalculationStrategy(*strategy))
+	if err != nil {
+		log.Fatalf("Failed to load starting model: %v", err)
+	}
+
+	var tune []string
+	for _, name := range strings.Split(*params, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			tune = append(tune, name)
+		}
+	}
+
+	// Ctrl-C stops the search
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := service.TuneParameters(ctx, service.TuningRequest{
+		Start:           start,
+		Parameters:      tune,
+		Search:          service.SearchMethod(*search),
+		Loss:            service.TuningLoss(*loss),
+		Line:            *line,
+		Iterations:      *iterations,
+		GridPoints:      *gridPoints,
+		Seed:            *seed,
+		HoldoutFraction: *holdout,
+		StartDate:       *startDate,
+		EndDate:         *endDate,
+	})
+	if err != nil {
+		log.Fatalf("Failed to tune parameters: %v", err)
+	}
+
+	if *register {
+		model, err := dbRepository.CreateModelVersion(result.Candidate)
+		if err != nil {
+			log.Fatalf("Failed to register candidate: %v", err)
+		}
+		result.Candidate = *model
+		log.Printf("Registered candidate as model %d", model.ID)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+}
+
+// startingModel loads a registered model, or the first built-in model for strategy
+func startingModel(modelID int, strategy models.CalculationStrategy) (models.ModelVersion, error) {
+	if modelID != 0 {
+		service.InitializeModels()
+		model, err := dbRepository.GetModelVersion(modelID)
+		if err != nil {
+			return models.ModelVersion{}, err
+		}
+		return *model, nil
+	}
+
+	for _, model := range models.GetDefaultModels() {
+		if model.CalculationStrategy == strategy {
+			return model, nil
+		}
+	}
+	return models.ModelVersion{}, fmt.Errorf("no built-in model uses the %q strategy", strategy)
+}
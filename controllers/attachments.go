@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"api.alexmontague.ca/helpers"
+	"api.alexmontague.ca/internal/database/repository"
+	"github.com/gorilla/mux"
+)
+
+// Route : '/budget/transactions/{id}/attachments'
+// Type  : 'GET'
+func GetAttachments(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	attachments, err := repository.GetAttachments(mux.Vars(r)["id"], member.HouseholdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch attachments", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// Route : '/budget/transactions/{id}/attachments'
+// Type  : 'POST' (multipart/form-data with a "file" field)
+func UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart headers around the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, repository.MAX_ATTACHMENT_SIZE+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			logAndRespondError(w, http.StatusRequestEntityTooLarge, repository.ErrAttachmentTooLarge.Error(), err)
+			return
+		}
+		logAndRespondError(w, http.StatusBadRequest, "Expected a multipart upload with a file field", err)
+		return
+	}
+	defer file.Close()
+
+	attachment, err := repository.SaveAttachment(mux.Vars(r)["id"], member.HouseholdID, member.UserID, header.Filename, file)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		logAndRespondError(w, http.StatusNotFound, "Transaction not found", err)
+		return
+	case errors.Is(err, repository.ErrAttachmentTooLarge):
+		logAndRespondError(w, http.StatusRequestEntityTooLarge, err.Error(), err)
+		return
+	case errors.Is(err, repository.ErrUnsupportedAttachmentType):
+		logAndRespondError(w, http.StatusUnsupportedMediaType, err.Error(), err)
+		return
+	case errors.Is(err, repository.ErrTooManyAttachments):
+		logAndRespondError(w, http.StatusConflict, err.Error(), err)
+		return
+	case err != nil:
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to save attachment", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// Route : '/budget/attachments/{id}'
+// Type  : 'GET'
+func DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	attachment, err := repository.GetAttachment(mux.Vars(r)["id"], member.HouseholdID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logAndRespondError(w, http.StatusNotFound, "Attachment not found", err)
+		return
+	}
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch attachment", err)
+		return
+	}
+
+	file, err := repository.OpenAttachment(attachment)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to open attachment", err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("content-type", attachment.ContentType)
+	w.Header().Set("content-length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	io.Copy(w, file)
+}
+
+// Route : '/budget/attachments/{id}'
+// Type  : 'DELETE'
+func DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	err := repository.DeleteAttachment(mux.Vars(r)["id"], member.HouseholdID, member.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logAndRespondError(w, http.StatusNotFound, "Attachment not found", err)
+		return
+	}
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete attachment", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exportBudgetArchive streams the export as a zip including attachment files
+func exportBudgetArchive(w http.ResponseWriter, householdID string) {
+	archive, err := repository.GetBudgetArchive(householdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to export data", err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/zip")
+	w.Header().Set("content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "budget-export-" + helpers.GetCurrentESTDate() + ".zip"}))
+
+	// Once the zip has started the status is sent, a failure leaves the client
+	// with a truncated archive that won't open
+	if err := archive.Write(w); err != nil {
+		log.Printf("[Budget Error] Failed to stream export archive: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api.alexmontague.ca/helpers"
+	"api.alexmontague.ca/internal/database/repository"
+	"github.com/gorilla/mux"
+)
+
+const DEFAULT_AUDIT_LIMIT = 100
+
+// Route : '/budget/audit?entityType=transaction&entityId=...&limit=100'
+// Type  : 'GET'
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := DEFAULT_AUDIT_LIMIT
+	if raw := query.Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "limit must be a positive integer"})
+			return
+		}
+		limit = value
+	}
+
+	entries, err := repository.GetAuditLog(member.HouseholdID, query.Get("entityType"), query.Get("entityId"), limit)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch audit log", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(entries)
+}
+
+// Route : '/budget/audit/{id}/undo'
+// Type  : 'POST'
+func UndoAuditEntry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid audit entry id", err)
+		return
+	}
+
+	entry, err := repository.UndoAuditEntry(id, member.HouseholdID, member.UserID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		logAndRespondError(w, http.StatusNotFound, "Audit entry not found", err)
+		return
+	case errors.Is(err, repository.ErrNotUndoable):
+		// Bulk deletes and restores are reverted through the trash, not undo
+		logAndRespondError(w, http.StatusBadRequest, "Failed to undo: "+err.Error()+", bulk deletes are restored from the trash", err)
+		return
+	case errors.Is(err, repository.ErrUndoConflict), errors.Is(err, repository.ErrAlreadyUndone):
+		logAndRespondError(w, http.StatusConflict, "Failed to undo: "+err.Error(), err)
+		return
+	case err != nil:
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to undo audit entry", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(entry)
+}
+
+// Route : '/budget/trash'
+// Type  : 'GET'
+func GetTrash(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	batches, err := repository.GetTrash(member.HouseholdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch trash", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(batches)
+}
+
+// Route : '/budget/trash/{id}/restore'
+// Type  : 'POST'
+func RestoreTrash(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	restored, err := repository.RestoreTrash(mux.Vars(r)["id"], member.HouseholdID, member.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logAndRespondError(w, http.StatusNotFound, "Trash batch not found or expired", err)
+		return
+	}
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to restore trash", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"restored": restored})
+}
+
+// Route : '/budget/trash/{id}'
+// Type  : 'DELETE'
+func DeleteTrash(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	err := repository.DeleteTrash(mux.Vars(r)["id"], member.HouseholdID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logAndRespondError(w, http.StatusNotFound, "Trash batch not found", err)
+		return
+	}
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete trash", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -38,7 +38,13 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := repository.CreateDefaultCategories(user.ID); err != nil {
+	household, err := repository.CreateHousehold(user.Email, user.ID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to create household", err)
+		return
+	}
+
+	if err := repository.CreateDefaultCategories(household.ID, user.ID); err != nil {
 		log.Printf("[Warning] Failed to create default category for user %d: %v", user.ID, err)
 	}
 
@@ -123,9 +129,16 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	households, err := repository.GetUserHouseholds(user.ID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch households", err)
+		return
+	}
+
 	response := map[string]interface{}{
-		"id":    user.ID,
-		"email": user.Email,
+		"id":         user.ID,
+		"email":      user.Email,
+		"households": households,
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"api.alexmontague.ca/internal/nhl/service"
+)
+
+// RunBacktest replays a registered model or an ad hoc parameter set over past dates
+// Route : '/nhl/backtest'
+// Type  : 'POST'
+func RunBacktest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req service.BacktestRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	days, err := req.Days()
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if days > service.MAX_BACKTEST_DAYS {
+		logAndRespondError(w, http.StatusBadRequest,
+			fmt.Sprintf("Backtests are limited to %d days, use the backtest command for longer ranges", service.MAX_BACKTEST_DAYS),
+			service.ErrInvalidBacktestRange)
+		return
+	}
+
+	model, err := req.Model()
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		logAndRespondError(w, http.StatusNotFound, "Failed to run backtest: model not found", err)
+		return
+	case errors.Is(err, service.ErrInvalidBacktestModel):
+		logAndRespondError(w, http.StatusBadRequest, "Failed to run backtest: "+err.Error(), err)
+		return
+	case err != nil:
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to run backtest", err)
+		return
+	}
+
+	result, err := service.RunBacktest(r.Context(), model, req.StartDate, req.EndDate)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to run backtest", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
@@ -1,9 +1,14 @@
 package controllers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"api.alexmontague.ca/helpers"
 	"api.alexmontague.ca/internal/database/repository"
@@ -17,70 +22,141 @@ func logAndRespondError(w http.ResponseWriter, statusCode int, message string, e
 	json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: statusCode, Message: message})
 }
 
+type validationErrorResponse struct {
+	helpers.Response
+	Fields []repository.FieldError `json:"fields"`
+}
+
+// respondPatchError maps a failed merge patch to 404 when the row is missing,
+// 412 when If-Match no longer holds and 400 listing every invalid field
+func respondPatchError(w http.ResponseWriter, message string, resource string, err error) {
+	var validationErr *repository.ValidationError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		logAndRespondError(w, http.StatusNotFound, message+": "+resource+" not found", err)
+	case errors.Is(err, repository.ErrVersionMismatch):
+		logAndRespondError(w, http.StatusPreconditionFailed, message+": "+err.Error(), err)
+	case errors.As(err, &validationErr):
+		log.Printf("[Budget Error] %s: %v", message, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(validationErrorResponse{
+			Response: helpers.Response{Error: true, Code: http.StatusBadRequest, Message: message + ": invalid fields"},
+			Fields:   validationErr.Fields,
+		})
+	default:
+		logAndRespondError(w, http.StatusInternalServerError, message, err)
+	}
+}
+
 func GetCategories(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	categories, err := repository.GetCategories(authUser.UserID)
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+	categories, err := repository.GetCategories(member.HouseholdID)
 	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch categories", err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(categories)
+	writeWithETag(w, r, "", categories)
 }
 
 func CreateCategory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	var category repository.Category
 	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
 		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	saved, err := repository.SaveCategory(category, authUser.UserID)
+	saved, err := repository.SaveCategory(category, member.HouseholdID, member.UserID)
+	if errors.Is(err, repository.ErrInvalidTaxClass) {
+		logAndRespondError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
 	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to save category", err)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(saved.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(saved)
 }
 
+// Route : '/budget/categories/{id}'
+// Type  : 'GET'
+func GetCategory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	category, err := repository.GetCategory(mux.Vars(r)["id"], member.HouseholdID)
+	if err != nil {
+		respondPatchError(w, "Failed to fetch category", "category", err)
+		return
+	}
+
+	writeWithETag(w, r, versionETag(category.Version), category)
+}
+
+// Route : '/budget/categories/{id}' (JSON Merge Patch)
+// Type  : 'PUT' or 'PATCH'
 func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var updates map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+	ifMatch, ok := parseIfMatch(r)
+	if !ok {
+		respondPatchError(w, "Failed to update category", "category", repository.ErrVersionMismatch)
+		return
+	}
+
+	var patch repository.Patch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
 		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	updated, err := repository.UpdateCategory(id, authUser.UserID, updates)
+	updated, err := repository.UpdateCategory(id, member.HouseholdID, member.UserID, patch, ifMatch)
 	if err != nil {
-		logAndRespondError(w, http.StatusInternalServerError, "Failed to update category", err)
+		respondPatchError(w, "Failed to update category", "category", err)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(updated.Version))
 	json.NewEncoder(w).Encode(updated)
 }
 
 func DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	if err := repository.DeleteCategory(id, authUser.UserID); err != nil {
-		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete category", err)
+	if err := repository.DeleteCategory(id, member.HouseholdID, member.UserID); err != nil {
+		respondPatchError(w, "Failed to delete category", "category", err)
 		return
 	}
 
@@ -90,25 +166,32 @@ func DeleteCategory(w http.ResponseWriter, r *http.Request) {
 func DeleteAllCategories(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	if err := repository.DeleteAllCategories(authUser.UserID); err != nil {
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+	batch, err := repository.DeleteAllCategories(member.HouseholdID, member.UserID)
+	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete all categories", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	json.NewEncoder(w).Encode(batch)
 }
 
 func CreateDefaultCategories(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	if err := repository.CreateDefaultCategories(authUser.UserID); err != nil {
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+	if err := repository.CreateDefaultCategories(member.HouseholdID, member.UserID); err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to create default categories", err)
 		return
 	}
 
-	categories, err := repository.GetCategories(authUser.UserID)
+	categories, err := repository.GetCategories(member.HouseholdID)
 	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch categories", err)
 		return
@@ -121,67 +204,108 @@ func CreateDefaultCategories(w http.ResponseWriter, r *http.Request) {
 func GetBudgets(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	budgets, err := repository.GetBudgets(authUser.UserID)
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+	budgets, err := repository.GetBudgets(member.HouseholdID)
 	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch budgets", err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(budgets)
+	writeWithETag(w, r, "", budgets)
 }
 
 func CreateBudget(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	var budget repository.Budget
 	if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
 		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	saved, err := repository.SaveBudget(budget, authUser.UserID)
+	saved, err := repository.SaveBudget(budget, member.HouseholdID, member.UserID)
 	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to save budget", err)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(saved.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(saved)
 }
 
+// Route : '/budget/budgets/{id}'
+// Type  : 'GET'
+func GetBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	budget, err := repository.GetBudget(mux.Vars(r)["id"], member.HouseholdID)
+	if err != nil {
+		respondPatchError(w, "Failed to fetch budget", "budget", err)
+		return
+	}
+
+	writeWithETag(w, r, versionETag(budget.Version), budget)
+}
+
+// Route : '/budget/budgets/{id}' (JSON Merge Patch)
+// Type  : 'PUT' or 'PATCH'
 func UpdateBudget(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var updates map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+	ifMatch, ok := parseIfMatch(r)
+	if !ok {
+		respondPatchError(w, "Failed to update budget", "budget", repository.ErrVersionMismatch)
+		return
+	}
+
+	var patch repository.Patch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
 		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	updated, err := repository.UpdateBudget(id, authUser.UserID, updates)
+	updated, err := repository.UpdateBudget(id, member.HouseholdID, member.UserID, patch, ifMatch)
 	if err != nil {
-		logAndRespondError(w, http.StatusInternalServerError, "Failed to update budget", err)
+		respondPatchError(w, "Failed to update budget", "budget", err)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(updated.Version))
 	json.NewEncoder(w).Encode(updated)
 }
 
 func DeleteBudget(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	if err := repository.DeleteBudget(id, authUser.UserID); err != nil {
-		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete budget", err)
+	if err := repository.DeleteBudget(id, member.HouseholdID, member.UserID); err != nil {
+		respondPatchError(w, "Failed to delete budget", "budget", err)
 		return
 	}
 
@@ -191,39 +315,66 @@ func DeleteBudget(w http.ResponseWriter, r *http.Request) {
 func DeleteAllBudgets(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	if err := repository.DeleteAllBudgets(authUser.UserID); err != nil {
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+	batch, err := repository.DeleteAllBudgets(member.HouseholdID, member.UserID)
+	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete all budgets", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	json.NewEncoder(w).Encode(batch)
 }
 
+// Route : '/budget/transactions?tag=vacation-2026&tag=tax-deductible&categoryId=...&from=2026-01-01&to=2026-12-31'
+// Type  : 'GET'
 func GetTransactions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	transactions, err := repository.GetTransactions(authUser.UserID)
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := repository.TransactionFilter{
+		CategoryID: query.Get("categoryId"),
+		From:       query.Get("from"),
+		To:         query.Get("to"),
+	}
+	for _, tag := range query["tag"] {
+		filter.Tags = append(filter.Tags, strings.Split(tag, ",")...)
+	}
+
+	transactions, err := repository.FilterTransactions(member.HouseholdID, filter)
 	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch transactions", err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(transactions)
+	writeWithETag(w, r, "", transactions)
 }
 
 func CreateTransactions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	var transactions []repository.Transaction
 	if err := json.NewDecoder(r.Body).Decode(&transactions); err != nil {
 		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	saved, err := repository.SaveTransactions(transactions, authUser.UserID)
+	saved, err := repository.SaveTransactions(transactions, member.HouseholdID, member.UserID)
+	if errors.Is(err, repository.ErrInvalidTransactionDate) {
+		logAndRespondError(w, http.StatusBadRequest, "Failed to save transactions: "+err.Error(), err)
+		return
+	}
 	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to save transactions", err)
 		return
@@ -233,37 +384,71 @@ func CreateTransactions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(saved)
 }
 
+// Route : '/budget/transactions/{id}'
+// Type  : 'GET'
+func GetTransaction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	transaction, err := repository.GetTransaction(mux.Vars(r)["id"], member.HouseholdID)
+	if err != nil {
+		respondPatchError(w, "Failed to fetch transaction", "transaction", err)
+		return
+	}
+
+	writeWithETag(w, r, versionETag(transaction.Version), transaction)
+}
+
+// Route : '/budget/transactions/{id}' (JSON Merge Patch)
+// Type  : 'PUT' or 'PATCH'
 func UpdateTransaction(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var updates map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+	ifMatch, ok := parseIfMatch(r)
+	if !ok {
+		respondPatchError(w, "Failed to update transaction", "transaction", repository.ErrVersionMismatch)
+		return
+	}
+
+	var patch repository.Patch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
 		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
-	updated, err := repository.UpdateTransaction(id, authUser.UserID, updates)
+	updated, err := repository.UpdateTransaction(id, member.HouseholdID, member.UserID, patch, ifMatch)
 	if err != nil {
-		logAndRespondError(w, http.StatusInternalServerError, "Failed to update transaction", err)
+		respondPatchError(w, "Failed to update transaction", "transaction", err)
 		return
 	}
 
+	w.Header().Set("ETag", versionETag(updated.Version))
 	json.NewEncoder(w).Encode(updated)
 }
 
 func DeleteTransaction(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	if err := repository.DeleteTransaction(id, authUser.UserID); err != nil {
-		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete transaction", err)
+	if err := repository.DeleteTransaction(id, member.HouseholdID, member.UserID); err != nil {
+		respondPatchError(w, "Failed to delete transaction", "transaction", err)
 		return
 	}
 
@@ -273,32 +458,49 @@ func DeleteTransaction(w http.ResponseWriter, r *http.Request) {
 func DeleteAllTransactions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	if err := repository.DeleteAllTransactions(authUser.UserID); err != nil {
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+	batch, err := repository.DeleteAllTransactions(member.HouseholdID, member.UserID)
+	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete all transactions", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	json.NewEncoder(w).Encode(batch)
 }
 
 func ClearAllBudgetData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	if err := repository.ClearAllBudgetData(authUser.UserID); err != nil {
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+	batch, err := repository.ClearAllBudgetData(member.HouseholdID, member.UserID)
+	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to clear all data", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	json.NewEncoder(w).Encode(batch)
 }
 
 func ExportBudgetData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
-	data, err := repository.ExportBudgetData(authUser.UserID)
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("attachments") == "true" {
+		exportBudgetArchive(w, member.HouseholdID)
+		return
+	}
+
+	data, err := repository.ExportBudgetData(member.HouseholdID)
 	if err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to export data", err)
 		return
@@ -310,7 +512,10 @@ func ExportBudgetData(w http.ResponseWriter, r *http.Request) {
 func ImportBudgetData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 
-	authUser := middleware.GetAuthUser(r)
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
 	var data map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
@@ -323,10 +528,214 @@ func ImportBudgetData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := repository.ImportBudgetData(string(jsonData), authUser.UserID); err != nil {
+	if err := repository.ImportBudgetData(string(jsonData), member.HouseholdID, member.UserID); err != nil {
 		logAndRespondError(w, http.StatusInternalServerError, "Failed to import data", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func GetBudgetTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	templates, err := repository.GetBudgetTemplates(authUser.UserID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch budget templates", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(templates)
+}
+
+func CreateBudgetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	var template repository.BudgetTemplate
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if template.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "Template name is required"})
+		return
+	}
+
+	saved, err := repository.SaveBudgetTemplate(template, authUser.UserID)
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Failed to save budget template", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
+
+func UpdateBudgetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var updates map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	updated, err := repository.UpdateBudgetTemplate(id, authUser.UserID, updates)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to update budget template", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+func DeleteBudgetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if err := repository.DeleteBudgetTemplate(id, authUser.UserID); err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to delete budget template", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetActiveBudgetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	template, err := repository.GetUserBudgetTemplate(authUser.UserID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch active budget template", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"template": template,
+	})
+}
+
+func SetActiveBudgetTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	var req struct {
+		TemplateID *string `json:"templateId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if err := repository.SetUserBudgetTemplate(authUser.UserID, req.TemplateID); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Failed to set active budget template", err)
+		return
+	}
+
+	GetActiveBudgetTemplate(w, r)
+}
+
+func GenerateBudget(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+	var req struct {
+		Month string `json:"month"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	budget, created, err := repository.CreateBudgetForMonth(member.HouseholdID, member.UserID, req.Month)
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Failed to generate budget", err)
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(budget)
+}
+
+// Route : '/budget/forecast?asOf=2025-10-15&startingBalance=1200'
+// Type  : 'GET'
+func GetForecast(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+	asOf, err := parseAsOfDate(r)
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid asOf date, expected YYYY-MM-DD", err)
+		return
+	}
+
+	var startingBalance *float64
+	if raw := r.URL.Query().Get("startingBalance"); raw != "" {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			logAndRespondError(w, http.StatusBadRequest, "Invalid startingBalance", err)
+			return
+		}
+		startingBalance = &value
+	}
+
+	forecast, err := repository.GetForecast(member.HouseholdID, asOf, startingBalance)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to build forecast", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(forecast)
+}
+
+// Route : '/budget/forecast/backtest?asOf=2025-09-15'
+// Type  : 'GET'
+func BacktestForecast(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+	asOf, err := parseAsOfDate(r)
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid asOf date, expected YYYY-MM-DD", err)
+		return
+	}
+
+	backtest, err := repository.BacktestForecast(member.HouseholdID, asOf)
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Failed to backtest forecast", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(backtest)
+}
+
+func parseAsOfDate(r *http.Request) (time.Time, error) {
+	asOf := r.URL.Query().Get("asOf")
+	if asOf == "" {
+		asOf = helpers.GetCurrentESTDate()
+	}
+	return time.Parse("2006-01-02", asOf)
+}
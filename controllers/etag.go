@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionETag is the strong ETag of a single row, its version number
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch returns the versions a PUT/PATCH is conditional on, nil when
+// there is no If-Match header or it is "*". ok is false when no listed ETag
+// could ever match, which is answered with 412 like any other mismatch.
+func parseIfMatch(r *http.Request) (versions []int, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		// Weak ETags never match under If-Match's strong comparison
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+		value, err := strconv.Atoi(strings.Trim(tag, `"`))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, value)
+	}
+	return versions, len(versions) > 0
+}
+
+// ifNoneMatch reports whether the request's If-None-Match header matches etag
+// using the weak comparison the header calls for
+func ifNoneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeWithETag encodes value with an ETag header, answering 304 with no body
+// when the client's If-None-Match already has it. An empty etag is derived
+// from a hash of the body, used for lists whose content changes on deletes.
+func writeWithETag(w http.ResponseWriter, r *http.Request, etag string, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to encode response", err)
+		return
+	}
+	if etag == "" {
+		sum := sha256.Sum256(body)
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+
+	w.Header().Set("ETag", etag)
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(append(body, '\n'))
+}
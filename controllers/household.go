@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api.alexmontague.ca/helpers"
+	"api.alexmontague.ca/internal/database/repository"
+	"api.alexmontague.ca/middleware"
+	"github.com/gorilla/mux"
+)
+
+// HOUSEHOLD_HEADER selects the household a budget request acts on, the
+// user's default household is used when it is missing
+const HOUSEHOLD_HEADER = "X-Household-ID"
+
+// requireHousehold resolves the household for the request and checks the user
+// holds at least role in it, writing the error response when they do not
+func requireHousehold(w http.ResponseWriter, r *http.Request, role string) (*repository.HouseholdMember, bool) {
+	authUser := middleware.GetAuthUser(r)
+	if authUser == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 401, Message: "Unauthorized"})
+		return nil, false
+	}
+
+	member, err := repository.GetHouseholdMembership(authUser.UserID, r.Header.Get(HOUSEHOLD_HEADER))
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 403, Message: "Not a member of this household"})
+		return nil, false
+	}
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to resolve household", err)
+		return nil, false
+	}
+
+	if !repository.HasRole(member.Role, role) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 403, Message: "This action requires the " + role + " role"})
+		return nil, false
+	}
+
+	return member, true
+}
+
+func GetHouseholds(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	households, err := repository.GetUserHouseholds(authUser.UserID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch households", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(households)
+}
+
+func CreateHousehold(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if req.Name == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "Household name is required"})
+		return
+	}
+
+	household, err := repository.CreateHousehold(req.Name, authUser.UserID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to create household", err)
+		return
+	}
+
+	if err := repository.CreateDefaultCategories(household.ID, authUser.UserID); err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to create default categories", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(household)
+}
+
+func GetHouseholdMembers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := repository.GetHouseholdMembers(member.HouseholdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch household members", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(members)
+}
+
+func UpdateHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid user id", err)
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if !repository.IsValidRole(req.Role) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "Role must be owner, editor or viewer"})
+		return
+	}
+
+	if err := repository.UpdateHouseholdMemberRole(member.HouseholdID, userID, req.Role); err != nil {
+		respondHouseholdError(w, "Failed to update household member", err)
+		return
+	}
+
+	members, err := repository.GetHouseholdMembers(member.HouseholdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch household members", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(members)
+}
+
+// RemoveHouseholdMember removes a member, owners can remove anyone and any member can leave
+func RemoveHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid user id", err)
+		return
+	}
+
+	if userID != member.UserID && !repository.HasRole(member.Role, repository.RoleOwner) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 403, Message: "This action requires the owner role"})
+		return
+	}
+
+	if err := repository.RemoveHouseholdMember(member.HouseholdID, userID); err != nil {
+		respondHouseholdError(w, "Failed to remove household member", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetHouseholdInvitations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	invitations, err := repository.GetHouseholdInvitations(member.HouseholdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch invitations", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func CreateHouseholdInvitation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = repository.RoleEditor
+	}
+	if req.Email == "" || !repository.IsValidRole(req.Role) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "An email and a role of owner, editor or viewer are required"})
+		return
+	}
+
+	invitation, err := repository.CreateHouseholdInvitation(member.HouseholdID, req.Email, req.Role, member.UserID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to create invitation", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invitation)
+}
+
+func RevokeHouseholdInvitation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleOwner)
+	if !ok {
+		return
+	}
+
+	if err := repository.RevokeHouseholdInvitation(member.HouseholdID, mux.Vars(r)["id"]); err != nil {
+		respondHouseholdError(w, "Failed to revoke invitation", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMyInvitations lists the pending invitations sent to the current user's email
+func GetMyInvitations(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	invitations, err := repository.GetInvitationsForEmail(authUser.Email)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch invitations", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func AcceptHouseholdInvitation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	authUser := middleware.GetAuthUser(r)
+	household, err := repository.AcceptHouseholdInvitation(mux.Vars(r)["token"], authUser.UserID, authUser.Email)
+	if err != nil {
+		respondHouseholdError(w, "Failed to accept invitation", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(household)
+}
+
+func respondHouseholdError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, repository.ErrInvitationNotFound):
+		logAndRespondError(w, http.StatusNotFound, message, err)
+	case errors.Is(err, repository.ErrLastOwner):
+		logAndRespondError(w, http.StatusConflict, message+": "+err.Error(), err)
+	default:
+		logAndRespondError(w, http.StatusInternalServerError, message, err)
+	}
+}
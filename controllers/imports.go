@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api.alexmontague.ca/helpers"
+	"api.alexmontague.ca/internal/database/repository"
+	"github.com/gorilla/mux"
+)
+
+// Route : '/budget/imports'
+// Type  : 'POST'
+func CreateImportSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	session, err := repository.CreateImportSession(member.HouseholdID, member.UserID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to create import session", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+// Route : '/budget/imports/{token}'
+// Type  : 'GET'
+func GetImportSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	session, err := repository.GetImportSession(mux.Vars(r)["token"], member.HouseholdID)
+	if err != nil {
+		respondImportError(w, "Failed to fetch import session", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(session)
+}
+
+// StreamImportTransactions reads one transaction per line and writes a
+// progress line after every committed chunk, then a final done or error line.
+// After a dropped connection, GET the session and resend from linesCommitted.
+// Route : '/budget/imports/{token}/transactions?offset=0'
+// Type  : 'POST'
+func StreamImportTransactions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	offset := 0
+	if raw := r.URL.Query().Get("offset"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "offset must be a non-negative integer"})
+			return
+		}
+		offset = value
+	}
+
+	token := mux.Vars(r)["token"]
+	session, err := repository.GetImportSession(token, member.HouseholdID)
+	if err != nil {
+		respondImportError(w, "Failed to fetch import session", err)
+		return
+	}
+	if session.Status != repository.ImportStatusActive {
+		respondImportError(w, "Failed to import transactions", repository.ErrImportCompleted)
+		return
+	}
+	if offset > session.LinesCommitted {
+		respondImportError(w, "Failed to import transactions", repository.ErrImportOffsetGap)
+		return
+	}
+
+	// Once streaming starts the status is sent, failures are reported in the body
+	w.Header().Set("content-type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	session, err = repository.ImportTransactionsStream(token, member.HouseholdID, member.UserID, offset, r.Body, func(progress repository.ImportProgress) {
+		encoder.Encode(map[string]interface{}{"type": "progress", "progress": progress})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		line := map[string]interface{}{"type": "error", "message": err.Error()}
+		if session != nil {
+			line["linesCommitted"] = session.LinesCommitted
+		}
+		encoder.Encode(line)
+		return
+	}
+
+	encoder.Encode(map[string]interface{}{"type": "done", "session": session})
+}
+
+// Route : '/budget/imports/{token}/complete'
+// Type  : 'POST'
+func CompleteImportSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	session, err := repository.CompleteImportSession(mux.Vars(r)["token"], member.HouseholdID)
+	if err != nil {
+		respondImportError(w, "Failed to complete import session", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(session)
+}
+
+func respondImportError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		logAndRespondError(w, http.StatusNotFound, message+": import session not found", err)
+	case errors.Is(err, repository.ErrImportCompleted), errors.Is(err, repository.ErrImportOffsetGap), errors.Is(err, repository.ErrImportConflict):
+		logAndRespondError(w, http.StatusConflict, message+": "+err.Error(), err)
+	default:
+		logAndRespondError(w, http.StatusInternalServerError, message, err)
+	}
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"api.alexmontague.ca/internal/database/repository"
+	"github.com/gorilla/mux"
+)
+
+func GetMerchants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	merchants, err := repository.GetMerchants(member.HouseholdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch merchants", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(merchants)
+}
+
+// Route : '/budget/merchants/{id}'
+// Type  : 'GET'
+func GetMerchantHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	history, err := repository.GetMerchantHistory(mux.Vars(r)["id"], member.HouseholdID)
+	if err != nil {
+		respondMerchantError(w, "Failed to fetch merchant history", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(history)
+}
+
+func UpdateMerchant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var patch repository.Patch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	merchant, err := repository.UpdateMerchant(mux.Vars(r)["id"], member.HouseholdID, member.UserID, patch)
+	if err != nil {
+		respondMerchantError(w, "Failed to update merchant", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(merchant)
+}
+
+// Route : '/budget/merchants/{id}/aliases'
+// Type  : 'POST'
+func AddMerchantAlias(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Alias string `json:"alias"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	merchant, err := repository.AddMerchantAlias(mux.Vars(r)["id"], member.HouseholdID, member.UserID, req.Alias)
+	if err != nil {
+		respondMerchantError(w, "Failed to add merchant alias", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(merchant)
+}
+
+// RelinkMerchants links existing transactions to canonical merchants
+// Route : '/budget/merchants/relink'
+// Type  : 'POST'
+func RelinkMerchants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	changed, err := repository.RelinkMerchants(member.HouseholdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to relink merchants", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"relinked": changed})
+}
+
+func respondMerchantError(w http.ResponseWriter, message string, err error) {
+	var validationErr *repository.ValidationError
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.As(err, &validationErr):
+		respondPatchError(w, message, "merchant", err)
+	case errors.Is(err, repository.ErrInvalidMerchantName):
+		logAndRespondError(w, http.StatusBadRequest, message+": "+err.Error(), err)
+	case errors.Is(err, repository.ErrMerchantAliasTaken):
+		logAndRespondError(w, http.StatusConflict, message+": "+err.Error(), err)
+	default:
+		logAndRespondError(w, http.StatusInternalServerError, message, err)
+	}
+}
@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync/atomic"
 
 	"api.alexmontague.ca/helpers"
@@ -11,6 +15,7 @@ import (
 	"api.alexmontague.ca/internal/nhl/models"
 	"api.alexmontague.ca/internal/nhl/repository"
 	"api.alexmontague.ca/internal/nhl/service"
+	"github.com/gorilla/mux"
 )
 
 // Route : '/nhl/shots?date=2025-02-23
@@ -25,7 +30,7 @@ func GetPlayerShotStats(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Println("[nhl/shots] Fetching upcoming games for date:", date)
 
-	gamesWithPlayers, err := service.GetPlayerShotStats(date)
+	gamesWithPlayers, err := service.GetPlayerShotStats(r.Context(), date)
 	if err != nil {
 		json.NewEncoder(w).Encode(helpers.Response{
 			Error:   true,
@@ -36,7 +41,7 @@ func GetPlayerShotStats(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Printf("Total API requests made: %d\n", atomic.LoadUint64(&repository.RequestCount))
 
-	totalAccuracy, err := dbRepository.GetTotalAccuracy()
+	totalAccuracy, err := dbRepository.GetTotalAccuracy(service.GetActiveModelVersion())
 	if err != nil {
 		json.NewEncoder(w).Encode(helpers.Response{
 			Error:   true,
@@ -67,7 +72,7 @@ func GetPlayerShotRecords(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Println("[nhl/shots/records] Fetching shot records for date:", date)
 
-	predictionRecords, err := dbRepository.GetGamePredictionsForDate(date)
+	predictionRecords, err := dbRepository.GetGamePredictionsForDate(date, service.GetActiveModelVersion())
 	if err != nil {
 		json.NewEncoder(w).Encode(helpers.Response{
 			Error:   true,
@@ -95,7 +100,7 @@ func SeedAndValidatePredictions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Run predictions for all models for this date
-	err := service.RunAndStoreAllModelPredictions(dateParam)
+	err := service.RunAndStoreAllModelPredictions(r.Context(), dateParam)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -112,3 +117,62 @@ func SeedAndValidatePredictions(w http.ResponseWriter, r *http.Request) {
 		"gameDate": dateParam,
 	})
 }
+
+// GetPredictionFeatures explains a stored prediction with the inputs and factors behind it
+// Route : '/nhl/predictions/{id}/features'
+// Type  : 'GET'
+func GetPredictionFeatures(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid prediction id", err)
+		return
+	}
+
+	features, err := dbRepository.GetPredictionFeatures(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		logAndRespondError(w, http.StatusNotFound, "No features recorded for prediction", err)
+		return
+	}
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch prediction features", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(features)
+}
+
+// ImportPropLines stores sportsbook shots on goal lines from an uploaded CSV
+// (Content-Type text/csv) or JSON array, replacing each player's earlier line
+// for the game
+// Route : '/nhl/lines'
+// Type  : 'POST'
+func ImportPropLines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body := http.MaxBytesReader(w, r.Body, service.MAX_PROP_LINE_UPLOAD_SIZE)
+	var source service.PropLineSource = service.JSONPropLines{Reader: body}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		source = service.CSVPropLines{Reader: body}
+	}
+
+	imported, err := service.ImportPropLines(r.Context(), source)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		logAndRespondError(w, http.StatusRequestEntityTooLarge, "Prop line upload is too large", err)
+		return
+	case errors.Is(err, models.ErrInvalidPropLine):
+		logAndRespondError(w, http.StatusBadRequest, "Failed to import prop lines: "+err.Error(), err)
+		return
+	case err != nil:
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to import prop lines", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"imported": imported,
+	})
+}
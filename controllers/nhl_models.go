@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+	"api.alexmontague.ca/internal/nhl/models"
+	"api.alexmontague.ca/internal/nhl/service"
+	"github.com/gorilla/mux"
+)
+
+// respondModelError maps model registry errors to 404 for unknown models,
+// 409 for state conflicts and 400 for invalid input
+func respondModelError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		logAndRespondError(w, http.StatusNotFound, message+": model not found", err)
+	case errors.Is(err, dbRepository.ErrModelRetired), errors.Is(err, dbRepository.ErrModelActive):
+		logAndRespondError(w, http.StatusConflict, message+": "+err.Error(), err)
+	case errors.Is(err, dbRepository.ErrInvalidModelName),
+		errors.Is(err, dbRepository.ErrInvalidModelStrategy),
+		errors.Is(err, dbRepository.ErrInvalidModelParameters):
+		logAndRespondError(w, http.StatusBadRequest, message+": "+err.Error(), err)
+	default:
+		logAndRespondError(w, http.StatusInternalServerError, message, err)
+	}
+}
+
+// modelIDParam reads the {id} route variable, answering 400 when it isn't a number
+func modelIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid model id", err)
+		return 0, false
+	}
+	return id, true
+}
+
+// Route : '/nhl/models?includeRetired=true'
+// Type  : 'GET'
+func GetModelVersions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	service.InitializeModels()
+
+	includeRetired := r.URL.Query().Get("includeRetired") == "true"
+	modelVersions, err := dbRepository.GetModelVersions(includeRetired)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch models", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(modelVersions)
+}
+
+// GetModelStats compares every model's validated predictions, including the
+// ROI of their bets against imported sportsbook lines
+// Route : '/nhl/models/stats'
+// Type  : 'GET'
+func GetModelStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	stats, err := dbRepository.GetModelComparisonStats()
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch model stats", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(stats)
+}
+
+// Route : '/nhl/models/{id}'
+// Type  : 'GET'
+func GetModelVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := modelIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	service.InitializeModels()
+
+	model, err := dbRepository.GetModelVersion(id)
+	if err != nil {
+		respondModelError(w, "Failed to fetch model", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(model)
+}
+
+// Route : '/nhl/models'
+// Type  : 'POST'
+func CreateModelVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		Name                string                     `json:"name"`
+		Description         string                     `json:"description"`
+		CalculationStrategy models.CalculationStrategy `json:"calculationStrategy"`
+		Parameters          *models.ModelParameters    `json:"parameters"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if req.Parameters == nil {
+		logAndRespondError(w, http.StatusBadRequest, "Failed to create model: parameters are required", dbRepository.ErrInvalidModelParameters)
+		return
+	}
+
+	service.InitializeModels()
+
+	model, err := dbRepository.CreateModelVersion(models.ModelVersion{
+		Name:                req.Name,
+		Description:         req.Description,
+		CalculationStrategy: req.CalculationStrategy,
+		Parameters:          *req.Parameters,
+	})
+	if err != nil {
+		respondModelError(w, "Failed to create model", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(model)
+}
+
+// CloneModelVersion copies a model, overriding only the fields and parameters given
+// Route : '/nhl/models/{id}/clone'
+// Type  : 'POST'
+func CloneModelVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := modelIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var clone dbRepository.ModelVersionClone
+	if err := json.NewDecoder(r.Body).Decode(&clone); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	service.InitializeModels()
+
+	model, err := dbRepository.CloneModelVersion(id, clone)
+	if err != nil {
+		respondModelError(w, "Failed to clone model", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(model)
+}
+
+// Route : '/nhl/models/{id}/activate'
+// Type  : 'POST'
+func ActivateModelVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := modelIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	service.InitializeModels()
+
+	model, err := service.ActivateModelVersion(id)
+	if err != nil {
+		respondModelError(w, "Failed to activate model", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(model)
+}
+
+// Route : '/nhl/models/{id}/retire'
+// Type  : 'POST'
+func RetireModelVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := modelIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	service.InitializeModels()
+
+	model, err := dbRepository.RetireModelVersion(id)
+	if err != nil {
+		respondModelError(w, "Failed to retire model", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(model)
+}
+
+// GetModelCalibration maps a model's confidence scores to realized success rates
+// Route : '/nhl/models/{id}/calibration?method=isotonic|platt'
+// Type  : 'GET'
+func GetModelCalibration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := modelIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	method := service.CalibrationMethod(r.URL.Query().Get("method"))
+	if method == "" {
+		method = service.IsotonicCalibration
+	}
+
+	calibration, err := service.CalibrateConfidence(id, method)
+	switch {
+	case errors.Is(err, service.ErrInvalidCalibration):
+		logAndRespondError(w, http.StatusBadRequest, "Failed to calibrate model: "+err.Error(), err)
+		return
+	case errors.Is(err, service.ErrNoCalibrationSamples):
+		logAndRespondError(w, http.StatusNotFound, "Failed to calibrate model: "+err.Error(), err)
+		return
+	case err != nil:
+		respondModelError(w, "Failed to calibrate model", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(calibration)
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"api.alexmontague.ca/helpers"
+	"api.alexmontague.ca/internal/database/repository"
+)
+
+// Route : '/budget/reports/tags?from=2026-01-01&to=2026-12-31'
+// Type  : 'GET'
+func GetTagReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "from and to must be YYYY-MM-DD dates"})
+			return
+		}
+	}
+
+	report, err := repository.GetTagReport(member.HouseholdID, from, to)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to build tag report", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
+
+// Route : '/budget/reports/tax?year=2026&format=csv'
+// Type  : 'GET'
+func GetTaxReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	year, err := strconv.Atoi(r.URL.Query().Get("year"))
+	if err != nil || year < 1900 || year > 9999 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "year is required, e.g. year=2026"})
+		return
+	}
+
+	report, err := repository.GetTaxReport(member.HouseholdID, year)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to build tax report", err)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "csv" {
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := repository.WriteTaxReportCSV(report, &buf); err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to export tax report", err)
+		return
+	}
+
+	w.Header().Set("content-type", "text/csv")
+	w.Header().Set("content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "tax-report-" + strconv.Itoa(year) + ".csv"}))
+	w.Write(buf.Bytes())
+}
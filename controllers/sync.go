@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"api.alexmontague.ca/helpers"
+	"api.alexmontague.ca/internal/database/repository"
+)
+
+const MAX_SYNC_PUSH_CHANGES = 500
+
+// GetSyncChanges returns what changed since the cursor of the previous pull,
+// omit since for a full sync
+// Route : '/budget/sync?since=<cursor>'
+// Type  : 'GET'
+func GetSyncChanges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	changes, err := repository.GetSyncChanges(member.HouseholdID, r.URL.Query().Get("since"))
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		logAndRespondError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if errors.Is(err, repository.ErrCursorExpired) {
+		logAndRespondError(w, http.StatusGone, err.Error(), err)
+		return
+	}
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch changes", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(changes)
+}
+
+// PushSyncChanges applies a batch of offline changes and reports each one as
+// applied, conflict or error. Pull afterwards to pick up the merged state.
+// Route : '/budget/sync'
+// Type  : 'POST'
+func PushSyncChanges(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Changes []repository.SyncChange `json:"changes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	if len(req.Changes) > MAX_SYNC_PUSH_CHANGES {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(helpers.Response{Error: true, Code: 400, Message: "A push can contain at most " + strconv.Itoa(MAX_SYNC_PUSH_CHANGES) + " changes"})
+		return
+	}
+
+	results := repository.ApplySyncChanges(member.HouseholdID, member.UserID, req.Changes)
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
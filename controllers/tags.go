@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"api.alexmontague.ca/internal/database/repository"
+	"github.com/gorilla/mux"
+)
+
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleViewer)
+	if !ok {
+		return
+	}
+
+	tags, err := repository.GetTags(member.HouseholdID)
+	if err != nil {
+		logAndRespondError(w, http.StatusInternalServerError, "Failed to fetch tags", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tags)
+}
+
+func CreateTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var tag repository.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	saved, err := repository.SaveTag(tag, member.HouseholdID, member.UserID)
+	if err != nil {
+		respondTagError(w, "Failed to save tag", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
+
+func UpdateTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var patch repository.Patch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		logAndRespondError(w, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	updated, err := repository.UpdateTag(mux.Vars(r)["id"], member.HouseholdID, member.UserID, patch)
+	if err != nil {
+		respondTagError(w, "Failed to update tag", err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updated)
+}
+
+func DeleteTag(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+
+	member, ok := requireHousehold(w, r, repository.RoleEditor)
+	if !ok {
+		return
+	}
+
+	if err := repository.DeleteTag(mux.Vars(r)["id"], member.HouseholdID, member.UserID); err != nil {
+		respondTagError(w, "Failed to delete tag", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondTagError(w http.ResponseWriter, message string, err error) {
+	var validationErr *repository.ValidationError
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.As(err, &validationErr):
+		respondPatchError(w, message, "tag", err)
+	case errors.Is(err, repository.ErrInvalidTagName), errors.Is(err, repository.ErrInvalidTaxClass):
+		logAndRespondError(w, http.StatusBadRequest, message+": "+err.Error(), err)
+	case errors.Is(err, repository.ErrTagExists):
+		logAndRespondError(w, http.StatusConflict, message+": "+err.Error(), err)
+	default:
+		logAndRespondError(w, http.StatusInternalServerError, message, err)
+	}
+}
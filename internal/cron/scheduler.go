@@ -1,6 +1,7 @@
 package cron
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -47,6 +48,49 @@ func StartScheduler() {
 		}
 	})
 
+	// Monthly job to create every user's budget for the new month - runs at 12:05 AM EST on the 1st.
+	// It's scheduled on Eastern time, the zone it picks the month in, so it can't run on the last
+	// evening of the previous month.
+	_, err := scheduler.AddFunc("CRON_TZ=America/New_York 0 5 0 1 * *", func() {
+		log.Println("Running monthly budget job")
+		if err := CreateMonthlyBudgets(nil); err != nil {
+			log.Printf("Error in monthly budget job: %v", err)
+			// Retry after 30 minutes if failed
+			time.AfterFunc(30*time.Minute, func() {
+				log.Println("Retrying monthly budget job")
+				if err := CreateMonthlyBudgets(nil); err != nil {
+					log.Printf("Retry failed: %v", err)
+				}
+			})
+		}
+	})
+	if err != nil {
+		log.Printf("Error scheduling monthly budget job: %v", err)
+	}
+
+	// Daily job to purge budget trash past its retention period - runs at 3:30 AM
+	scheduler.AddFunc("0 30 3 * * *", func() {
+		log.Println("Running trash purge job")
+		if err := PurgeExpiredTrash(); err != nil {
+			log.Printf("Error in trash purge job: %v", err)
+			// Retry after 30 minutes if failed
+			time.AfterFunc(30*time.Minute, func() {
+				log.Println("Retrying trash purge job")
+				if err := PurgeExpiredTrash(); err != nil {
+					log.Printf("Retry failed: %v", err)
+				}
+			})
+		}
+	})
+
+	// Daily job to drop expired NHL API responses from the cache - runs at 3:45 AM
+	scheduler.AddFunc("0 45 3 * * *", func() {
+		log.Println("Running NHL response cache purge job")
+		if err := PurgeNHLResponseCache(); err != nil {
+			log.Printf("Error in NHL response cache purge job: %v", err)
+		}
+	})
+
 	scheduler.Start()
 	log.Println("Scheduler started")
 }
@@ -70,8 +114,8 @@ func FetchDailyPredictions(date *string) error {
 		today = *date
 	}
 
-	// Run all models and store predictions in both tables
-	err := service.RunAndStoreAllModelPredictions(today)
+	// Run all models and store their predictions
+	err := service.RunAndStoreAllModelPredictions(context.Background(), today)
 	if err != nil {
 		return fmt.Errorf("failed to run and store model predictions: %w", err)
 	}
@@ -80,7 +124,7 @@ func FetchDailyPredictions(date *string) error {
 	return nil
 }
 
-// ValidateCompletedGames validates predictions for completed games in both tables
+// ValidateCompletedGames validates every model's predictions for completed games
 func ValidateCompletedGames(date *string) error {
 	est, _ := time.LoadLocation("America/New_York")
 	var today string
@@ -90,23 +134,35 @@ func ValidateCompletedGames(date *string) error {
 		today = *date
 	}
 
-	// Get predictions from original table
-	predictionRecords, err := repository.GetGamePredictionsForDate(today)
-	log.Printf("Found %d predictions in original table for date %s", len(predictionRecords), today)
+	predictionsByModel, err := repository.GetModelPredictionsForDate(today)
 	if err != nil {
 		return fmt.Errorf("failed to get pending games: %w", err)
 	}
 
-	// Get actual shots for games
+	// Collect the unique games and game/player pairs predicted across all models
+	type gamePlayer struct {
+		gameID   int
+		playerID int
+	}
 	gameIDs := make([]int, 0)
 	gameIDMap := make(map[int]bool)
-
-	for _, prediction := range predictionRecords {
-		if !gameIDMap[prediction.GameID] {
-			gameIDs = append(gameIDs, prediction.GameID)
-			gameIDMap[prediction.GameID] = true
+	var pairs []gamePlayer
+	pairMap := make(map[gamePlayer]bool)
+
+	for _, predictionRecords := range predictionsByModel {
+		for _, prediction := range predictionRecords {
+			if !gameIDMap[prediction.GameID] {
+				gameIDs = append(gameIDs, prediction.GameID)
+				gameIDMap[prediction.GameID] = true
+			}
+			pair := gamePlayer{prediction.GameID, prediction.PlayerID}
+			if !pairMap[pair] {
+				pairs = append(pairs, pair)
+				pairMap[pair] = true
+			}
 		}
 	}
+	log.Printf("Found %d predicted players across %d models for date %s", len(pairs), len(predictionsByModel), today)
 
 	if len(gameIDs) == 0 {
 		log.Printf("No games to validate for date %s", today)
@@ -114,29 +170,21 @@ func ValidateCompletedGames(date *string) error {
 	}
 
 	// Fetch actual shots
-	actualShots, err := nhlRepo.FetchActualGameShots(gameIDs)
+	actualShots, err := nhlRepo.FetchActualGameShots(context.Background(), gameIDs)
 	if err != nil {
 		log.Printf("Error fetching results for games %v: %v", gameIDs, err)
 		return fmt.Errorf("failed to fetch actual shots: %w", err)
 	}
 
-	// Update original table
-	for _, prediction := range predictionRecords {
+	for _, pair := range pairs {
 		// Skip if no actual shots data available for this player
-		if _, exists := actualShots[prediction.PlayerID]; !exists {
+		shots, exists := actualShots[pair.playerID]
+		if !exists {
 			continue
 		}
 
-		if err := repository.StoreActualShots(prediction, actualShots[prediction.PlayerID]); err != nil {
-			log.Printf("Error storing results for game %d, player %d in original table: %v",
-				prediction.GameID, prediction.PlayerID, err)
-			continue
-		}
-
-		// Also update in model_predictions table
-		if err := repository.UpdateModelPredictionsWithActual(prediction.GameID, prediction.PlayerID, actualShots[prediction.PlayerID]); err != nil {
-			log.Printf("Error storing results for game %d, player %d in model_predictions table: %v",
-				prediction.GameID, prediction.PlayerID, err)
+		if err := repository.UpdateModelPredictionsWithActual(pair.gameID, pair.playerID, shots); err != nil {
+			log.Printf("Error storing results for game %d, player %d: %v", pair.gameID, pair.playerID, err)
 			continue
 		}
 	}
@@ -144,3 +192,58 @@ func ValidateCompletedGames(date *string) error {
 	log.Printf("Validated predictions for %d games", len(gameIDs))
 	return nil
 }
+
+// CreateMonthlyBudgets creates each user's budget for the given month (YYYY-MM) from their selected template
+func CreateMonthlyBudgets(month *string) error {
+	est, _ := time.LoadLocation("America/New_York")
+	var currentMonth string
+	if month == nil {
+		currentMonth = time.Now().In(est).Format("2006-01")
+	} else {
+		currentMonth = *month
+	}
+
+	created, err := repository.CreateMonthlyBudgets(currentMonth)
+	log.Printf("Created %d budgets for month %s", created, currentMonth)
+	if err != nil {
+		return fmt.Errorf("failed to create monthly budgets: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredTrash permanently deletes trashed budget data older than the retention period
+// along with the attachments of transactions that no longer exist
+func PurgeExpiredTrash() error {
+	purged, err := repository.PurgeExpiredTrash()
+	if err != nil {
+		return fmt.Errorf("failed to purge expired trash: %w", err)
+	}
+
+	log.Printf("Purged %d trash batches", purged)
+
+	orphaned, err := repository.PurgeOrphanedAttachments()
+	if err != nil {
+		return fmt.Errorf("failed to purge orphaned attachments: %w", err)
+	}
+
+	log.Printf("Purged %d orphaned attachments", orphaned)
+
+	compacted, err := repository.PurgeChangeLog()
+	if err != nil {
+		return fmt.Errorf("failed to purge change log: %w", err)
+	}
+
+	log.Printf("Purged %d change log entries", compacted)
+	return nil
+}
+
+// PurgeNHLResponseCache deletes NHL API responses past their TTL
+func PurgeNHLResponseCache() error {
+	purged, err := repository.PurgeExpiredNHLResponses()
+	if err != nil {
+		return fmt.Errorf("failed to purge NHL response cache: %w", err)
+	}
+
+	log.Printf("Purged %d cached NHL responses", purged)
+	return nil
+}
@@ -0,0 +1,26 @@
+-- Migration: add_budget_templates
+-- Created at: 2025-10-11T00:00:00Z
+
+CREATE TABLE IF NOT EXISTS budget_templates (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	mode TEXT NOT NULL DEFAULT 'category_defaults',
+	allocations TEXT NOT NULL DEFAULT '{}',
+	average_months INTEGER NOT NULL DEFAULT 3,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_budget_templates_user_id ON budget_templates(user_id);
+
+-- The template used when a new month's budget is created for the user.
+-- NULL keeps the original behaviour of using each category's monthly_budget.
+ALTER TABLE users ADD COLUMN budget_template_id TEXT REFERENCES budget_templates(id) ON DELETE SET NULL;
+
+-- DOWN
+
+ALTER TABLE users DROP COLUMN budget_template_id;
+
+DROP INDEX IF EXISTS idx_budget_templates_user_id;
+DROP TABLE IF EXISTS budget_templates;
@@ -0,0 +1,78 @@
+-- Migration: add_households
+-- Created at: 2025-10-12T00:00:00Z
+
+CREATE TABLE IF NOT EXISTS households (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS household_members (
+	household_id TEXT NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (household_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_household_members_user_id ON household_members(user_id);
+
+CREATE TABLE IF NOT EXISTS household_invitations (
+	id TEXT PRIMARY KEY,
+	household_id TEXT NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL,
+	token TEXT NOT NULL UNIQUE,
+	invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	accepted_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_household_invitations_household_id ON household_invitations(household_id);
+CREATE INDEX IF NOT EXISTS idx_household_invitations_email ON household_invitations(email);
+
+ALTER TABLE categories ADD COLUMN household_id TEXT REFERENCES households(id) ON DELETE CASCADE;
+ALTER TABLE budgets ADD COLUMN household_id TEXT REFERENCES households(id) ON DELETE CASCADE;
+ALTER TABLE transactions ADD COLUMN household_id TEXT REFERENCES households(id) ON DELETE CASCADE;
+ALTER TABLE transactions ADD COLUMN created_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE transactions ADD COLUMN updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_categories_household_id ON categories(household_id);
+CREATE INDEX IF NOT EXISTS idx_budgets_household_id ON budgets(household_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_household_id ON transactions(household_id);
+
+-- Every existing user becomes the owner of a personal household holding their data
+INSERT INTO households (id, name, created_at, updated_at)
+SELECT 'household-' || id, email, created_at, updated_at FROM users;
+
+INSERT INTO household_members (household_id, user_id, role, created_at, updated_at)
+SELECT 'household-' || id, id, 'owner', created_at, updated_at FROM users;
+
+UPDATE categories SET household_id = 'household-' || user_id WHERE user_id IS NOT NULL;
+UPDATE budgets SET household_id = 'household-' || user_id WHERE user_id IS NOT NULL;
+UPDATE transactions
+SET household_id = 'household-' || user_id, created_by = user_id, updated_by = user_id
+WHERE user_id IS NOT NULL;
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_transactions_household_id;
+DROP INDEX IF EXISTS idx_budgets_household_id;
+DROP INDEX IF EXISTS idx_categories_household_id;
+
+ALTER TABLE transactions DROP COLUMN updated_by;
+ALTER TABLE transactions DROP COLUMN created_by;
+ALTER TABLE transactions DROP COLUMN household_id;
+ALTER TABLE budgets DROP COLUMN household_id;
+ALTER TABLE categories DROP COLUMN household_id;
+
+DROP INDEX IF EXISTS idx_household_invitations_email;
+DROP INDEX IF EXISTS idx_household_invitations_household_id;
+DROP TABLE IF EXISTS household_invitations;
+
+DROP INDEX IF EXISTS idx_household_members_user_id;
+DROP TABLE IF EXISTS household_members;
+DROP TABLE IF EXISTS households;
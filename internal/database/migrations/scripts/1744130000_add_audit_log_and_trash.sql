@@ -0,0 +1,54 @@
+-- Migration: add_audit_log_and_trash
+-- Created at: 2025-10-13T00:00:00Z
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	household_id TEXT NOT NULL,
+	user_id INTEGER,
+	entity_type TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	before_snapshot TEXT,
+	after_snapshot TEXT,
+	undone_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_household_id ON audit_log(household_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id);
+
+-- Bulk deletes move their rows here so they can be restored until expires_at
+CREATE TABLE IF NOT EXISTS trash_batches (
+	id TEXT PRIMARY KEY,
+	household_id TEXT NOT NULL,
+	user_id INTEGER,
+	operation TEXT NOT NULL,
+	item_count INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	restored_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_trash_batches_household_id ON trash_batches(household_id);
+CREATE INDEX IF NOT EXISTS idx_trash_batches_expires_at ON trash_batches(expires_at);
+
+CREATE TABLE IF NOT EXISTS trash_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	batch_id TEXT NOT NULL REFERENCES trash_batches(id) ON DELETE CASCADE,
+	entity_type TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	snapshot TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_trash_items_batch_id ON trash_items(batch_id);
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_trash_items_batch_id;
+DROP TABLE IF EXISTS trash_items;
+DROP INDEX IF EXISTS idx_trash_batches_expires_at;
+DROP INDEX IF EXISTS idx_trash_batches_household_id;
+DROP TABLE IF EXISTS trash_batches;
+DROP INDEX IF EXISTS idx_audit_log_entity;
+DROP INDEX IF EXISTS idx_audit_log_household_id;
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,26 @@
+-- Migration: add_transaction_attachments
+-- Created at: 2025-10-14T00:00:00Z
+
+-- Files are stored on disk by content hash, several rows may share one file
+CREATE TABLE IF NOT EXISTS attachments (
+	id TEXT PRIMARY KEY,
+	transaction_id TEXT NOT NULL,
+	household_id TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	content_hash TEXT NOT NULL,
+	uploaded_by INTEGER,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_transaction_id ON attachments(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_household_id ON attachments(household_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_content_hash ON attachments(content_hash);
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_attachments_content_hash;
+DROP INDEX IF EXISTS idx_attachments_household_id;
+DROP INDEX IF EXISTS idx_attachments_transaction_id;
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,29 @@
+-- Migration: add_transaction_tags_and_notes
+-- Created at: 2025-10-15T00:00:00Z
+
+ALTER TABLE transactions ADD COLUMN notes TEXT;
+
+CREATE TABLE IF NOT EXISTS tags (
+	id TEXT PRIMARY KEY,
+	household_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	color TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (household_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS transaction_tags (
+	transaction_id TEXT NOT NULL,
+	tag_id TEXT NOT NULL,
+	PRIMARY KEY (transaction_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_tags_tag_id ON transaction_tags(tag_id);
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_transaction_tags_tag_id;
+DROP TABLE IF EXISTS transaction_tags;
+DROP TABLE IF EXISTS tags;
+ALTER TABLE transactions DROP COLUMN notes;
@@ -0,0 +1,11 @@
+-- Migration: add_tax_classes
+-- Created at: 2025-10-16T00:00:00Z
+
+-- Tax class (medical, charitable, home_office) marking a category or tag as deductible
+ALTER TABLE categories ADD COLUMN tax_class TEXT;
+ALTER TABLE tags ADD COLUMN tax_class TEXT;
+
+-- DOWN
+
+ALTER TABLE tags DROP COLUMN tax_class;
+ALTER TABLE categories DROP COLUMN tax_class;
@@ -0,0 +1,39 @@
+-- Migration: add_merchants
+-- Created at: 2025-10-17T00:00:00Z
+
+-- Canonical merchants, raw transaction merchants are cleaned and matched
+-- against merchant_aliases. Existing transactions are linked by
+-- POST /budget/merchants/relink.
+CREATE TABLE IF NOT EXISTS merchants (
+	id TEXT PRIMARY KEY,
+	household_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	category_id TEXT,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_merchants_household_id ON merchants(household_id);
+
+CREATE TABLE IF NOT EXISTS merchant_aliases (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	merchant_id TEXT NOT NULL,
+	household_id TEXT NOT NULL,
+	alias TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (household_id, alias)
+);
+
+CREATE INDEX IF NOT EXISTS idx_merchant_aliases_merchant_id ON merchant_aliases(merchant_id);
+
+ALTER TABLE transactions ADD COLUMN merchant_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_transactions_merchant_id ON transactions(merchant_id);
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_transactions_merchant_id;
+ALTER TABLE transactions DROP COLUMN merchant_id;
+DROP INDEX IF EXISTS idx_merchant_aliases_merchant_id;
+DROP TABLE IF EXISTS merchant_aliases;
+DROP INDEX IF EXISTS idx_merchants_household_id;
+DROP TABLE IF EXISTS merchants;
@@ -0,0 +1,24 @@
+-- Migration: add_import_sessions
+-- Created at: 2025-10-18T00:00:00Z
+
+-- Resumable NDJSON imports, lines_committed is the number of body lines
+-- already saved so a client reconnecting can skip them.
+CREATE TABLE IF NOT EXISTS import_sessions (
+	token TEXT PRIMARY KEY,
+	household_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'active',
+	lines_committed INTEGER NOT NULL DEFAULT 0,
+	rows_inserted INTEGER NOT NULL DEFAULT 0,
+	rows_skipped INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_import_sessions_household_id ON import_sessions(household_id);
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_import_sessions_household_id;
+DROP TABLE IF EXISTS import_sessions;
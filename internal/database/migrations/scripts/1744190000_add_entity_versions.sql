@@ -0,0 +1,14 @@
+-- Migration: add_entity_versions
+-- Created at: 2025-10-18T00:00:00Z
+
+-- Row versions for optimistic concurrency, bumped on every update and
+-- served as the resource's ETag.
+ALTER TABLE categories ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE budgets ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE transactions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- DOWN
+
+ALTER TABLE transactions DROP COLUMN version;
+ALTER TABLE budgets DROP COLUMN version;
+ALTER TABLE categories DROP COLUMN version;
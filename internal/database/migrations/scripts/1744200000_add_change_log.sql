@@ -0,0 +1,101 @@
+-- Migration: add_change_log
+-- Created at: 2025-10-19T00:00:00Z
+
+-- Every write to categories, budgets and transactions appends a row here,
+-- seq is the cursor handed to syncing clients. Triggers catch the bulk paths
+-- (trash, restore, relinking) that don't go through a single update function.
+CREATE TABLE IF NOT EXISTS change_log (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	household_id TEXT NOT NULL,
+	entity_type TEXT NOT NULL,
+	entity_id TEXT NOT NULL,
+	operation TEXT NOT NULL,
+	changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_change_log_household_seq ON change_log(household_id, seq);
+
+CREATE TRIGGER IF NOT EXISTS change_log_categories_insert AFTER INSERT ON categories
+WHEN NEW.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (NEW.household_id, 'category', NEW.id, 'upsert');
+END;
+
+CREATE TRIGGER IF NOT EXISTS change_log_categories_update AFTER UPDATE ON categories
+WHEN NEW.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (NEW.household_id, 'category', NEW.id, 'upsert');
+END;
+
+CREATE TRIGGER IF NOT EXISTS change_log_categories_delete AFTER DELETE ON categories
+WHEN OLD.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (OLD.household_id, 'category', OLD.id, 'delete');
+END;
+
+CREATE TRIGGER IF NOT EXISTS change_log_budgets_insert AFTER INSERT ON budgets
+WHEN NEW.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (NEW.household_id, 'budget', NEW.id, 'upsert');
+END;
+
+CREATE TRIGGER IF NOT EXISTS change_log_budgets_update AFTER UPDATE ON budgets
+WHEN NEW.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (NEW.household_id, 'budget', NEW.id, 'upsert');
+END;
+
+CREATE TRIGGER IF NOT EXISTS change_log_budgets_delete AFTER DELETE ON budgets
+WHEN OLD.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (OLD.household_id, 'budget', OLD.id, 'delete');
+END;
+
+CREATE TRIGGER IF NOT EXISTS change_log_transactions_insert AFTER INSERT ON transactions
+WHEN NEW.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (NEW.household_id, 'transaction', NEW.id, 'upsert');
+END;
+
+CREATE TRIGGER IF NOT EXISTS change_log_transactions_update AFTER UPDATE ON transactions
+WHEN NEW.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (NEW.household_id, 'transaction', NEW.id, 'upsert');
+END;
+
+CREATE TRIGGER IF NOT EXISTS change_log_transactions_delete AFTER DELETE ON transactions
+WHEN OLD.household_id IS NOT NULL
+BEGIN
+	INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+	VALUES (OLD.household_id, 'transaction', OLD.id, 'delete');
+END;
+
+-- Existing rows are the starting state for a first sync
+INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+SELECT household_id, 'category', id, 'upsert' FROM categories WHERE household_id IS NOT NULL;
+INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+SELECT household_id, 'budget', id, 'upsert' FROM budgets WHERE household_id IS NOT NULL;
+INSERT INTO change_log (household_id, entity_type, entity_id, operation)
+SELECT household_id, 'transaction', id, 'upsert' FROM transactions WHERE household_id IS NOT NULL;
+
+-- DOWN
+
+DROP TRIGGER IF EXISTS change_log_transactions_delete;
+DROP TRIGGER IF EXISTS change_log_transactions_update;
+DROP TRIGGER IF EXISTS change_log_transactions_insert;
+DROP TRIGGER IF EXISTS change_log_budgets_delete;
+DROP TRIGGER IF EXISTS change_log_budgets_update;
+DROP TRIGGER IF EXISTS change_log_budgets_insert;
+DROP TRIGGER IF EXISTS change_log_categories_delete;
+DROP TRIGGER IF EXISTS change_log_categories_update;
+DROP TRIGGER IF EXISTS change_log_categories_insert;
+DROP INDEX IF EXISTS idx_change_log_household_seq;
+DROP TABLE IF EXISTS change_log;
@@ -0,0 +1,55 @@
+-- Migration: backfill_model_predictions
+-- Created at: 2025-10-20T00:00:00Z
+
+-- model_predictions is now the single source of truth for NHL predictions.
+-- Copy legacy game_predictions rows that have no model_predictions counterpart.
+INSERT OR IGNORE INTO model_predictions (
+    game_date, game_id, game_title,
+    away_team_abbrev, away_team_id, home_team_abbrev, home_team_id,
+    player_id, player_name, player_team_abbrev, player_team_id,
+    model_version_id, predicted_shots, confidence, actual_shots, successful,
+    created_at, validated_at
+)
+SELECT
+    game_date, game_id, game_title,
+    away_team_abbrev, away_team_id, home_team_abbrev, home_team_id,
+    player_id, player_name, player_team_abbrev, player_team_id,
+    model_version_id, predicted_shots, confidence, actual_shots, successful,
+    COALESCE(created_at, CURRENT_TIMESTAMP), validated_at
+FROM game_predictions;
+
+-- Carry over validation results the legacy table recorded but model_predictions missed
+UPDATE model_predictions
+SET actual_shots = (
+        SELECT gp.actual_shots FROM game_predictions gp
+        WHERE gp.game_id = model_predictions.game_id
+          AND gp.player_id = model_predictions.player_id
+          AND gp.model_version_id = model_predictions.model_version_id
+    ),
+    successful = (
+        SELECT gp.successful FROM game_predictions gp
+        WHERE gp.game_id = model_predictions.game_id
+          AND gp.player_id = model_predictions.player_id
+          AND gp.model_version_id = model_predictions.model_version_id
+    ),
+    validated_at = (
+        SELECT gp.validated_at FROM game_predictions gp
+        WHERE gp.game_id = model_predictions.game_id
+          AND gp.player_id = model_predictions.player_id
+          AND gp.model_version_id = model_predictions.model_version_id
+    )
+WHERE actual_shots IS NULL
+  AND EXISTS (
+        SELECT 1 FROM game_predictions gp
+        WHERE gp.game_id = model_predictions.game_id
+          AND gp.player_id = model_predictions.player_id
+          AND gp.model_version_id = model_predictions.model_version_id
+          AND gp.actual_shots IS NOT NULL
+    );
+
+-- game_predictions is kept for reference but is no longer written or read
+
+-- DOWN
+
+-- Backfilled rows can't be told apart from rows written by the models,
+-- so this is a no-op to avoid losing prediction history
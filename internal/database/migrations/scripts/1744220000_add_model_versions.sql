@@ -0,0 +1,26 @@
+-- Migration: add_model_versions
+-- Created at: 2025-10-21T00:00:00Z
+
+-- Registry of NHL prediction models. The defaults from models.GetDefaultModels
+-- are seeded on startup; parameters holds models.ModelParameters as JSON.
+CREATE TABLE model_versions
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    calculation_strategy TEXT NOT NULL,
+    parameters TEXT NOT NULL,
+    active INTEGER NOT NULL DEFAULT 0,
+    parent_id INTEGER REFERENCES model_versions(id),
+    retired_at TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+-- At most one model can be active at a time
+CREATE UNIQUE INDEX idx_model_versions_active ON model_versions(active) WHERE active = 1;
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_model_versions_active;
+DROP TABLE IF EXISTS model_versions;
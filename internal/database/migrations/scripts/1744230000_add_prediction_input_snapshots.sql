@@ -0,0 +1,15 @@
+-- Migration: add_prediction_input_snapshots
+-- Created at: 2025-10-22T00:00:00Z
+
+-- Model inputs (games, player details, team stats, rest days) as they were
+-- when predictions ran for a date, stored as models.PredictionInputs JSON
+CREATE TABLE prediction_input_snapshots
+(
+    game_date TEXT PRIMARY KEY,
+    inputs TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+-- DOWN
+
+DROP TABLE IF EXISTS prediction_input_snapshots;
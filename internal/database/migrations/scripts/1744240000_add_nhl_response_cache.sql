@@ -0,0 +1,18 @@
+-- Migration: add_nhl_response_cache
+-- Created at: 2025-10-23T00:00:00Z
+
+-- Successful NHL API responses keyed by URL, shared across requests and models
+CREATE TABLE nhl_response_cache
+(
+    url TEXT PRIMARY KEY,
+    body BLOB NOT NULL,
+    fetched_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_nhl_response_cache_expires_at ON nhl_response_cache(expires_at);
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_nhl_response_cache_expires_at;
+DROP TABLE IF EXISTS nhl_response_cache;
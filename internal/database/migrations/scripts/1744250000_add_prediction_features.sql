@@ -0,0 +1,49 @@
+-- Migration: add_prediction_features
+-- Created at: 2025-10-24T00:00:00Z
+
+-- The inputs and intermediate factors behind each model prediction, so a
+-- prediction can be explained and the rows used to refit model parameters.
+-- Factors that a strategy doesn't use are stored as 1.
+CREATE TABLE prediction_features
+(
+    prediction_id INTEGER PRIMARY KEY REFERENCES model_predictions(id) ON DELETE CASCADE,
+    model_version_id INTEGER NOT NULL,
+    calculation_strategy TEXT NOT NULL,
+
+    -- Inputs
+    position TEXT NOT NULL,
+    shots_last5 TEXT NOT NULL,
+    avg_shots_last5 REAL NOT NULL,
+    season_shots_per_game REAL NOT NULL,
+    season_games_played INTEGER NOT NULL,
+    avg_toi REAL NOT NULL,
+    rest_days INTEGER,
+    team_shots_for_per_game REAL,
+    opponent_shots_against_per_game REAL,
+    opponent_shots_for_per_game REAL,
+    league_shot_average REAL,
+
+    -- Intermediate factors
+    weighted_recent_shots REAL,
+    toi_base_prediction REAL,
+    base_prediction REAL NOT NULL,
+    game_pace_factor REAL NOT NULL,
+    team_offense_factor REAL NOT NULL,
+    team_defense_factor REAL NOT NULL,
+    position_factor REAL NOT NULL,
+    icetime_factor REAL NOT NULL,
+    rest_factor REAL NOT NULL,
+    home_ice_factor REAL NOT NULL,
+    streak_factor REAL NOT NULL,
+    unrounded_prediction REAL NOT NULL,
+    predicted_shots REAL NOT NULL,
+    fallback TEXT NOT NULL DEFAULT '',
+
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_prediction_features_model_version_id ON prediction_features(model_version_id);
+
+-- DOWN
+
+DROP TABLE IF EXISTS prediction_features;
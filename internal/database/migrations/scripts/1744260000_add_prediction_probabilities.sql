@@ -0,0 +1,24 @@
+-- Migration: add_prediction_probabilities
+-- Created at: 2025-10-25T00:00:00Z
+
+-- Each prediction's shot distribution and the half shot line it is graded on.
+-- Predictions made before this have no line and keep the old successful rule.
+ALTER TABLE model_predictions ADD COLUMN distribution TEXT;
+ALTER TABLE model_predictions ADD COLUMN dispersion REAL;
+ALTER TABLE model_predictions ADD COLUMN shot_probabilities TEXT;
+ALTER TABLE model_predictions ADD COLUMN line REAL;
+ALTER TABLE model_predictions ADD COLUMN over_probability REAL;
+
+-- Proper scores of over_probability, recorded at validation
+ALTER TABLE model_predictions ADD COLUMN log_loss REAL;
+ALTER TABLE model_predictions ADD COLUMN brier REAL;
+
+-- DOWN
+
+ALTER TABLE model_predictions DROP COLUMN brier;
+ALTER TABLE model_predictions DROP COLUMN log_loss;
+ALTER TABLE model_predictions DROP COLUMN over_probability;
+ALTER TABLE model_predictions DROP COLUMN line;
+ALTER TABLE model_predictions DROP COLUMN shot_probabilities;
+ALTER TABLE model_predictions DROP COLUMN dispersion;
+ALTER TABLE model_predictions DROP COLUMN distribution;
@@ -0,0 +1,24 @@
+-- Migration: add_prediction_matchup_features
+-- Created at: 2025-10-26T00:00:00Z
+
+-- The opposing starting goalie and team form behind each prediction. They are
+-- NULL when they couldn't be fetched, and for predictions made before they were.
+ALTER TABLE prediction_features ADD COLUMN opponent_goalie_id INTEGER;
+ALTER TABLE prediction_features ADD COLUMN opponent_goalie_confirmed INTEGER;
+ALTER TABLE prediction_features ADD COLUMN opponent_goalie_games_played INTEGER;
+ALTER TABLE prediction_features ADD COLUMN opponent_goalie_save_pct REAL;
+ALTER TABLE prediction_features ADD COLUMN league_save_pct REAL;
+ALTER TABLE prediction_features ADD COLUMN team_form_games INTEGER;
+ALTER TABLE prediction_features ADD COLUMN team_form_point_pct REAL;
+ALTER TABLE prediction_features ADD COLUMN goalie_factor REAL NOT NULL DEFAULT 1;
+
+-- DOWN
+
+ALTER TABLE prediction_features DROP COLUMN opponent_goalie_id;
+ALTER TABLE prediction_features DROP COLUMN opponent_goalie_confirmed;
+ALTER TABLE prediction_features DROP COLUMN opponent_goalie_games_played;
+ALTER TABLE prediction_features DROP COLUMN opponent_goalie_save_pct;
+ALTER TABLE prediction_features DROP COLUMN league_save_pct;
+ALTER TABLE prediction_features DROP COLUMN team_form_games;
+ALTER TABLE prediction_features DROP COLUMN team_form_point_pct;
+ALTER TABLE prediction_features DROP COLUMN goalie_factor;
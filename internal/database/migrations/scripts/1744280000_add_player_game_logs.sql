@@ -0,0 +1,28 @@
+-- Migration: add_player_game_logs
+-- Created at: 2025-10-27T00:00:00Z
+
+-- Each player's regular season games, kept so rolling features can be built
+-- from stored history when the NHL API can't be reached. Power play TOI is
+-- NULL when the stats API didn't have it.
+CREATE TABLE player_game_logs
+(
+    player_id INTEGER NOT NULL,
+    season TEXT NOT NULL,
+    game_id INTEGER NOT NULL,
+    game_date TEXT NOT NULL,
+    team_abbrev TEXT NOT NULL,
+    opponent_abbrev TEXT NOT NULL,
+    home_road_flag TEXT NOT NULL,
+    shots INTEGER NOT NULL,
+    toi TEXT NOT NULL,
+    power_play_toi TEXT,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (player_id, game_id)
+);
+
+CREATE INDEX idx_player_game_logs_player_season ON player_game_logs(player_id, season, game_date);
+
+-- DOWN
+
+DROP INDEX IF EXISTS idx_player_game_logs_player_season;
+DROP TABLE IF EXISTS player_game_logs;
@@ -0,0 +1,24 @@
+-- Migration: add_prediction_rolling_features
+-- Created at: 2025-10-27T00:00:00Z
+
+-- The season game log windows behind each prediction. They are NULL when the
+-- log couldn't be fetched, and for predictions made before they were.
+ALTER TABLE prediction_features ADD COLUMN game_log_games INTEGER;
+ALTER TABLE prediction_features ADD COLUMN shots_last10 REAL;
+ALTER TABLE prediction_features ADD COLUMN shots_last20 REAL;
+ALTER TABLE prediction_features ADD COLUMN shots_ewma REAL;
+ALTER TABLE prediction_features ADD COLUMN venue_shots_per_game REAL;
+ALTER TABLE prediction_features ADD COLUMN toi_last10 REAL;
+ALTER TABLE prediction_features ADD COLUMN power_play_toi_last10 REAL;
+ALTER TABLE prediction_features ADD COLUMN venue_factor REAL NOT NULL DEFAULT 1;
+
+-- DOWN
+
+ALTER TABLE prediction_features DROP COLUMN game_log_games;
+ALTER TABLE prediction_features DROP COLUMN shots_last10;
+ALTER TABLE prediction_features DROP COLUMN shots_last20;
+ALTER TABLE prediction_features DROP COLUMN shots_ewma;
+ALTER TABLE prediction_features DROP COLUMN venue_shots_per_game;
+ALTER TABLE prediction_features DROP COLUMN toi_last10;
+ALTER TABLE prediction_features DROP COLUMN power_play_toi_last10;
+ALTER TABLE prediction_features DROP COLUMN venue_factor;
@@ -0,0 +1,34 @@
+-- Migration: add_prop_lines
+-- Created at: 2025-10-28T00:00:00Z
+
+-- Sportsbook shots on goal lines with American odds, one per player per game.
+-- A new import of a player's line replaces the old one.
+CREATE TABLE prop_lines
+(
+    game_id INTEGER NOT NULL,
+    player_id INTEGER NOT NULL,
+    sportsbook TEXT NOT NULL DEFAULT '',
+    line REAL NOT NULL,
+    over_odds INTEGER NOT NULL,
+    under_odds INTEGER,
+    updated_at TEXT NOT NULL,
+    PRIMARY KEY (game_id, player_id)
+);
+
+-- The line each prediction was settled against and the one unit bet the model
+-- made on it. They are NULL for predictions without a line when validated, and
+-- bet_side is NULL when the model had no edge on either side.
+ALTER TABLE model_predictions ADD COLUMN prop_line REAL;
+ALTER TABLE model_predictions ADD COLUMN prop_over_odds INTEGER;
+ALTER TABLE model_predictions ADD COLUMN prop_under_odds INTEGER;
+ALTER TABLE model_predictions ADD COLUMN bet_side TEXT;
+ALTER TABLE model_predictions ADD COLUMN bet_profit REAL;
+
+-- DOWN
+
+ALTER TABLE model_predictions DROP COLUMN prop_line;
+ALTER TABLE model_predictions DROP COLUMN prop_over_odds;
+ALTER TABLE model_predictions DROP COLUMN prop_under_odds;
+ALTER TABLE model_predictions DROP COLUMN bet_side;
+ALTER TABLE model_predictions DROP COLUMN bet_profit;
+DROP TABLE IF EXISTS prop_lines;
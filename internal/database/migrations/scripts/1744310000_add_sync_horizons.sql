@@ -0,0 +1,14 @@
+-- Migration: add_sync_horizons
+-- Created at: 2025-10-29T00:00:00Z
+
+-- The highest change_log seq purged for a household. Old tombstones are
+-- dropped from change_log, so a cursor below this could miss deletions and
+-- has to start over with a full sync.
+CREATE TABLE IF NOT EXISTS sync_horizons (
+	household_id TEXT PRIMARY KEY,
+	purged_through INTEGER NOT NULL
+);
+
+-- DOWN
+
+DROP TABLE IF EXISTS sync_horizons;
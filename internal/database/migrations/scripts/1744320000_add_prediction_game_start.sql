@@ -0,0 +1,11 @@
+-- Migration: add_prediction_game_start
+-- Created at: 2025-10-30T00:00:00Z
+
+-- When the predicted game started, in UTC. A sportsbook line is only settled
+-- against a prediction if it was imported before the game started. Older
+-- predictions have none and their lines aren't settled.
+ALTER TABLE model_predictions ADD COLUMN game_start_utc TEXT;
+
+-- DOWN
+
+ALTER TABLE model_predictions DROP COLUMN game_start_utc;
@@ -80,7 +80,7 @@ func buildPrompt(categories []Category, transactions []Transaction) (string, str
 		xmlTransactions[i] = XMLTransaction{
 			ID:          tx.ID,
 			Description: tx.Description,
-			Merchant:    tx.Merchant,
+			Merchant:    cleanMerchantName(tx),
 		}
 	}
 
@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"github.com/google/uuid"
+)
+
+// ATTACHMENTS_DIR is where uploaded files are stored, named by their sha256
+const ATTACHMENTS_DIR = "./attachments"
+
+const (
+	MAX_ATTACHMENT_SIZE             = 10 << 20 // 10 MB
+	MAX_ATTACHMENTS_PER_TRANSACTION = 10
+)
+
+// allowedAttachmentTypes are the sniffed content types accepted for upload
+var allowedAttachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+var ErrAttachmentTooLarge = errors.New("attachment exceeds the maximum size of 10 MB")
+var ErrUnsupportedAttachmentType = errors.New("attachments must be an image or a PDF")
+var ErrTooManyAttachments = errors.New("transaction already has the maximum number of attachments")
+
+type Attachment struct {
+	ID            string `json:"id"`
+	TransactionID string `json:"transactionId"`
+	Filename      string `json:"filename"`
+	ContentType   string `json:"contentType"`
+	Size          int64  `json:"size"`
+	ContentHash   string `json:"contentHash"`
+	UploadedBy    *int   `json:"uploadedBy,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+// SaveAttachment stores an uploaded file against a transaction. Identical
+// content is only written to disk once, and uploading the same file to the
+// same transaction again returns the existing attachment.
+func SaveAttachment(transactionID string, householdID string, userID int, filename string, content io.Reader) (*Attachment, error) {
+	if _, err := getTransaction(database.DB, transactionID, householdID); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, MAX_ATTACHMENT_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MAX_ATTACHMENT_SIZE {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := allowedAttachmentTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedAttachmentType
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	existing, err := queryAttachments(database.DB, "WHERE transaction_id = ? AND household_id = ?", transactionID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range existing {
+		if a.ContentHash == hash {
+			return &a, nil
+		}
+	}
+	if len(existing) >= MAX_ATTACHMENTS_PER_TRANSACTION {
+		return nil, ErrTooManyAttachments
+	}
+
+	if err := writeAttachmentFile(hash, data); err != nil {
+		return nil, err
+	}
+
+	filename = sanitizeFilename(filename)
+	if filename == "" {
+		filename = "attachment" + extension
+	}
+
+	attachment := Attachment{
+		ID:            uuid.New().String(),
+		TransactionID: transactionID,
+		Filename:      filename,
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		ContentHash:   hash,
+		UploadedBy:    &userID,
+		CreatedAt:     time.Now().Format("2006-01-02 15:04:05"),
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO attachments (id, transaction_id, household_id, filename, content_type, size, content_hash, uploaded_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, attachment.ID, attachment.TransactionID, householdID, attachment.Filename, attachment.ContentType, attachment.Size, attachment.ContentHash, userID, attachment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeAudit(tx, householdID, userID, EntityAttachment, attachment.ID, AuditActionCreate, nil, attachment); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func GetAttachments(transactionID string, householdID string) ([]Attachment, error) {
+	return queryAttachments(database.DB, "WHERE transaction_id = ? AND household_id = ? ORDER BY created_at", transactionID, householdID)
+}
+
+func GetAttachment(id string, householdID string) (*Attachment, error) {
+	attachments, err := queryAttachments(database.DB, "WHERE id = ? AND household_id = ?", id, householdID)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &attachments[0], nil
+}
+
+// OpenAttachment opens the stored file, the caller must close it
+func OpenAttachment(attachment *Attachment) (*os.File, error) {
+	return os.Open(attachmentPath(attachment.ContentHash))
+}
+
+func DeleteAttachment(id string, householdID string, userID int) error {
+	attachment, err := GetAttachment(id, householdID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM attachments WHERE id = ? AND household_id = ?", id, householdID); err != nil {
+		return err
+	}
+	if err := writeAudit(tx, householdID, userID, EntityAttachment, id, AuditActionDelete, attachment, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return removeUnreferencedFile(attachment.ContentHash)
+}
+
+// PurgeOrphanedAttachments removes attachments whose transaction is gone for
+// good. A transaction that can still come back keeps its attachments: one in
+// a trash batch that hasn't expired or been restored, or one deleted on its
+// own within TRASH_RETENTION_DAYS whose delete hasn't been undone. Undoing an
+// older delete brings the transaction back without its attachments.
+func PurgeOrphanedAttachments() (int, error) {
+	now := time.Now()
+	orphans, err := queryAttachments(database.DB, `
+		WHERE transaction_id NOT IN (SELECT id FROM transactions)
+		AND transaction_id NOT IN (
+			SELECT i.entity_id
+			FROM trash_items i
+			JOIN trash_batches b ON b.id = i.batch_id
+			WHERE i.entity_type = ? AND b.expires_at > ? AND b.restored_at IS NULL
+		)
+		AND transaction_id NOT IN (
+			SELECT entity_id
+			FROM audit_log
+			WHERE entity_type = ? AND action = ? AND undone_at IS NULL AND created_at > ?
+		)
+	`, EntityTransaction, now.Format("2006-01-02 15:04:05"),
+		EntityTransaction, AuditActionDelete, now.AddDate(0, 0, -TRASH_RETENTION_DAYS).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, a := range orphans {
+		if _, err := database.DB.Exec("DELETE FROM attachments WHERE id = ?", a.ID); err != nil {
+			return 0, err
+		}
+		if err := removeUnreferencedFile(a.ContentHash); err != nil {
+			return 0, err
+		}
+	}
+	return len(orphans), nil
+}
+
+// BudgetArchive is a household's exported budget data and attachment metadata,
+// loaded up front so the zip can be streamed once nothing else can fail
+// before the first byte is written
+type BudgetArchive struct {
+	data        string
+	attachments []Attachment
+}
+
+// GetBudgetArchive loads what BudgetArchive.Write puts in the zip
+func GetBudgetArchive(householdID string) (*BudgetArchive, error) {
+	data, err := ExportBudgetData(householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := queryAttachments(database.DB, "WHERE household_id = ? ORDER BY transaction_id, created_at", householdID)
+	if err != nil {
+		return nil, err
+	}
+	return &BudgetArchive{data: data, attachments: attachments}, nil
+}
+
+// Write streams a zip containing the exported budget data, the attachment
+// metadata and every attachment file to w
+func (b *BudgetArchive) Write(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	dataFile, err := archive.Create("budget.json")
+	if err != nil {
+		return err
+	}
+	if _, err := dataFile.Write([]byte(b.data)); err != nil {
+		return err
+	}
+
+	type archivedAttachment struct {
+		Attachment
+		Path string `json:"path"`
+	}
+	manifest := []archivedAttachment{}
+
+	for _, a := range b.attachments {
+		path := "attachments/" + a.ID + "/" + a.Filename
+		manifest = append(manifest, archivedAttachment{Attachment: a, Path: path})
+
+		file, err := OpenAttachment(&a)
+		if err != nil {
+			return err
+		}
+		entry, err := archive.Create(path)
+		if err == nil {
+			_, err = io.Copy(entry, file)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestFile, err := archive.Create("attachments.json")
+	if err != nil {
+		return err
+	}
+	if _, err := manifestFile.Write(manifestJSON); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func queryAttachments(exec execer, where string, args ...interface{}) ([]Attachment, error) {
+	rows, err := exec.Query(`
+		SELECT id, transaction_id, filename, content_type, size, content_hash, uploaded_by, created_at
+		FROM attachments
+	`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		var uploadedBy sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.TransactionID, &a.Filename, &a.ContentType, &a.Size, &a.ContentHash, &uploadedBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.UploadedBy = nullableUserID(uploadedBy)
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+func attachmentPath(hash string) string {
+	return filepath.Join(ATTACHMENTS_DIR, hash[:2], hash)
+}
+
+// writeAttachmentFile writes content to its hash path unless it already exists,
+// going through a temp file so a partial write is never visible
+func writeAttachmentFile(hash string, data []byte) error {
+	path := attachmentPath(hash)
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func removeUnreferencedFile(hash string) error {
+	var references int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM attachments WHERE content_hash = ?", hash).Scan(&references); err != nil {
+		return err
+	}
+	if references > 0 {
+		return nil
+	}
+
+	if err := os.Remove(attachmentPath(hash)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func sanitizeFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 32 || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,695 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	EntityCategory    = "category"
+	EntityBudget      = "budget"
+	EntityTransaction = "transaction"
+	EntityAttachment  = "attachment"
+	EntityTag         = "tag"
+	EntityMerchant    = "merchant"
+)
+
+const (
+	AuditActionCreate     = "create"
+	AuditActionUpdate     = "update"
+	AuditActionDelete     = "delete"
+	AuditActionBulkDelete = "bulk_delete"
+	AuditActionRestore    = "restore"
+	AuditActionUndo       = "undo"
+)
+
+// TRASH_RETENTION_DAYS is how long bulk deleted rows can be restored for
+const TRASH_RETENTION_DAYS = 30
+
+var ErrUndoConflict = errors.New("entity has changed since this entry was recorded")
+var ErrNotUndoable = errors.New("this entry cannot be undone")
+var ErrAlreadyUndone = errors.New("this entry has already been undone")
+
+type AuditEntry struct {
+	ID         int             `json:"id"`
+	UserID     *int            `json:"userId,omitempty"`
+	EntityType string          `json:"entityType"`
+	EntityID   string          `json:"entityId"`
+	Action     string          `json:"action"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	UndoneAt   *string         `json:"undoneAt,omitempty"`
+	CreatedAt  string          `json:"createdAt"`
+}
+
+type TrashBatch struct {
+	ID         string  `json:"id"`
+	UserID     *int    `json:"userId,omitempty"`
+	Operation  string  `json:"operation"`
+	ItemCount  int     `json:"itemCount"`
+	CreatedAt  string  `json:"createdAt"`
+	ExpiresAt  string  `json:"expiresAt"`
+	RestoredAt *string `json:"restoredAt,omitempty"`
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// writeAudit records a mutation, before and after are marshalled as JSON and
+// may be nil for creates and deletes respectively
+func writeAudit(exec execer, householdID string, userID int, entityType, entityID, action string, before, after interface{}) error {
+	beforeJSON, err := marshalSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := marshalSnapshot(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = exec.Exec(`
+		INSERT INTO audit_log (household_id, user_id, entity_type, entity_id, action, before_snapshot, after_snapshot, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, householdID, userID, entityType, entityID, action, beforeJSON, afterJSON, time.Now().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// GetAuditLog returns the household's most recent audit entries, optionally
+// narrowed to one entity type and ID
+func GetAuditLog(householdID, entityType, entityID string, limit int) ([]AuditEntry, error) {
+	query := `
+		SELECT id, user_id, entity_type, entity_id, action, before_snapshot, after_snapshot, undone_at, created_at
+		FROM audit_log
+		WHERE household_id = ?
+	`
+	args := []interface{}{householdID}
+
+	if entityType != "" {
+		query += ` AND entity_type = ?`
+		args = append(args, entityType)
+	}
+	if entityID != "" {
+		query += ` AND entity_id = ?`
+		args = append(args, entityID)
+	}
+
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+// UndoAuditEntry reverts a single create, update or delete. Updates are only
+// reverted while the entity is still in the state the entry left it in, and a
+// budget's creation is kept while transactions still reference it.
+func UndoAuditEntry(id int, householdID string, userID int) (*AuditEntry, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`
+		SELECT id, user_id, entity_type, entity_id, action, before_snapshot, after_snapshot, undone_at, created_at
+		FROM audit_log
+		WHERE id = ? AND household_id = ?
+	`, id, householdID)
+	entry, err := scanAuditEntry(row)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.UndoneAt != nil {
+		return nil, ErrAlreadyUndone
+	}
+	if !isUndoable(entry) {
+		return nil, ErrNotUndoable
+	}
+
+	current, err := loadEntity(tx, entry.EntityType, entry.EntityID, householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch entry.Action {
+	case AuditActionCreate:
+		if current == nil {
+			return nil, ErrUndoConflict
+		}
+		if entry.EntityType == EntityBudget {
+			var referenced int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM transactions WHERE budget_id = ? AND household_id = ?", entry.EntityID, householdID).Scan(&referenced); err != nil {
+				return nil, err
+			}
+			if referenced > 0 {
+				return nil, ErrUndoConflict
+			}
+		}
+		if err := deleteEntity(tx, entry.EntityType, entry.EntityID, householdID); err != nil {
+			return nil, err
+		}
+	case AuditActionUpdate:
+		if current == nil || !snapshotMatches(current, entry.After) {
+			return nil, ErrUndoConflict
+		}
+		err := updateEntity(tx, entry.EntityType, entry.Before, entityVersion(current), householdID, userID)
+		if errors.Is(err, ErrVersionMismatch) {
+			return nil, ErrUndoConflict
+		} else if err != nil {
+			return nil, err
+		}
+	case AuditActionDelete:
+		if current != nil {
+			return nil, ErrUndoConflict
+		}
+		if err := insertEntity(tx, entry.EntityType, entry.Before, 0, householdID, userID); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNotUndoable
+	}
+
+	restored, err := loadEntity(tx, entry.EntityType, entry.EntityID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(tx, householdID, userID, entry.EntityType, entry.EntityID, AuditActionUndo, current, restored); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	if _, err := tx.Exec("UPDATE audit_log SET undone_at = ? WHERE id = ?", now, entry.ID); err != nil {
+		return nil, err
+	}
+	entry.UndoneAt = &now
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// moveToTrash snapshots the household's rows of the given entity types into
+// a new trash batch and deletes them. Categories named "Other" are kept unless
+// includeOther is set.
+func moveToTrash(tx *sql.Tx, householdID string, userID int, operation string, entityTypes []string, includeOther bool) (*TrashBatch, error) {
+	now := time.Now()
+	batch := TrashBatch{
+		ID:        uuid.New().String(),
+		UserID:    &userID,
+		Operation: operation,
+		CreatedAt: now.Format("2006-01-02 15:04:05"),
+		ExpiresAt: now.AddDate(0, 0, TRASH_RETENTION_DAYS).Format("2006-01-02 15:04:05"),
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO trash_batches (id, household_id, user_id, operation, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, batch.ID, householdID, userID, operation, batch.CreatedAt, batch.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	itemStmt, err := tx.Prepare(`
+		INSERT INTO trash_items (batch_id, entity_type, entity_id, snapshot)
+		VALUES (?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer itemStmt.Close()
+
+	for _, entityType := range entityTypes {
+		snapshots, err := loadAllEntities(tx, entityType, householdID)
+		if err != nil {
+			return nil, err
+		}
+
+		for entityID, snapshot := range snapshots {
+			if entityType == EntityCategory && !includeOther {
+				var category Category
+				if err := json.Unmarshal(snapshot, &category); err == nil && category.Name == "Other" {
+					continue
+				}
+			}
+			if _, err := itemStmt.Exec(batch.ID, entityType, entityID, string(snapshot)); err != nil {
+				return nil, err
+			}
+			if err := deleteEntity(tx, entityType, entityID, householdID); err != nil {
+				return nil, err
+			}
+			batch.ItemCount++
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE trash_batches SET item_count = ? WHERE id = ?", batch.ItemCount, batch.ID); err != nil {
+		return nil, err
+	}
+
+	summary := map[string]interface{}{"trashId": batch.ID, "itemCount": batch.ItemCount}
+	if err := writeAudit(tx, householdID, userID, operation, batch.ID, AuditActionBulkDelete, summary, nil); err != nil {
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+// GetTrash returns the household's restorable trash batches
+func GetTrash(householdID string) ([]TrashBatch, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, operation, item_count, created_at, expires_at, restored_at
+		FROM trash_batches
+		WHERE household_id = ? AND restored_at IS NULL AND expires_at > ?
+		ORDER BY created_at DESC
+	`, householdID, time.Now().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches := []TrashBatch{}
+	for rows.Next() {
+		var b TrashBatch
+		var userID sql.NullInt64
+		var restoredAt sql.NullString
+		if err := rows.Scan(&b.ID, &userID, &b.Operation, &b.ItemCount, &b.CreatedAt, &b.ExpiresAt, &restoredAt); err != nil {
+			return nil, err
+		}
+		b.UserID = nullableUserID(userID)
+		if restoredAt.Valid {
+			b.RestoredAt = &restoredAt.String
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
+
+// RestoreTrash re-inserts every row of a trash batch. Rows whose ID has been
+// reused since are skipped.
+func RestoreTrash(batchID string, householdID string, userID int) (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM trash_batches
+		WHERE id = ? AND household_id = ? AND restored_at IS NULL AND expires_at > ?
+	`, batchID, householdID, time.Now().Format("2006-01-02 15:04:05")).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if exists == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	restored := 0
+	// Parents first so transactions point at restored budgets and categories
+	for _, entityType := range []string{EntityCategory, EntityBudget, EntityTransaction} {
+		rows, err := tx.Query(`
+			SELECT entity_id, snapshot FROM trash_items
+			WHERE batch_id = ? AND entity_type = ?
+			ORDER BY id
+		`, batchID, entityType)
+		if err != nil {
+			return 0, err
+		}
+
+		snapshots := make(map[string]json.RawMessage)
+		var order []string
+		for rows.Next() {
+			var entityID, snapshot string
+			if err := rows.Scan(&entityID, &snapshot); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			snapshots[entityID] = json.RawMessage(snapshot)
+			order = append(order, entityID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for _, entityID := range order {
+			current, err := loadEntity(tx, entityType, entityID, householdID)
+			if err != nil {
+				return 0, err
+			}
+			if current != nil {
+				continue
+			}
+			if err := insertEntity(tx, entityType, snapshots[entityID], 0, householdID, userID); err != nil {
+				return 0, err
+			}
+			restored++
+		}
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	if _, err := tx.Exec("UPDATE trash_batches SET restored_at = ? WHERE id = ?", now, batchID); err != nil {
+		return 0, err
+	}
+
+	summary := map[string]interface{}{"trashId": batchID, "itemCount": restored}
+	if err := writeAudit(tx, householdID, userID, "trash", batchID, AuditActionRestore, nil, summary); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return restored, nil
+}
+
+func DeleteTrash(batchID string, householdID string) error {
+	result, err := database.DB.Exec("DELETE FROM trash_batches WHERE id = ? AND household_id = ?", batchID, householdID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = database.DB.Exec("DELETE FROM trash_items WHERE batch_id = ?", batchID)
+	return err
+}
+
+// PurgeExpiredTrash permanently removes trash batches past their retention
+// period along with batches that were already restored
+func PurgeExpiredTrash() (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	if _, err := tx.Exec(`
+		DELETE FROM trash_items WHERE batch_id IN (
+			SELECT id FROM trash_batches WHERE expires_at <= ? OR restored_at IS NOT NULL
+		)
+	`, now); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("DELETE FROM trash_batches WHERE expires_at <= ? OR restored_at IS NOT NULL", now)
+	if err != nil {
+		return 0, err
+	}
+	purged, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(purged), nil
+}
+
+// Entity helpers shared by undo and restore
+
+func loadEntity(exec execer, entityType, id, householdID string) (interface{}, error) {
+	var entity interface{}
+	var err error
+	switch entityType {
+	case EntityCategory:
+		entity, err = getCategory(exec, id, householdID)
+	case EntityBudget:
+		entity, err = getBudget(exec, id, householdID)
+	case EntityTransaction:
+		entity, err = getTransaction(exec, id, householdID)
+	default:
+		return nil, fmt.Errorf("unknown entity type: %s", entityType)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return entity, err
+}
+
+func loadAllEntities(exec execer, entityType, householdID string) (map[string]json.RawMessage, error) {
+	var table string
+	switch entityType {
+	case EntityCategory:
+		table = "categories"
+	case EntityBudget:
+		table = "budgets"
+	case EntityTransaction:
+		table = "transactions"
+	default:
+		return nil, fmt.Errorf("unknown entity type: %s", entityType)
+	}
+
+	rows, err := exec.Query("SELECT id FROM "+table+" WHERE household_id = ?", householdID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	snapshots := make(map[string]json.RawMessage)
+	for _, id := range ids {
+		entity, err := loadEntity(exec, entityType, id, householdID)
+		if err != nil {
+			return nil, err
+		}
+		snapshot, err := json.Marshal(entity)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[id] = snapshot
+	}
+	return snapshots, nil
+}
+
+// insertEntity re-inserts a snapshot with a version above both the
+// snapshot's and minVersion, so ETags handed out before the undo or restore
+// no longer match
+func insertEntity(exec execer, entityType string, snapshot json.RawMessage, minVersion int, householdID string, userID int) error {
+	switch entityType {
+	case EntityCategory:
+		var c Category
+		if err := json.Unmarshal(snapshot, &c); err != nil {
+			return err
+		}
+		c.Version = max(c.Version, minVersion) + 1
+		return insertCategory(exec, c, householdID, userID)
+	case EntityBudget:
+		var b Budget
+		if err := json.Unmarshal(snapshot, &b); err != nil {
+			return err
+		}
+		b.Version = max(b.Version, minVersion) + 1
+		return insertBudget(exec, b, householdID, userID)
+	case EntityTransaction:
+		var t Transaction
+		if err := json.Unmarshal(snapshot, &t); err != nil {
+			return err
+		}
+		t.Version = max(t.Version, minVersion) + 1
+		return insertTransaction(exec, t, householdID, userID)
+	}
+	return fmt.Errorf("unknown entity type: %s", entityType)
+}
+
+// updateEntity writes a snapshot back over the row in place, guarded by the
+// version the caller read so a concurrent edit is not overwritten
+func updateEntity(exec execer, entityType string, snapshot json.RawMessage, version int, householdID string, userID int) error {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	switch entityType {
+	case EntityCategory:
+		var c Category
+		if err := json.Unmarshal(snapshot, &c); err != nil {
+			return err
+		}
+		result, err := exec.Exec(`
+			UPDATE categories
+			SET name = ?, monthly_budget = ?, color = ?, tax_class = ?, version = ?, updated_at = ?
+			WHERE id = ? AND household_id = ? AND version = ?
+		`, c.Name, c.MonthlyBudget, c.Color, c.TaxClass, version+1, now, c.ID, householdID, version)
+		return checkVersionedUpdate(result, err)
+	case EntityBudget:
+		var b Budget
+		if err := json.Unmarshal(snapshot, &b); err != nil {
+			return err
+		}
+		allocationsJSON, err := json.Marshal(b.Allocations)
+		if err != nil {
+			return err
+		}
+		result, err := exec.Exec(`
+			UPDATE budgets
+			SET month = ?, allocations = ?, version = ?, updated_at = ?
+			WHERE id = ? AND household_id = ? AND version = ?
+		`, b.Month, string(allocationsJSON), version+1, now, b.ID, householdID, version)
+		return checkVersionedUpdate(result, err)
+	case EntityTransaction:
+		var t Transaction
+		if err := json.Unmarshal(snapshot, &t); err != nil {
+			return err
+		}
+		result, err := exec.Exec(`
+			UPDATE transactions
+			SET budget_id = ?, category_id = ?, date = ?, merchant = ?, merchant_id = ?, amount = ?, description = ?, account_type = ?, transaction_type = ?, notes = ?, updated_by = ?, version = ?, updated_at = ?
+			WHERE id = ? AND household_id = ? AND version = ?
+		`, t.BudgetID, t.CategoryID, t.Date, t.Merchant, t.MerchantID, t.Amount, t.Description, t.AccountType, t.TransactionType, t.Notes, userID, version+1, now, t.ID, householdID, version)
+		if err := checkVersionedUpdate(result, err); err != nil {
+			return err
+		}
+		return setTransactionTags(exec, t.ID, householdID, t.Tags)
+	}
+	return fmt.Errorf("unknown entity type: %s", entityType)
+}
+
+// deleteEntity returns sql.ErrNoRows when the household has no such row
+func deleteEntity(exec execer, entityType, id, householdID string) error {
+	var query string
+	switch entityType {
+	case EntityCategory:
+		query = "DELETE FROM categories WHERE id = ? AND household_id = ?"
+	case EntityBudget:
+		query = "DELETE FROM budgets WHERE id = ? AND household_id = ?"
+	case EntityTransaction:
+		if _, err := exec.Exec("DELETE FROM transaction_tags WHERE transaction_id = ?", id); err != nil {
+			return err
+		}
+		query = "DELETE FROM transactions WHERE id = ? AND household_id = ?"
+	default:
+		return fmt.Errorf("unknown entity type: %s", entityType)
+	}
+	result, err := exec.Exec(query, id, householdID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// isUndoable reports whether an entry is a single row change of one of the
+// budget entities, bulk deletes are reverted through the trash instead
+func isUndoable(entry *AuditEntry) bool {
+	switch entry.EntityType {
+	case EntityCategory, EntityBudget, EntityTransaction:
+	default:
+		return false
+	}
+	switch entry.Action {
+	case AuditActionCreate, AuditActionUpdate, AuditActionDelete:
+		return true
+	}
+	return false
+}
+
+func entityVersion(entity interface{}) int {
+	switch e := entity.(type) {
+	case *Category:
+		return e.Version
+	case *Budget:
+		return e.Version
+	case *Transaction:
+		return e.Version
+	}
+	return 0
+}
+
+// snapshotMatches reports whether entity is still in the state snapshot
+// recorded, by version when the snapshot has one and by updatedAt for
+// entries written before versions existed
+func snapshotMatches(entity interface{}, snapshot json.RawMessage) bool {
+	current, err := json.Marshal(entity)
+	if err != nil {
+		return false
+	}
+
+	var a, b map[string]interface{}
+	if json.Unmarshal(current, &a) != nil || json.Unmarshal(snapshot, &b) != nil {
+		return false
+	}
+	if version, ok := b["version"]; ok {
+		return a["version"] == version
+	}
+	return parseTimestamp(a["updatedAt"]).Equal(parseTimestamp(b["updatedAt"]))
+}
+
+// parseTimestamp accepts both the format rows are written in and the RFC3339
+// form the sqlite driver reads TIMESTAMP columns back as
+func parseTimestamp(value interface{}) time.Time {
+	s, _ := value.(string)
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func marshalSnapshot(value interface{}) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := string(data)
+	return &snapshot, nil
+}
+
+func scanAuditEntry(scanner interface{ Scan(...any) error }) (*AuditEntry, error) {
+	var entry AuditEntry
+	var userID sql.NullInt64
+	var before, after, undoneAt sql.NullString
+	if err := scanner.Scan(&entry.ID, &userID, &entry.EntityType, &entry.EntityID, &entry.Action, &before, &after, &undoneAt, &entry.CreatedAt); err != nil {
+		return nil, err
+	}
+	if undoneAt.Valid {
+		entry.UndoneAt = &undoneAt.String
+	}
+	entry.UserID = nullableUserID(userID)
+	if before.Valid {
+		entry.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		entry.After = json.RawMessage(after.String)
+	}
+	return &entry, nil
+}
@@ -0,0 +1,27 @@
+package repository
+
+import "testing"
+
+func TestIsUndoable(t *testing.T) {
+	tests := []struct {
+		entityType string
+		action     string
+		want       bool
+	}{
+		{EntityTransaction, AuditActionCreate, true},
+		{EntityCategory, AuditActionUpdate, true},
+		{EntityBudget, AuditActionDelete, true},
+		{EntityTransaction, AuditActionBulkDelete, false},
+		{EntityCategory, AuditActionRestore, false},
+		{EntityTransaction, AuditActionUndo, false},
+		{EntityAttachment, AuditActionDelete, false},
+		{"clear_all", AuditActionBulkDelete, false},
+	}
+
+	for _, tt := range tests {
+		entry := &AuditEntry{EntityType: tt.entityType, Action: tt.action}
+		if got := isUndoable(entry); got != tt.want {
+			t.Errorf("isUndoable(%s %s) = %v, want %v", tt.entityType, tt.action, got, tt.want)
+		}
+	}
+}
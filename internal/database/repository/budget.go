@@ -3,18 +3,30 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"api.alexmontague.ca/internal/database"
 	"github.com/google/uuid"
 )
 
+// readOnlyFields may be sent back in a patch, as when a client PUTs the
+// object it fetched, and are ignored rather than rejected
+var readOnlyFields = []string{"id", "version", "householdId", "createdAt", "updatedAt", "createdBy", "updatedBy", "merchantId", "merchantName", "transactionHash"}
+
+var ErrInvalidTransactionDate = errors.New("transaction date must be YYYY-MM-DD")
+var ErrVersionMismatch = errors.New("resource was modified since it was fetched")
+
 type Category struct {
 	ID            string   `json:"id"`
 	Name          string   `json:"name"`
 	MonthlyBudget *float64 `json:"monthlyBudget,omitempty"`
 	Color         *string  `json:"color,omitempty"`
+	TaxClass      *string  `json:"taxClass,omitempty"`
+	Version       int      `json:"version"`
 	CreatedAt     string   `json:"createdAt"`
 	UpdatedAt     string   `json:"updatedAt"`
 }
@@ -23,32 +35,40 @@ type Budget struct {
 	ID          string             `json:"id"`
 	Month       string             `json:"month"`
 	Allocations map[string]float64 `json:"allocations"`
+	Version     int                `json:"version"`
 	CreatedAt   string             `json:"createdAt"`
 	UpdatedAt   string             `json:"updatedAt"`
 }
 
 type Transaction struct {
-	ID              string  `json:"id"`
-	BudgetID        string  `json:"budgetId"`
-	CategoryID      *string `json:"categoryId,omitempty"`
-	TransactionHash string  `json:"transactionHash"`
-	Date            string  `json:"date"`
-	Merchant        string  `json:"merchant"`
-	Amount          float64 `json:"amount"`
-	Description     string  `json:"description"`
-	AccountType     string  `json:"accountType"`
-	TransactionType string  `json:"transactionType"` // "DEBIT" (expense) or "CREDIT" (income)
-	CreatedAt       string  `json:"createdAt"`
-	UpdatedAt       string  `json:"updatedAt"`
-}
-
-func GetCategories(userID int) ([]Category, error) {
+	ID              string   `json:"id"`
+	BudgetID        string   `json:"budgetId"`
+	CategoryID      *string  `json:"categoryId,omitempty"`
+	TransactionHash string   `json:"transactionHash"`
+	Date            string   `json:"date"`
+	Merchant        string   `json:"merchant"`
+	MerchantID      *string  `json:"merchantId,omitempty"`
+	MerchantName    string   `json:"merchantName,omitempty"` // canonical name of the linked merchant
+	Amount          float64  `json:"amount"`
+	Description     string   `json:"description"`
+	AccountType     string   `json:"accountType"`
+	TransactionType string   `json:"transactionType"` // "DEBIT" (expense) or "CREDIT" (income)
+	Notes           *string  `json:"notes,omitempty"`
+	Tags            []string `json:"tags,omitempty"`
+	CreatedBy       *int     `json:"createdBy,omitempty"`
+	UpdatedBy       *int     `json:"updatedBy,omitempty"`
+	Version         int      `json:"version"`
+	CreatedAt       string   `json:"createdAt"`
+	UpdatedAt       string   `json:"updatedAt"`
+}
+
+func GetCategories(householdID string) ([]Category, error) {
 	rows, err := database.DB.Query(`
-		SELECT id, name, monthly_budget, color, created_at, updated_at
+		SELECT id, name, monthly_budget, color, tax_class, version, created_at, updated_at
 		FROM categories
-		WHERE user_id = ?
+		WHERE household_id = ?
 		ORDER BY name
-	`, userID)
+	`, householdID)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +77,7 @@ func GetCategories(userID int) ([]Category, error) {
 	categories := []Category{}
 	for rows.Next() {
 		var c Category
-		err := rows.Scan(&c.ID, &c.Name, &c.MonthlyBudget, &c.Color, &c.CreatedAt, &c.UpdatedAt)
+		err := rows.Scan(&c.ID, &c.Name, &c.MonthlyBudget, &c.Color, &c.TaxClass, &c.Version, &c.CreatedAt, &c.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -66,24 +86,40 @@ func GetCategories(userID int) ([]Category, error) {
 	return categories, rows.Err()
 }
 
-func SaveCategory(category Category, userID int) (*Category, error) {
+func SaveCategory(category Category, householdID string, userID int) (*Category, error) {
 	now := time.Now().Format("2006-01-02 15:04:05")
+	if category.TaxClass != nil && !IsValidTaxClass(*category.TaxClass) {
+		return nil, ErrInvalidTaxClass
+	}
 	category.ID = uuid.New().String()
+	category.Version = 1
 	category.CreatedAt = now
 	category.UpdatedAt = now
 
-	_, err := database.DB.Exec(`
-		INSERT INTO categories (id, name, monthly_budget, color, user_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, category.ID, category.Name, category.MonthlyBudget, category.Color, userID, category.CreatedAt, category.UpdatedAt)
-
+	tx, err := database.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	if err := insertCategory(tx, category, householdID, userID); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(tx, householdID, userID, EntityCategory, category.ID, AuditActionCreate, nil, category); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return &category, nil
 }
 
-func UpdateCategory(id string, userID int, updates map[string]interface{}) (*Category, error) {
+// UpdateCategory applies a merge patch to a category, returning sql.ErrNoRows
+// when it doesn't exist, a *ValidationError for invalid fields and
+// ErrVersionMismatch when ifMatch lists versions and the category has moved
+// past all of them
+func UpdateCategory(id string, householdID string, userID int, patch Patch, ifMatch []int) (*Category, error) {
 	now := time.Now().Format("2006-01-02 15:04:05")
 
 	tx, err := database.DB.Begin()
@@ -92,35 +128,51 @@ func UpdateCategory(id string, userID int, updates map[string]interface{}) (*Cat
 	}
 	defer tx.Rollback()
 
-	var category Category
-	err = tx.QueryRow(`
-		SELECT id, name, monthly_budget, color, created_at, updated_at
-		FROM categories WHERE id = ? AND user_id = ?
-	`, id, userID).Scan(&category.ID, &category.Name, &category.MonthlyBudget, &category.Color, &category.CreatedAt, &category.UpdatedAt)
+	category, err := getCategory(tx, id, householdID)
 	if err != nil {
 		return nil, err
 	}
-
-	if name, ok := updates["name"].(string); ok {
-		if category.Name != "Other" {
+	if !versionMatches(ifMatch, category.Version) {
+		return nil, ErrVersionMismatch
+	}
+	before := *category
+
+	fields := newPatchReader(patch, []string{"name", "monthlyBudget", "color", "taxClass"}, readOnlyFields)
+	var name string
+	if fields.String("name", &name) {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+			fields.fail("name", "can't be empty")
+		case category.Name == "Other" && name != "Other":
+			fields.fail("name", "the Other category can't be renamed")
+		default:
 			category.Name = name
 		}
 	}
-	if monthlyBudget, ok := updates["monthlyBudget"].(float64); ok {
-		category.MonthlyBudget = &monthlyBudget
+	if fields.NullableFloat("monthlyBudget", &category.MonthlyBudget) && category.MonthlyBudget != nil && *category.MonthlyBudget < 0 {
+		fields.fail("monthlyBudget", "can't be negative")
 	}
-	if color, ok := updates["color"].(string); ok {
-		category.Color = &color
+	fields.NullableString("color", &category.Color)
+	if fields.NullableString("taxClass", &category.TaxClass) && category.TaxClass != nil && !IsValidTaxClass(*category.TaxClass) {
+		fields.fail("taxClass", "%s", ErrInvalidTaxClass)
+	}
+	if err := fields.err(); err != nil {
+		return nil, err
 	}
 	category.UpdatedAt = now
+	category.Version++
 
-	_, err = tx.Exec(`
+	result, err := tx.Exec(`
 		UPDATE categories
-		SET name = ?, monthly_budget = ?, color = ?, updated_at = ?
-		WHERE id = ?
-	`, category.Name, category.MonthlyBudget, category.Color, category.UpdatedAt, id)
+		SET name = ?, monthly_budget = ?, color = ?, tax_class = ?, version = ?, updated_at = ?
+		WHERE id = ? AND version = ?
+	`, category.Name, category.MonthlyBudget, category.Color, category.TaxClass, category.Version, category.UpdatedAt, id, before.Version)
+	if err := checkVersionedUpdate(result, err); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	if err := writeAudit(tx, householdID, userID, EntityCategory, id, AuditActionUpdate, before, category); err != nil {
 		return nil, err
 	}
 
@@ -128,30 +180,41 @@ func UpdateCategory(id string, userID int, updates map[string]interface{}) (*Cat
 		return nil, err
 	}
 
-	return &category, nil
+	return category, nil
 }
 
-func DeleteCategory(id string, userID int) error {
-	var categoryName string
-	err := database.DB.QueryRow("SELECT name FROM categories WHERE id = ? AND user_id = ?", id, userID).Scan(&categoryName)
+func DeleteCategory(id string, householdID string, userID int) error {
+	tx, err := database.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if categoryName == "Other" {
+	category, err := getCategory(tx, id, householdID)
+	if err != nil {
+		return err
+	}
+
+	if category.Name == "Other" {
 		return sql.ErrNoRows
 	}
 
-	_, err = database.DB.Exec("DELETE FROM categories WHERE id = ? AND user_id = ?", id, userID)
-	return err
+	if err := deleteEntity(tx, EntityCategory, id, householdID); err != nil {
+		return err
+	}
+	if err := writeAudit(tx, householdID, userID, EntityCategory, id, AuditActionDelete, category, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func DeleteAllCategories(userID int) error {
-	_, err := database.DB.Exec("DELETE FROM categories WHERE user_id = ? AND name != 'Other'", userID)
-	return err
+// DeleteAllCategories moves every category except "Other" to the trash
+func DeleteAllCategories(householdID string, userID int) (*TrashBatch, error) {
+	return trashEntities(householdID, userID, "delete_all_categories", []string{EntityCategory}, false)
 }
 
-func CreateDefaultCategories(userID int) error {
+func CreateDefaultCategories(householdID string, userID int) error {
 	defaultCategories := []struct {
 		name  string
 		color string
@@ -175,7 +238,7 @@ func CreateDefaultCategories(userID int) error {
 			Name:  dc.name,
 			Color: &color,
 		}
-		_, err := SaveCategory(category, userID)
+		_, err := SaveCategory(category, householdID, userID)
 		if err != nil {
 			return err
 		}
@@ -184,13 +247,13 @@ func CreateDefaultCategories(userID int) error {
 	return nil
 }
 
-func GetBudgets(userID int) ([]Budget, error) {
+func GetBudgets(householdID string) ([]Budget, error) {
 	rows, err := database.DB.Query(`
-		SELECT id, month, allocations, created_at, updated_at
+		SELECT id, month, allocations, version, created_at, updated_at
 		FROM budgets
-		WHERE user_id = ?
+		WHERE household_id = ?
 		ORDER BY month DESC
-	`, userID)
+	`, householdID)
 	if err != nil {
 		return nil, err
 	}
@@ -200,7 +263,7 @@ func GetBudgets(userID int) ([]Budget, error) {
 	for rows.Next() {
 		var b Budget
 		var allocationsJSON string
-		err := rows.Scan(&b.ID, &b.Month, &allocationsJSON, &b.CreatedAt, &b.UpdatedAt)
+		err := rows.Scan(&b.ID, &b.Month, &allocationsJSON, &b.Version, &b.CreatedAt, &b.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -213,29 +276,35 @@ func GetBudgets(userID int) ([]Budget, error) {
 	return budgets, rows.Err()
 }
 
-func SaveBudget(budget Budget, userID int) (*Budget, error) {
+func SaveBudget(budget Budget, householdID string, userID int) (*Budget, error) {
 	now := time.Now().Format("2006-01-02 15:04:05")
 	budget.ID = uuid.New().String()
+	budget.Version = 1
 	budget.CreatedAt = now
 	budget.UpdatedAt = now
 
-	allocationsJSON, err := json.Marshal(budget.Allocations)
+	tx, err := database.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	_, err = database.DB.Exec(`
-		INSERT INTO budgets (id, month, allocations, user_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, budget.ID, budget.Month, string(allocationsJSON), userID, budget.CreatedAt, budget.UpdatedAt)
+	if err := insertBudget(tx, budget, householdID, userID); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(tx, householdID, userID, EntityBudget, budget.ID, AuditActionCreate, nil, budget); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 	return &budget, nil
 }
 
-func UpdateBudget(id string, userID int, updates map[string]interface{}) (*Budget, error) {
+// UpdateBudget applies a merge patch to a budget. allocations is merged per
+// category, a null allocation removes that category from the budget.
+func UpdateBudget(id string, householdID string, userID int, patch Patch, ifMatch []int) (*Budget, error) {
 	now := time.Now().Format("2006-01-02 15:04:05")
 
 	tx, err := database.DB.Begin()
@@ -244,46 +313,81 @@ func UpdateBudget(id string, userID int, updates map[string]interface{}) (*Budge
 	}
 	defer tx.Rollback()
 
-	var budget Budget
-	var allocationsJSON string
-	err = tx.QueryRow(`
-		SELECT id, month, allocations, created_at, updated_at
-		FROM budgets WHERE id = ? AND user_id = ?
-	`, id, userID).Scan(&budget.ID, &budget.Month, &allocationsJSON, &budget.CreatedAt, &budget.UpdatedAt)
+	budget, err := getBudget(tx, id, householdID)
 	if err != nil {
 		return nil, err
 	}
-
-	if err := json.Unmarshal([]byte(allocationsJSON), &budget.Allocations); err != nil {
-		return nil, err
+	if !versionMatches(ifMatch, budget.Version) {
+		return nil, ErrVersionMismatch
 	}
-
-	if month, ok := updates["month"].(string); ok {
-		budget.Month = month
+	before := *budget
+
+	fields := newPatchReader(patch, []string{"month", "allocations"}, readOnlyFields)
+	var month string
+	if fields.String("month", &month) {
+		if !isValidMonth(month) {
+			fields.fail("month", "must be YYYY-MM")
+		} else if month != budget.Month {
+			var existing string
+			err := tx.QueryRow("SELECT id FROM budgets WHERE household_id = ? AND month = ? AND id != ?", householdID, month, id).Scan(&existing)
+			if err == nil {
+				fields.fail("month", "a budget for %s already exists", month)
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+			budget.Month = month
+		}
 	}
-	if allocations, ok := updates["allocations"].(map[string]interface{}); ok {
-		alloc := make(map[string]float64)
-		for k, v := range allocations {
-			if val, ok := v.(float64); ok {
-				alloc[k] = val
+	if allocations, ok := fields.Object("allocations"); ok {
+		merged := make(map[string]float64)
+		for categoryID, amount := range budget.Allocations {
+			merged[categoryID] = amount
+		}
+		for categoryID, value := range allocations {
+			field := "allocations." + categoryID
+			if isJSONNull(value) {
+				delete(merged, categoryID)
+				continue
+			}
+			var amount float64
+			if !fields.decode(field, value, &amount, "a number or null") {
+				continue
+			}
+			if amount < 0 {
+				fields.fail(field, "can't be negative")
+				continue
+			}
+			if _, err := getCategory(tx, categoryID, householdID); errors.Is(err, sql.ErrNoRows) {
+				fields.fail(field, "category not found")
+				continue
+			} else if err != nil {
+				return nil, err
 			}
+			merged[categoryID] = amount
 		}
-		budget.Allocations = alloc
+		budget.Allocations = merged
+	}
+	if err := fields.err(); err != nil {
+		return nil, err
 	}
 	budget.UpdatedAt = now
+	budget.Version++
 
 	newAllocationsJSON, err := json.Marshal(budget.Allocations)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = tx.Exec(`
+	result, err := tx.Exec(`
 		UPDATE budgets
-		SET month = ?, allocations = ?, updated_at = ?
-		WHERE id = ?
-	`, budget.Month, string(newAllocationsJSON), budget.UpdatedAt, id)
+		SET month = ?, allocations = ?, version = ?, updated_at = ?
+		WHERE id = ? AND version = ?
+	`, budget.Month, string(newAllocationsJSON), budget.Version, budget.UpdatedAt, id, before.Version)
+	if err := checkVersionedUpdate(result, err); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	if err := writeAudit(tx, householdID, userID, EntityBudget, id, AuditActionUpdate, before, budget); err != nil {
 		return nil, err
 	}
 
@@ -291,26 +395,85 @@ func UpdateBudget(id string, userID int, updates map[string]interface{}) (*Budge
 		return nil, err
 	}
 
-	return &budget, nil
+	return budget, nil
 }
 
-func DeleteBudget(id string, userID int) error {
-	_, err := database.DB.Exec("DELETE FROM budgets WHERE id = ? AND user_id = ?", id, userID)
-	return err
+func DeleteBudget(id string, householdID string, userID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	budget, err := getBudget(tx, id, householdID)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteEntity(tx, EntityBudget, id, householdID); err != nil {
+		return err
+	}
+	if err := writeAudit(tx, householdID, userID, EntityBudget, id, AuditActionDelete, budget, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func DeleteAllBudgets(userID int) error {
-	_, err := database.DB.Exec("DELETE FROM budgets WHERE user_id = ?", userID)
-	return err
+// DeleteAllBudgets moves every budget to the trash
+func DeleteAllBudgets(householdID string, userID int) (*TrashBatch, error) {
+	return trashEntities(householdID, userID, "delete_all_budgets", []string{EntityBudget}, false)
 }
 
-func GetTransactions(userID int) ([]Transaction, error) {
-	rows, err := database.DB.Query(`
-		SELECT id, budget_id, category_id, transaction_hash, date, merchant, amount, description, account_type, transaction_type, created_at, updated_at
+// TransactionFilter narrows FilterTransactions, empty fields are ignored
+type TransactionFilter struct {
+	Tags       []string // transactions must have every tag
+	CategoryID string
+	MerchantID string
+	From       string // YYYY-MM-DD, inclusive
+	To         string // YYYY-MM-DD, inclusive
+}
+
+func GetTransactions(householdID string) ([]Transaction, error) {
+	return FilterTransactions(householdID, TransactionFilter{})
+}
+
+func FilterTransactions(householdID string, filter TransactionFilter) ([]Transaction, error) {
+	query := `
+		SELECT id, budget_id, category_id, transaction_hash, date, merchant, merchant_id, (SELECT name FROM merchants WHERE id = transactions.merchant_id), amount, description, account_type, transaction_type, notes, created_by, updated_by, version, created_at, updated_at
 		FROM transactions
-		WHERE user_id = ?
-		ORDER BY date DESC
-	`, userID)
+		WHERE household_id = ?
+	`
+	args := []interface{}{householdID}
+
+	for _, tag := range normalizeTagNames(filter.Tags) {
+		query += ` AND id IN (
+			SELECT tt.transaction_id FROM transaction_tags tt
+			JOIN tags t ON t.id = tt.tag_id
+			WHERE t.household_id = ? AND t.name = ?
+		)`
+		args = append(args, householdID, tag)
+	}
+	if filter.CategoryID != "" {
+		query += ` AND category_id = ?`
+		args = append(args, filter.CategoryID)
+	}
+	if filter.MerchantID != "" {
+		query += ` AND merchant_id = ?`
+		args = append(args, filter.MerchantID)
+	}
+	if filter.From != "" {
+		query += ` AND substr(date, 1, 10) >= ?`
+		args = append(args, filter.From)
+	}
+	if filter.To != "" {
+		query += ` AND substr(date, 1, 10) <= ?`
+		args = append(args, filter.To)
+	}
+
+	query += ` ORDER BY date DESC`
+
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -319,77 +482,166 @@ func GetTransactions(userID int) ([]Transaction, error) {
 	transactions := []Transaction{}
 	for rows.Next() {
 		var t Transaction
-		var categoryID sql.NullString
-		err := rows.Scan(&t.ID, &t.BudgetID, &categoryID, &t.TransactionHash, &t.Date, &t.Merchant, &t.Amount, &t.Description, &t.AccountType, &t.TransactionType, &t.CreatedAt, &t.UpdatedAt)
+		var categoryID, merchantName sql.NullString
+		var createdBy, updatedBy sql.NullInt64
+		err := rows.Scan(&t.ID, &t.BudgetID, &categoryID, &t.TransactionHash, &t.Date, &t.Merchant, &t.MerchantID, &merchantName, &t.Amount, &t.Description, &t.AccountType, &t.TransactionType, &t.Notes, &createdBy, &updatedBy, &t.Version, &t.CreatedAt, &t.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
 		if categoryID.Valid {
 			t.CategoryID = &categoryID.String
 		}
+		t.MerchantName = merchantName.String
+		t.CreatedBy = nullableUserID(createdBy)
+		t.UpdatedBy = nullableUserID(updatedBy)
 		transactions = append(transactions, t)
 	}
-	return transactions, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tags, err := loadTransactionTags(database.DB, householdID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range transactions {
+		transactions[i].Tags = tags[transactions[i].ID]
+	}
+
+	return transactions, nil
 }
 
-func SaveTransactions(transactions []Transaction, userID int) ([]Transaction, error) {
-	categories, err := GetCategories(userID)
+func SaveTransactions(transactions []Transaction, householdID string, userID int) ([]Transaction, error) {
+	batch, err := newTransactionBatch(householdID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	budgets, err := GetBudgets(userID)
+	transactionsToSave, err := batch.prepare(transactions)
 	if err != nil {
 		return nil, err
 	}
 
-	now := time.Now().Format("2006-01-02 15:04:05")
-	transactionsToSave := make([]Transaction, len(transactions))
-	budgetCache := make(map[string]string)
+	dbTx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer dbTx.Rollback()
 
+	savedTransactions, err := batch.insert(dbTx, transactionsToSave)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return savedTransactions, nil
+}
+
+// transactionBatch holds the lookups shared across the chunks of an import so
+// budgets and merchants are only resolved once per month and merchant
+type transactionBatch struct {
+	householdID        string
+	userID             int
+	categories         []Category
+	budgetCache        map[string]string
+	newBudgets         map[string]Budget // by month, inserted with the first chunk that uses them
+	merchantCategories map[string]string
+}
+
+func newTransactionBatch(householdID string, userID int) (*transactionBatch, error) {
+	categories, err := GetCategories(householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets, err := GetBudgets(householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &transactionBatch{
+		householdID:        householdID,
+		userID:             userID,
+		categories:         categories,
+		budgetCache:        make(map[string]string),
+		newBudgets:         make(map[string]Budget),
+		merchantCategories: make(map[string]string),
+	}
 	for _, b := range budgets {
-		budgetCache[b.Month] = b.ID
+		batch.budgetCache[b.Month] = b.ID
 	}
+	return batch, nil
+}
+
+// prepare assigns IDs, budgets, merchants and categories to new transactions.
+// Missing monthly budgets are only built here, insert creates them.
+func (b *transactionBatch) prepare(transactions []Transaction) ([]Transaction, error) {
+	householdID, userID := b.householdID, b.userID
+	now := time.Now().Format("2006-01-02 15:04:05")
+	transactionsToSave := make([]Transaction, len(transactions))
 
 	for i, t := range transactions {
+		if !isValidTransactionDate(t.Date) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTransactionDate, t.Date)
+		}
+
 		t.ID = uuid.New().String()
+		t.Version = 1
 		t.CreatedAt = now
 		t.UpdatedAt = now
+		t.CreatedBy = &userID
+		t.UpdatedBy = &userID
 
 		if t.TransactionType == "" {
 			t.TransactionType = "DEBIT"
 		}
+		t.Tags = normalizeTagNames(t.Tags)
+		if len(t.Tags) == 0 {
+			t.Tags = nil
+		}
+
+		// Known merchants are linked up front so categorization sees the canonical name,
+		// new ones are created inside the insert transaction
+		t.MerchantID = nil
+		t.MerchantName = NormalizeMerchantName(rawMerchant(t))
+		if merchant, err := findMerchant(database.DB, householdID, rawMerchant(t)); err == nil {
+			t.MerchantID = &merchant.ID
+			t.MerchantName = merchant.Name
+			if merchant.CategoryID != nil {
+				b.merchantCategories[merchant.ID] = *merchant.CategoryID
+			}
+		}
 
 		transactionMonth := t.Date[:7]
-		if budgetID, exists := budgetCache[transactionMonth]; exists {
+		if budgetID, exists := b.budgetCache[transactionMonth]; exists {
 			t.BudgetID = budgetID
+		} else if newBudget, exists := b.newBudgets[transactionMonth]; exists {
+			t.BudgetID = newBudget.ID
 		} else {
-			allocations := make(map[string]float64)
-			for _, cat := range categories {
-				if cat.MonthlyBudget != nil {
-					allocations[cat.ID] = *cat.MonthlyBudget
-				} else {
-					allocations[cat.ID] = 0
-				}
+			allocations, err := BuildBudgetAllocations(householdID, userID, transactionMonth, b.categories)
+			if err != nil {
+				return nil, err
 			}
 
 			newBudget := Budget{
+				ID:          uuid.New().String(),
 				Month:       transactionMonth,
 				Allocations: allocations,
+				Version:     1,
+				CreatedAt:   now,
+				UpdatedAt:   now,
 			}
-
-			savedBudget, err := SaveBudget(newBudget, userID)
-			if err != nil {
-				return nil, err
-			}
-
-			budgetCache[transactionMonth] = savedBudget.ID
-			t.BudgetID = savedBudget.ID
+			b.newBudgets[transactionMonth] = newBudget
+			t.BudgetID = newBudget.ID
 		}
 
 		transactionsToSave[i] = t
 	}
 
+	categories := b.categories
 	if len(categories) > 0 && len(transactionsToSave) > 0 {
 		categorized, err := CategorizeTransactions(categories, transactionsToSave)
 		if err == nil && len(categorized) > 0 {
@@ -411,21 +663,36 @@ func SaveTransactions(transactions []Transaction, userID int) ([]Transaction, er
 				fmt.Printf("Transaction: %-40s | Merchant: %-30s | Amount: $%-8.2f | Category: %s\n",
 					tx.Description, tx.Merchant, tx.Amount, categoryName)
 			}
-			fmt.Println("================================\n")
+			fmt.Print("================================\n\n")
 		} else if err != nil {
 			fmt.Printf("AI Categorization Error: %v\n", err)
 		}
 	}
 
-	dbTx, err := database.DB.Begin()
-	if err != nil {
+	// A category set on the merchant overrides the AI's guess
+	for i, t := range transactionsToSave {
+		if t.MerchantID == nil {
+			continue
+		}
+		if categoryID, ok := b.merchantCategories[*t.MerchantID]; ok {
+			transactionsToSave[i].CategoryID = &categoryID
+		}
+	}
+
+	return transactionsToSave, nil
+}
+
+// insert writes prepared transactions within dbTx, the caller commits
+func (b *transactionBatch) insert(dbTx *sql.Tx, transactions []Transaction) ([]Transaction, error) {
+	householdID, userID := b.householdID, b.userID
+
+	if err := b.insertNewBudgets(dbTx, transactions); err != nil {
 		return nil, err
 	}
-	defer dbTx.Rollback()
 
 	stmt, err := dbTx.Prepare(`
-		INSERT INTO transactions (id, budget_id, category_id, transaction_hash, date, merchant, amount, description, account_type, transaction_type, user_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO transactions (id, budget_id, category_id, transaction_hash, date, merchant, merchant_id, amount, description, account_type, transaction_type, notes, household_id, user_id, created_by, updated_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return nil, err
@@ -433,22 +700,66 @@ func SaveTransactions(transactions []Transaction, userID int) ([]Transaction, er
 	defer stmt.Close()
 
 	savedTransactions := []Transaction{}
-	for _, t := range transactionsToSave {
-		_, err = stmt.Exec(t.ID, t.BudgetID, t.CategoryID, t.TransactionHash, t.Date, t.Merchant, t.Amount, t.Description, t.AccountType, t.TransactionType, userID, t.CreatedAt, t.UpdatedAt)
+	for _, t := range transactions {
+		if t.MerchantID == nil {
+			merchant, err := resolveMerchant(dbTx, householdID, rawMerchant(t))
+			if err != nil {
+				return nil, err
+			}
+			t.MerchantID = &merchant.ID
+			t.MerchantName = merchant.Name
+		}
+
+		_, err = stmt.Exec(t.ID, t.BudgetID, t.CategoryID, t.TransactionHash, t.Date, t.Merchant, t.MerchantID, t.Amount, t.Description, t.AccountType, t.TransactionType, t.Notes, householdID, userID, t.CreatedBy, t.UpdatedBy, t.CreatedAt, t.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		if len(t.Tags) > 0 {
+			if err := setTransactionTags(dbTx, t.ID, householdID, t.Tags); err != nil {
+				return nil, err
+			}
+		}
+		if err := writeAudit(dbTx, householdID, userID, EntityTransaction, t.ID, AuditActionCreate, nil, t); err != nil {
+			return nil, err
+		}
 		savedTransactions = append(savedTransactions, t)
 	}
 
-	if err := dbTx.Commit(); err != nil {
-		return nil, err
-	}
-
 	return savedTransactions, nil
 }
 
-func UpdateTransaction(id string, userID int, updates map[string]interface{}) (*Transaction, error) {
+// insertNewBudgets creates the budgets prepare built for the transactions'
+// months. A budget whose chunk rolled back doesn't exist yet, so it is
+// created again with the next chunk that uses it.
+func (b *transactionBatch) insertNewBudgets(dbTx *sql.Tx, transactions []Transaction) error {
+	for _, t := range transactions {
+		newBudget, ok := b.newBudgets[t.Date[:7]]
+		if !ok || newBudget.ID != t.BudgetID {
+			continue
+		}
+
+		var exists int
+		err := dbTx.QueryRow("SELECT COUNT(*) FROM budgets WHERE id = ?", newBudget.ID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		if err := insertBudget(dbTx, newBudget, b.householdID, b.userID); err != nil {
+			return err
+		}
+		if err := writeAudit(dbTx, b.householdID, b.userID, EntityBudget, newBudget.ID, AuditActionCreate, nil, newBudget); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateTransaction applies a merge patch to a transaction, a null categoryId
+// uncategorizes it and a null tags removes every tag
+func UpdateTransaction(id string, householdID string, userID int, patch Patch, ifMatch []int) (*Transaction, error) {
 	now := time.Now().Format("2006-01-02 15:04:05")
 
 	tx, err := database.DB.Begin()
@@ -457,52 +768,81 @@ func UpdateTransaction(id string, userID int, updates map[string]interface{}) (*
 	}
 	defer tx.Rollback()
 
-	var t Transaction
-	var categoryID sql.NullString
-	err = tx.QueryRow(`
-		SELECT id, budget_id, category_id, transaction_hash, date, merchant, amount, description, account_type, transaction_type, created_at, updated_at
-		FROM transactions WHERE id = ? AND user_id = ?
-	`, id, userID).Scan(&t.ID, &t.BudgetID, &categoryID, &t.TransactionHash, &t.Date, &t.Merchant, &t.Amount, &t.Description, &t.AccountType, &t.TransactionType, &t.CreatedAt, &t.UpdatedAt)
+	t, err := getTransaction(tx, id, householdID)
 	if err != nil {
 		return nil, err
 	}
-	if categoryID.Valid {
-		t.CategoryID = &categoryID.String
-	}
-
-	if budgetID, ok := updates["budgetId"].(string); ok {
-		t.BudgetID = budgetID
+	if !versionMatches(ifMatch, t.Version) {
+		return nil, ErrVersionMismatch
 	}
-	if categoryIDUpdate, ok := updates["categoryId"].(string); ok {
-		t.CategoryID = &categoryIDUpdate
+	before := *t
+
+	fields := newPatchReader(patch, []string{
+		"budgetId", "categoryId", "date", "merchant", "amount", "description",
+		"accountType", "transactionType", "notes", "tags",
+	}, readOnlyFields)
+	if fields.String("budgetId", &t.BudgetID) {
+		if _, err := getBudget(tx, t.BudgetID, householdID); errors.Is(err, sql.ErrNoRows) {
+			fields.fail("budgetId", "budget not found")
+		} else if err != nil {
+			return nil, err
+		}
 	}
-	if date, ok := updates["date"].(string); ok {
-		t.Date = date
+	if fields.NullableString("categoryId", &t.CategoryID) && t.CategoryID != nil {
+		if _, err := getCategory(tx, *t.CategoryID, householdID); errors.Is(err, sql.ErrNoRows) {
+			fields.fail("categoryId", "category not found")
+		} else if err != nil {
+			return nil, err
+		}
 	}
-	if merchant, ok := updates["merchant"].(string); ok {
-		t.Merchant = merchant
+	if fields.String("date", &t.Date) && !isValidTransactionDate(t.Date) {
+		fields.fail("date", "must be YYYY-MM-DD")
 	}
-	if amount, ok := updates["amount"].(float64); ok {
-		t.Amount = amount
+	fields.String("merchant", &t.Merchant)
+	fields.Float("amount", &t.Amount)
+	fields.String("description", &t.Description)
+	fields.String("accountType", &t.AccountType)
+	if fields.String("transactionType", &t.TransactionType) && !isValidTransactionType(t.TransactionType) {
+		fields.fail("transactionType", "must be DEBIT or CREDIT")
 	}
-	if description, ok := updates["description"].(string); ok {
-		t.Description = description
+	fields.NullableString("notes", &t.Notes)
+	var tags []string
+	tagsChanged := fields.Strings("tags", &tags)
+	if err := fields.err(); err != nil {
+		return nil, err
 	}
-	if accountType, ok := updates["accountType"].(string); ok {
-		t.AccountType = accountType
+
+	if tagsChanged {
+		if err := setTransactionTags(tx, id, householdID, tags); err != nil {
+			return nil, err
+		}
+		t.Tags = normalizeTagNames(tags)
+		if len(t.Tags) == 0 {
+			t.Tags = nil
+		}
 	}
-	if transactionType, ok := updates["transactionType"].(string); ok {
-		t.TransactionType = transactionType
+	if rawMerchant(*t) != rawMerchant(before) {
+		merchant, err := resolveMerchant(tx, householdID, rawMerchant(*t))
+		if err != nil {
+			return nil, err
+		}
+		t.MerchantID = &merchant.ID
+		t.MerchantName = merchant.Name
 	}
 	t.UpdatedAt = now
+	t.UpdatedBy = &userID
+	t.Version++
 
-	_, err = tx.Exec(`
+	result, err := tx.Exec(`
 		UPDATE transactions
-		SET budget_id = ?, category_id = ?, date = ?, merchant = ?, amount = ?, description = ?, account_type = ?, transaction_type = ?, updated_at = ?
-		WHERE id = ?
-	`, t.BudgetID, t.CategoryID, t.Date, t.Merchant, t.Amount, t.Description, t.AccountType, t.TransactionType, t.UpdatedAt, id)
+		SET budget_id = ?, category_id = ?, date = ?, merchant = ?, merchant_id = ?, amount = ?, description = ?, account_type = ?, transaction_type = ?, notes = ?, updated_by = ?, version = ?, updated_at = ?
+		WHERE id = ? AND version = ?
+	`, t.BudgetID, t.CategoryID, t.Date, t.Merchant, t.MerchantID, t.Amount, t.Description, t.AccountType, t.TransactionType, t.Notes, t.UpdatedBy, t.Version, t.UpdatedAt, id, before.Version)
+	if err := checkVersionedUpdate(result, err); err != nil {
+		return nil, err
+	}
 
-	if err != nil {
+	if err := writeAudit(tx, householdID, userID, EntityTransaction, id, AuditActionUpdate, before, t); err != nil {
 		return nil, err
 	}
 
@@ -510,55 +850,58 @@ func UpdateTransaction(id string, userID int, updates map[string]interface{}) (*
 		return nil, err
 	}
 
-	return &t, nil
+	return t, nil
 }
 
-func DeleteTransaction(id string, userID int) error {
-	_, err := database.DB.Exec("DELETE FROM transactions WHERE id = ? AND user_id = ?", id, userID)
-	return err
-}
-
-func DeleteAllTransactions(userID int) error {
-	_, err := database.DB.Exec("DELETE FROM transactions WHERE user_id = ?", userID)
-	return err
-}
-
-func ClearAllBudgetData(userID int) error {
+func DeleteTransaction(id string, householdID string, userID int) error {
 	tx, err := database.DB.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec("DELETE FROM transactions WHERE user_id = ?", userID); err != nil {
+	t, err := getTransaction(tx, id, householdID)
+	if err != nil {
 		return err
 	}
-	if _, err := tx.Exec("DELETE FROM budgets WHERE user_id = ?", userID); err != nil {
+
+	if err := deleteEntity(tx, EntityTransaction, id, householdID); err != nil {
 		return err
 	}
-	if _, err := tx.Exec("DELETE FROM categories WHERE user_id = ?", userID); err != nil {
+	if err := writeAudit(tx, householdID, userID, EntityTransaction, id, AuditActionDelete, t, nil); err != nil {
 		return err
 	}
 
 	return tx.Commit()
 }
 
-func ExportBudgetData(userID int) (string, error) {
+// DeleteAllTransactions moves every transaction to the trash
+func DeleteAllTransactions(householdID string, userID int) (*TrashBatch, error) {
+	return trashEntities(householdID, userID, "delete_all_transactions", []string{EntityTransaction}, false)
+}
+
+// ClearAllBudgetData moves all of the household's transactions, budgets and
+// categories to a single trash batch so the clear can be restored
+func ClearAllBudgetData(householdID string, userID int) (*TrashBatch, error) {
+	return trashEntities(householdID, userID, "clear_all", []string{EntityTransaction, EntityBudget, EntityCategory}, true)
+}
+
+func ExportBudgetData(householdID string) (string, error) {
 	data := make(map[string]interface{})
 
-	categories, err := GetCategories(userID)
+	categories, err := GetCategories(householdID)
 	if err != nil {
 		return "", err
 	}
 	data["categories"] = categories
 
-	budgets, err := GetBudgets(userID)
+	budgets, err := GetBudgets(householdID)
 	if err != nil {
 		return "", err
 	}
 	data["budgets"] = budgets
 
-	transactions, err := GetTransactions(userID)
+	transactions, err := GetTransactions(householdID)
 	if err != nil {
 		return "", err
 	}
@@ -572,7 +915,7 @@ func ExportBudgetData(userID int) (string, error) {
 	return string(jsonData), nil
 }
 
-func ImportBudgetData(jsonData string, userID int) error {
+func ImportBudgetData(jsonData string, householdID string, userID int) error {
 	var data map[string]interface{}
 	if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
 		return err
@@ -591,7 +934,7 @@ func ImportBudgetData(jsonData string, userID int) error {
 			if err := json.Unmarshal(catJSON, &category); err != nil {
 				return err
 			}
-			if _, err := SaveCategory(category, userID); err != nil {
+			if _, err := SaveCategory(category, householdID, userID); err != nil {
 				return err
 			}
 		}
@@ -604,7 +947,7 @@ func ImportBudgetData(jsonData string, userID int) error {
 			if err := json.Unmarshal(budgetJSON, &budget); err != nil {
 				return err
 			}
-			if _, err := SaveBudget(budget, userID); err != nil {
+			if _, err := SaveBudget(budget, householdID, userID); err != nil {
 				return err
 			}
 		}
@@ -620,10 +963,180 @@ func ImportBudgetData(jsonData string, userID int) error {
 			}
 			transactionsList = append(transactionsList, transaction)
 		}
-		if _, err := SaveTransactions(transactionsList, userID); err != nil {
+		if _, err := SaveTransactions(transactionsList, householdID, userID); err != nil {
 			return err
 		}
 	}
 
 	return tx.Commit()
 }
+
+func nullableUserID(id sql.NullInt64) *int {
+	if !id.Valid {
+		return nil
+	}
+	userID := int(id.Int64)
+	return &userID
+}
+
+func trashEntities(householdID string, userID int, operation string, entityTypes []string, includeOther bool) (*TrashBatch, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	batch, err := moveToTrash(tx, householdID, userID, operation, entityTypes, includeOther)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+func GetCategory(id string, householdID string) (*Category, error) {
+	return getCategory(database.DB, id, householdID)
+}
+
+func GetBudget(id string, householdID string) (*Budget, error) {
+	return getBudget(database.DB, id, householdID)
+}
+
+func GetTransaction(id string, householdID string) (*Transaction, error) {
+	return getTransaction(database.DB, id, householdID)
+}
+
+func getCategory(exec execer, id string, householdID string) (*Category, error) {
+	var c Category
+	err := exec.QueryRow(`
+		SELECT id, name, monthly_budget, color, tax_class, version, created_at, updated_at
+		FROM categories WHERE id = ? AND household_id = ?
+	`, id, householdID).Scan(&c.ID, &c.Name, &c.MonthlyBudget, &c.Color, &c.TaxClass, &c.Version, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func getBudget(exec execer, id string, householdID string) (*Budget, error) {
+	var b Budget
+	var allocationsJSON string
+	err := exec.QueryRow(`
+		SELECT id, month, allocations, version, created_at, updated_at
+		FROM budgets WHERE id = ? AND household_id = ?
+	`, id, householdID).Scan(&b.ID, &b.Month, &allocationsJSON, &b.Version, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(allocationsJSON), &b.Allocations); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func getTransaction(exec execer, id string, householdID string) (*Transaction, error) {
+	var t Transaction
+	var categoryID, merchantName sql.NullString
+	var createdBy, updatedBy sql.NullInt64
+	err := exec.QueryRow(`
+		SELECT id, budget_id, category_id, transaction_hash, date, merchant, merchant_id, (SELECT name FROM merchants WHERE id = transactions.merchant_id), amount, description, account_type, transaction_type, notes, created_by, updated_by, version, created_at, updated_at
+		FROM transactions WHERE id = ? AND household_id = ?
+	`, id, householdID).Scan(&t.ID, &t.BudgetID, &categoryID, &t.TransactionHash, &t.Date, &t.Merchant, &t.MerchantID, &merchantName, &t.Amount, &t.Description, &t.AccountType, &t.TransactionType, &t.Notes, &createdBy, &updatedBy, &t.Version, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if categoryID.Valid {
+		t.CategoryID = &categoryID.String
+	}
+	t.MerchantName = merchantName.String
+	t.CreatedBy = nullableUserID(createdBy)
+	t.UpdatedBy = nullableUserID(updatedBy)
+
+	rows, err := exec.Query(`
+		SELECT t.name FROM transaction_tags tt
+		JOIN tags t ON t.id = tt.tag_id
+		WHERE tt.transaction_id = ?
+		ORDER BY t.name
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		t.Tags = append(t.Tags, name)
+	}
+	return &t, rows.Err()
+}
+
+func insertCategory(exec execer, c Category, householdID string, userID int) error {
+	_, err := exec.Exec(`
+		INSERT INTO categories (id, name, monthly_budget, color, tax_class, household_id, user_id, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.ID, c.Name, c.MonthlyBudget, c.Color, c.TaxClass, householdID, userID, max(c.Version, 1), c.CreatedAt, c.UpdatedAt)
+	return err
+}
+
+func insertBudget(exec execer, b Budget, householdID string, userID int) error {
+	allocationsJSON, err := json.Marshal(b.Allocations)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec(`
+		INSERT INTO budgets (id, month, allocations, household_id, user_id, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, b.ID, b.Month, string(allocationsJSON), householdID, userID, max(b.Version, 1), b.CreatedAt, b.UpdatedAt)
+	return err
+}
+
+func insertTransaction(exec execer, t Transaction, householdID string, userID int) error {
+	_, err := exec.Exec(`
+		INSERT INTO transactions (id, budget_id, category_id, transaction_hash, date, merchant, merchant_id, amount, description, account_type, transaction_type, notes, household_id, user_id, created_by, updated_by, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, t.BudgetID, t.CategoryID, t.TransactionHash, t.Date, t.Merchant, t.MerchantID, t.Amount, t.Description, t.AccountType, t.TransactionType, t.Notes, householdID, userID, t.CreatedBy, t.UpdatedBy, max(t.Version, 1), t.CreatedAt, t.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if len(t.Tags) > 0 {
+		return setTransactionTags(exec, t.ID, householdID, t.Tags)
+	}
+	return nil
+}
+
+// versionMatches reports whether version is one an If-Match precondition
+// lists, a nil ifMatch is unconditional
+func versionMatches(ifMatch []int, version int) bool {
+	return ifMatch == nil || slices.Contains(ifMatch, version)
+}
+
+// checkVersionedUpdate reports ErrVersionMismatch when an UPDATE guarded by
+// "AND version = ?" matched no row because a concurrent write got there first
+func checkVersionedUpdate(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+func substr(s string, start int, end int) string {
+	if end > len(s) {
+		end = len(s)
+	}
+	if start > end {
+		return ""
+	}
+	return s[start:end]
+}
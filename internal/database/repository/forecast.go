@@ -0,0 +1,522 @@
+package repository
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// FORECAST_MONTHS_AHEAD is how many months past the current one the forecast covers
+	FORECAST_MONTHS_AHEAD = 3
+	// RECURRING_LOOKBACK_MONTHS is how far back recurring income and bills are detected from
+	RECURRING_LOOKBACK_MONTHS = 6
+	// RECURRING_MIN_MONTHS is the number of distinct months a merchant must appear in to be recurring
+	RECURRING_MIN_MONTHS = 3
+	// RECURRING_MAX_VARIATION is the largest relative deviation from the median amount a recurring item may have
+	RECURRING_MAX_VARIATION = 0.25
+	// VELOCITY_LOOKBACK_DAYS is the window used for the historical daily spending rate
+	VELOCITY_LOOKBACK_DAYS = 90
+)
+
+const (
+	ForecastWarningCategoryOverrun = "category_overrun"
+	ForecastWarningNegativeBalance = "negative_balance"
+)
+
+type RecurringItem struct {
+	Merchant        string  `json:"merchant"`
+	CategoryID      *string `json:"categoryId,omitempty"`
+	TransactionType string  `json:"transactionType"`
+	Amount          float64 `json:"amount"`
+	DayOfMonth      int     `json:"dayOfMonth"`
+	Months          int     `json:"months"`
+	LastDate        string  `json:"lastDate"`
+}
+
+type ForecastDay struct {
+	Date     string  `json:"date"`
+	Income   float64 `json:"income"`
+	Expenses float64 `json:"expenses"`
+	Balance  float64 `json:"balance"`
+}
+
+type CategoryForecast struct {
+	CategoryID *string `json:"categoryId,omitempty"`
+	Name       string  `json:"name"`
+	Spent      float64 `json:"spent"`
+	Projected  float64 `json:"projected"`
+	Budgeted   float64 `json:"budgeted"`
+	DailyRate  float64 `json:"dailyRate"`
+	Overrun    bool    `json:"overrun"`
+}
+
+type ForecastWarning struct {
+	Type       string  `json:"type"`
+	Date       string  `json:"date,omitempty"`
+	CategoryID *string `json:"categoryId,omitempty"`
+	Message    string  `json:"message"`
+}
+
+type Forecast struct {
+	AsOf            string             `json:"asOf"`
+	Through         string             `json:"through"`
+	StartingBalance float64            `json:"startingBalance"`
+	EndingBalance   float64            `json:"endingBalance"`
+	Days            []ForecastDay      `json:"days"`
+	Categories      []CategoryForecast `json:"categories"`
+	Recurring       []RecurringItem    `json:"recurring"`
+	Warnings        []ForecastWarning  `json:"warnings"`
+}
+
+type CategoryBacktest struct {
+	CategoryID *string `json:"categoryId,omitempty"`
+	Name       string  `json:"name"`
+	Projected  float64 `json:"projected"`
+	Actual     float64 `json:"actual"`
+	Error      float64 `json:"error"`
+}
+
+type ForecastBacktest struct {
+	AsOf                 string             `json:"asOf"`
+	MonthEnd             string             `json:"monthEnd"`
+	ProjectedBalance     float64            `json:"projectedBalance"`
+	ActualBalance        float64            `json:"actualBalance"`
+	BalanceError         float64            `json:"balanceError"`
+	Categories           []CategoryBacktest `json:"categories"`
+	CategoryMeanAbsError float64            `json:"categoryMeanAbsError"`
+}
+
+// GetForecast projects the household's balance and category spend from asOf, only
+// using transactions dated on or before asOf so the result can be reproduced
+// for any historical date. A nil startingBalance uses the net of all
+// transactions up to asOf.
+func GetForecast(householdID string, asOf time.Time, startingBalance *float64) (*Forecast, error) {
+	categories, err := GetCategories(householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := GetTransactions(householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets, err := GetBudgets(householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	var budget *Budget
+	for i := range budgets {
+		if budgets[i].Month == asOf.Format("2006-01") {
+			budget = &budgets[i]
+			break
+		}
+	}
+
+	forecast := BuildForecast(transactions, categories, budget, asOf, startingBalance)
+	return &forecast, nil
+}
+
+// BacktestForecast runs the forecast as of a past date and compares the
+// projected end of month against what actually happened
+func BacktestForecast(householdID string, asOf time.Time) (*ForecastBacktest, error) {
+	monthEnd := endOfMonth(asOf)
+	if !monthEnd.Before(startOfDay(time.Now())) {
+		return nil, fmt.Errorf("month of %s has not finished yet", asOf.Format("2006-01-02"))
+	}
+
+	forecast, err := GetForecast(householdID, asOf, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := GetTransactions(householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	month := asOf.Format("2006-01")
+	actualByCategory := make(map[string]float64)
+	actualBalance := forecast.StartingBalance
+	for _, t := range transactions {
+		if len(t.Date) < 10 || t.Date[:7] != month {
+			continue
+		}
+		amount := math.Abs(t.Amount)
+		if t.TransactionType == "DEBIT" {
+			actualByCategory[categoryKey(t.CategoryID)] += amount
+		}
+		if t.Date[:10] > asOf.Format("2006-01-02") {
+			actualBalance += signedAmount(t)
+		}
+	}
+
+	result := &ForecastBacktest{
+		AsOf:          forecast.AsOf,
+		MonthEnd:      monthEnd.Format("2006-01-02"),
+		ActualBalance: roundCents(actualBalance),
+		Categories:    []CategoryBacktest{},
+	}
+	for _, day := range forecast.Days {
+		if day.Date == result.MonthEnd {
+			result.ProjectedBalance = day.Balance
+		}
+	}
+	if asOf.Format("2006-01-02") == result.MonthEnd {
+		result.ProjectedBalance = forecast.StartingBalance
+	}
+	result.BalanceError = roundCents(result.ProjectedBalance - result.ActualBalance)
+
+	var totalError float64
+	for _, cf := range forecast.Categories {
+		actual := roundCents(actualByCategory[categoryKey(cf.CategoryID)])
+		diff := roundCents(cf.Projected - actual)
+		totalError += math.Abs(diff)
+		result.Categories = append(result.Categories, CategoryBacktest{
+			CategoryID: cf.CategoryID,
+			Name:       cf.Name,
+			Projected:  cf.Projected,
+			Actual:     actual,
+			Error:      diff,
+		})
+	}
+	if len(result.Categories) > 0 {
+		result.CategoryMeanAbsError = roundCents(totalError / float64(len(result.Categories)))
+	}
+
+	return result, nil
+}
+
+// BuildForecast is the pure forecasting step behind GetForecast, transactions
+// after asOf are ignored
+func BuildForecast(transactions []Transaction, categories []Category, budget *Budget, asOf time.Time, startingBalance *float64) Forecast {
+	asOf = startOfDay(asOf)
+	asOfDate := asOf.Format("2006-01-02")
+	currentMonth := asOf.Format("2006-01")
+	monthEnd := endOfMonth(asOf)
+	through := endOfMonth(asOf.AddDate(0, FORECAST_MONTHS_AHEAD, 1-asOf.Day()))
+
+	var history []Transaction
+	for _, t := range transactions {
+		if len(t.Date) >= 10 && t.Date[:10] <= asOfDate {
+			history = append(history, t)
+		}
+	}
+
+	balance := 0.0
+	if startingBalance != nil {
+		balance = *startingBalance
+	} else {
+		for _, t := range history {
+			balance += signedAmount(t)
+		}
+	}
+
+	forecast := Forecast{
+		AsOf:            asOfDate,
+		Through:         through.Format("2006-01-02"),
+		StartingBalance: roundCents(balance),
+		Days:            []ForecastDay{},
+		Categories:      []CategoryForecast{},
+		Recurring:       detectRecurring(history, asOf),
+		Warnings:        []ForecastWarning{},
+	}
+
+	recurringKeys := make(map[string]bool)
+	for _, item := range forecast.Recurring {
+		recurringKeys[recurringKey(item.TransactionType, item.Merchant)] = true
+	}
+
+	// Spend so far this month and the discretionary (non-recurring) part of it
+	spentThisMonth := make(map[string]float64)
+	discretionaryThisMonth := make(map[string]float64)
+	seenThisMonth := make(map[string]bool)
+	historicalSpend := make(map[string]float64)
+	velocityStart := asOf.AddDate(0, 0, -VELOCITY_LOOKBACK_DAYS).Format("2006-01-02")
+	for _, t := range history {
+		key := recurringKey(t.TransactionType, cleanMerchantName(t))
+		isRecurring := recurringKeys[key]
+		if t.Date[:7] == currentMonth {
+			seenThisMonth[key] = true
+		}
+		if t.TransactionType != "DEBIT" {
+			continue
+		}
+		category := categoryKey(t.CategoryID)
+		amount := math.Abs(t.Amount)
+		if t.Date[:7] == currentMonth {
+			spentThisMonth[category] += amount
+			if !isRecurring {
+				discretionaryThisMonth[category] += amount
+			}
+		}
+		if !isRecurring && t.Date[:10] > velocityStart {
+			historicalSpend[category] += amount
+		}
+	}
+
+	// Blend this month's velocity with the historical rate, trusting the
+	// current month more the further into it we are
+	daysInMonth := float64(monthEnd.Day())
+	elapsed := float64(asOf.Day())
+	monthWeight := elapsed / daysInMonth
+	currentRates := make(map[string]float64)
+	futureRates := make(map[string]float64)
+	categoryKeys := make(map[string]bool)
+	for key := range spentThisMonth {
+		categoryKeys[key] = true
+	}
+	for key := range historicalSpend {
+		categoryKeys[key] = true
+	}
+	for _, cat := range categories {
+		categoryKeys[cat.ID] = true
+	}
+	sortedKeys := make([]string, 0, len(categoryKeys))
+	for key := range categoryKeys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+	for _, key := range sortedKeys {
+		historicalRate := historicalSpend[key] / VELOCITY_LOOKBACK_DAYS
+		currentVelocity := discretionaryThisMonth[key] / elapsed
+		currentRates[key] = monthWeight*currentVelocity + (1-monthWeight)*historicalRate
+		futureRates[key] = historicalRate
+	}
+
+	// Walk forward day by day
+	projectedMonthSpend := make(map[string]float64)
+	for key, amount := range spentThisMonth {
+		projectedMonthSpend[key] = amount
+	}
+	negativeWarned := false
+	for day := asOf.AddDate(0, 0, 1); !day.After(through); day = day.AddDate(0, 0, 1) {
+		inCurrentMonth := !day.After(monthEnd)
+		rates := futureRates
+		if inCurrentMonth {
+			rates = currentRates
+		}
+
+		var income, expenses float64
+		for _, key := range sortedKeys {
+			rate := rates[key]
+			expenses += rate
+			if inCurrentMonth {
+				projectedMonthSpend[key] += rate
+			}
+		}
+
+		for _, item := range forecast.Recurring {
+			if day.Day() != min(item.DayOfMonth, endOfMonth(day).Day()) {
+				continue
+			}
+			key := recurringKey(item.TransactionType, item.Merchant)
+			if inCurrentMonth && seenThisMonth[key] {
+				continue
+			}
+			if item.TransactionType == "CREDIT" {
+				income += item.Amount
+			} else {
+				expenses += item.Amount
+				if inCurrentMonth {
+					projectedMonthSpend[categoryKey(item.CategoryID)] += item.Amount
+				}
+			}
+		}
+
+		balance += income - expenses
+		date := day.Format("2006-01-02")
+		forecast.Days = append(forecast.Days, ForecastDay{
+			Date:     date,
+			Income:   roundCents(income),
+			Expenses: roundCents(expenses),
+			Balance:  roundCents(balance),
+		})
+
+		if balance < 0 && !negativeWarned {
+			negativeWarned = true
+			forecast.Warnings = append(forecast.Warnings, ForecastWarning{
+				Type:    ForecastWarningNegativeBalance,
+				Date:    date,
+				Message: fmt.Sprintf("Balance is projected to go negative on %s", date),
+			})
+		}
+	}
+	forecast.EndingBalance = roundCents(balance)
+
+	// End-of-month category projections
+	categoryNames := make(map[string]string)
+	for _, cat := range categories {
+		categoryNames[cat.ID] = cat.Name
+	}
+	for _, key := range sortedKeys {
+		name, ok := categoryNames[key]
+		var categoryID *string
+		if key == "" {
+			name = "Uncategorized"
+		} else {
+			id := key
+			categoryID = &id
+			if !ok {
+				name = key
+			}
+		}
+
+		budgeted := 0.0
+		if budget != nil {
+			budgeted = budget.Allocations[key]
+		}
+
+		cf := CategoryForecast{
+			CategoryID: categoryID,
+			Name:       name,
+			Spent:      roundCents(spentThisMonth[key]),
+			Projected:  roundCents(projectedMonthSpend[key]),
+			Budgeted:   budgeted,
+			DailyRate:  roundCents(currentRates[key]),
+		}
+		cf.Overrun = budgeted > 0 && cf.Projected > budgeted
+		forecast.Categories = append(forecast.Categories, cf)
+
+		if cf.Overrun {
+			forecast.Warnings = append(forecast.Warnings, ForecastWarning{
+				Type:       ForecastWarningCategoryOverrun,
+				Date:       monthEnd.Format("2006-01-02"),
+				CategoryID: categoryID,
+				Message:    fmt.Sprintf("%s is projected to reach $%.2f against a budget of $%.2f", name, cf.Projected, budgeted),
+			})
+		}
+	}
+	sort.Slice(forecast.Categories, func(i, j int) bool {
+		return forecast.Categories[i].Name < forecast.Categories[j].Name
+	})
+	sort.SliceStable(forecast.Warnings, func(i, j int) bool {
+		return forecast.Warnings[i].Date < forecast.Warnings[j].Date
+	})
+
+	return forecast
+}
+
+// detectRecurring finds merchants that charge or pay a similar amount in at
+// least RECURRING_MIN_MONTHS distinct months of the lookback window and that
+// are still active
+func detectRecurring(history []Transaction, asOf time.Time) []RecurringItem {
+	windowStart := asOf.AddDate(0, -RECURRING_LOOKBACK_MONTHS, 0).Format("2006-01-02")
+	activeSince := asOf.AddDate(0, -2, 0).Format("2006-01-02")
+
+	groups := make(map[string][]Transaction)
+	var keys []string
+	for _, t := range history {
+		if t.Date[:10] <= windowStart {
+			continue
+		}
+		key := recurringKey(t.TransactionType, cleanMerchantName(t))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], t)
+	}
+	sort.Strings(keys)
+
+	items := []RecurringItem{}
+	for _, key := range keys {
+		group := groups[key]
+		sort.Slice(group, func(i, j int) bool { return group[i].Date < group[j].Date })
+
+		months := make(map[string]bool)
+		amounts := make([]float64, 0, len(group))
+		days := make([]float64, 0, len(group))
+		for _, t := range group {
+			months[t.Date[:7]] = true
+			amounts = append(amounts, math.Abs(t.Amount))
+			day, err := time.Parse("2006-01-02", t.Date[:10])
+			if err == nil {
+				days = append(days, float64(day.Day()))
+			}
+		}
+
+		// Roughly one occurrence per month in enough months
+		if len(months) < RECURRING_MIN_MONTHS || float64(len(group)) > float64(len(months))*1.5 {
+			continue
+		}
+
+		last := group[len(group)-1]
+		if last.Date[:10] < activeSince {
+			continue
+		}
+
+		amount := median(amounts)
+		if amount == 0 {
+			continue
+		}
+		consistent := true
+		for _, a := range amounts {
+			if math.Abs(a-amount)/amount > RECURRING_MAX_VARIATION {
+				consistent = false
+				break
+			}
+		}
+		if !consistent {
+			continue
+		}
+
+		items = append(items, RecurringItem{
+			Merchant:        cleanMerchantName(last),
+			CategoryID:      last.CategoryID,
+			TransactionType: last.TransactionType,
+			Amount:          roundCents(amount),
+			DayOfMonth:      int(median(days)),
+			Months:          len(months),
+			LastDate:        last.Date[:10],
+		})
+	}
+	return items
+}
+
+// Helpers
+func signedAmount(t Transaction) float64 {
+	if t.TransactionType == "CREDIT" {
+		return math.Abs(t.Amount)
+	}
+	return -math.Abs(t.Amount)
+}
+
+func categoryKey(categoryID *string) string {
+	if categoryID == nil {
+		return ""
+	}
+	return *categoryID
+}
+
+func recurringKey(transactionType, merchant string) string {
+	return transactionType + "|" + strings.ToLower(merchant)
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func endOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// charges builds one transaction per date from a merchant for amount
+func charges(merchant, transactionType string, amount float64, dates ...string) []Transaction {
+	transactions := make([]Transaction, len(dates))
+	for i, date := range dates {
+		transactions[i] = Transaction{
+			Date:            date,
+			MerchantName:    merchant,
+			Amount:          amount,
+			TransactionType: transactionType,
+		}
+	}
+	return transactions
+}
+
+func mustDate(t *testing.T, date string) time.Time {
+	t.Helper()
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return day
+}
+
+func TestDetectRecurring(t *testing.T) {
+	irregular := charges("Restaurant", "DEBIT", 20, "2025-01-09", "2025-02-14", "2025-03-02", "2025-04-20", "2025-05-11")
+	for i, amount := range []float64{20, 140, 35, 90, 210} {
+		irregular[i].Amount = amount
+	}
+
+	tests := []struct {
+		name    string
+		history []Transaction
+		want    []RecurringItem
+	}{
+		{
+			name: "monthly",
+			history: charges("Rent", "DEBIT", 1500,
+				"2025-01-01", "2025-02-01", "2025-03-01", "2025-04-01", "2025-05-01", "2025-06-01"),
+			want: []RecurringItem{{
+				Merchant: "Rent", TransactionType: "DEBIT", Amount: 1500, DayOfMonth: 1, Months: 6, LastDate: "2025-06-01",
+			}},
+		},
+		{
+			name: "monthly within the allowed variation",
+			history: charges("Hydro", "DEBIT", 80,
+				"2025-03-18", "2025-04-17", "2025-05-19"),
+			want: []RecurringItem{{
+				Merchant: "Hydro", TransactionType: "DEBIT", Amount: 80, DayOfMonth: 18, Months: 3, LastDate: "2025-05-19",
+			}},
+		},
+		{
+			// Twice a month isn't a monthly recurring item
+			name: "biweekly",
+			history: charges("Payroll", "CREDIT", 2000,
+				"2025-03-07", "2025-03-21", "2025-04-04", "2025-04-18", "2025-05-02", "2025-05-16", "2025-05-30", "2025-06-13"),
+			want: []RecurringItem{},
+		},
+		{
+			name:    "irregular amounts",
+			history: irregular,
+			want:    []RecurringItem{},
+		},
+		{
+			name:    "too few months",
+			history: charges("Streaming", "DEBIT", 15, "2025-05-03", "2025-06-03"),
+			want:    []RecurringItem{},
+		},
+		{
+			name:    "no longer active",
+			history: charges("Old Gym", "DEBIT", 50, "2025-01-10", "2025-02-10", "2025-03-10"),
+			want:    []RecurringItem{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectRecurring(tt.history, mustDate(t, "2025-06-15"))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectRecurring = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildForecastMonthBoundaries(t *testing.T) {
+	// A bill charged on the last day of every month
+	fitness := "fitness"
+	categories := []Category{{ID: fitness, Name: "Fitness"}}
+	gym := charges("Gym", "DEBIT", 100, "2024-08-31", "2024-09-30", "2024-10-31", "2024-11-30", "2024-12-31", "2025-01-31")
+	for i := range gym {
+		gym[i].CategoryID = &fitness
+	}
+	beforeJanuary := gym[:5]
+
+	tests := []struct {
+		name        string
+		asOf        string
+		history     []Transaction
+		wantFirst   string
+		wantThrough string
+		wantCharges []string
+		wantMonth   float64 // projected spend for the month of asOf
+	}{
+		{
+			name:        "day before the month ends",
+			asOf:        "2025-01-30",
+			history:     beforeJanuary,
+			wantFirst:   "2025-01-31",
+			wantThrough: "2025-04-30",
+			wantCharges: []string{"2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30"},
+			wantMonth:   100,
+		},
+		{
+			// Already charged this month, the projection starts in the next
+			name:        "last day of the month",
+			asOf:        "2025-01-31",
+			history:     gym,
+			wantFirst:   "2025-02-01",
+			wantThrough: "2025-04-30",
+			wantCharges: []string{"2025-02-28", "2025-03-31", "2025-04-30"},
+			wantMonth:   100,
+		},
+		{
+			name:        "first day of a short month",
+			asOf:        "2025-02-01",
+			history:     gym,
+			wantFirst:   "2025-02-02",
+			wantThrough: "2025-05-31",
+			wantCharges: []string{"2025-02-28", "2025-03-31", "2025-04-30", "2025-05-31"},
+			wantMonth:   100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startingBalance := 1000.0
+			forecast := BuildForecast(tt.history, categories, nil, mustDate(t, tt.asOf), &startingBalance)
+
+			if len(forecast.Days) == 0 || forecast.Days[0].Date != tt.wantFirst || forecast.Through != tt.wantThrough {
+				t.Fatalf("forecast runs %v through %s, want %s through %s", forecast.Days[:min(1, len(forecast.Days))], forecast.Through, tt.wantFirst, tt.wantThrough)
+			}
+			if last := forecast.Days[len(forecast.Days)-1].Date; last != tt.wantThrough {
+				t.Errorf("last day = %s, want %s", last, tt.wantThrough)
+			}
+
+			var charged []string
+			for _, day := range forecast.Days {
+				if day.Expenses != 0 {
+					charged = append(charged, day.Date)
+				}
+			}
+			if !reflect.DeepEqual(charged, tt.wantCharges) {
+				t.Errorf("charged on %v, want %v", charged, tt.wantCharges)
+			}
+			if want := 1000 - 100*float64(len(tt.wantCharges)); forecast.EndingBalance != want {
+				t.Errorf("ending balance = %.2f, want %.2f", forecast.EndingBalance, want)
+			}
+
+			if len(forecast.Categories) != 1 || forecast.Categories[0].Projected != tt.wantMonth {
+				t.Errorf("categories = %+v, want Fitness projected at %.2f", forecast.Categories, tt.wantMonth)
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+package repository
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+const INVITATION_TTL = 7 * 24 * time.Hour
+
+var ErrInvitationNotFound = errors.New("invitation not found or expired")
+var ErrLastOwner = errors.New("a household must keep at least one owner")
+
+type Household struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role,omitempty"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type HouseholdMember struct {
+	HouseholdID string `json:"householdId"`
+	UserID      int    `json:"userId"`
+	Email       string `json:"email"`
+	Role        string `json:"role"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+type HouseholdInvitation struct {
+	ID          string  `json:"id"`
+	HouseholdID string  `json:"householdId"`
+	Household   string  `json:"household,omitempty"`
+	Email       string  `json:"email"`
+	Role        string  `json:"role"`
+	Token       string  `json:"token,omitempty"`
+	InvitedBy   *int    `json:"invitedBy,omitempty"`
+	CreatedAt   string  `json:"createdAt"`
+	ExpiresAt   string  `json:"expiresAt"`
+	AcceptedAt  *string `json:"acceptedAt,omitempty"`
+}
+
+// roleRank orders roles so permissions can be compared, unknown roles rank lowest
+func roleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 3
+	case RoleEditor:
+		return 2
+	case RoleViewer:
+		return 1
+	}
+	return 0
+}
+
+func IsValidRole(role string) bool {
+	return roleRank(role) > 0
+}
+
+// HasRole reports whether role grants at least the permissions of required
+func HasRole(role string, required string) bool {
+	return roleRank(role) >= roleRank(required)
+}
+
+func CreateHousehold(name string, ownerID int) (*Household, error) {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	household := Household{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Role:      RoleOwner,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO households (id, name, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+	`, household.ID, household.Name, household.CreatedAt, household.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO household_members (household_id, user_id, role, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, household.ID, ownerID, RoleOwner, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &household, nil
+}
+
+// GetUserHouseholds returns every household the user belongs to with the user's role,
+// owned households first
+func GetUserHouseholds(userID int) ([]Household, error) {
+	rows, err := database.DB.Query(`
+		SELECT h.id, h.name, m.role, h.created_at, h.updated_at
+		FROM households h
+		JOIN household_members m ON m.household_id = h.id
+		WHERE m.user_id = ?
+		ORDER BY CASE m.role WHEN 'owner' THEN 0 ELSE 1 END, h.created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	households := []Household{}
+	for rows.Next() {
+		var h Household
+		if err := rows.Scan(&h.ID, &h.Name, &h.Role, &h.CreatedAt, &h.UpdatedAt); err != nil {
+			return nil, err
+		}
+		households = append(households, h)
+	}
+	return households, rows.Err()
+}
+
+// GetHouseholdMembership returns the user's membership in a household. An empty
+// householdID resolves to the user's default household.
+func GetHouseholdMembership(userID int, householdID string) (*HouseholdMember, error) {
+	if householdID == "" {
+		households, err := GetUserHouseholds(userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(households) == 0 {
+			return nil, sql.ErrNoRows
+		}
+		householdID = households[0].ID
+	}
+
+	var member HouseholdMember
+	err := database.DB.QueryRow(`
+		SELECT m.household_id, m.user_id, u.email, m.role, m.created_at
+		FROM household_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.household_id = ? AND m.user_id = ?
+	`, householdID, userID).Scan(&member.HouseholdID, &member.UserID, &member.Email, &member.Role, &member.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetHouseholdMembers(householdID string) ([]HouseholdMember, error) {
+	rows, err := database.DB.Query(`
+		SELECT m.household_id, m.user_id, u.email, m.role, m.created_at
+		FROM household_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.household_id = ?
+		ORDER BY m.created_at
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []HouseholdMember{}
+	for rows.Next() {
+		var m HouseholdMember
+		if err := rows.Scan(&m.HouseholdID, &m.UserID, &m.Email, &m.Role, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func UpdateHouseholdMemberRole(householdID string, userID int, role string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != RoleOwner {
+		if err := ensureAnotherOwner(tx, householdID, userID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	result, err := tx.Exec(`
+		UPDATE household_members SET role = ?, updated_at = ?
+		WHERE household_id = ? AND user_id = ?
+	`, role, now, householdID, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func RemoveHouseholdMember(householdID string, userID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ensureAnotherOwner(tx, householdID, userID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM household_members WHERE household_id = ? AND user_id = ?", householdID, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// GetHouseholdOwners returns every household with the user ID of its earliest owner
+func GetHouseholdOwners() (map[string]int, error) {
+	rows, err := database.DB.Query(`
+		SELECT household_id, user_id
+		FROM household_members
+		WHERE role = 'owner'
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners := make(map[string]int)
+	for rows.Next() {
+		var householdID string
+		var userID int
+		if err := rows.Scan(&householdID, &userID); err != nil {
+			return nil, err
+		}
+		owners[householdID] = userID
+	}
+	return owners, rows.Err()
+}
+
+func CreateHouseholdInvitation(householdID, email, role string, invitedBy int) (*HouseholdInvitation, error) {
+	tokenBytes := make([]byte, 24)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invitedByID := invitedBy
+	invitation := HouseholdInvitation{
+		ID:          uuid.New().String(),
+		HouseholdID: householdID,
+		Email:       strings.ToLower(strings.TrimSpace(email)),
+		Role:        role,
+		Token:       hex.EncodeToString(tokenBytes),
+		InvitedBy:   &invitedByID,
+		CreatedAt:   now.Format("2006-01-02 15:04:05"),
+		ExpiresAt:   now.Add(INVITATION_TTL).Format("2006-01-02 15:04:05"),
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO household_invitations (id, household_id, email, role, token, invited_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, invitation.ID, invitation.HouseholdID, invitation.Email, invitation.Role, invitation.Token, invitation.InvitedBy, invitation.CreatedAt, invitation.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetHouseholdInvitations returns the pending invitations of a household
+func GetHouseholdInvitations(householdID string) ([]HouseholdInvitation, error) {
+	return queryInvitations(`
+		SELECT i.id, i.household_id, h.name, i.email, i.role, i.token, i.invited_by, i.created_at, i.expires_at, i.accepted_at
+		FROM household_invitations i
+		JOIN households h ON h.id = i.household_id
+		WHERE i.household_id = ? AND i.accepted_at IS NULL AND i.expires_at > ?
+		ORDER BY i.created_at DESC
+	`, householdID, time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// GetInvitationsForEmail returns the pending invitations sent to an email address,
+// tokens are included so the invitee can accept them
+func GetInvitationsForEmail(email string) ([]HouseholdInvitation, error) {
+	return queryInvitations(`
+		SELECT i.id, i.household_id, h.name, i.email, i.role, i.token, i.invited_by, i.created_at, i.expires_at, i.accepted_at
+		FROM household_invitations i
+		JOIN households h ON h.id = i.household_id
+		WHERE i.email = ? AND i.accepted_at IS NULL AND i.expires_at > ?
+		ORDER BY i.created_at DESC
+	`, strings.ToLower(strings.TrimSpace(email)), time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// HasPendingInvitation reports whether an email address has an invitation it can still accept
+func HasPendingInvitation(email string) bool {
+	invitations, err := GetInvitationsForEmail(email)
+	return err == nil && len(invitations) > 0
+}
+
+func RevokeHouseholdInvitation(householdID, invitationID string) error {
+	result, err := database.DB.Exec(`
+		DELETE FROM household_invitations
+		WHERE id = ? AND household_id = ? AND accepted_at IS NULL
+	`, invitationID, householdID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// AcceptHouseholdInvitation adds the user to the invitation's household. The
+// invitation must have been sent to the user's email address.
+func AcceptHouseholdInvitation(token string, userID int, email string) (*Household, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	var invitationID, householdID, role string
+	err = tx.QueryRow(`
+		SELECT id, household_id, role
+		FROM household_invitations
+		WHERE token = ? AND email = ? AND accepted_at IS NULL AND expires_at > ?
+	`, token, strings.ToLower(strings.TrimSpace(email)), now).Scan(&invitationID, &householdID, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Re-accepting never downgrades an existing membership
+	var existingRole string
+	err = tx.QueryRow("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?", householdID, userID).Scan(&existingRole)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.Exec(`
+			INSERT INTO household_members (household_id, user_id, role, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+		`, householdID, userID, role, now, now)
+	case err == nil && !HasRole(existingRole, role):
+		_, err = tx.Exec("UPDATE household_members SET role = ?, updated_at = ? WHERE household_id = ? AND user_id = ?", role, now, householdID, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("UPDATE household_invitations SET accepted_at = ? WHERE id = ?", now, invitationID); err != nil {
+		return nil, err
+	}
+
+	var household Household
+	err = tx.QueryRow("SELECT id, name, created_at, updated_at FROM households WHERE id = ?", householdID).
+		Scan(&household.ID, &household.Name, &household.CreatedAt, &household.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	membership, err := GetHouseholdMembership(userID, householdID)
+	if err != nil {
+		return nil, err
+	}
+	household.Role = membership.Role
+	return &household, nil
+}
+
+// Helpers
+func queryInvitations(query string, args ...interface{}) ([]HouseholdInvitation, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []HouseholdInvitation{}
+	for rows.Next() {
+		var i HouseholdInvitation
+		var invitedBy sql.NullInt64
+		var acceptedAt sql.NullString
+		if err := rows.Scan(&i.ID, &i.HouseholdID, &i.Household, &i.Email, &i.Role, &i.Token, &invitedBy, &i.CreatedAt, &i.ExpiresAt, &acceptedAt); err != nil {
+			return nil, err
+		}
+		if invitedBy.Valid {
+			id := int(invitedBy.Int64)
+			i.InvitedBy = &id
+		}
+		if acceptedAt.Valid {
+			i.AcceptedAt = &acceptedAt.String
+		}
+		invitations = append(invitations, i)
+	}
+	return invitations, rows.Err()
+}
+
+// ensureAnotherOwner fails if userID is the household's only owner
+func ensureAnotherOwner(tx *sql.Tx, householdID string, userID int) error {
+	var otherOwners int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM household_members
+		WHERE household_id = ? AND role = 'owner' AND user_id != ?
+	`, householdID, userID).Scan(&otherOwners)
+	if err != nil {
+		return err
+	}
+
+	var role string
+	err = tx.QueryRow("SELECT role FROM household_members WHERE household_id = ? AND user_id = ?", householdID, userID).Scan(&role)
+	if err != nil {
+		return err
+	}
+
+	if role == RoleOwner && otherOwners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
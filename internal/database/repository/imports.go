@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	IMPORT_CHUNK_SIZE = 500
+
+	ImportStatusActive    = "active"
+	ImportStatusCompleted = "completed"
+)
+
+var ErrImportCompleted = errors.New("import session is already completed")
+var ErrImportOffsetGap = errors.New("offset is past the last committed line")
+var ErrImportConflict = errors.New("import session was advanced by another request")
+
+type ImportSession struct {
+	Token          string  `json:"token"`
+	Status         string  `json:"status"`
+	LinesCommitted int     `json:"linesCommitted"`
+	RowsInserted   int     `json:"rowsInserted"`
+	RowsSkipped    int     `json:"rowsSkipped"`
+	CreatedAt      string  `json:"createdAt"`
+	UpdatedAt      string  `json:"updatedAt"`
+	CompletedAt    *string `json:"completedAt,omitempty"`
+}
+
+// ImportProgress is reported after every committed chunk
+type ImportProgress struct {
+	LinesCommitted int `json:"linesCommitted"`
+	RowsInserted   int `json:"rowsInserted"`
+	RowsSkipped    int `json:"rowsSkipped"`
+}
+
+// ImportLineError points at the NDJSON line that could not be imported,
+// everything before it has been committed
+type ImportLineError struct {
+	Line int
+	Err  error
+}
+
+func (e *ImportLineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ImportLineError) Unwrap() error {
+	return e.Err
+}
+
+func CreateImportSession(householdID string, userID int) (*ImportSession, error) {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	session := ImportSession{
+		Token:     uuid.New().String(),
+		Status:    ImportStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO import_sessions (token, household_id, user_id, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, session.Token, householdID, userID, session.Status, session.CreatedAt, session.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func GetImportSession(token string, householdID string) (*ImportSession, error) {
+	var s ImportSession
+	err := database.DB.QueryRow(`
+		SELECT token, status, lines_committed, rows_inserted, rows_skipped, created_at, updated_at, completed_at
+		FROM import_sessions WHERE token = ? AND household_id = ?
+	`, token, householdID).Scan(&s.Token, &s.Status, &s.LinesCommitted, &s.RowsInserted, &s.RowsSkipped, &s.CreatedAt, &s.UpdatedAt, &s.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func CompleteImportSession(token string, householdID string) (*ImportSession, error) {
+	session, err := GetImportSession(token, householdID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status == ImportStatusCompleted {
+		return session, nil
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	_, err = database.DB.Exec(`
+		UPDATE import_sessions SET status = ?, completed_at = ?, updated_at = ?
+		WHERE token = ?
+	`, ImportStatusCompleted, now, now, token)
+	if err != nil {
+		return nil, err
+	}
+
+	session.Status = ImportStatusCompleted
+	session.CompletedAt = &now
+	session.UpdatedAt = now
+	return session, nil
+}
+
+// ImportTransactionsStream decodes one transaction per line from r and saves
+// them in chunks of IMPORT_CHUNK_SIZE, each chunk is committed together with
+// the session's line count. offset is the line number of r's first line so a
+// client that lost its connection can resend from any point at or before the
+// last committed line, lines already committed are skipped rather than
+// inserted twice. Transactions whose hash already exists are skipped too.
+func ImportTransactionsStream(token string, householdID string, userID int, offset int, r io.Reader, progress func(ImportProgress)) (*ImportSession, error) {
+	session, err := GetImportSession(token, householdID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != ImportStatusActive {
+		return nil, ErrImportCompleted
+	}
+	if offset < 0 || offset > session.LinesCommitted {
+		return nil, ErrImportOffsetGap
+	}
+
+	batch, err := newTransactionBatch(householdID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(r)
+	line := offset
+	chunk := []Transaction{}
+	for {
+		raw, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return session, readErr
+		}
+		if len(raw) == 0 && readErr == io.EOF {
+			break
+		}
+
+		if line >= session.LinesCommitted {
+			raw = bytes.TrimSpace(raw)
+			if len(raw) > 0 {
+				var t Transaction
+				if err := json.Unmarshal(raw, &t); err != nil {
+					return session, &ImportLineError{Line: line, Err: err}
+				}
+				if _, err := time.Parse("2006-01", substr(t.Date, 0, 7)); err != nil {
+					return session, &ImportLineError{Line: line, Err: fmt.Errorf("%w: %q", ErrInvalidTransactionDate, t.Date)}
+				}
+				chunk = append(chunk, t)
+			}
+		}
+		line++
+
+		if len(chunk) >= IMPORT_CHUNK_SIZE {
+			if err := commitImportChunk(batch, session, chunk, line); err != nil {
+				return session, err
+			}
+			chunk = chunk[:0]
+			if progress != nil {
+				progress(session.progress())
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if line > session.LinesCommitted {
+		if err := commitImportChunk(batch, session, chunk, line); err != nil {
+			return session, err
+		}
+		if progress != nil {
+			progress(session.progress())
+		}
+	}
+
+	return session, nil
+}
+
+// commitImportChunk saves chunk and advances the session to linesCommitted in
+// one transaction. The update is conditional on the session still being
+// where this request left it so two concurrent uploads can't both insert.
+func commitImportChunk(batch *transactionBatch, session *ImportSession, chunk []Transaction, linesCommitted int) error {
+	toSave := []Transaction{}
+	seen := make(map[string]bool)
+	for _, t := range chunk {
+		if t.TransactionHash != "" {
+			if seen[t.TransactionHash] || transactionHashExists(batch.householdID, t.TransactionHash) {
+				continue
+			}
+			seen[t.TransactionHash] = true
+		}
+		toSave = append(toSave, t)
+	}
+	skipped := len(chunk) - len(toSave)
+
+	prepared, err := batch.prepare(toSave)
+	if err != nil {
+		return err
+	}
+
+	dbTx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer dbTx.Rollback()
+
+	if _, err := batch.insert(dbTx, prepared); err != nil {
+		return err
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	result, err := dbTx.Exec(`
+		UPDATE import_sessions
+		SET lines_committed = ?, rows_inserted = rows_inserted + ?, rows_skipped = rows_skipped + ?, updated_at = ?
+		WHERE token = ? AND lines_committed = ? AND status = ?
+	`, linesCommitted, len(prepared), skipped, now, session.Token, session.LinesCommitted, ImportStatusActive)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrImportConflict
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return err
+	}
+
+	session.LinesCommitted = linesCommitted
+	session.RowsInserted += len(prepared)
+	session.RowsSkipped += skipped
+	session.UpdatedAt = now
+	return nil
+}
+
+func transactionHashExists(householdID string, hash string) bool {
+	var exists int
+	err := database.DB.QueryRow("SELECT 1 FROM transactions WHERE household_id = ? AND transaction_hash = ? LIMIT 1", householdID, hash).Scan(&exists)
+	return err == nil
+}
+
+func (s *ImportSession) progress() ImportProgress {
+	return ImportProgress{
+		LinesCommitted: s.LinesCommitted,
+		RowsInserted:   s.RowsInserted,
+		RowsSkipped:    s.RowsSkipped,
+	}
+}
@@ -0,0 +1,577 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"api.alexmontague.ca/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidMerchantName = errors.New("merchant name is required")
+var ErrMerchantAliasTaken = errors.New("another merchant already matches this name, move its alias to this merchant instead")
+
+// processorPrefix matches payment processor prefixes like "SQ *" or "TST* "
+var processorPrefix = regexp.MustCompile(`^(?:SQ|SQU|TST|SP|PP|PAYPAL|IC|PY|WPY|SUMUP|ZTL|CKE|LS|FSP|BT|PAR|CLV)\s*\*\s*`)
+
+// domainSuffix matches the TLD of merchants billed by domain, "NETFLIX.COM"
+var domainSuffix = regexp.MustCompile(`\.(?:COM|CA|NET|ORG|IO)\b`)
+
+// storeNumber matches "#123", "1234" and other tokens that are only a store number
+var storeNumber = regexp.MustCompile(`^#?\d+$`)
+
+var storeNumberLabels = map[string]bool{"STORE": true, "STR": true, "NO": true, "NO.": true, "UNIT": true, "LOC": true}
+
+// regionCodes are trailing province, state and country codes, always location
+var regionCodes = map[string]bool{
+	"AB": true, "BC": true, "MB": true, "NB": true, "NL": true, "NS": true, "NT": true, "NU": true,
+	"ON": true, "PE": true, "QC": true, "SK": true, "YT": true, "CA": true, "US": true,
+	// Common US states seen on cross-border purchases
+	"NY": true, "WA": true, "FL": true, "TX": true, "IL": true, "MA": true, "MI": true,
+}
+
+// countries are also part of merchant names, "AIR CANADA"
+var countries = map[string]bool{"CAN": true, "CANADA": true, "USA": true}
+
+// cities are stripped from the end of merchant names, multi-word cities are
+// matched as a whole
+var cities = map[string]bool{
+	"TORONTO": true, "MONTREAL": true, "VANCOUVER": true, "OTTAWA": true, "CALGARY": true,
+	"EDMONTON": true, "WINNIPEG": true, "HAMILTON": true, "KITCHENER": true, "WATERLOO": true,
+	"LONDON": true, "HALIFAX": true, "VICTORIA": true, "MISSISSAUGA": true, "BRAMPTON": true,
+	"MARKHAM": true, "VAUGHAN": true, "OAKVILLE": true, "BURLINGTON": true, "GUELPH": true,
+	"KINGSTON": true, "REGINA": true, "SASKATOON": true, "ETOBICOKE": true, "SCARBOROUGH": true,
+	"RICHMOND": true, "BURNABY": true, "SURREY": true, "GATINEAU": true, "LAVAL": true,
+	"NORTH YORK": true, "QUEBEC CITY": true, "ST. JOHN'S": true, "RICHMOND HILL": true,
+	"NEW YORK": true, "SAN FRANCISCO": true, "LOS ANGELES": true, "SEATTLE": true, "CHICAGO": true,
+	"BOSTON": true, "MIAMI": true, "DETROIT": true, "BUFFALO": true,
+}
+
+// nameConnectors lead into a place that is part of the name, "BANK OF MONTREAL"
+var nameConnectors = map[string]bool{"OF": true, "DE": true, "DU": true, "DES": true, "&": true, "AND": true, "THE": true}
+
+type Merchant struct {
+	ID               string   `json:"id"`
+	Name             string   `json:"name"`
+	CategoryID       *string  `json:"categoryId,omitempty"` // applied to new transactions from this merchant
+	Aliases          []string `json:"aliases"`
+	TransactionCount int      `json:"transactionCount"`
+	TotalSpent       float64  `json:"totalSpent"`
+	LastDate         string   `json:"lastDate,omitempty"`
+	CreatedAt        string   `json:"createdAt"`
+	UpdatedAt        string   `json:"updatedAt"`
+}
+
+type MerchantMonth struct {
+	Month            string  `json:"month"`
+	Spent            float64 `json:"spent"`
+	Income           float64 `json:"income"`
+	TransactionCount int     `json:"transactionCount"`
+}
+
+type MerchantHistory struct {
+	Merchant     Merchant           `json:"merchant"`
+	AverageSpent float64            `json:"averageSpent"` // per spending transaction
+	FirstDate    string             `json:"firstDate,omitempty"`
+	Months       []MerchantMonth    `json:"months"`
+	Transactions []Transaction      `json:"transactions"`
+	ByCategory   map[string]float64 `json:"byCategory"`
+}
+
+// NormalizeMerchantName cleans a raw bank merchant string into a display name,
+// "SQ *COFFEE 1234" becomes "Coffee", "FRIAR & FIRKIN TORONTO" becomes
+// "Friar & Firkin" and "AIR CANADA" stays "Air Canada"
+func NormalizeMerchantName(raw string) string {
+	name := strings.ToUpper(strings.Join(strings.Fields(raw), " "))
+
+	for i := 0; i < 2 && processorPrefix.MatchString(name); i++ {
+		name = processorPrefix.ReplaceAllString(name, "")
+	}
+	name = domainSuffix.ReplaceAllString(name, "")
+
+	tokens := []string{}
+	storeNumberAt := -1
+	for _, token := range strings.Fields(name) {
+		// Reference codes are appended after a "*", "AMZN MKTP CA*2K3JD7", while
+		// a leading "*" only separates words, "UBER *EATS"
+		token = strings.TrimLeft(token, "*")
+		if i := strings.Index(token, "*"); i >= 0 {
+			token = token[:i]
+		}
+		if token == "" || storeNumber.MatchString(token) {
+			if len(tokens) > 0 && storeNumberLabels[tokens[len(tokens)-1]] {
+				tokens = tokens[:len(tokens)-1]
+			}
+			if token != "" {
+				storeNumberAt = len(tokens)
+			}
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	tokens = stripLocation(tokens, storeNumberAt)
+
+	name = strings.Trim(strings.Join(tokens, " "), " -*#,.")
+	if name == "" {
+		name = strings.ToUpper(strings.TrimSpace(raw))
+	}
+	return titleCase(name)
+}
+
+// stripLocation drops the city, province and country banks append to a
+// merchant name. Everything after a store number is location. Otherwise a
+// city is dropped after a province code, "SUBWAY TORONTO ON", and any other
+// place only when at least two words are left and the name doesn't lead
+// into it, so "AIR CANADA" and "BANK OF MONTREAL" stay whole.
+func stripLocation(tokens []string, storeNumberAt int) []string {
+	afterRegion := false
+	for len(tokens) > 1 {
+		size := 1
+		if len(tokens) > 2 && cities[tokens[len(tokens)-2]+" "+tokens[len(tokens)-1]] {
+			size = 2
+		}
+		place := strings.Join(tokens[len(tokens)-size:], " ")
+		rest := tokens[:len(tokens)-size]
+		if len(rest) == 0 || !(regionCodes[place] || countries[place] || cities[place]) {
+			break
+		}
+		joined := nameConnectors[rest[len(rest)-1]]
+
+		switch {
+		case storeNumberAt >= 0 && len(rest) >= storeNumberAt:
+		case regionCodes[place]:
+			afterRegion = true
+		case cities[place] && afterRegion && !joined:
+			afterRegion = false
+		case len(rest) >= 2 && !joined:
+		default:
+			return tokens
+		}
+		tokens = rest
+	}
+	return tokens
+}
+
+// merchantKey is the alias lookup key for a merchant name
+func merchantKey(name string) string {
+	return strings.ToLower(NormalizeMerchantName(name))
+}
+
+// cleanMerchantName is the canonical merchant name of a transaction when it is
+// linked, otherwise the cleaned raw merchant
+func cleanMerchantName(t Transaction) string {
+	if t.MerchantName != "" {
+		return t.MerchantName
+	}
+	return NormalizeMerchantName(rawMerchant(t))
+}
+
+func rawMerchant(t Transaction) string {
+	if strings.TrimSpace(t.Merchant) != "" {
+		return strings.TrimSpace(t.Merchant)
+	}
+	return strings.TrimSpace(t.Description)
+}
+
+func GetMerchants(householdID string) ([]Merchant, error) {
+	rows, err := database.DB.Query(`
+		SELECT m.id, m.name, m.category_id, m.created_at, m.updated_at,
+			COUNT(t.id),
+			COALESCE(SUM(CASE WHEN t.transaction_type = 'CREDIT' THEN 0 ELSE ABS(t.amount) END), 0),
+			COALESCE(MAX(substr(t.date, 1, 10)), '')
+		FROM merchants m
+		LEFT JOIN transactions t ON t.merchant_id = m.id AND t.household_id = m.household_id
+		WHERE m.household_id = ?
+		GROUP BY m.id
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merchants := []Merchant{}
+	for rows.Next() {
+		var m Merchant
+		if err := rows.Scan(&m.ID, &m.Name, &m.CategoryID, &m.CreatedAt, &m.UpdatedAt, &m.TransactionCount, &m.TotalSpent, &m.LastDate); err != nil {
+			return nil, err
+		}
+		m.TotalSpent = roundCents(m.TotalSpent)
+		merchants = append(merchants, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	aliases, err := loadMerchantAliases(database.DB, householdID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range merchants {
+		merchants[i].Aliases = aliasesFor(aliases, merchants[i].ID)
+	}
+
+	sort.Slice(merchants, func(i, j int) bool {
+		if merchants[i].TotalSpent != merchants[j].TotalSpent {
+			return merchants[i].TotalSpent > merchants[j].TotalSpent
+		}
+		return merchants[i].Name < merchants[j].Name
+	})
+	return merchants, nil
+}
+
+func GetMerchant(id string, householdID string) (*Merchant, error) {
+	merchants, err := GetMerchants(householdID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range merchants {
+		if m.ID == id {
+			return &m, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetMerchantHistory returns a merchant's spending per month along with its transactions
+func GetMerchantHistory(id string, householdID string) (*MerchantHistory, error) {
+	merchant, err := GetMerchant(id, householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := FilterTransactions(householdID, TransactionFilter{MerchantID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	history := &MerchantHistory{
+		Merchant:     *merchant,
+		Months:       []MerchantMonth{},
+		Transactions: transactions,
+		ByCategory:   make(map[string]float64),
+	}
+
+	months := make(map[string]*MerchantMonth)
+	spendingCount := 0
+	for _, t := range transactions {
+		month := t.Date[:7]
+		if months[month] == nil {
+			months[month] = &MerchantMonth{Month: month}
+		}
+		months[month].TransactionCount++
+
+		amount := signedAmount(t)
+		if amount < 0 {
+			months[month].Spent += -amount
+			history.ByCategory[categoryKey(t.CategoryID)] += -amount
+			spendingCount++
+		} else {
+			months[month].Income += amount
+		}
+
+		if history.FirstDate == "" || t.Date[:10] < history.FirstDate {
+			history.FirstDate = t.Date[:10]
+		}
+	}
+
+	for _, month := range months {
+		month.Spent = roundCents(month.Spent)
+		month.Income = roundCents(month.Income)
+		history.Months = append(history.Months, *month)
+	}
+	sort.Slice(history.Months, func(i, j int) bool { return history.Months[i].Month < history.Months[j].Month })
+	for key, value := range history.ByCategory {
+		history.ByCategory[key] = roundCents(value)
+	}
+	if spendingCount > 0 {
+		history.AverageSpent = roundCents(merchant.TotalSpent / float64(spendingCount))
+	}
+
+	return history, nil
+}
+
+// UpdateMerchant applies a merge patch to a merchant. A rename also matches
+// the new name, unless another merchant already does, which has to be moved
+// explicitly with AddMerchantAlias.
+func UpdateMerchant(id string, householdID string, userID int, patch Patch) (*Merchant, error) {
+	before, err := GetMerchant(id, householdID)
+	if err != nil {
+		return nil, err
+	}
+	after := *before
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	fields := newPatchReader(patch, []string{"name", "categoryId"},
+		[]string{"id", "aliases", "transactionCount", "totalSpent", "lastDate", "createdAt", "updatedAt"})
+	var name string
+	if fields.String("name", &name) {
+		if name = strings.TrimSpace(name); name == "" {
+			fields.fail("name", "%s", ErrInvalidMerchantName)
+		} else {
+			after.Name = name
+		}
+	}
+	// New transactions from the merchant take its category, so it has to be
+	// one of the household's
+	if fields.NullableString("categoryId", &after.CategoryID) && after.CategoryID != nil {
+		if _, err := getCategory(tx, *after.CategoryID, householdID); errors.Is(err, sql.ErrNoRows) {
+			fields.fail("categoryId", "category not found")
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if err := fields.err(); err != nil {
+		return nil, err
+	}
+
+	renamed := after.Name != before.Name
+	if renamed {
+		if owner, err := findMerchant(tx, householdID, after.Name); err == nil && owner.ID != id {
+			return nil, ErrMerchantAliasTaken
+		} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	after.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
+
+	_, err = tx.Exec(`
+		UPDATE merchants SET name = ?, category_id = ?, updated_at = ?
+		WHERE id = ? AND household_id = ?
+	`, after.Name, after.CategoryID, after.UpdatedAt, id, householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The renamed merchant should also match its new name
+	if renamed {
+		if err := addMerchantAlias(tx, id, householdID, merchantKey(after.Name)); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("UPDATE transactions SET version = version + 1 WHERE merchant_id = ?", id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeAudit(tx, householdID, userID, EntityMerchant, id, AuditActionUpdate, before, after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetMerchant(id, householdID)
+}
+
+// AddMerchantAlias points alias at the merchant, moving it from whichever
+// merchant held it before, and relinks the household's transactions
+func AddMerchantAlias(id string, householdID string, userID int, alias string) (*Merchant, error) {
+	key := merchantKey(alias)
+	if strings.TrimSpace(alias) == "" || key == "" {
+		return nil, ErrInvalidMerchantName
+	}
+
+	before, err := GetMerchant(id, householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := addMerchantAlias(tx, id, householdID, key); err != nil {
+		return nil, err
+	}
+	if _, err := relinkTransactions(tx, householdID); err != nil {
+		return nil, err
+	}
+
+	after := *before
+	after.Aliases = append(append([]string{}, before.Aliases...), key)
+	if err := writeAudit(tx, householdID, userID, EntityMerchant, id, AuditActionUpdate, before, after); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetMerchant(id, householdID)
+}
+
+// RelinkMerchants links every transaction in the household to its canonical
+// merchant, creating merchants as needed. It returns how many transactions changed.
+func RelinkMerchants(householdID string) (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	changed, err := relinkTransactions(tx, householdID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+func relinkTransactions(exec execer, householdID string) (int, error) {
+	rows, err := exec.Query(`
+		SELECT id, merchant, description, merchant_id
+		FROM transactions
+		WHERE household_id = ?
+	`, householdID)
+	if err != nil {
+		return 0, err
+	}
+
+	type link struct {
+		id         string
+		raw        string
+		merchantID sql.NullString
+	}
+	links := []link{}
+	for rows.Next() {
+		var l link
+		var t Transaction
+		if err := rows.Scan(&l.id, &t.Merchant, &t.Description, &l.merchantID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		l.raw = rawMerchant(t)
+		links = append(links, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, l := range links {
+		merchant, err := resolveMerchant(exec, householdID, l.raw)
+		if err != nil {
+			return 0, err
+		}
+		if l.merchantID.Valid && l.merchantID.String == merchant.ID {
+			continue
+		}
+		if _, err := exec.Exec("UPDATE transactions SET merchant_id = ?, version = version + 1 WHERE id = ?", merchant.ID, l.id); err != nil {
+			return 0, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// findMerchant looks up the canonical merchant for a raw merchant string
+func findMerchant(exec execer, householdID string, raw string) (*Merchant, error) {
+	var m Merchant
+	err := exec.QueryRow(`
+		SELECT m.id, m.name, m.category_id, m.created_at, m.updated_at
+		FROM merchant_aliases a
+		JOIN merchants m ON m.id = a.merchant_id
+		WHERE a.household_id = ? AND a.alias = ?
+	`, householdID, merchantKey(raw)).Scan(&m.ID, &m.Name, &m.CategoryID, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// resolveMerchant finds the canonical merchant for a raw merchant string,
+// creating it when no alias matches
+func resolveMerchant(exec execer, householdID string, raw string) (*Merchant, error) {
+	merchant, err := findMerchant(exec, householdID, raw)
+	if err == nil {
+		return merchant, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	merchant = &Merchant{
+		ID:        uuid.New().String(),
+		Name:      NormalizeMerchantName(raw),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	_, err = exec.Exec(`
+		INSERT INTO merchants (id, household_id, name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, merchant.ID, householdID, merchant.Name, merchant.CreatedAt, merchant.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addMerchantAlias(exec, merchant.ID, householdID, merchantKey(raw)); err != nil {
+		return nil, err
+	}
+	return merchant, nil
+}
+
+func addMerchantAlias(exec execer, merchantID string, householdID string, key string) error {
+	_, err := exec.Exec(`
+		INSERT INTO merchant_aliases (merchant_id, household_id, alias, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (household_id, alias) DO UPDATE SET merchant_id = excluded.merchant_id
+	`, merchantID, householdID, key, time.Now().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+func loadMerchantAliases(exec execer, householdID string) (map[string][]string, error) {
+	rows, err := exec.Query(`
+		SELECT merchant_id, alias FROM merchant_aliases
+		WHERE household_id = ?
+		ORDER BY alias
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make(map[string][]string)
+	for rows.Next() {
+		var merchantID, alias string
+		if err := rows.Scan(&merchantID, &alias); err != nil {
+			return nil, err
+		}
+		aliases[merchantID] = append(aliases[merchantID], alias)
+	}
+	return aliases, rows.Err()
+}
+
+func aliasesFor(aliases map[string][]string, merchantID string) []string {
+	if list, ok := aliases[merchantID]; ok {
+		return list
+	}
+	return []string{}
+}
+
+// titleCase capitalizes the first letter of each word, "7-ELEVEN" becomes
+// "7-Eleven" and "A&W" stays "A&W"
+func titleCase(s string) string {
+	runes := []rune(strings.ToLower(s))
+	for i, r := range runes {
+		if i == 0 || (!unicode.IsLetter(runes[i-1]) && runes[i-1] != '\'') {
+			runes[i] = unicode.ToUpper(r)
+		}
+	}
+	return string(runes)
+}
@@ -0,0 +1,41 @@
+package repository
+
+import "testing"
+
+func TestNormalizeMerchantName(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"SQ *COFFEE 1234", "Coffee"},
+		{"TST* BURGER PLACE", "Burger Place"},
+		{"UBER *EATS", "Uber Eats"},
+		{"AMZN MKTP CA*2K3JD7", "Amzn Mktp"},
+		{"NETFLIX.COM", "Netflix"},
+		{"7-ELEVEN", "7-Eleven"},
+
+		// Trailing location
+		{"FRIAR & FIRKIN TORONTO", "Friar & Firkin"},
+		{"SUBWAY TORONTO ON", "Subway"},
+		{"TIM HORTONS #1234 NORTH YORK ON", "Tim Hortons"},
+		{"WALMART STORE 1234 OTTAWA", "Walmart"},
+		{"SHELL 0042 CANADA", "Shell"},
+
+		// Places that are part of the brand
+		{"AIR CANADA", "Air Canada"},
+		{"AIR CANADA MONTREAL QC", "Air Canada"},
+		{"AIR CANADA #0123 MONTREAL QC", "Air Canada"},
+		{"ROYAL BANK OF CANADA", "Royal Bank Of Canada"},
+		{"BANK OF MONTREAL", "Bank Of Montreal"},
+		{"BANK OF MONTREAL QC", "Bank Of Montreal"},
+		{"BOSTON PIZZA", "Boston Pizza"},
+		{"CANADA POST", "Canada Post"},
+		{"TORONTO", "Toronto"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeMerchantName(tt.raw); got != tt.want {
+			t.Errorf("NormalizeMerchantName(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
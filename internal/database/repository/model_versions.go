@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+var (
+	ErrInvalidModelName       = errors.New("model name is required")
+	ErrInvalidModelStrategy   = errors.New("unknown calculation strategy")
+	ErrInvalidModelParameters = errors.New("invalid model parameters")
+	ErrModelRetired           = errors.New("model is retired")
+	ErrModelActive            = errors.New("the active model can't be retired")
+)
+
+// ModelVersionClone describes a new model copied from an existing one. Nil
+// fields keep the source's value and parameters only override the keys given.
+type ModelVersionClone struct {
+	Name                *string                     `json:"name"`
+	Description         *string                     `json:"description"`
+	CalculationStrategy *models.CalculationStrategy `json:"calculationStrategy"`
+	Parameters          json.RawMessage             `json:"parameters"`
+}
+
+const modelVersionColumns = `id, name, description, calculation_strategy, parameters, active, parent_id, retired_at, created_at`
+
+func scanModelVersion(row rowScanner) (*models.ModelVersion, error) {
+	var model models.ModelVersion
+	var parameters string
+	var parentID sql.NullInt64
+	var retiredAt sql.NullString
+	if err := row.Scan(&model.ID, &model.Name, &model.Description, &model.CalculationStrategy,
+		&parameters, &model.Active, &parentID, &retiredAt, &model.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(parameters), &model.Parameters); err != nil {
+		return nil, fmt.Errorf("model %d parameters: %w", model.ID, err)
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		model.ParentID = &id
+	}
+	if retiredAt.Valid {
+		model.RetiredAt = &retiredAt.String
+	}
+	return &model, nil
+}
+
+// SeedModelVersions inserts any default model missing from the registry. A
+// default only becomes active when no other model is.
+func SeedModelVersions(defaults []models.ModelVersion) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	for _, model := range defaults {
+		parameters, err := json.Marshal(model.Parameters)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO model_versions
+			(id, name, description, calculation_strategy, parameters, active, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, CASE WHEN ? AND NOT EXISTS (SELECT 1 FROM model_versions WHERE active = 1) THEN 1 ELSE 0 END, ?, ?)`,
+			model.ID, model.Name, model.Description, model.CalculationStrategy, string(parameters),
+			model.Active, model.CreatedAt, currentTime)
+		if err != nil {
+			return fmt.Errorf("seed model %d: %w", model.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetModelVersions returns the registered models, oldest first
+func GetModelVersions(includeRetired bool) ([]models.ModelVersion, error) {
+	query := `SELECT ` + modelVersionColumns + ` FROM model_versions`
+	if !includeRetired {
+		query += ` WHERE retired_at IS NULL`
+	}
+	query += ` ORDER BY id`
+
+	rows, err := database.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	modelVersions := []models.ModelVersion{}
+	for rows.Next() {
+		model, err := scanModelVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		modelVersions = append(modelVersions, *model)
+	}
+	return modelVersions, rows.Err()
+}
+
+// GetModelVersion returns a registered model, sql.ErrNoRows if there is none
+func GetModelVersion(id int) (*models.ModelVersion, error) {
+	return scanModelVersion(database.DB.QueryRow(
+		`SELECT `+modelVersionColumns+` FROM model_versions WHERE id = ?`, id))
+}
+
+// GetActiveModelVersionID returns the id of the active model, sql.ErrNoRows if none is active
+func GetActiveModelVersionID() (int, error) {
+	var id int
+	err := database.DB.QueryRow(`SELECT id FROM model_versions WHERE active = 1`).Scan(&id)
+	return id, err
+}
+
+// CreateModelVersion registers a new, inactive model
+func CreateModelVersion(model models.ModelVersion) (*models.ModelVersion, error) {
+	model.Name = strings.TrimSpace(model.Name)
+	if model.Name == "" {
+		return nil, ErrInvalidModelName
+	}
+	if !model.CalculationStrategy.Valid() {
+		return nil, ErrInvalidModelStrategy
+	}
+	if err := ValidateModelParameters(model.Parameters); err != nil {
+		return nil, err
+	}
+
+	parameters, err := json.Marshal(model.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	result, err := database.DB.Exec(`
+		INSERT INTO model_versions
+		(name, description, calculation_strategy, parameters, active, parent_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 0, ?, ?, ?)`,
+		model.Name, model.Description, model.CalculationStrategy, string(parameters),
+		model.ParentID, currentTime, currentTime)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetModelVersion(int(id))
+}
+
+// modelParameterBound is the range a parameter has to fall in
+type modelParameterBound struct {
+	name     string
+	value    float64
+	min, max float64
+}
+
+// ValidateModelParameters checks every parameter is a finite number in a
+// range the calculations hold up in. Weights and shares can't be negative,
+// factors multiplying the prediction can't be zero or negative and exponents
+// can't flip a factor's direction.
+func ValidateModelParameters(p models.ModelParameters) error {
+	bounds := []modelParameterBound{
+		{"recentPerformanceWeight", p.RecentPerformanceWeight, 0, 2},
+		{"seasonPerformanceWeight", p.SeasonPerformanceWeight, 0, 2},
+
+		{"gamePaceExponent", p.GamePaceExponent, 0, 3},
+		{"teamOffenseExponent", p.TeamOffenseExponent, 0, 3},
+		{"teamDefenseExponent", p.TeamDefenseExponent, 0, 3},
+
+		{"defensePositionFactor", p.DefensePositionFactor, 0.1, 2},
+
+		{"backToBackFactor", p.BackToBackFactor, 0.1, 2},
+		{"oneRestDayFactor", p.OneRestDayFactor, 0.1, 2},
+		{"fourPlusRestDayFactor", p.FourPlusRestDayFactor, 0.1, 2},
+
+		{"shotScoreMultiplier", p.ShotScoreMultiplier, 0, 10},
+		{"toiBaseMultiplier", p.TOIBaseMultiplier, 0, 10},
+		{"toiBonusThreshold", p.TOIBonusThreshold, 0, 60},
+		{"toiBonusMultiplier", p.TOIBonusMultiplier, 0, 10},
+		{"trendUpwardScore", p.TrendUpwardScore, 0, 10},
+		{"trendImprovementScore", p.TrendImprovementScore, 0, 10},
+		{"defenseConfidenceFactor", p.DefenseConfidenceFactor, 0, 2},
+
+		{"lastGameWeight", p.LastGameWeight, 0, 1},
+		{"secondLastGameWeight", p.SecondLastGameWeight, 0, 1},
+		{"thirdLastGameWeight", p.ThirdLastGameWeight, 0, 1},
+		{"fourthLastGameWeight", p.FourthLastGameWeight, 0, 1},
+		{"fifthLastGameWeight", p.FifthLastGameWeight, 0, 1},
+		{"homeIceAdvantageFactor", p.HomeIceAdvantageFactor, 0, 2},
+		{"streakImpactFactor", p.StreakImpactFactor, 0, 1},
+
+		{"last10Weight", p.Last10Weight, 0, 1},
+		{"last20Weight", p.Last20Weight, 0, 1},
+		{"ewmaWeight", p.EWMAWeight, 0, 1},
+		{"ewmaHalfLife", p.EWMAHalfLife, 0, 82}, // 0 uses the default
+		{"venueSplitWeight", p.VenueSplitWeight, 0, 1},
+	}
+	for _, b := range bounds {
+		if math.IsNaN(b.value) || math.IsInf(b.value, 0) || b.value < b.min || b.value > b.max {
+			return fmt.Errorf("%w: %s must be between %g and %g", ErrInvalidModelParameters, b.name, b.min, b.max)
+		}
+	}
+	// 0 ignores goalies, below 1 would favour shooters facing the best goalies
+	if g := p.OpposingGoalieQualityFactor; g != 0 && !(g >= 1 && g <= 2) {
+		return fmt.Errorf("%w: opposingGoalieQualityFactor must be 0 or between 1 and 2", ErrInvalidModelParameters)
+	}
+	if p.RecentPerformanceWeight+p.SeasonPerformanceWeight == 0 {
+		return fmt.Errorf("%w: recentPerformanceWeight and seasonPerformanceWeight can't both be 0", ErrInvalidModelParameters)
+	}
+	return nil
+}
+
+// CloneModelVersion registers a copy of an existing model with the given overrides
+func CloneModelVersion(sourceID int, clone ModelVersionClone) (*models.ModelVersion, error) {
+	source, err := GetModelVersion(sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	model := *source
+	model.ParentID = &source.ID
+	model.Name = source.Name + " (copy)"
+	if clone.Name != nil {
+		model.Name = *clone.Name
+	}
+	if clone.Description != nil {
+		model.Description = *clone.Description
+	}
+	if clone.CalculationStrategy != nil {
+		model.CalculationStrategy = *clone.CalculationStrategy
+	}
+	if len(clone.Parameters) > 0 && !isJSONNull(clone.Parameters) {
+		// Decoding onto the source's parameters keeps every key not overridden
+		decoder := json.NewDecoder(bytes.NewReader(clone.Parameters))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&model.Parameters); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidModelParameters, err)
+		}
+	}
+
+	return CreateModelVersion(model)
+}
+
+// ActivateModelVersion makes a model the one used for predictions, deactivating the previous one
+func ActivateModelVersion(id int) (*models.ModelVersion, error) {
+	model, err := GetModelVersion(id)
+	if err != nil {
+		return nil, err
+	}
+	if model.RetiredAt != nil {
+		return nil, ErrModelRetired
+	}
+	if model.Active {
+		return model, nil
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	if _, err := tx.Exec(`UPDATE model_versions SET active = 0, updated_at = ? WHERE active = 1`, currentTime); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE model_versions SET active = 1, updated_at = ? WHERE id = ?`, currentTime, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetModelVersion(id)
+}
+
+// RetireModelVersion stops a model from making new predictions. Its past
+// predictions are kept.
+func RetireModelVersion(id int) (*models.ModelVersion, error) {
+	model, err := GetModelVersion(id)
+	if err != nil {
+		return nil, err
+	}
+	if model.Active {
+		return nil, ErrModelActive
+	}
+	if model.RetiredAt != nil {
+		return model, nil
+	}
+
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	_, err = database.DB.Exec(`UPDATE model_versions SET retired_at = ?, updated_at = ? WHERE id = ?`,
+		currentTime, currentTime, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetModelVersion(id)
+}
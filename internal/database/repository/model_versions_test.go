@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+func TestValidateModelParameters(t *testing.T) {
+	for _, model := range models.GetDefaultModels() {
+		if err := ValidateModelParameters(model.Parameters); err != nil {
+			t.Errorf("%s: %v", model.Name, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *models.ModelParameters)
+	}{
+		{"NaN weight", func(p *models.ModelParameters) { p.RecentPerformanceWeight = math.NaN() }},
+		{"infinite exponent", func(p *models.ModelParameters) { p.GamePaceExponent = math.Inf(1) }},
+		{"negative weight", func(p *models.ModelParameters) { p.LastGameWeight = -0.1 }},
+		{"zero rest factor", func(p *models.ModelParameters) { p.BackToBackFactor = 0 }},
+		{"negative exponent", func(p *models.ModelParameters) { p.TeamDefenseExponent = -1 }},
+		{"share above 1", func(p *models.ModelParameters) { p.VenueSplitWeight = 1.5 }},
+		{"inverted goalie factor", func(p *models.ModelParameters) { p.OpposingGoalieQualityFactor = 0.5 }},
+		{"NaN goalie factor", func(p *models.ModelParameters) { p.OpposingGoalieQualityFactor = math.NaN() }},
+		{"no performance weight", func(p *models.ModelParameters) {
+			p.RecentPerformanceWeight, p.SeasonPerformanceWeight = 0, 0
+		}},
+	}
+	for _, tt := range tests {
+		params := models.GetDefaultModels()[0].Parameters
+		tt.change(&params)
+		if err := ValidateModelParameters(params); !errors.Is(err, ErrInvalidModelParameters) {
+			t.Errorf("%s: err = %v, want ErrInvalidModelParameters", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+)
+
+// GetCachedNHLResponse returns an unexpired cached response body for a URL,
+// sql.ErrNoRows when there is none
+func GetCachedNHLResponse(url string) ([]byte, error) {
+	var body []byte
+	err := database.DB.QueryRow(`
+		SELECT body FROM nhl_response_cache
+		WHERE url = ? AND expires_at > ?`,
+		url, time.Now().Format("2006-01-02 15:04:05")).Scan(&body)
+	return body, err
+}
+
+// StoreNHLResponse caches a response body for a URL until ttl has passed
+func StoreNHLResponse(url string, body []byte, ttl time.Duration) error {
+	now := time.Now()
+	_, err := database.DB.Exec(`
+		INSERT INTO nhl_response_cache (url, body, fetched_at, expires_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(url) DO UPDATE SET body = excluded.body, fetched_at = excluded.fetched_at, expires_at = excluded.expires_at`,
+		url, body, now.Format("2006-01-02 15:04:05"), now.Add(ttl).Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// PurgeExpiredNHLResponses deletes cached responses past their expiry
+func PurgeExpiredNHLResponses() (int, error) {
+	result, err := database.DB.Exec(`DELETE FROM nhl_response_cache WHERE expires_at <= ?`,
+		time.Now().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	return int(purged), err
+}
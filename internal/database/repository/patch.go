@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Patch is a JSON Merge Patch (RFC 7396) body. A missing member leaves the
+// field alone, null clears it and any other value replaces it.
+type Patch map[string]json.RawMessage
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every invalid field of a patch so clients can
+// fix them all in one round trip
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Field+": "+f.Message)
+	}
+	return "invalid fields: " + strings.Join(messages, "; ")
+}
+
+// patchReader decodes typed fields out of a Patch, recording a field error
+// instead of ignoring values of the wrong type
+type patchReader struct {
+	patch  Patch
+	errors []FieldError
+}
+
+func newPatchReader(patch Patch, fields []string, readOnly []string) *patchReader {
+	r := &patchReader{patch: patch}
+
+	known := make(map[string]bool)
+	for _, f := range fields {
+		known[f] = true
+	}
+	ignored := make(map[string]bool)
+	for _, f := range readOnly {
+		ignored[f] = true
+	}
+	unknown := []string{}
+	for field := range patch {
+		if !known[field] && !ignored[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		r.fail(field, "unknown field")
+	}
+	return r
+}
+
+func (r *patchReader) fail(field string, format string, args ...interface{}) {
+	r.errors = append(r.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *patchReader) err() error {
+	if len(r.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: r.errors}
+}
+
+// raw returns the field's value, ok is false when the field is absent
+func (r *patchReader) raw(field string) (value json.RawMessage, isNull bool, ok bool) {
+	value, ok = r.patch[field]
+	if !ok {
+		return nil, false, false
+	}
+	return value, isJSONNull(value), true
+}
+
+func isJSONNull(value json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+func (r *patchReader) decode(field string, value json.RawMessage, target interface{}, kind string) bool {
+	if err := json.Unmarshal(value, target); err != nil {
+		r.fail(field, "must be %s", kind)
+		return false
+	}
+	return true
+}
+
+// String sets target when field holds a string, null is rejected
+func (r *patchReader) String(field string, target *string) bool {
+	value, isNull, ok := r.raw(field)
+	if !ok {
+		return false
+	}
+	if isNull {
+		r.fail(field, "can't be null")
+		return false
+	}
+	var s string
+	if !r.decode(field, value, &s, "a string") {
+		return false
+	}
+	*target = s
+	return true
+}
+
+// NullableString sets target when field holds a string, null or "" clears it
+func (r *patchReader) NullableString(field string, target **string) bool {
+	value, isNull, ok := r.raw(field)
+	if !ok {
+		return false
+	}
+	if isNull {
+		*target = nil
+		return true
+	}
+	var s string
+	if !r.decode(field, value, &s, "a string or null") {
+		return false
+	}
+	if s == "" {
+		*target = nil
+	} else {
+		*target = &s
+	}
+	return true
+}
+
+func (r *patchReader) Float(field string, target *float64) bool {
+	value, isNull, ok := r.raw(field)
+	if !ok {
+		return false
+	}
+	if isNull {
+		r.fail(field, "can't be null")
+		return false
+	}
+	var f float64
+	if !r.decode(field, value, &f, "a number") {
+		return false
+	}
+	*target = f
+	return true
+}
+
+func (r *patchReader) NullableFloat(field string, target **float64) bool {
+	value, isNull, ok := r.raw(field)
+	if !ok {
+		return false
+	}
+	if isNull {
+		*target = nil
+		return true
+	}
+	var f float64
+	if !r.decode(field, value, &f, "a number or null") {
+		return false
+	}
+	*target = &f
+	return true
+}
+
+// Strings sets target when field holds an array of strings, null clears it
+func (r *patchReader) Strings(field string, target *[]string) bool {
+	value, isNull, ok := r.raw(field)
+	if !ok {
+		return false
+	}
+	if isNull {
+		*target = nil
+		return true
+	}
+	var s []string
+	if !r.decode(field, value, &s, "an array of strings or null") {
+		return false
+	}
+	*target = s
+	return true
+}
+
+// Object decodes a nested merge patch, null is rejected since the field
+// itself can't be removed
+func (r *patchReader) Object(field string) (Patch, bool) {
+	value, isNull, ok := r.raw(field)
+	if !ok {
+		return nil, false
+	}
+	if isNull {
+		r.fail(field, "can't be null")
+		return nil, false
+	}
+	var nested Patch
+	if !r.decode(field, value, &nested, "an object") {
+		return nil, false
+	}
+	return nested, true
+}
+
+func isValidMonth(month string) bool {
+	_, err := time.Parse("2006-01", month)
+	return err == nil && len(month) == 7
+}
+
+// isValidTransactionDate accepts YYYY-MM-DD or a full RFC 3339 timestamp
+func isValidTransactionDate(date string) bool {
+	if _, err := time.Parse("2006-01-02", date); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, date)
+	return err == nil
+}
+
+func isValidTransactionType(transactionType string) bool {
+	return transactionType == "DEBIT" || transactionType == "CREDIT"
+}
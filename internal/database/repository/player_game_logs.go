@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// StorePlayerGameLog stores a player's season game log, replacing any games
+// already stored
+func StorePlayerGameLog(playerID int, season string, entries []models.GameLogEntry) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+	INSERT OR REPLACE INTO player_game_logs (
+		player_id, season, game_id, game_date, team_abbrev, opponent_abbrev,
+		home_road_flag, shots, toi, power_play_toi, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	updatedAt := time.Now().Format("2006-01-02 15:04:05")
+	for _, entry := range entries {
+		_, err := stmt.Exec(
+			playerID,
+			season,
+			entry.GameID,
+			entry.GameDate,
+			entry.TeamAbbrev,
+			entry.OpponentAbbrev,
+			entry.HomeRoadFlag,
+			entry.Shots,
+			entry.TOI,
+			sql.NullString{String: entry.PowerPlayTOI, Valid: entry.PowerPlayTOI != ""},
+			updatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetStoredPlayerGameLog returns a player's stored season game log, most
+// recent first
+func GetStoredPlayerGameLog(playerID int, season string) ([]models.GameLogEntry, error) {
+	rows, err := database.DB.Query(`
+		SELECT game_id, game_date, team_abbrev, opponent_abbrev, home_road_flag, shots, toi, power_play_toi
+		FROM player_game_logs
+		WHERE player_id = ? AND season = ?
+		ORDER BY game_date DESC`, playerID, season)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.GameLogEntry
+	for rows.Next() {
+		var entry models.GameLogEntry
+		var powerPlayTOI sql.NullString
+		err := rows.Scan(
+			&entry.GameID,
+			&entry.GameDate,
+			&entry.TeamAbbrev,
+			&entry.OpponentAbbrev,
+			&entry.HomeRoadFlag,
+			&entry.Shots,
+			&entry.TOI,
+			&powerPlayTOI,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		entry.PowerPlayTOI = powerPlayTOI.String
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
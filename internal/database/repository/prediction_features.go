@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"api.alexmontague.ca/internal/database"
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// predictionFeatureColumns are the prediction_features columns written by
+// storePredictionFeatures and scanned by GetPredictionFeatures, in order
+const predictionFeatureColumns = `prediction_id, model_version_id, calculation_strategy,
+	position, shots_last5, avg_shots_last5, season_shots_per_game, season_games_played, avg_toi, rest_days,
+	team_shots_for_per_game, opponent_shots_against_per_game, opponent_shots_for_per_game, league_shot_average,
+	opponent_goalie_id, opponent_goalie_confirmed, opponent_goalie_games_played, opponent_goalie_save_pct,
+	league_save_pct, team_form_games, team_form_point_pct,
+	game_log_games, shots_last10, shots_last20, shots_ewma, venue_shots_per_game, toi_last10, power_play_toi_last10,
+	weighted_recent_shots, toi_base_prediction, base_prediction,
+	game_pace_factor, team_offense_factor, team_defense_factor, position_factor,
+	icetime_factor, rest_factor, home_ice_factor, streak_factor, goalie_factor, venue_factor,
+	unrounded_prediction, predicted_shots, fallback`
+
+func storePredictionFeatures(stmt *sql.Stmt, predictionID int64, modelID int, features *models.PredictionFeatures, createdAt string) error {
+	shotsLast5, err := json.Marshal(features.ShotsLast5)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.Exec(
+		predictionID,
+		modelID,
+		features.CalculationStrategy,
+		features.Position,
+		string(shotsLast5),
+		features.AvgShotsLast5,
+		features.SeasonShotsPerGame,
+		features.SeasonGamesPlayed,
+		features.AvgTOI,
+		features.RestDays,
+		features.TeamShotsForPerGame,
+		features.OpponentShotsAgainstPerGame,
+		features.OpponentShotsForPerGame,
+		features.LeagueShotAverage,
+		features.OpponentGoalieID,
+		features.OpponentGoalieConfirmed,
+		features.OpponentGoalieGamesPlayed,
+		features.OpponentGoalieSavePct,
+		features.LeagueSavePct,
+		features.TeamFormGames,
+		features.TeamFormPointPct,
+		features.GameLogGames,
+		features.ShotsLast10,
+		features.ShotsLast20,
+		features.ShotsEWMA,
+		features.VenueShotsPerGame,
+		features.TOILast10,
+		features.PowerPlayTOILast10,
+		features.WeightedRecentShots,
+		features.TOIBasePrediction,
+		features.BasePrediction,
+		features.GamePaceFactor,
+		features.TeamOffenseFactor,
+		features.TeamDefenseFactor,
+		features.PositionFactor,
+		features.IcetimeFactor,
+		features.RestFactor,
+		features.HomeIceFactor,
+		features.StreakFactor,
+		features.GoalieFactor,
+		features.VenueFactor,
+		features.UnroundedPrediction,
+		features.PredictedShots,
+		features.Fallback,
+		createdAt,
+	)
+	return err
+}
+
+func scanPredictionFeatures(row rowScanner) (models.PredictionFeatures, error) {
+	var features models.PredictionFeatures
+	var shotsLast5 string
+	err := row.Scan(
+		&features.PredictionID,
+		&features.ModelVersionID,
+		&features.CalculationStrategy,
+		&features.Position,
+		&shotsLast5,
+		&features.AvgShotsLast5,
+		&features.SeasonShotsPerGame,
+		&features.SeasonGamesPlayed,
+		&features.AvgTOI,
+		&features.RestDays,
+		&features.TeamShotsForPerGame,
+		&features.OpponentShotsAgainstPerGame,
+		&features.OpponentShotsForPerGame,
+		&features.LeagueShotAverage,
+		&features.OpponentGoalieID,
+		&features.OpponentGoalieConfirmed,
+		&features.OpponentGoalieGamesPlayed,
+		&features.OpponentGoalieSavePct,
+		&features.LeagueSavePct,
+		&features.TeamFormGames,
+		&features.TeamFormPointPct,
+		&features.GameLogGames,
+		&features.ShotsLast10,
+		&features.ShotsLast20,
+		&features.ShotsEWMA,
+		&features.VenueShotsPerGame,
+		&features.TOILast10,
+		&features.PowerPlayTOILast10,
+		&features.WeightedRecentShots,
+		&features.TOIBasePrediction,
+		&features.BasePrediction,
+		&features.GamePaceFactor,
+		&features.TeamOffenseFactor,
+		&features.TeamDefenseFactor,
+		&features.PositionFactor,
+		&features.IcetimeFactor,
+		&features.RestFactor,
+		&features.HomeIceFactor,
+		&features.StreakFactor,
+		&features.GoalieFactor,
+		&features.VenueFactor,
+		&features.UnroundedPrediction,
+		&features.PredictedShots,
+		&features.Fallback,
+	)
+	if err != nil {
+		return features, err
+	}
+
+	if err := json.Unmarshal([]byte(shotsLast5), &features.ShotsLast5); err != nil {
+		return features, fmt.Errorf("shots last 5 for prediction %d: %w", features.PredictionID, err)
+	}
+	return features, nil
+}
+
+// GetPredictionFeatures returns the features behind a stored prediction,
+// sql.ErrNoRows when the prediction has none
+func GetPredictionFeatures(predictionID int) (*models.PredictionFeatures, error) {
+	row := database.DB.QueryRow(`
+	SELECT `+predictionFeatureColumns+`
+	FROM prediction_features
+	WHERE prediction_id = ?`, predictionID)
+
+	features, err := scanPredictionFeatures(row)
+	if err != nil {
+		return nil, err
+	}
+	return &features, nil
+}
@@ -1,6 +1,9 @@
 package repository
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -8,66 +11,72 @@ import (
 	"api.alexmontague.ca/internal/nhl/models"
 )
 
-// StoreGamePredictions stores predictions for a game in the simplified format
-func StoreGamePredictions(game models.GameWithPlayers) error {
-	tx, err := database.DB.Begin()
-	if err != nil {
-		return err
-	}
+// predictionColumns are the model_predictions columns scanned by scanPredictionRecord
+const predictionColumns = `id, game_date, game_id, game_title,
+	       away_team_abbrev, away_team_id, home_team_abbrev, home_team_id,
+	       player_id, player_name, player_team_abbrev, player_team_id,
+	       predicted_shots, confidence, actual_shots, successful, created_at, validated_at, model_version_id,
+	       distribution, dispersion, shot_probabilities, line, over_probability, log_loss, brier,
+	       prop_line, prop_over_odds, prop_under_odds, bet_side, bet_profit`
 
-	stmt, err := tx.Prepare(`
-	INSERT OR REPLACE INTO game_predictions (
-		game_date, game_id, game_title,
-		away_team_abbrev, away_team_id, home_team_abbrev, home_team_id,
-		player_id, player_name, player_team_abbrev, player_team_id,
-		predicted_shots, confidence, created_at, model_version_id
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	if err != nil {
-		tx.Rollback()
-		return err
+func scanPredictionRecord(row rowScanner) (models.PredictionRecord, error) {
+	var record models.PredictionRecord
+	var shotProbabilities sql.NullString
+	err := row.Scan(
+		&record.ID,
+		&record.GameDate,
+		&record.GameID,
+		&record.GameTitle,
+		&record.AwayTeamAbbrev,
+		&record.AwayTeamID,
+		&record.HomeTeamAbbrev,
+		&record.HomeTeamID,
+		&record.PlayerID,
+		&record.PlayerName,
+		&record.PlayerTeamAbbrev,
+		&record.PlayerTeamID,
+		&record.PredictedShots,
+		&record.Confidence,
+		&record.ActualShots,
+		&record.Successful,
+		&record.CreatedAt,
+		&record.ValidatedAt,
+		&record.ModelVersionID,
+		&record.Distribution,
+		&record.Dispersion,
+		&shotProbabilities,
+		&record.Line,
+		&record.OverProbability,
+		&record.LogLoss,
+		&record.Brier,
+		&record.PropLine,
+		&record.PropOverOdds,
+		&record.PropUnderOdds,
+		&record.BetSide,
+		&record.BetProfit,
+	)
+	if err != nil || !shotProbabilities.Valid {
+		return record, err
 	}
-	defer stmt.Close()
-
-	for _, player := range game.Players {
-		_, err = stmt.Exec(
-			game.EstDate,
-			game.GameID,
-			game.Title,
-			game.AwayTeam.Abbrev,
-			game.AwayTeam.Id,
-			game.HomeTeam.Abbrev,
-			game.HomeTeam.Id,
-			player.PlayerId,
-			player.Name,
-			player.TeamAbbrev,
-			player.TeamId,
-			player.PredictedGameShots,
-			player.Confidence,
-			time.Now().Format("2006-01-02 15:04:05"),
-			player.ModelVersionID,
-		)
 
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
+	if err := json.Unmarshal([]byte(shotProbabilities.String), &record.ShotProbabilities); err != nil {
+		return record, fmt.Errorf("shot probabilities for prediction %d: %w", record.ID, err)
 	}
-
-	return tx.Commit()
+	return record, nil
 }
 
-// GetGamePredictionsForDate retrieves all predictions for a specific date
-func GetGamePredictionsForDate(date string) ([]models.PredictionRecord, error) {
+// GetGamePredictionsForDate retrieves one model's predictions for a specific date
+func GetGamePredictionsForDate(date string, modelVersionID int) ([]models.PredictionRecord, error) {
 	query := `
-	SELECT id, game_date, game_id, game_title,
-	       away_team_abbrev, away_team_id, home_team_abbrev, home_team_id,
-	       player_id, player_name, player_team_abbrev, player_team_id,
-	       predicted_shots, confidence, actual_shots, successful, created_at, validated_at, model_version_id
-	FROM game_predictions
-	WHERE game_date = ?;`
+	SELECT ` + predictionColumns + `
+	FROM model_predictions
+	WHERE game_date = ? AND model_version_id = ?;`
 
-	gameRows, err := database.DB.Query(query, date)
+	gameRows, err := database.DB.Query(query, date, modelVersionID)
 	if err != nil {
 		return nil, fmt.Errorf("query error: %w", err)
 	}
@@ -76,28 +85,7 @@ func GetGamePredictionsForDate(date string) ([]models.PredictionRecord, error) {
 	var predictionRecords []models.PredictionRecord
 
 	for gameRows.Next() {
-		var record models.PredictionRecord
-		err := gameRows.Scan(
-			&record.ID,
-			&record.GameDate,
-			&record.GameID,
-			&record.GameTitle,
-			&record.AwayTeamAbbrev,
-			&record.AwayTeamID,
-			&record.HomeTeamAbbrev,
-			&record.HomeTeamID,
-			&record.PlayerID,
-			&record.PlayerName,
-			&record.PlayerTeamAbbrev,
-			&record.PlayerTeamID,
-			&record.PredictedShots,
-			&record.Confidence,
-			&record.ActualShots,
-			&record.Successful,
-			&record.CreatedAt,
-			&record.ValidatedAt,
-			&record.ModelVersionID,
-		)
+		record, err := scanPredictionRecord(gameRows)
 		if err != nil {
 			return nil, fmt.Errorf("scan error: %w", err)
 		}
@@ -113,42 +101,16 @@ func GetGamePredictionsForDate(date string) ([]models.PredictionRecord, error) {
 	return predictionRecords, nil
 }
 
-func StoreActualShots(predictionRecord models.PredictionRecord, actualShots int) error {
-	tx, err := database.DB.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare(`
-		UPDATE game_predictions
-		SET actual_shots = ?, successful = ?, validated_at = ?
-		WHERE id = ?
-	`)
-
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	successful := actualShots >= int(predictionRecord.PredictedShots)
-
-	_, err = stmt.Exec(actualShots, successful, time.Now().Format("2006-01-02 15:04:05"), predictionRecord.ID)
-	if err != nil {
-		return err
-	}
-
-	return tx.Commit()
-}
-
-func GetTotalAccuracy() (float64, error) {
+// GetTotalAccuracy returns the share of a model's validated predictions that were successful
+func GetTotalAccuracy(modelVersionID int) (float64, error) {
 	query := `
-	SELECT COALESCE(AVG(successful), 0) FROM game_predictions
-		WHERE validated_at IS NOT NULL
+	SELECT COALESCE(AVG(successful), 0) FROM model_predictions
+		WHERE model_version_id = ?
+		AND validated_at IS NOT NULL
 		AND validated_at <= datetime('now', '+3 hours');
 	`
 
-	row := database.DB.QueryRow(query)
+	row := database.DB.QueryRow(query, modelVersionID)
 	var accuracy float64
 	err := row.Scan(&accuracy)
 	if err != nil {
@@ -157,13 +119,13 @@ func GetTotalAccuracy() (float64, error) {
 	return accuracy, nil
 }
 
-func GetPlayerPastPredictionAccuracy(playerID int) (float64, error) {
+func GetPlayerPastPredictionAccuracy(playerID int, modelVersionID int) (float64, error) {
 	query := `
-	SELECT COALESCE(AVG(successful), 0) FROM game_predictions
-	WHERE player_id = ?
+	SELECT COALESCE(AVG(successful), 0) FROM model_predictions
+	WHERE player_id = ? AND model_version_id = ?
 	`
 
-	row := database.DB.QueryRow(query, playerID)
+	row := database.DB.QueryRow(query, playerID, modelVersionID)
 	var accuracy float64
 	err := row.Scan(&accuracy)
 	if err != nil {
@@ -172,17 +134,14 @@ func GetPlayerPastPredictionAccuracy(playerID int) (float64, error) {
 	return accuracy, nil
 }
 
-func GetPlayerPredictionRecord(playerID int, gameID *int) (models.PredictionRecord, error) {
+func GetPlayerPredictionRecord(playerID int, gameID *int, modelVersionID int) (models.PredictionRecord, error) {
 	query := `
-	SELECT id, game_date, game_id, game_title,
-	       away_team_abbrev, away_team_id, home_team_abbrev, home_team_id,
-	       player_id, player_name, player_team_abbrev, player_team_id,
-	       predicted_shots, confidence, actual_shots, successful, created_at, validated_at, model_version_id
-	FROM game_predictions
-	WHERE player_id = ?
+	SELECT ` + predictionColumns + `
+	FROM model_predictions
+	WHERE player_id = ? AND model_version_id = ?
 	`
 
-	args := []interface{}{playerID}
+	args := []interface{}{playerID, modelVersionID}
 
 	if gameID != nil {
 		query += ` AND game_id = ?`
@@ -191,29 +150,7 @@ func GetPlayerPredictionRecord(playerID int, gameID *int) (models.PredictionReco
 
 	query += ` ORDER BY created_at DESC LIMIT 1`
 
-	row := database.DB.QueryRow(query, args...)
-	var predictionRecord models.PredictionRecord
-	err := row.Scan(
-		&predictionRecord.ID,
-		&predictionRecord.GameDate,
-		&predictionRecord.GameID,
-		&predictionRecord.GameTitle,
-		&predictionRecord.AwayTeamAbbrev,
-		&predictionRecord.AwayTeamID,
-		&predictionRecord.HomeTeamAbbrev,
-		&predictionRecord.HomeTeamID,
-		&predictionRecord.PlayerID,
-		&predictionRecord.PlayerName,
-		&predictionRecord.PlayerTeamAbbrev,
-		&predictionRecord.PlayerTeamID,
-		&predictionRecord.PredictedShots,
-		&predictionRecord.Confidence,
-		&predictionRecord.ActualShots,
-		&predictionRecord.Successful,
-		&predictionRecord.CreatedAt,
-		&predictionRecord.ValidatedAt,
-		&predictionRecord.ModelVersionID,
-	)
+	predictionRecord, err := scanPredictionRecord(database.DB.QueryRow(query, args...))
 	if err != nil {
 		return models.PredictionRecord{}, err
 	}
@@ -223,7 +160,7 @@ func GetPlayerPredictionRecord(playerID int, gameID *int) (models.PredictionReco
 // GetModelAccuracy calculates the accuracy for a specific model version
 func GetModelAccuracy(modelVersionID int) (float64, error) {
 	query := `
-	SELECT AVG(successful) FROM game_predictions
+	SELECT COALESCE(AVG(successful), 0) FROM model_predictions
 	WHERE validated_at IS NOT NULL
 	AND model_version_id = ?
 	`
@@ -241,7 +178,7 @@ func GetModelAccuracy(modelVersionID int) (float64, error) {
 func GetAllModelsAccuracy() (map[int]float64, error) {
 	query := `
 	SELECT model_version_id, AVG(successful) as accuracy
-	FROM game_predictions
+	FROM model_predictions
 	WHERE validated_at IS NOT NULL
 	GROUP BY model_version_id
 	`
@@ -265,27 +202,48 @@ func GetAllModelsAccuracy() (map[int]float64, error) {
 	return results, rows.Err()
 }
 
-// StoreModelPredictions stores predictions from multiple models for a game
+// StoreModelPredictions stores predictions from multiple models for a game,
+// along with the features behind each prediction when they were calculated
 func StoreModelPredictions(gameDate string, modelPredictions map[int][]models.GameWithPlayers) error {
 	tx, err := database.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	// Replacing a prediction gives it a new id, so its old features go first
+	deleteFeaturesStmt, err := tx.Prepare(`
+	DELETE FROM prediction_features
+	WHERE prediction_id IN (
+		SELECT id FROM model_predictions
+		WHERE game_id = ? AND player_id = ? AND model_version_id = ?
+	)`)
+	if err != nil {
+		return err
+	}
+	defer deleteFeaturesStmt.Close()
 
 	stmt, err := tx.Prepare(`
 	INSERT OR REPLACE INTO model_predictions (
 		game_date, game_id, game_title,
 		away_team_abbrev, away_team_id, home_team_abbrev, home_team_id,
 		player_id, player_name, player_team_abbrev, player_team_id,
-		model_version_id, predicted_shots, confidence, created_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
-
+		model_version_id, predicted_shots, confidence, created_at,
+		distribution, dispersion, shot_probabilities, line, over_probability, game_start_utc
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
 
+	featuresStmt, err := tx.Prepare(`
+	INSERT INTO prediction_features (` + predictionFeatureColumns + `, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer featuresStmt.Close()
+
 	// Current timestamp for all records
 	currentTime := time.Now().Format("2006-01-02 15:04:05")
 
@@ -293,7 +251,16 @@ func StoreModelPredictions(gameDate string, modelPredictions map[int][]models.Ga
 	for modelID, games := range modelPredictions {
 		for _, game := range games {
 			for _, player := range game.Players {
-				_, err = stmt.Exec(
+				if _, err := deleteFeaturesStmt.Exec(game.GameID, player.PlayerId, modelID); err != nil {
+					return err
+				}
+
+				shotProbabilities, err := json.Marshal(player.Distribution.AtLeast)
+				if err != nil {
+					return err
+				}
+
+				result, err := stmt.Exec(
 					gameDate,
 					game.GameID,
 					game.Title,
@@ -309,12 +276,27 @@ func StoreModelPredictions(gameDate string, modelPredictions map[int][]models.Ga
 					player.PredictedGameShots,
 					player.Confidence,
 					currentTime,
+					player.Distribution.Family,
+					sql.NullFloat64{Float64: player.Distribution.Dispersion, Valid: player.Distribution.Dispersion > 0},
+					string(shotProbabilities),
+					sql.NullFloat64{Float64: player.Distribution.Line, Valid: player.Distribution.Line > 0},
+					sql.NullFloat64{Float64: player.Distribution.OverProbability, Valid: player.Distribution.Line > 0},
+					sql.NullString{String: game.StartTimeUTC, Valid: game.StartTimeUTC != ""},
 				)
+				if err != nil {
+					return err
+				}
 
+				if player.Features == nil {
+					continue
+				}
+				predictionID, err := result.LastInsertId()
 				if err != nil {
-					tx.Rollback()
 					return err
 				}
+				if err := storePredictionFeatures(featuresStmt, predictionID, modelID, player.Features, currentTime); err != nil {
+					return fmt.Errorf("features for player %d in game %d: %w", player.PlayerId, game.GameID, err)
+				}
 			}
 		}
 	}
@@ -322,7 +304,12 @@ func StoreModelPredictions(gameDate string, modelPredictions map[int][]models.Ga
 	return tx.Commit()
 }
 
-// UpdateModelPredictionsWithActual updates the model predictions with actual shot data
+// UpdateModelPredictionsWithActual updates the model predictions with actual
+// shot data. Predictions with a line are successful when the player goes over
+// it and get log loss and Brier scores; older predictions are successful when
+// the player reaches the whole number of predicted shots. When the player has
+// a sportsbook line imported before the game started, each model's one unit
+// bet on it is settled too.
 func UpdateModelPredictionsWithActual(gameID int, playerID int, actualShots int) error {
 	tx, err := database.DB.Begin()
 	if err != nil {
@@ -330,9 +317,15 @@ func UpdateModelPredictionsWithActual(gameID int, playerID int, actualShots int)
 	}
 	defer tx.Rollback()
 
+	propLine, err := getPropLine(tx, gameID, playerID)
+	hasPropLine := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
 	// Get all model predictions for this game and player
 	rows, err := tx.Query(`
-		SELECT id, predicted_shots
+		SELECT id, predicted_shots, line, over_probability, shot_probabilities, game_start_utc
 		FROM model_predictions
 		WHERE game_id = ? AND player_id = ? AND actual_shots IS NULL`,
 		gameID, playerID)
@@ -344,7 +337,8 @@ func UpdateModelPredictionsWithActual(gameID int, playerID int, actualShots int)
 	// Update each prediction
 	updateStmt, err := tx.Prepare(`
 		UPDATE model_predictions
-		SET actual_shots = ?, successful = ?, validated_at = ?
+		SET actual_shots = ?, successful = ?, log_loss = ?, brier = ?, validated_at = ?,
+			prop_line = ?, prop_over_odds = ?, prop_under_odds = ?, bet_side = ?, bet_profit = ?
 		WHERE id = ?
 	`)
 	if err != nil {
@@ -357,15 +351,47 @@ func UpdateModelPredictionsWithActual(gameID int, playerID int, actualShots int)
 	for rows.Next() {
 		var id int
 		var predictedShots float64
-		err := rows.Scan(&id, &predictedShots)
+		var line, overProbability *float64
+		var shotProbabilities, gameStart sql.NullString
+		err := rows.Scan(&id, &predictedShots, &line, &overProbability, &shotProbabilities, &gameStart)
 		if err != nil {
 			return err
 		}
 
-		// A prediction is successful if the player gets at least the predicted number of shots
 		successful := actualShots >= int(predictedShots)
+		var logLoss, brier *float64
+		if line != nil && overProbability != nil {
+			var lineLogLoss, lineBrier float64
+			successful, lineLogLoss, lineBrier = models.ScoreLine(*line, *overProbability, actualShots)
+			logLoss, brier = &lineLogLoss, &lineBrier
+		}
+
+		// Bet from the shot probabilities recorded with the prediction
+		var settled *models.PropLine
+		var betSide *models.BetSide
+		var betProfit *float64
+		if hasPropLine && shotProbabilities.Valid && lineSetBeforeStart(propLine, gameStart) {
+			var distribution models.ShotDistribution
+			if err := json.Unmarshal([]byte(shotProbabilities.String), &distribution.AtLeast); err != nil {
+				return fmt.Errorf("shot probabilities for prediction %d: %w", id, err)
+			}
+			if probability, ok := distribution.OverProbabilityAt(propLine.Line); ok {
+				settled = &propLine
+				if side := propLine.Bet(probability); side != "" {
+					profit := propLine.Settle(side, actualShots)
+					betSide, betProfit = &side, &profit
+				}
+			}
+		}
 
-		_, err = updateStmt.Exec(actualShots, successful, currentTime, id)
+		var propLineValue *float64
+		var propOverOdds, propUnderOdds *int
+		if settled != nil {
+			propLineValue, propOverOdds, propUnderOdds = &settled.Line, &settled.OverOdds, settled.UnderOdds
+		}
+
+		_, err = updateStmt.Exec(actualShots, successful, logLoss, brier, currentTime,
+			propLineValue, propOverOdds, propUnderOdds, betSide, betProfit, id)
 		if err != nil {
 			return err
 		}
@@ -374,13 +400,29 @@ func UpdateModelPredictionsWithActual(gameID int, playerID int, actualShots int)
 	return tx.Commit()
 }
 
+// lineSetBeforeStart reports whether a line was last imported before the game
+// started. A line moved after puck drop could be bet with the game underway,
+// and predictions stored without a start time can't be checked.
+func lineSetBeforeStart(line models.PropLine, gameStart sql.NullString) bool {
+	if !gameStart.Valid {
+		return false
+	}
+	start, err := time.Parse(time.RFC3339, gameStart.String)
+	if err != nil {
+		return false
+	}
+	// Lines are stamped in server local time
+	updatedAt, err := time.ParseInLocation("2006-01-02 15:04:05", line.UpdatedAt, time.Local)
+	if err != nil {
+		return false
+	}
+	return updatedAt.Before(start)
+}
+
 // GetModelPredictionsForDate retrieves all model predictions for a specific date
 func GetModelPredictionsForDate(date string) (map[int][]models.PredictionRecord, error) {
 	query := `
-	SELECT id, game_date, game_id, game_title,
-	       away_team_abbrev, away_team_id, home_team_abbrev, home_team_id,
-	       player_id, player_name, player_team_abbrev, player_team_id,
-	       predicted_shots, confidence, actual_shots, successful, created_at, validated_at, model_version_id
+	SELECT ` + predictionColumns + `
 	FROM model_predictions
 	WHERE game_date = ?
 	ORDER BY model_version_id, game_id, player_team_id, confidence DESC;`
@@ -395,28 +437,7 @@ func GetModelPredictionsForDate(date string) (map[int][]models.PredictionRecord,
 	result := make(map[int][]models.PredictionRecord)
 
 	for rows.Next() {
-		var record models.PredictionRecord
-		err := rows.Scan(
-			&record.ID,
-			&record.GameDate,
-			&record.GameID,
-			&record.GameTitle,
-			&record.AwayTeamAbbrev,
-			&record.AwayTeamID,
-			&record.HomeTeamAbbrev,
-			&record.HomeTeamID,
-			&record.PlayerID,
-			&record.PlayerName,
-			&record.PlayerTeamAbbrev,
-			&record.PlayerTeamID,
-			&record.PredictedShots,
-			&record.Confidence,
-			&record.ActualShots,
-			&record.Successful,
-			&record.CreatedAt,
-			&record.ValidatedAt,
-			&record.ModelVersionID,
-		)
+		record, err := scanPredictionRecord(rows)
 		if err != nil {
 			return nil, fmt.Errorf("scan error: %w", err)
 		}
@@ -424,7 +445,7 @@ func GetModelPredictionsForDate(date string) (map[int][]models.PredictionRecord,
 		result[record.ModelVersionID] = append(result[record.ModelVersionID], record)
 	}
 
-	return result, nil
+	return result, rows.Err()
 }
 
 // GetModelComparisonStats returns accuracy statistics for all models
@@ -435,7 +456,13 @@ func GetModelComparisonStats() (map[int]models.ModelAccuracyStats, error) {
 		COUNT(*) as total_predictions,
 		SUM(CASE WHEN successful = 1 THEN 1 ELSE 0 END) as successful_predictions,
 		AVG(CASE WHEN successful = 1 THEN 1.0 ELSE 0.0 END) as accuracy,
-		AVG(ABS(predicted_shots - actual_shots)) as avg_error
+		AVG(ABS(predicted_shots - actual_shots)) as avg_error,
+		AVG(log_loss) as avg_log_loss,
+		AVG(brier) as avg_brier,
+		COUNT(bet_side) as bets,
+		SUM(CASE WHEN bet_side IS NOT NULL AND actual_shots = prop_line THEN 1 ELSE 0 END) as pushes,
+		COALESCE(SUM(bet_profit), 0) as bet_profit,
+		SUM(bet_profit) / NULLIF(SUM(CASE WHEN bet_side IS NOT NULL AND actual_shots != prop_line THEN 1 ELSE 0 END), 0) as roi
 	FROM model_predictions
 	WHERE validated_at IS NOT NULL
 	GROUP BY model_version_id
@@ -459,6 +486,12 @@ func GetModelComparisonStats() (map[int]models.ModelAccuracyStats, error) {
 			&modelStats.SuccessfulPredictions,
 			&modelStats.Accuracy,
 			&modelStats.AvgError,
+			&modelStats.AvgLogLoss,
+			&modelStats.AvgBrier,
+			&modelStats.Bets,
+			&modelStats.Pushes,
+			&modelStats.BetProfit,
+			&modelStats.ROI,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan error: %w", err)
@@ -469,3 +502,126 @@ func GetModelComparisonStats() (map[int]models.ModelAccuracyStats, error) {
 
 	return stats, nil
 }
+
+// StorePredictionInputs records the inputs predictions were made from. Only the
+// first capture for a date is kept so later runs can't overwrite pre-game data.
+func StorePredictionInputs(inputs models.PredictionInputs) error {
+	data, err := json.Marshal(inputs)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT OR IGNORE INTO prediction_input_snapshots (game_date, inputs, created_at)
+		VALUES (?, ?, ?)`,
+		inputs.Date, string(data), time.Now().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// GetPredictionInputs returns the recorded inputs for a date, sql.ErrNoRows if none were captured
+func GetPredictionInputs(date string) (*models.PredictionInputs, error) {
+	var data string
+	err := database.DB.QueryRow(`SELECT inputs FROM prediction_input_snapshots WHERE game_date = ?`, date).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs models.PredictionInputs
+	if err := json.Unmarshal([]byte(data), &inputs); err != nil {
+		return nil, fmt.Errorf("prediction inputs for %s: %w", date, err)
+	}
+	return &inputs, nil
+}
+
+// GetPredictionInputDates lists the dates from startDate to endDate (inclusive)
+// with recorded prediction inputs, oldest first
+func GetPredictionInputDates(startDate string, endDate string) ([]string, error) {
+	rows, err := database.DB.Query(`
+		SELECT game_date FROM prediction_input_snapshots
+		WHERE game_date BETWEEN ? AND ?
+		ORDER BY game_date`, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []string
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		dates = append(dates, date)
+	}
+
+	return dates, rows.Err()
+}
+
+// ValidatedShot is a player's actual shots in a game that predictions were validated against
+type ValidatedShot struct {
+	GameDate    string
+	GameID      int
+	PlayerID    int
+	ActualShots int
+}
+
+// GetValidatedShots returns the actual shots recorded for every predicted
+// player from startDate to endDate (inclusive), once per game and player no
+// matter how many models predicted them
+func GetValidatedShots(startDate string, endDate string) ([]ValidatedShot, error) {
+	rows, err := database.DB.Query(`
+		SELECT game_date, game_id, player_id, MAX(actual_shots)
+		FROM model_predictions
+		WHERE actual_shots IS NOT NULL AND game_date BETWEEN ? AND ?
+		GROUP BY game_date, game_id, player_id
+		ORDER BY game_date, game_id, player_id`, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	var shots []ValidatedShot
+	for rows.Next() {
+		var shot ValidatedShot
+		if err := rows.Scan(&shot.GameDate, &shot.GameID, &shot.PlayerID, &shot.ActualShots); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		shots = append(shots, shot)
+	}
+
+	return shots, rows.Err()
+}
+
+// ConfidenceOutcome is a validated prediction's confidence score and whether it went over its line
+type ConfidenceOutcome struct {
+	Confidence float64
+	Successful bool
+}
+
+// GetConfidenceOutcomes returns the confidence and outcome of a model's
+// validated predictions that were made over a line, lowest confidence first.
+// Older predictions without a line were graded by a different rule and are
+// left out so they don't skew the fit.
+func GetConfidenceOutcomes(modelVersionID int) ([]ConfidenceOutcome, error) {
+	rows, err := database.DB.Query(`
+		SELECT confidence, successful
+		FROM model_predictions
+		WHERE model_version_id = ? AND validated_at IS NOT NULL AND successful IS NOT NULL
+		  AND line IS NOT NULL AND over_probability IS NOT NULL
+		ORDER BY confidence`, modelVersionID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	var outcomes []ConfidenceOutcome
+	for rows.Next() {
+		var outcome ConfidenceOutcome
+		if err := rows.Scan(&outcome.Confidence, &outcome.Successful); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		outcomes = append(outcomes, outcome)
+	}
+
+	return outcomes, rows.Err()
+}
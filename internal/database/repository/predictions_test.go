@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+func TestLineSetBeforeStart(t *testing.T) {
+	start := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	stamp := func(at time.Time) models.PropLine {
+		return models.PropLine{UpdatedAt: at.In(time.Local).Format("2006-01-02 15:04:05")}
+	}
+	gameStart := sql.NullString{String: start.Format(time.RFC3339), Valid: true}
+
+	tests := []struct {
+		name      string
+		line      models.PropLine
+		gameStart sql.NullString
+		want      bool
+	}{
+		{"imported before puck drop", stamp(start.Add(-time.Hour)), gameStart, true},
+		{"moved after puck drop", stamp(start.Add(time.Minute)), gameStart, false},
+		{"imported at puck drop", stamp(start), gameStart, false},
+		{"prediction without a start time", stamp(start.Add(-time.Hour)), sql.NullString{}, false},
+		{"unreadable start time", stamp(start.Add(-time.Hour)), sql.NullString{String: "tonight", Valid: true}, false},
+	}
+	for _, tt := range tests {
+		if got := lineSetBeforeStart(tt.line, tt.gameStart); got != tt.want {
+			t.Errorf("%s: lineSetBeforeStart = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
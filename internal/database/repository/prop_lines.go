@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+const propLineColumns = `game_id, player_id, sportsbook, line, over_odds, under_odds, updated_at`
+
+// StorePropLines stores sportsbook lines, replacing each player's earlier
+// line for the game
+func StorePropLines(lines []models.PropLine) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+	INSERT INTO prop_lines (` + propLineColumns + `)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(game_id, player_id) DO UPDATE SET
+		sportsbook = excluded.sportsbook, line = excluded.line, over_odds = excluded.over_odds,
+		under_odds = excluded.under_odds, updated_at = excluded.updated_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	updatedAt := time.Now().Format("2006-01-02 15:04:05")
+	for _, line := range lines {
+		_, err := stmt.Exec(line.GameID, line.PlayerID, line.Sportsbook, line.Line, line.OverOdds, line.UnderOdds, updatedAt)
+		if err != nil {
+			return fmt.Errorf("line for player %d in game %d: %w", line.PlayerID, line.GameID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetPropLinesForGame returns a game's lines by player id
+func GetPropLinesForGame(gameID int) (map[int]models.PropLine, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+propLineColumns+`
+		FROM prop_lines
+		WHERE game_id = ?`, gameID)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	lines := make(map[int]models.PropLine)
+	for rows.Next() {
+		line, err := scanPropLine(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		lines[line.PlayerID] = line
+	}
+
+	return lines, rows.Err()
+}
+
+// getPropLine returns a player's line for a game, sql.ErrNoRows when there is none
+func getPropLine(exec execer, gameID int, playerID int) (models.PropLine, error) {
+	return scanPropLine(exec.QueryRow(`
+		SELECT `+propLineColumns+`
+		FROM prop_lines
+		WHERE game_id = ? AND player_id = ?`, gameID, playerID))
+}
+
+func scanPropLine(row rowScanner) (models.PropLine, error) {
+	var line models.PropLine
+	err := row.Scan(
+		&line.GameID,
+		&line.PlayerID,
+		&line.Sportsbook,
+		&line.Line,
+		&line.OverOdds,
+		&line.UnderOdds,
+		&line.UpdatedAt,
+	)
+	return line, err
+}
@@ -0,0 +1,499 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"github.com/google/uuid"
+)
+
+// SYNC_PAGE_SIZE caps the entities returned by one pull, clients keep
+// pulling with the returned cursor while hasMore is set
+const SYNC_PAGE_SIZE = 1000
+
+// FULL_SYNC_CURSOR_PREFIX marks the cursors handed out between the pages of
+// a full sync
+const FULL_SYNC_CURSOR_PREFIX = "f"
+
+const (
+	SyncOperationUpsert = "upsert"
+	SyncOperationDelete = "delete"
+
+	SyncStatusApplied  = "applied"
+	SyncStatusConflict = "conflict"
+	SyncStatusError    = "error"
+)
+
+// CHANGE_LOG_RETENTION_DAYS is how long deletions stay in the change log,
+// clients that haven't synced since have to do a full sync
+const CHANGE_LOG_RETENTION_DAYS = 90
+
+var ErrInvalidCursor = errors.New("invalid sync cursor")
+var ErrCursorExpired = errors.New("sync cursor has expired, pull a full sync")
+var ErrDeletedOnServer = errors.New("entity was deleted on the server")
+
+type Tombstone struct {
+	EntityType string `json:"entityType"`
+	ID         string `json:"id"`
+	DeletedAt  string `json:"deletedAt"`
+}
+
+type SyncChanges struct {
+	Cursor       string        `json:"cursor"`
+	HasMore      bool          `json:"hasMore"`
+	Categories   []Category    `json:"categories"`
+	Budgets      []Budget      `json:"budgets"`
+	Transactions []Transaction `json:"transactions"`
+	Deleted      []Tombstone   `json:"deleted"`
+}
+
+// SyncChange is one client side change. Updates are merge patches applied
+// only if the entity is still at baseVersion, or baseUpdatedAt for clients
+// that don't track versions. An upsert of an unknown ID creates the entity
+// with that ID so offline-created rows keep their identity.
+type SyncChange struct {
+	EntityType    string `json:"entityType"`
+	ID            string `json:"id"`
+	Operation     string `json:"operation"`
+	BaseVersion   *int   `json:"baseVersion,omitempty"`
+	BaseUpdatedAt string `json:"baseUpdatedAt,omitempty"`
+	Data          Patch  `json:"data,omitempty"`
+}
+
+type SyncResult struct {
+	Index      int          `json:"index"`
+	EntityType string       `json:"entityType"`
+	ID         string       `json:"id"`
+	Status     string       `json:"status"`
+	Message    string       `json:"message,omitempty"`
+	Fields     []FieldError `json:"fields,omitempty"`
+	Entity     interface{}  `json:"entity,omitempty"` // the server's copy, after the change or at the conflict
+}
+
+// GetSyncChanges returns every category, budget and transaction changed
+// after cursor, deletions as tombstones. An empty cursor is a full sync.
+// Several changes to one entity collapse into its current state. A cursor
+// from before the household's purged deletions gets ErrCursorExpired.
+func GetSyncChanges(householdID string, cursor string) (*SyncChanges, error) {
+	since, full, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deletions up to the horizon are gone from the log, an incremental
+	// cursor from before it would never see them
+	var purgedThrough int64
+	err = database.DB.QueryRow("SELECT purged_through FROM sync_horizons WHERE household_id = ?", householdID).Scan(&purgedThrough)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if !full && since < purgedThrough {
+		return nil, ErrCursorExpired
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT entity_type, entity_id, MAX(seq), MAX(changed_at)
+		FROM change_log
+		WHERE household_id = ? AND seq > ?
+		GROUP BY entity_type, entity_id
+		ORDER BY MAX(seq)
+		LIMIT ?
+	`, householdID, since, SYNC_PAGE_SIZE+1)
+	if err != nil {
+		return nil, err
+	}
+
+	type change struct {
+		entityType, entityID, changedAt string
+		seq                             int64
+	}
+	var changed []change
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.entityType, &c.entityID, &c.seq, &c.changedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		changed = append(changed, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &SyncChanges{
+		Categories:   []Category{},
+		Budgets:      []Budget{},
+		Transactions: []Transaction{},
+		Deleted:      []Tombstone{},
+	}
+	if len(changed) > SYNC_PAGE_SIZE {
+		changed = changed[:SYNC_PAGE_SIZE]
+		result.HasMore = true
+	}
+
+	next := since
+	if len(changed) == 0 {
+		// Nothing new, hand back the latest cursor so an empty full sync
+		// still moves the client forward
+		if err := database.DB.QueryRow("SELECT COALESCE(MAX(seq), ?) FROM change_log WHERE household_id = ?", since, householdID).Scan(&next); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range changed {
+		next = c.seq
+		entity, err := loadEntity(database.DB, c.entityType, c.entityID, householdID)
+		if err != nil {
+			return nil, err
+		}
+		switch e := entity.(type) {
+		case nil:
+			result.Deleted = append(result.Deleted, Tombstone{
+				EntityType: c.entityType,
+				ID:         c.entityID,
+				DeletedAt:  parseTimestamp(c.changedAt).Format(time.RFC3339),
+			})
+		case *Category:
+			result.Categories = append(result.Categories, *e)
+		case *Budget:
+			result.Budgets = append(result.Budgets, *e)
+		case *Transaction:
+			result.Transactions = append(result.Transactions, *e)
+		}
+	}
+
+	switch {
+	case result.HasMore && full:
+		// The rest of a full sync may still be behind the horizon
+		result.Cursor = FULL_SYNC_CURSOR_PREFIX + strconv.FormatInt(next, 10)
+	case !result.HasMore:
+		// Nothing is left past next, so the client is caught up to the horizon
+		result.Cursor = strconv.FormatInt(max(next, purgedThrough), 10)
+	default:
+		result.Cursor = strconv.FormatInt(next, 10)
+	}
+	return result, nil
+}
+
+// ApplySyncChanges applies a batch of client changes in order, each on its
+// own so one conflict or bad change doesn't hold back the rest of the batch
+func ApplySyncChanges(householdID string, userID int, changes []SyncChange) []SyncResult {
+	results := make([]SyncResult, 0, len(changes))
+	for i, change := range changes {
+		result := SyncResult{Index: i, EntityType: change.EntityType, ID: change.ID}
+
+		entity, err := applySyncChange(householdID, userID, change)
+		var validationErr *ValidationError
+		switch {
+		case err == nil:
+			result.Status = SyncStatusApplied
+			result.Entity = entity
+		case errors.Is(err, ErrVersionMismatch), errors.Is(err, ErrDeletedOnServer):
+			result.Status = SyncStatusConflict
+			result.Message = err.Error()
+			if current, loadErr := loadEntity(database.DB, change.EntityType, change.ID, householdID); loadErr == nil && current != nil {
+				result.Entity = current
+			}
+		case errors.As(err, &validationErr):
+			result.Status = SyncStatusError
+			result.Message = "invalid fields"
+			result.Fields = validationErr.Fields
+		case errors.Is(err, sql.ErrNoRows):
+			result.Status = SyncStatusError
+			result.Message = "not found"
+		default:
+			// Reported per change, the changes before it are already applied
+			result.Status = SyncStatusError
+			result.Message = err.Error()
+		}
+		if result.ID == "" {
+			if id := entityID(entity); id != "" {
+				result.ID = id
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+var ErrInvalidSyncChange = errors.New("entityType must be category, budget or transaction and operation upsert or delete")
+
+func applySyncChange(householdID string, userID int, change SyncChange) (interface{}, error) {
+	switch change.EntityType {
+	case EntityCategory, EntityBudget, EntityTransaction:
+	default:
+		return nil, ErrInvalidSyncChange
+	}
+
+	var current interface{}
+	if change.ID != "" {
+		var err error
+		current, err = loadEntity(database.DB, change.EntityType, change.ID, householdID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	expected, err := syncBaseVersion(change, current)
+	if err != nil {
+		return nil, err
+	}
+
+	switch change.Operation {
+	case SyncOperationDelete:
+		if current == nil {
+			// Deleting what is already gone is a no-op
+			return nil, nil
+		}
+		if !versionMatches(expected, entityVersion(current)) {
+			return nil, ErrVersionMismatch
+		}
+		switch change.EntityType {
+		case EntityCategory:
+			return nil, DeleteCategory(change.ID, householdID, userID)
+		case EntityBudget:
+			return nil, DeleteBudget(change.ID, householdID, userID)
+		default:
+			return nil, DeleteTransaction(change.ID, householdID, userID)
+		}
+
+	case SyncOperationUpsert:
+		if current == nil {
+			if change.BaseVersion != nil || change.BaseUpdatedAt != "" {
+				// Edited offline but deleted on the server
+				return nil, ErrDeletedOnServer
+			}
+			return createSyncedEntity(householdID, userID, change)
+		}
+		switch change.EntityType {
+		case EntityCategory:
+			return UpdateCategory(change.ID, householdID, userID, change.Data, expected)
+		case EntityBudget:
+			return UpdateBudget(change.ID, householdID, userID, change.Data, expected)
+		default:
+			return UpdateTransaction(change.ID, householdID, userID, change.Data, expected)
+		}
+	}
+	return nil, ErrInvalidSyncChange
+}
+
+// syncBaseVersion turns a change's baseVersion or baseUpdatedAt into the
+// If-Match versions the update is conditional on, nil when it isn't
+func syncBaseVersion(change SyncChange, current interface{}) ([]int, error) {
+	if change.BaseVersion != nil {
+		return []int{*change.BaseVersion}, nil
+	}
+	if current == nil {
+		return nil, nil
+	}
+	if change.BaseUpdatedAt == "" {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var fields struct {
+		UpdatedAt string `json:"updatedAt"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if !parseTimestamp(fields.UpdatedAt).Equal(parseTimestamp(change.BaseUpdatedAt)) {
+		return nil, ErrVersionMismatch
+	}
+	return []int{entityVersion(current)}, nil
+}
+
+// createSyncedEntity creates an entity from a sync upsert, keeping the
+// client's ID when it sent one
+func createSyncedEntity(householdID string, userID int, change SyncChange) (interface{}, error) {
+	data, err := json.Marshal(change.Data)
+	if err != nil {
+		return nil, err
+	}
+	id := change.ID
+	if id == "" {
+		id = uuid.New().String()
+	} else if parsed, err := uuid.Parse(id); err != nil || parsed.String() != id {
+		return nil, &ValidationError{Fields: []FieldError{{Field: "id", Message: "must be a lowercase UUID"}}}
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	switch change.EntityType {
+	case EntityCategory:
+		var c Category
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "data", Message: err.Error()}}}
+		}
+		if c.Name == "" {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "name", Message: "can't be empty"}}}
+		}
+		if c.TaxClass != nil && !IsValidTaxClass(*c.TaxClass) {
+			return nil, ErrInvalidTaxClass
+		}
+		c.ID, c.Version, c.CreatedAt, c.UpdatedAt = id, 1, now, now
+		return &c, inTransaction(func(tx *sql.Tx) error {
+			if err := insertCategory(tx, c, householdID, userID); err != nil {
+				return err
+			}
+			return writeAudit(tx, householdID, userID, EntityCategory, c.ID, AuditActionCreate, nil, c)
+		})
+
+	case EntityBudget:
+		var b Budget
+		if err := json.Unmarshal(data, &b); err != nil {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "data", Message: err.Error()}}}
+		}
+		if !isValidMonth(b.Month) {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "month", Message: "must be YYYY-MM"}}}
+		}
+		if b.Allocations == nil {
+			b.Allocations = map[string]float64{}
+		}
+		b.ID, b.Version, b.CreatedAt, b.UpdatedAt = id, 1, now, now
+		return &b, inTransaction(func(tx *sql.Tx) error {
+			var existing string
+			err := tx.QueryRow("SELECT id FROM budgets WHERE household_id = ? AND month = ?", householdID, b.Month).Scan(&existing)
+			if err == nil {
+				return &ValidationError{Fields: []FieldError{{Field: "month", Message: fmt.Sprintf("a budget for %s already exists", b.Month)}}}
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			if err := insertBudget(tx, b, householdID, userID); err != nil {
+				return err
+			}
+			return writeAudit(tx, householdID, userID, EntityBudget, b.ID, AuditActionCreate, nil, b)
+		})
+
+	default:
+		var t Transaction
+		if err := json.Unmarshal(data, &t); err != nil {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "data", Message: err.Error()}}}
+		}
+		if !isValidTransactionDate(t.Date) {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "date", Message: "must be YYYY-MM-DD"}}}
+		}
+		if t.TransactionType != "" && !isValidTransactionType(t.TransactionType) {
+			return nil, &ValidationError{Fields: []FieldError{{Field: "transactionType", Message: "must be DEBIT or CREDIT"}}}
+		}
+		if t.CategoryID != nil {
+			if _, err := getCategory(database.DB, *t.CategoryID, householdID); errors.Is(err, sql.ErrNoRows) {
+				return nil, &ValidationError{Fields: []FieldError{{Field: "categoryId", Message: "category not found"}}}
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		batch, err := newTransactionBatch(householdID, userID)
+		if err != nil {
+			return nil, err
+		}
+		prepared, err := batch.prepare([]Transaction{t})
+		if err != nil {
+			return nil, err
+		}
+		prepared[0].ID = id
+
+		var saved []Transaction
+		err = inTransaction(func(tx *sql.Tx) error {
+			saved, err = batch.insert(tx, prepared)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &saved[0], nil
+	}
+}
+
+// PurgeChangeLog compacts the change log. Pulls only read the latest change
+// to each entity, so older rows for it go first. Deletions older than
+// CHANGE_LOG_RETENTION_DAYS go too, moving the household's horizon past them
+// so cursors from before it are sent back for a full sync.
+func PurgeChangeLog() (int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		DELETE FROM change_log WHERE seq NOT IN (
+			SELECT MAX(seq) FROM change_log GROUP BY household_id, entity_type, entity_id
+		)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	superseded, _ := result.RowsAffected()
+
+	// changed_at is written by SQLite in UTC
+	cutoff := time.Now().UTC().AddDate(0, 0, -CHANGE_LOG_RETENTION_DAYS).Format("2006-01-02 15:04:05")
+	if _, err := tx.Exec(`
+		INSERT INTO sync_horizons (household_id, purged_through)
+		SELECT household_id, MAX(seq) FROM change_log
+		WHERE operation = ? AND changed_at < ?
+		GROUP BY household_id
+		ON CONFLICT(household_id) DO UPDATE SET purged_through = MAX(purged_through, excluded.purged_through)
+	`, SyncOperationDelete, cutoff); err != nil {
+		return 0, err
+	}
+
+	result, err = tx.Exec("DELETE FROM change_log WHERE operation = ? AND changed_at < ?", SyncOperationDelete, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	expired, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(superseded + expired), nil
+}
+
+func inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// parseCursor returns the seq a pull continues from and whether it's part of
+// a full sync, which doesn't need the deletions purged from the log
+func parseCursor(cursor string) (since int64, full bool, err error) {
+	if cursor == "" {
+		return 0, true, nil
+	}
+	seq, full := strings.CutPrefix(cursor, FULL_SYNC_CURSOR_PREFIX)
+	since, err = strconv.ParseInt(seq, 10, 64)
+	if err != nil || since < 0 {
+		return 0, false, fmt.Errorf("%w: %q", ErrInvalidCursor, cursor)
+	}
+	return since, full, nil
+}
+
+func entityID(entity interface{}) string {
+	switch e := entity.(type) {
+	case *Category:
+		return e.ID
+	case *Budget:
+		return e.ID
+	case *Transaction:
+		return e.ID
+	}
+	return ""
+}
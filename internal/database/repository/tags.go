@@ -0,0 +1,372 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidTagName = errors.New("tag name is required")
+var ErrTagExists = errors.New("a tag with this name already exists")
+
+type Tag struct {
+	ID               string  `json:"id"`
+	Name             string  `json:"name"`
+	Color            *string `json:"color,omitempty"`
+	TaxClass         *string `json:"taxClass,omitempty"`
+	TransactionCount int     `json:"transactionCount"`
+	CreatedAt        string  `json:"createdAt"`
+	UpdatedAt        string  `json:"updatedAt"`
+}
+
+type TagReport struct {
+	TagID            string             `json:"tagId"`
+	Name             string             `json:"name"`
+	Color            *string            `json:"color,omitempty"`
+	TransactionCount int                `json:"transactionCount"`
+	Spent            float64            `json:"spent"`
+	Income           float64            `json:"income"`
+	Net              float64            `json:"net"`
+	ByCategory       map[string]float64 `json:"byCategory"` // spent per category ID, "" for uncategorized
+	ByMonth          map[string]float64 `json:"byMonth"`    // spent per YYYY-MM
+	FirstDate        string             `json:"firstDate,omitempty"`
+	LastDate         string             `json:"lastDate,omitempty"`
+}
+
+// NormalizeTagName trims and lowercases a tag so "Vacation-2026 " and
+// "vacation-2026" are the same tag
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func GetTags(householdID string) ([]Tag, error) {
+	rows, err := database.DB.Query(`
+		SELECT t.id, t.name, t.color, t.tax_class, COUNT(tt.transaction_id), t.created_at, t.updated_at
+		FROM tags t
+		LEFT JOIN transaction_tags tt ON tt.tag_id = t.id
+		WHERE t.household_id = ?
+		GROUP BY t.id
+		ORDER BY t.name
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.Color, &t.TaxClass, &t.TransactionCount, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func SaveTag(tag Tag, householdID string, userID int) (*Tag, error) {
+	tag.Name = NormalizeTagName(tag.Name)
+	if tag.Name == "" {
+		return nil, ErrInvalidTagName
+	}
+	if tag.TaxClass != nil && !IsValidTaxClass(*tag.TaxClass) {
+		return nil, ErrInvalidTaxClass
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := findTagID(tx, householdID, tag.Name); err == nil {
+		return nil, ErrTagExists
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	tag.ID = uuid.New().String()
+	tag.TransactionCount = 0
+	tag.CreatedAt = now
+	tag.UpdatedAt = now
+
+	_, err = tx.Exec(`
+		INSERT INTO tags (id, household_id, name, color, tax_class, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, tag.ID, householdID, tag.Name, tag.Color, tag.TaxClass, tag.CreatedAt, tag.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeAudit(tx, householdID, userID, EntityTag, tag.ID, AuditActionCreate, nil, tag); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func UpdateTag(id string, householdID string, userID int, patch Patch) (*Tag, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var tag Tag
+	err = tx.QueryRow(`
+		SELECT id, name, color, tax_class, created_at, updated_at
+		FROM tags WHERE id = ? AND household_id = ?
+	`, id, householdID).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.TaxClass, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	before := tag
+
+	fields := newPatchReader(patch, []string{"name", "color", "taxClass"}, []string{"id", "transactionCount", "createdAt", "updatedAt"})
+	var name string
+	if fields.String("name", &name) {
+		if name = NormalizeTagName(name); name == "" {
+			fields.fail("name", "%s", ErrInvalidTagName)
+		} else {
+			tag.Name = name
+		}
+	}
+	fields.NullableString("color", &tag.Color)
+	if fields.NullableString("taxClass", &tag.TaxClass) && tag.TaxClass != nil && !IsValidTaxClass(*tag.TaxClass) {
+		fields.fail("taxClass", "%s", ErrInvalidTaxClass)
+	}
+	if err := fields.err(); err != nil {
+		return nil, err
+	}
+	if tag.Name != before.Name {
+		if existingID, err := findTagID(tx, householdID, tag.Name); err == nil && existingID != id {
+			return nil, ErrTagExists
+		}
+	}
+	tag.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
+
+	_, err = tx.Exec(`
+		UPDATE tags SET name = ?, color = ?, tax_class = ?, updated_at = ?
+		WHERE id = ?
+	`, tag.Name, tag.Color, tag.TaxClass, tag.UpdatedAt, id)
+	if err != nil {
+		return nil, err
+	}
+	if tag.Name != before.Name {
+		if err := bumpTaggedTransactions(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.QueryRow("SELECT COUNT(*) FROM transaction_tags WHERE tag_id = ?", id).Scan(&tag.TransactionCount); err != nil {
+		return nil, err
+	}
+
+	if err := writeAudit(tx, householdID, userID, EntityTag, id, AuditActionUpdate, before, tag); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// DeleteTag removes the tag from every transaction and deletes it
+func DeleteTag(id string, householdID string, userID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tag Tag
+	err = tx.QueryRow(`
+		SELECT id, name, color, tax_class, created_at, updated_at
+		FROM tags WHERE id = ? AND household_id = ?
+	`, id, householdID).Scan(&tag.ID, &tag.Name, &tag.Color, &tag.TaxClass, &tag.CreatedAt, &tag.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := bumpTaggedTransactions(tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM transaction_tags WHERE tag_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	if err := writeAudit(tx, householdID, userID, EntityTag, id, AuditActionDelete, tag, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTagReport totals tagged spending per tag between from and to
+// (YYYY-MM-DD, inclusive, either may be empty) across categories and months
+func GetTagReport(householdID string, from string, to string) ([]TagReport, error) {
+	tags, err := GetTags(householdID)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := FilterTransactions(householdID, TransactionFilter{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make(map[string]*TagReport)
+	for _, tag := range tags {
+		reports[tag.Name] = &TagReport{
+			TagID:      tag.ID,
+			Name:       tag.Name,
+			Color:      tag.Color,
+			ByCategory: make(map[string]float64),
+			ByMonth:    make(map[string]float64),
+		}
+	}
+
+	for _, t := range transactions {
+		for _, name := range t.Tags {
+			report, exists := reports[name]
+			if !exists {
+				continue
+			}
+
+			report.TransactionCount++
+			amount := signedAmount(t)
+			if amount < 0 {
+				report.Spent += -amount
+				report.ByCategory[categoryKey(t.CategoryID)] += -amount
+				report.ByMonth[t.Date[:7]] += -amount
+			} else {
+				report.Income += amount
+			}
+
+			date := t.Date[:10]
+			if report.FirstDate == "" || date < report.FirstDate {
+				report.FirstDate = date
+			}
+			if date > report.LastDate {
+				report.LastDate = date
+			}
+		}
+	}
+
+	result := make([]TagReport, 0, len(reports))
+	for _, report := range reports {
+		report.Spent = roundCents(report.Spent)
+		report.Income = roundCents(report.Income)
+		report.Net = roundCents(report.Income - report.Spent)
+		for key, value := range report.ByCategory {
+			report.ByCategory[key] = roundCents(value)
+		}
+		for key, value := range report.ByMonth {
+			report.ByMonth[key] = roundCents(value)
+		}
+		result = append(result, *report)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Spent != result[j].Spent {
+			return result[i].Spent > result[j].Spent
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func findTagID(exec execer, householdID string, name string) (string, error) {
+	var id string
+	err := exec.QueryRow("SELECT id FROM tags WHERE household_id = ? AND name = ?", householdID, name).Scan(&id)
+	return id, err
+}
+
+// setTransactionTags replaces a transaction's tags, creating any tag that
+// does not exist yet
+func setTransactionTags(exec execer, transactionID string, householdID string, names []string) error {
+	if _, err := exec.Exec("DELETE FROM transaction_tags WHERE transaction_id = ?", transactionID); err != nil {
+		return err
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, name := range normalizeTagNames(names) {
+		tagID, err := findTagID(exec, householdID, name)
+		if err != nil {
+			tagID = uuid.New().String()
+			_, err = exec.Exec(`
+				INSERT INTO tags (id, household_id, name, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?)
+			`, tagID, householdID, name, now, now)
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := exec.Exec("INSERT OR IGNORE INTO transaction_tags (transaction_id, tag_id) VALUES (?, ?)", transactionID, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bumpTaggedTransactions moves the version of every transaction carrying the
+// tag, since their tag names are part of what clients cached
+func bumpTaggedTransactions(exec execer, tagID string) error {
+	_, err := exec.Exec(`
+		UPDATE transactions SET version = version + 1
+		WHERE id IN (SELECT transaction_id FROM transaction_tags WHERE tag_id = ?)
+	`, tagID)
+	return err
+}
+
+// loadTransactionTags returns the tag names of every tagged transaction in the household
+func loadTransactionTags(exec execer, householdID string) (map[string][]string, error) {
+	rows, err := exec.Query(`
+		SELECT tt.transaction_id, t.name
+		FROM transaction_tags tt
+		JOIN tags t ON t.id = tt.tag_id
+		WHERE t.household_id = ?
+		ORDER BY t.name
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var transactionID, name string
+		if err := rows.Scan(&transactionID, &name); err != nil {
+			return nil, err
+		}
+		tags[transactionID] = append(tags[transactionID], name)
+	}
+	return tags, rows.Err()
+}
+
+func normalizeTagNames(names []string) []string {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, name := range names {
+		name = NormalizeTagName(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"api.alexmontague.ca/internal/database"
+)
+
+const (
+	TaxClassMedical    = "medical"
+	TaxClassCharitable = "charitable"
+	TaxClassHomeOffice = "home_office"
+)
+
+var ErrInvalidTaxClass = errors.New("tax class must be medical, charitable or home_office")
+
+type TaxReportTransaction struct {
+	ID           string       `json:"id"`
+	Date         string       `json:"date"`
+	Merchant     string       `json:"merchant"`
+	Description  string       `json:"description"`
+	Amount       float64      `json:"amount"` // positive for expenses, negative for refunds
+	CategoryID   *string      `json:"categoryId,omitempty"`
+	CategoryName string       `json:"categoryName,omitempty"`
+	Tags         []string     `json:"tags,omitempty"`
+	Notes        *string      `json:"notes,omitempty"`
+	Source       string       `json:"source"` // "category" or "tag:<name>", what put it in this class
+	Attachments  []Attachment `json:"attachments"`
+}
+
+type TaxClassSummary struct {
+	TaxClass         string                 `json:"taxClass"`
+	Total            float64                `json:"total"`
+	TransactionCount int                    `json:"transactionCount"`
+	MissingReceipts  int                    `json:"missingReceipts"`
+	Transactions     []TaxReportTransaction `json:"transactions"`
+}
+
+type TaxReport struct {
+	Year    int               `json:"year"`
+	Total   float64           `json:"total"`
+	Classes []TaxClassSummary `json:"classes"`
+}
+
+func IsValidTaxClass(taxClass string) bool {
+	switch taxClass {
+	case TaxClassMedical, TaxClassCharitable, TaxClassHomeOffice:
+		return true
+	}
+	return false
+}
+
+// GetTaxReport groups the year's transactions by tax class. A tag's tax class
+// takes precedence over the category's since it is the more specific marking,
+// and each transaction is counted in one class only.
+func GetTaxReport(householdID string, year int) (*TaxReport, error) {
+	categories, err := GetCategories(householdID)
+	if err != nil {
+		return nil, err
+	}
+	categoryByID := make(map[string]Category)
+	for _, c := range categories {
+		categoryByID[c.ID] = c
+	}
+
+	tags, err := GetTags(householdID)
+	if err != nil {
+		return nil, err
+	}
+	tagClasses := make(map[string]string)
+	for _, t := range tags {
+		if t.TaxClass != nil {
+			tagClasses[t.Name] = *t.TaxClass
+		}
+	}
+
+	transactions, err := FilterTransactions(householdID, TransactionFilter{
+		From: fmt.Sprintf("%d-01-01", year),
+		To:   fmt.Sprintf("%d-12-31", year),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := queryAttachments(database.DB, "WHERE household_id = ? ORDER BY created_at", householdID)
+	if err != nil {
+		return nil, err
+	}
+	attachmentsByTransaction := make(map[string][]Attachment)
+	for _, a := range attachments {
+		attachmentsByTransaction[a.TransactionID] = append(attachmentsByTransaction[a.TransactionID], a)
+	}
+
+	summaries := make(map[string]*TaxClassSummary)
+	for _, t := range transactions {
+		taxClass, source := "", ""
+		// Tags are sorted by name so the first classified tag wins deterministically
+		for _, name := range t.Tags {
+			if class, ok := tagClasses[name]; ok {
+				taxClass, source = class, "tag:"+name
+				break
+			}
+		}
+
+		var category Category
+		if t.CategoryID != nil {
+			category = categoryByID[*t.CategoryID]
+		}
+		if taxClass == "" && category.TaxClass != nil {
+			taxClass, source = *category.TaxClass, "category"
+		}
+		if taxClass == "" {
+			continue
+		}
+
+		summary, exists := summaries[taxClass]
+		if !exists {
+			summary = &TaxClassSummary{TaxClass: taxClass, Transactions: []TaxReportTransaction{}}
+			summaries[taxClass] = summary
+		}
+
+		receipts := attachmentsByTransaction[t.ID]
+		if receipts == nil {
+			receipts = []Attachment{}
+			summary.MissingReceipts++
+		}
+
+		amount := -signedAmount(t)
+		summary.Total += amount
+		summary.TransactionCount++
+		summary.Transactions = append(summary.Transactions, TaxReportTransaction{
+			ID:           t.ID,
+			Date:         t.Date,
+			Merchant:     t.Merchant,
+			Description:  t.Description,
+			Amount:       roundCents(amount),
+			CategoryID:   t.CategoryID,
+			CategoryName: category.Name,
+			Tags:         t.Tags,
+			Notes:        t.Notes,
+			Source:       source,
+			Attachments:  receipts,
+		})
+	}
+
+	report := &TaxReport{Year: year, Classes: []TaxClassSummary{}}
+	for _, summary := range summaries {
+		summary.Total = roundCents(summary.Total)
+		report.Total += summary.Total
+		sort.Slice(summary.Transactions, func(i, j int) bool {
+			return summary.Transactions[i].Date < summary.Transactions[j].Date
+		})
+		report.Classes = append(report.Classes, *summary)
+	}
+	report.Total = roundCents(report.Total)
+	sort.Slice(report.Classes, func(i, j int) bool {
+		return report.Classes[i].TaxClass < report.Classes[j].TaxClass
+	})
+
+	return report, nil
+}
+
+// WriteTaxReportCSV writes one row per transaction of the report, receipts
+// are listed by filename with their download paths
+func WriteTaxReportCSV(report *TaxReport, w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"tax_class", "date", "merchant", "description", "category", "tags", "notes", "amount", "source", "receipts"}); err != nil {
+		return err
+	}
+
+	for _, summary := range report.Classes {
+		for _, t := range summary.Transactions {
+			receipts := make([]string, 0, len(t.Attachments))
+			for _, a := range t.Attachments {
+				receipts = append(receipts, a.Filename+" (/budget/attachments/"+a.ID+")")
+			}
+			notes := ""
+			if t.Notes != nil {
+				notes = *t.Notes
+			}
+
+			err := writer.Write([]string{
+				summary.TaxClass,
+				substr(t.Date, 0, 10),
+				t.Merchant,
+				t.Description,
+				t.CategoryName,
+				strings.Join(t.Tags, ";"),
+				notes,
+				fmt.Sprintf("%.2f", t.Amount),
+				t.Source,
+				strings.Join(receipts, ";"),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,414 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	"github.com/google/uuid"
+)
+
+// Template modes control how allocations are produced for a new month's budget
+const (
+	TemplateModeCategoryDefaults = "category_defaults" // each category's monthlyBudget
+	TemplateModeFixed            = "fixed"             // the allocations stored on the template
+	TemplateModeCopyLastMonth    = "copy_last_month"   // allocations of the most recent earlier budget
+	TemplateModeAverage          = "average"           // average spend per category over the last N months
+)
+
+const DEFAULT_AVERAGE_MONTHS = 3
+
+type BudgetTemplate struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Mode          string             `json:"mode"`
+	Allocations   map[string]float64 `json:"allocations"`
+	AverageMonths int                `json:"averageMonths"`
+	CreatedAt     string             `json:"createdAt"`
+	UpdatedAt     string             `json:"updatedAt"`
+}
+
+func isValidTemplateMode(mode string) bool {
+	switch mode {
+	case TemplateModeCategoryDefaults, TemplateModeFixed, TemplateModeCopyLastMonth, TemplateModeAverage:
+		return true
+	}
+	return false
+}
+
+func scanBudgetTemplate(scanner interface{ Scan(...any) error }) (*BudgetTemplate, error) {
+	var t BudgetTemplate
+	var allocationsJSON string
+	if err := scanner.Scan(&t.ID, &t.Name, &t.Mode, &allocationsJSON, &t.AverageMonths, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(allocationsJSON), &t.Allocations); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func GetBudgetTemplates(userID int) ([]BudgetTemplate, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, name, mode, allocations, average_months, created_at, updated_at
+		FROM budget_templates
+		WHERE user_id = ?
+		ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []BudgetTemplate{}
+	for rows.Next() {
+		t, err := scanBudgetTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *t)
+	}
+	return templates, rows.Err()
+}
+
+func GetBudgetTemplate(id string, userID int) (*BudgetTemplate, error) {
+	row := database.DB.QueryRow(`
+		SELECT id, name, mode, allocations, average_months, created_at, updated_at
+		FROM budget_templates
+		WHERE id = ? AND user_id = ?
+	`, id, userID)
+	return scanBudgetTemplate(row)
+}
+
+func SaveBudgetTemplate(template BudgetTemplate, userID int) (*BudgetTemplate, error) {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	template.ID = uuid.New().String()
+	template.CreatedAt = now
+	template.UpdatedAt = now
+
+	if template.Mode == "" {
+		template.Mode = TemplateModeCategoryDefaults
+	}
+	if !isValidTemplateMode(template.Mode) {
+		return nil, fmt.Errorf("invalid template mode: %s", template.Mode)
+	}
+	if template.AverageMonths <= 0 {
+		template.AverageMonths = DEFAULT_AVERAGE_MONTHS
+	}
+	if template.Allocations == nil {
+		template.Allocations = map[string]float64{}
+	}
+
+	allocationsJSON, err := json.Marshal(template.Allocations)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO budget_templates (id, name, mode, allocations, average_months, user_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, template.ID, template.Name, template.Mode, string(allocationsJSON), template.AverageMonths, userID, template.CreatedAt, template.UpdatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func UpdateBudgetTemplate(id string, userID int, updates map[string]interface{}) (*BudgetTemplate, error) {
+	now := time.Now().Format("2006-01-02 15:04:05")
+
+	template, err := GetBudgetTemplate(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if name, ok := updates["name"].(string); ok {
+		template.Name = name
+	}
+	if mode, ok := updates["mode"].(string); ok {
+		if !isValidTemplateMode(mode) {
+			return nil, fmt.Errorf("invalid template mode: %s", mode)
+		}
+		template.Mode = mode
+	}
+	if averageMonths, ok := updates["averageMonths"].(float64); ok && averageMonths > 0 {
+		template.AverageMonths = int(averageMonths)
+	}
+	if allocations, ok := updates["allocations"].(map[string]interface{}); ok {
+		alloc := make(map[string]float64)
+		for k, v := range allocations {
+			if val, ok := v.(float64); ok {
+				alloc[k] = val
+			}
+		}
+		template.Allocations = alloc
+	}
+	template.UpdatedAt = now
+
+	allocationsJSON, err := json.Marshal(template.Allocations)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE budget_templates
+		SET name = ?, mode = ?, allocations = ?, average_months = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`, template.Name, template.Mode, string(allocationsJSON), template.AverageMonths, template.UpdatedAt, id, userID)
+
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func DeleteBudgetTemplate(id string, userID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Unset the selection explicitly in case foreign keys are not enforced on this connection
+	if _, err := tx.Exec("UPDATE users SET budget_template_id = NULL WHERE id = ? AND budget_template_id = ?", userID, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM budget_templates WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetUserBudgetTemplate returns the template selected by the user, or nil when
+// the user relies on the category defaults
+func GetUserBudgetTemplate(userID int) (*BudgetTemplate, error) {
+	var templateID sql.NullString
+	err := database.DB.QueryRow("SELECT budget_template_id FROM users WHERE id = ?", userID).Scan(&templateID)
+	if err != nil {
+		return nil, err
+	}
+	if !templateID.Valid {
+		return nil, nil
+	}
+
+	template, err := GetBudgetTemplate(templateID.String, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return template, err
+}
+
+// SetUserBudgetTemplate stores the user's template choice, a nil templateID
+// resets the user to the category defaults
+func SetUserBudgetTemplate(userID int, templateID *string) error {
+	if templateID != nil {
+		if _, err := GetBudgetTemplate(*templateID, userID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().Format("2006-01-02 15:04:05")
+	_, err := database.DB.Exec("UPDATE users SET budget_template_id = ?, updated_at = ? WHERE id = ?", templateID, now, userID)
+	return err
+}
+
+// BuildBudgetAllocations produces the allocations for a new household budget
+// for month (YYYY-MM) using the template selected by userID
+func BuildBudgetAllocations(householdID string, userID int, month string, categories []Category) (map[string]float64, error) {
+	template, err := GetUserBudgetTemplate(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	allocations := categoryDefaultAllocations(categories)
+	if template == nil {
+		return allocations, nil
+	}
+
+	switch template.Mode {
+	case TemplateModeFixed:
+		for _, cat := range categories {
+			if amount, ok := template.Allocations[cat.ID]; ok {
+				allocations[cat.ID] = amount
+			}
+		}
+	case TemplateModeCopyLastMonth:
+		previous, err := getPreviousBudget(householdID, month)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil {
+			for _, cat := range categories {
+				if amount, ok := previous.Allocations[cat.ID]; ok {
+					allocations[cat.ID] = amount
+				}
+			}
+		}
+	case TemplateModeAverage:
+		averages, err := getAverageCategorySpend(householdID, month, template.AverageMonths)
+		if err != nil {
+			return nil, err
+		}
+		if averages != nil {
+			for _, cat := range categories {
+				allocations[cat.ID] = averages[cat.ID]
+			}
+		}
+	}
+
+	return allocations, nil
+}
+
+// CreateBudgetForMonth returns the household's budget for month, creating it
+// from userID's template if it does not exist yet
+func CreateBudgetForMonth(householdID string, userID int, month string) (*Budget, bool, error) {
+	if _, err := time.Parse("2006-01", month); err != nil {
+		return nil, false, fmt.Errorf("invalid month %q, expected YYYY-MM", month)
+	}
+
+	var existing Budget
+	var allocationsJSON string
+	err := database.DB.QueryRow(`
+		SELECT id, month, allocations, created_at, updated_at
+		FROM budgets WHERE household_id = ? AND month = ?
+	`, householdID, month).Scan(&existing.ID, &existing.Month, &allocationsJSON, &existing.CreatedAt, &existing.UpdatedAt)
+	if err == nil {
+		if err := json.Unmarshal([]byte(allocationsJSON), &existing.Allocations); err != nil {
+			return nil, false, err
+		}
+		return &existing, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	categories, err := GetCategories(householdID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	allocations, err := BuildBudgetAllocations(householdID, userID, month, categories)
+	if err != nil {
+		return nil, false, err
+	}
+
+	saved, err := SaveBudget(Budget{Month: month, Allocations: allocations}, householdID, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	return saved, true, nil
+}
+
+// CreateMonthlyBudgets creates the budget for month for every household that
+// does not have one yet, using the template selected by the household's owner.
+// Households that fail are skipped and their errors returned together.
+func CreateMonthlyBudgets(month string) (int, error) {
+	owners, err := GetHouseholdOwners()
+	if err != nil {
+		return 0, err
+	}
+
+	// A household that fails doesn't stop the rest, its error is returned
+	// with the others once every household has been tried
+	created := 0
+	var failures []error
+	for householdID, ownerID := range owners {
+		_, isNew, err := CreateBudgetForMonth(householdID, ownerID, month)
+		if err != nil {
+			failures = append(failures, fmt.Errorf("failed to create %s budget for household %s: %w", month, householdID, err))
+			continue
+		}
+		if isNew {
+			created++
+		}
+	}
+	return created, errors.Join(failures...)
+}
+
+// Helpers
+func categoryDefaultAllocations(categories []Category) map[string]float64 {
+	allocations := make(map[string]float64)
+	for _, cat := range categories {
+		if cat.MonthlyBudget != nil {
+			allocations[cat.ID] = *cat.MonthlyBudget
+		} else {
+			allocations[cat.ID] = 0
+		}
+	}
+	return allocations
+}
+
+func getPreviousBudget(householdID string, month string) (*Budget, error) {
+	var b Budget
+	var allocationsJSON string
+	err := database.DB.QueryRow(`
+		SELECT id, month, allocations, created_at, updated_at
+		FROM budgets
+		WHERE household_id = ? AND month < ?
+		ORDER BY month DESC
+		LIMIT 1
+	`, householdID, month).Scan(&b.ID, &b.Month, &allocationsJSON, &b.CreatedAt, &b.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(allocationsJSON), &b.Allocations); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// getAverageCategorySpend averages DEBIT spend per category over the months
+// preceding month, only counting months the household has transactions in.
+// Returns nil when there is no history to average.
+func getAverageCategorySpend(householdID string, month string, months int) (map[string]float64, error) {
+	monthTime, err := time.Parse("2006-01", month)
+	if err != nil {
+		return nil, err
+	}
+	startMonth := monthTime.AddDate(0, -months, 0).Format("2006-01")
+
+	var activeMonths int
+	err = database.DB.QueryRow(`
+		SELECT COUNT(DISTINCT substr(date, 1, 7))
+		FROM transactions
+		WHERE household_id = ? AND substr(date, 1, 7) >= ? AND substr(date, 1, 7) < ?
+	`, householdID, startMonth, month).Scan(&activeMonths)
+	if err != nil {
+		return nil, err
+	}
+	if activeMonths == 0 {
+		return nil, nil
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT category_id, SUM(amount)
+		FROM transactions
+		WHERE household_id = ? AND transaction_type = 'DEBIT' AND category_id IS NOT NULL
+		AND substr(date, 1, 7) >= ? AND substr(date, 1, 7) < ?
+		GROUP BY category_id
+	`, householdID, startMonth, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	averages := make(map[string]float64)
+	for rows.Next() {
+		var categoryID string
+		var total float64
+		if err := rows.Scan(&categoryID, &total); err != nil {
+			return nil, err
+		}
+		averages[categoryID] = math.Round(math.Abs(total)/float64(activeMonths)*100) / 100
+	}
+	return averages, rows.Err()
+}
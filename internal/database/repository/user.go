@@ -38,7 +38,7 @@ func CreateUser(email, password string) (*User, error) {
 		return nil, err
 	}
 
-	if !slices.Contains(ALLOWED_USERS, email) {
+	if !slices.Contains(ALLOWED_USERS, email) && !HasPendingInvitation(email) {
 		return nil, errors.New("unauthorized user " + email)
 	}
 
@@ -0,0 +1,121 @@
+package models
+
+import "math"
+
+// MAX_SHOT_LINE is the highest k that P(shots >= k) is reported for
+const MAX_SHOT_LINE = 6
+
+// MAX_SHOT_COUNT is the most shots the pmf is walked to. P(shots = 0)
+// underflows to 0 for a mean past about 745, the line then stops here.
+const MAX_SHOT_COUNT = 100
+
+// minScoredProbability keeps log loss finite for predictions of 0 or 1
+const minScoredProbability = 1e-6
+
+// DistributionFamily is the kind of distribution a player's shots are modeled with
+type DistributionFamily string
+
+const (
+	PoissonDistribution          DistributionFamily = "poisson"
+	NegativeBinomialDistribution DistributionFamily = "negative_binomial"
+)
+
+// ShotDistribution is the probability distribution of a player's shots in a game.
+//
+// Each prediction is made over a half shot Line: the highest of 0.5, 1.5, 2.5 ...
+// the player is more likely than not to go over, or 0.5 when even one shot is
+// unlikely. A prediction is successful when the player goes over its line.
+type ShotDistribution struct {
+	Family DistributionFamily `json:"family"`
+	Mean   float64            `json:"mean"`
+
+	// Dispersion is the negative binomial size r, with variance mean + mean²/r.
+	// It is 0 for Poisson.
+	Dispersion float64 `json:"dispersion,omitempty"`
+
+	// AtLeast is P(shots >= k) for k = 1..MAX_SHOT_LINE
+	AtLeast map[int]float64 `json:"atLeast"`
+
+	Line            float64 `json:"line"`
+	OverProbability float64 `json:"overProbability"` // P(shots > Line)
+}
+
+// NewShotDistribution builds a shot distribution with the given mean, Poisson
+// when dispersion is 0 or infinite and negative binomial with size dispersion
+// otherwise. A NaN or infinite mean has no distribution, it's returned empty
+// with no line, and a line is never set above MAX_SHOT_COUNT.
+func NewShotDistribution(mean float64, dispersion float64) ShotDistribution {
+	if math.IsNaN(mean) || math.IsInf(mean, 0) {
+		return ShotDistribution{Family: PoissonDistribution, AtLeast: map[int]float64{}}
+	}
+
+	mean = math.Max(mean, 0)
+	d := ShotDistribution{
+		Family:  PoissonDistribution,
+		Mean:    mean,
+		AtLeast: make(map[int]float64, MAX_SHOT_LINE),
+	}
+	if dispersion > 0 && !math.IsInf(dispersion, 1) {
+		d.Family = NegativeBinomialDistribution
+		d.Dispersion = dispersion
+	}
+
+	// Walk the pmf from 0 shots, tracking P(shots < k). Probabilities are
+	// rounded to 4 places.
+	below := 0.0
+	pmf := d.probability0()
+	for k := 1; k <= MAX_SHOT_COUNT; k++ {
+		below += pmf
+		atLeast := math.Round(math.Max(0, 1-below)*10000) / 10000
+		if k <= MAX_SHOT_LINE {
+			d.AtLeast[k] = atLeast
+		}
+		if k == 1 || atLeast >= 0.5 {
+			d.Line = float64(k) - 0.5
+			d.OverProbability = atLeast
+		}
+		if atLeast < 0.5 && k >= MAX_SHOT_LINE {
+			break
+		}
+		pmf = d.nextProbability(pmf, k)
+	}
+
+	return d
+}
+
+// probability0 returns P(shots = 0)
+func (d ShotDistribution) probability0() float64 {
+	if d.Family == NegativeBinomialDistribution {
+		return math.Pow(d.Dispersion/(d.Dispersion+d.Mean), d.Dispersion)
+	}
+	return math.Exp(-d.Mean)
+}
+
+// nextProbability returns P(shots = k) from P(shots = k-1)
+func (d ShotDistribution) nextProbability(previous float64, k int) float64 {
+	if d.Family == NegativeBinomialDistribution {
+		r := d.Dispersion
+		return previous * (float64(k-1) + r) / float64(k) * d.Mean / (r + d.Mean)
+	}
+	return previous * d.Mean / float64(k)
+}
+
+// Score grades the distribution's line against the actual shots, returning
+// whether the player went over and the log loss and Brier score of OverProbability
+func (d ShotDistribution) Score(actualShots int) (over bool, logLoss float64, brier float64) {
+	return ScoreLine(d.Line, d.OverProbability, actualShots)
+}
+
+// ScoreLine grades an over prediction of line with probability overProbability
+func ScoreLine(line float64, overProbability float64, actualShots int) (over bool, logLoss float64, brier float64) {
+	over = float64(actualShots) > line
+	outcome := 0.0
+	if over {
+		outcome = 1
+	}
+
+	p := math.Min(math.Max(overProbability, minScoredProbability), 1-minScoredProbability)
+	logLoss = -(outcome*math.Log(p) + (1-outcome)*math.Log(1-p))
+	brier = (overProbability - outcome) * (overProbability - outcome)
+	return over, logLoss, brier
+}
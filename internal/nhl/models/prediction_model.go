@@ -15,59 +15,81 @@ const (
 
 	// MatchupFocusedCalculation emphasizes team matchup statistics
 	MatchupFocusedCalculation CalculationStrategy = "matchup_focused"
+
+	// RollingWindowCalculation blends 10 and 20 game windows and an EWMA of
+	// the season game log, adjusted for the player's home/away split
+	RollingWindowCalculation CalculationStrategy = "rolling_window"
 )
 
+// Valid reports whether the strategy is one the prediction engine implements
+func (s CalculationStrategy) Valid() bool {
+	switch s {
+	case StandardCalculation, WeightedRecencyCalculation, TOIDrivenCalculation, MatchupFocusedCalculation, RollingWindowCalculation:
+		return true
+	}
+	return false
+}
+
 // ModelVersion represents a specific version of the shot prediction model
 type ModelVersion struct {
-	ID                  int
-	Name                string
-	Description         string
-	CalculationStrategy CalculationStrategy
-	Parameters          ModelParameters
-	Active              bool
-	CreatedAt           string
+	ID                  int                 `json:"id"`
+	Name                string              `json:"name"`
+	Description         string              `json:"description"`
+	CalculationStrategy CalculationStrategy `json:"calculationStrategy"`
+	Parameters          ModelParameters     `json:"parameters"`
+	Active              bool                `json:"active"`
+	ParentID            *int                `json:"parentId,omitempty"` // model this one was cloned from
+	RetiredAt           *string             `json:"retiredAt,omitempty"`
+	CreatedAt           string              `json:"createdAt"`
 }
 
 // ModelParameters contains all configurable parameters for a prediction model
 type ModelParameters struct {
 	// Weight factors
-	RecentPerformanceWeight float64
-	SeasonPerformanceWeight float64
+	RecentPerformanceWeight float64 `json:"recentPerformanceWeight"`
+	SeasonPerformanceWeight float64 `json:"seasonPerformanceWeight"`
 
 	// Team and game factors
-	GamePaceExponent    float64
-	TeamOffenseExponent float64
-	TeamDefenseExponent float64
+	GamePaceExponent    float64 `json:"gamePaceExponent"`
+	TeamOffenseExponent float64 `json:"teamOffenseExponent"`
+	TeamDefenseExponent float64 `json:"teamDefenseExponent"`
 
 	// Position adjustment
-	DefensePositionFactor float64
+	DefensePositionFactor float64 `json:"defensePositionFactor"`
 
 	// Rest day factors
-	BackToBackFactor      float64
-	OneRestDayFactor      float64
-	FourPlusRestDayFactor float64
+	BackToBackFactor      float64 `json:"backToBackFactor"`
+	OneRestDayFactor      float64 `json:"oneRestDayFactor"`
+	FourPlusRestDayFactor float64 `json:"fourPlusRestDayFactor"`
 
 	// Confidence calculation parameters
-	ShotScoreMultiplier     float64
-	TOIBaseMultiplier       float64
-	TOIBonusThreshold       float64
-	TOIBonusMultiplier      float64
-	TrendUpwardScore        float64
-	TrendImprovementScore   float64
-	DefenseConfidenceFactor float64
+	ShotScoreMultiplier     float64 `json:"shotScoreMultiplier"`
+	TOIBaseMultiplier       float64 `json:"toiBaseMultiplier"`
+	TOIBonusThreshold       float64 `json:"toiBonusThreshold"`
+	TOIBonusMultiplier      float64 `json:"toiBonusMultiplier"`
+	TrendUpwardScore        float64 `json:"trendUpwardScore"`
+	TrendImprovementScore   float64 `json:"trendImprovementScore"`
+	DefenseConfidenceFactor float64 `json:"defenseConfidenceFactor"`
 
 	// Advanced parameters
-	LastGameWeight              float64
-	SecondLastGameWeight        float64
-	ThirdLastGameWeight         float64
-	FourthLastGameWeight        float64
-	FifthLastGameWeight         float64
-	OpposingGoalieQualityFactor float64
-	HomeIceAdvantageFactor      float64
-	StreakImpactFactor          float64
+	LastGameWeight              float64 `json:"lastGameWeight"`
+	SecondLastGameWeight        float64 `json:"secondLastGameWeight"`
+	ThirdLastGameWeight         float64 `json:"thirdLastGameWeight"`
+	FourthLastGameWeight        float64 `json:"fourthLastGameWeight"`
+	FifthLastGameWeight         float64 `json:"fifthLastGameWeight"`
+	OpposingGoalieQualityFactor float64 `json:"opposingGoalieQualityFactor"` // multiplier against the weakest goalies, 0 to ignore goalies
+	HomeIceAdvantageFactor      float64 `json:"homeIceAdvantageFactor"`
+	StreakImpactFactor          float64 `json:"streakImpactFactor"` // share added or taken away by the team's recent point percentage
+
+	// Rolling window parameters, blended with SeasonPerformanceWeight
+	Last10Weight     float64 `json:"last10Weight,omitempty"`
+	Last20Weight     float64 `json:"last20Weight,omitempty"`
+	EWMAWeight       float64 `json:"ewmaWeight,omitempty"`
+	EWMAHalfLife     float64 `json:"ewmaHalfLife,omitempty"`     // games for a game's weight to halve
+	VenueSplitWeight float64 `json:"venueSplitWeight,omitempty"` // share of the home/away split applied
 }
 
-// GetDefaultModels returns the predefined model versions
+// GetDefaultModels returns the predefined model versions seeded into the model registry
 func GetDefaultModels() []ModelVersion {
 	return []ModelVersion{
 		{
@@ -309,8 +331,18 @@ type ModelPredictionRecord struct {
 
 // ModelAccuracyStats holds aggregated statistics about a model's performance
 type ModelAccuracyStats struct {
-	TotalPredictions      int
-	SuccessfulPredictions int
-	Accuracy              float64
-	AvgError              float64
+	TotalPredictions      int      `json:"totalPredictions"`
+	SuccessfulPredictions int      `json:"successfulPredictions"`
+	Accuracy              float64  `json:"accuracy"`
+	AvgError              float64  `json:"avgError"`
+	AvgLogLoss            *float64 `json:"avgLogLoss"` // nil until predictions with a line are validated
+	AvgBrier              *float64 `json:"avgBrier"`
+
+	// One unit bets against sportsbook lines. Bets includes Pushes, which
+	// return the stake and are left out of ROI, the profit per bet that won
+	// or lost. ROI is nil until one has.
+	Bets      int      `json:"bets"`
+	Pushes    int      `json:"pushes"`
+	BetProfit float64  `json:"betProfit"`
+	ROI       *float64 `json:"roi"`
 }
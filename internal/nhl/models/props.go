@@ -0,0 +1,147 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrInvalidPropLine = errors.New("invalid prop line")
+
+// BetSide is the side of a prop line a model bets
+type BetSide string
+
+const (
+	BetOver  BetSide = "over"
+	BetUnder BetSide = "under"
+)
+
+// PropLine is a sportsbook's shots on goal line for a player in a game, with
+// American odds on each side
+type PropLine struct {
+	GameID     int     `json:"gameId"`
+	PlayerID   int     `json:"playerId"`
+	Sportsbook string  `json:"sportsbook,omitempty"`
+	Line       float64 `json:"line"`
+	OverOdds   int     `json:"overOdds"`
+	UnderOdds  *int    `json:"underOdds,omitempty"` // without it the over's implied probability keeps the vig
+	UpdatedAt  string  `json:"updatedAt,omitempty"`
+}
+
+// Validate checks the ids, that the line is positive, in half or whole shots,
+// and that the odds are American odds
+func (l PropLine) Validate() error {
+	switch {
+	case l.GameID <= 0 || l.PlayerID <= 0:
+		return fmt.Errorf("%w: game and player ids are required", ErrInvalidPropLine)
+	case l.Line <= 0 || math.Mod(l.Line*2, 1) != 0:
+		return fmt.Errorf("%w: line %v isn't a positive half or whole number of shots", ErrInvalidPropLine, l.Line)
+	case !validAmericanOdds(l.OverOdds):
+		return fmt.Errorf("%w: over odds %d aren't American odds", ErrInvalidPropLine, l.OverOdds)
+	case l.UnderOdds != nil && !validAmericanOdds(*l.UnderOdds):
+		return fmt.Errorf("%w: under odds %d aren't American odds", ErrInvalidPropLine, *l.UnderOdds)
+	}
+	return nil
+}
+
+// validAmericanOdds reports whether odds are at least +100 or at most -100
+func validAmericanOdds(odds int) bool {
+	return odds >= 100 || odds <= -100
+}
+
+// ImpliedProbability is the break-even probability of American odds
+func ImpliedProbability(odds int) float64 {
+	if odds < 0 {
+		return float64(-odds) / float64(-odds+100)
+	}
+	return 100 / float64(odds+100)
+}
+
+// Payout is the profit on a winning one unit bet at American odds
+func Payout(odds int) float64 {
+	if odds < 0 {
+		return 100 / float64(-odds)
+	}
+	return float64(odds) / 100
+}
+
+// ImpliedOverProbability is the sportsbook's probability of the over, with
+// the vig removed when both sides are priced
+func (l PropLine) ImpliedOverProbability() float64 {
+	over := ImpliedProbability(l.OverOdds)
+	if l.UnderOdds == nil {
+		return over
+	}
+	return over / (over + ImpliedProbability(*l.UnderOdds))
+}
+
+// underOdds are the under's odds, or the over's when the under isn't priced
+func (l PropLine) underOdds() int {
+	if l.UnderOdds == nil {
+		return l.OverOdds
+	}
+	return *l.UnderOdds
+}
+
+// Bet picks the side a model with the given probability of the over bets: the
+// over when it beats the over's break-even probability, the under when the
+// under does, and no bet ("") otherwise. Break-even includes the vig.
+func (l PropLine) Bet(overProbability float64) BetSide {
+	if overProbability > ImpliedProbability(l.OverOdds) {
+		return BetOver
+	}
+	if l.UnderOdds != nil && 1-overProbability > ImpliedProbability(*l.UnderOdds) {
+		return BetUnder
+	}
+	return ""
+}
+
+// Settle returns the profit of a one unit bet on side once the player has
+// taken actualShots. A whole number line the player lands on is a push, and
+// no bet has no profit.
+func (l PropLine) Settle(side BetSide, actualShots int) float64 {
+	shots := float64(actualShots)
+	switch {
+	case side == "" || shots == l.Line:
+		return 0
+	case side == BetOver && shots > l.Line:
+		return Payout(l.OverOdds)
+	case side == BetUnder && shots < l.Line:
+		return Payout(l.underOdds())
+	}
+	return -1
+}
+
+// PropLineEdge compares a model's probability of the over with a sportsbook line
+type PropLineEdge struct {
+	PropLine
+	OverProbability    float64 `json:"overProbability"`    // the model's P(shots > line)
+	ImpliedProbability float64 `json:"impliedProbability"` // the sportsbook's, without the vig when both sides are priced
+	Edge               float64 `json:"edge"`               // OverProbability - ImpliedProbability
+	Bet                BetSide `json:"bet,omitempty"`
+}
+
+// Edge compares the distribution with a line, false when the line is past the
+// shot counts the distribution reports
+func (d ShotDistribution) Edge(line PropLine) (PropLineEdge, bool) {
+	overProbability, ok := d.OverProbabilityAt(line.Line)
+	if !ok {
+		return PropLineEdge{}, false
+	}
+	implied := line.ImpliedOverProbability()
+	return PropLineEdge{
+		PropLine:           line,
+		OverProbability:    overProbability,
+		ImpliedProbability: math.Round(implied*10000) / 10000,
+		Edge:               math.Round((overProbability-implied)*10000) / 10000,
+		Bet:                line.Bet(overProbability),
+	}, true
+}
+
+// OverProbabilityAt returns P(shots > line), false when that needs more than
+// MAX_SHOT_LINE shots
+func (d ShotDistribution) OverProbabilityAt(line float64) (float64, bool) {
+	k := int(math.Floor(line)) + 1
+	probability, ok := d.AtLeast[k]
+	return probability, ok && k <= MAX_SHOT_LINE
+}
@@ -21,23 +21,26 @@ type Game struct {
 }
 
 type PlayerStats struct {
-	PlayerId               int              `json:"playerId"`
-	Name                   string           `json:"name"`
-	Position               string           `json:"position"`
-	TeamAbbrev             string           `json:"teamAbbrev"`
-	TeamId                 int              `json:"teamId"`
-	ShotsLast5             []int            `json:"shotsLast5"`
-	AvgShotsLast5          float64          `json:"avgShotsLast5"`
-	ShotTrend              []int            `json:"shotTrend"`
-	AvgTOI                 float64          `json:"avgTOI"`
-	SeasonShotsPerGame     float64          `json:"seasonShotsPerGame"`
-	PredictedGameShots     float64          `json:"predictedGameShots"`
-	Confidence             float64          `json:"confidence"`
-	RestDays               int              `json:"restDays"`
-	Headshot               string           `json:"headshot"`
-	PastPredictionAccuracy float64          `json:"pastPredictionAccuracy"`
-	PredictionRecord       PredictionRecord `json:"predictionRecord"`
-	ModelVersionID         int              `json:"modelVersionId"`
+	PlayerId               int                 `json:"playerId"`
+	Name                   string              `json:"name"`
+	Position               string              `json:"position"`
+	TeamAbbrev             string              `json:"teamAbbrev"`
+	TeamId                 int                 `json:"teamId"`
+	ShotsLast5             []int               `json:"shotsLast5"`
+	AvgShotsLast5          float64             `json:"avgShotsLast5"`
+	ShotTrend              []int               `json:"shotTrend"`
+	AvgTOI                 float64             `json:"avgTOI"`
+	SeasonShotsPerGame     float64             `json:"seasonShotsPerGame"`
+	PredictedGameShots     float64             `json:"predictedGameShots"`
+	Confidence             float64             `json:"confidence"`
+	RestDays               int                 `json:"restDays"`
+	Headshot               string              `json:"headshot"`
+	PastPredictionAccuracy float64             `json:"pastPredictionAccuracy"`
+	PredictionRecord       PredictionRecord    `json:"predictionRecord"`
+	ModelVersionID         int                 `json:"modelVersionId"`
+	Features               *PredictionFeatures `json:"features,omitempty"`
+	Distribution           ShotDistribution    `json:"distribution"`
+	PropLine               *PropLineEdge       `json:"propLine,omitempty"` // nil without an imported sportsbook line
 }
 
 type TeamStats struct {
@@ -119,6 +122,52 @@ type PlayerDetail struct {
 	} `json:"featuredStats"`
 	Last5Games []Last5Game `json:"last5Games"`
 	Headshot   string      `json:"headshot"`
+
+	// Matchup inputs attached when predicting, nil when they couldn't be fetched
+	OpposingGoalie *StartingGoalie `json:"opposingGoalie,omitempty"`
+	TeamForm       *TeamForm       `json:"teamForm,omitempty"`
+	IsHome         bool            `json:"isHome,omitempty"`
+
+	// GameLog is the player's season before the game, most recent first. It's
+	// empty when the log couldn't be fetched or stored.
+	GameLog []GameLogEntry `json:"gameLog,omitempty"`
+}
+
+// GoalieSource is where a game's starting goalie came from
+type GoalieSource string
+
+const (
+	// GoalieFromBoxscore is the starter named in the game's boxscore
+	GoalieFromBoxscore GoalieSource = "boxscore"
+
+	// GoalieFromGamesPlayed is a guess before the boxscore names a starter:
+	// the team's goalie with the most games played, not a reported probable starter
+	GoalieFromGamesPlayed GoalieSource = "most_games_played"
+)
+
+// StartingGoalie is the goalie a team is assumed to start in a game. Until
+// the boxscore names a starter, and it's Confirmed, it's only the goalie
+// with the most games played.
+type StartingGoalie struct {
+	PlayerID    int          `json:"playerId"`
+	Name        string       `json:"name"`
+	TeamID      int          `json:"teamId"`
+	Confirmed   bool         `json:"confirmed"`
+	Source      GoalieSource `json:"source"`
+	GamesPlayed int          `json:"gamesPlayed"`
+	SavePct     float64      `json:"savePct"` // season save percentage, 0-1
+}
+
+// TeamForm is a team's results over its most recent completed games
+type TeamForm struct {
+	TeamID       int     `json:"teamId"`
+	Games        int     `json:"games"`
+	Wins         int     `json:"wins"`
+	Losses       int     `json:"losses"`
+	OTLosses     int     `json:"otLosses"`
+	GoalsFor     int     `json:"goalsFor"`
+	GoalsAgainst int     `json:"goalsAgainst"`
+	PointPct     float64 `json:"pointPct"`
 }
 
 type GameWithPlayers struct {
@@ -146,4 +195,102 @@ type PredictionRecord struct {
 	CreatedAt        string  `json:"created_at"`
 	ValidatedAt      *string `json:"validated_at,omitempty"`
 	ModelVersionID   int     `json:"model_version_id"`
+
+	// Shot distribution and line, nil for predictions made before they were recorded
+	Distribution      *DistributionFamily `json:"distribution,omitempty"`
+	Dispersion        *float64            `json:"dispersion,omitempty"`
+	ShotProbabilities map[int]float64     `json:"shot_probabilities,omitempty"` // P(shots >= k)
+	Line              *float64            `json:"line,omitempty"`
+	OverProbability   *float64            `json:"over_probability,omitempty"`
+	LogLoss           *float64            `json:"log_loss,omitempty"`
+	Brier             *float64            `json:"brier,omitempty"`
+
+	// Sportsbook line the prediction was settled against and the model's one
+	// unit bet on it, nil without a line or, for the bet, without an edge
+	PropLine      *float64 `json:"prop_line,omitempty"`
+	PropOverOdds  *int     `json:"prop_over_odds,omitempty"`
+	PropUnderOdds *int     `json:"prop_under_odds,omitempty"`
+	BetSide       *BetSide `json:"bet_side,omitempty"`
+	BetProfit     *float64 `json:"bet_profit,omitempty"`
+}
+
+// PredictionInputs are the model inputs for every game on a date. They are
+// captured when predictions run so backtests can replay them later.
+type PredictionInputs struct {
+	Date      string                 `json:"date"`
+	Games     []Game                 `json:"games"`
+	Players   map[int][]PlayerDetail `json:"players"` // by game id
+	TeamStats []TeamStats            `json:"teamStats"`
+	RestDays  map[int]int            `json:"restDays"`
+}
+
+// GameLogEntry is one game from a player's season game log
+type GameLogEntry struct {
+	GameID         int    `json:"gameId"`
+	GameDate       string `json:"gameDate"`
+	TeamAbbrev     string `json:"teamAbbrev"`
+	OpponentAbbrev string `json:"opponentAbbrev"`
+	HomeRoadFlag   string `json:"homeRoadFlag"` // "H" or "R"
+	Shots          int    `json:"shots"`
+	TOI            string `json:"toi"`
+	PowerPlayTOI   string `json:"powerPlayToi,omitempty"` // from the stats API, empty when it couldn't be fetched
+}
+
+// PredictionFeatures are the inputs and intermediate factors behind one
+// prediction, recorded so it can be explained and used to refit parameters.
+// Factors are stored as applied, after any strategy specific exponent, and
+// factors a strategy doesn't use are 1. The team stat inputs are nil when
+// either team's stats were missing, and the goalie, form and game log inputs
+// when they couldn't be fetched.
+type PredictionFeatures struct {
+	PredictionID        int                 `json:"predictionId,omitempty"`
+	ModelVersionID      int                 `json:"modelVersionId"`
+	CalculationStrategy CalculationStrategy `json:"calculationStrategy"`
+
+	// Inputs
+	Position                    string   `json:"position"`
+	ShotsLast5                  []int    `json:"shotsLast5"`
+	AvgShotsLast5               float64  `json:"avgShotsLast5"`
+	SeasonShotsPerGame          float64  `json:"seasonShotsPerGame"`
+	SeasonGamesPlayed           int      `json:"seasonGamesPlayed"`
+	AvgTOI                      float64  `json:"avgTOI"`
+	RestDays                    *int     `json:"restDays"`
+	TeamShotsForPerGame         *float64 `json:"teamShotsForPerGame"`
+	OpponentShotsAgainstPerGame *float64 `json:"opponentShotsAgainstPerGame"`
+	OpponentShotsForPerGame     *float64 `json:"opponentShotsForPerGame"`
+	LeagueShotAverage           *float64 `json:"leagueShotAverage"`
+	OpponentGoalieID            *int     `json:"opponentGoalieId"`
+	OpponentGoalieConfirmed     *bool    `json:"opponentGoalieConfirmed"`
+	OpponentGoalieGamesPlayed   *int     `json:"opponentGoalieGamesPlayed"`
+	OpponentGoalieSavePct       *float64 `json:"opponentGoalieSavePct"`
+	LeagueSavePct               *float64 `json:"leagueSavePct"`
+	TeamFormGames               *int     `json:"teamFormGames"`
+	TeamFormPointPct            *float64 `json:"teamFormPointPct"`
+	GameLogGames                *int     `json:"gameLogGames"`
+	ShotsLast10                 *float64 `json:"shotsLast10"`
+	ShotsLast20                 *float64 `json:"shotsLast20"`
+	ShotsEWMA                   *float64 `json:"shotsEWMA"`
+	VenueShotsPerGame           *float64 `json:"venueShotsPerGame"` // home or away, whichever the game is
+	TOILast10                   *float64 `json:"toiLast10"`
+	PowerPlayTOILast10          *float64 `json:"powerPlayToiLast10"`
+
+	// Intermediate factors
+	WeightedRecentShots *float64 `json:"weightedRecentShots,omitempty"` // weighted recency only
+	TOIBasePrediction   *float64 `json:"toiBasePrediction,omitempty"`   // TOI driven only, after the position factor
+	BasePrediction      float64  `json:"basePrediction"`                // recent and season shots blended
+	GamePaceFactor      float64  `json:"gamePaceFactor"`
+	TeamOffenseFactor   float64  `json:"teamOffenseFactor"`
+	TeamDefenseFactor   float64  `json:"teamDefenseFactor"`
+	PositionFactor      float64  `json:"positionFactor"`
+	IcetimeFactor       float64  `json:"icetimeFactor"`
+	RestFactor          float64  `json:"restFactor"`
+	HomeIceFactor       float64  `json:"homeIceFactor"`
+	StreakFactor        float64  `json:"streakFactor"`
+	GoalieFactor        float64  `json:"goalieFactor"`
+	VenueFactor         float64  `json:"venueFactor"`
+	UnroundedPrediction float64  `json:"unroundedPrediction"`
+	PredictedShots      float64  `json:"predictedShots"`
+
+	// Fallback says why a simpler calculation than the strategy's was used
+	Fallback string `json:"fallback,omitempty"`
 }
@@ -1,127 +1,128 @@
 package repository
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"net/http"
+	neturl "net/url"
+	"sort"
 	"strconv"
-	"sync"
-	"sync/atomic"
+	"strings"
 	"time"
 
 	"api.alexmontague.ca/helpers"
 	"api.alexmontague.ca/internal/nhl/models"
 )
 
+// RequestCount counts requests sent to the NHL API, cache hits aren't counted
 var RequestCount uint64
 
-func httpGetAndCount(url string) (*http.Response, error) {
-	atomic.AddUint64(&RequestCount, 1)
-	return http.Get(url)
+// PLAYER_FETCH_CONCURRENCY bounds the player landing requests in flight for one game
+const PLAYER_FETCH_CONCURRENCY = 8
+
+// PlayerFetchFailure is a rostered player whose landing page couldn't be fetched
+type PlayerFetchFailure struct {
+	PlayerID   int
+	TeamAbbrev string
+	Err        error
 }
 
-func GetPlayerStats(gameId int, teamInfo []models.Team) ([]models.PlayerDetail, error) {
-	var allPlayers []models.PlayerDetail
-	playerChan := make(chan models.PlayerDetail, 50) // Buffered channel to prevent blocking
-	errorChan := make(chan error, 2)                 // Buffer for potential errors
-	var wg sync.WaitGroup
+// PlayerStatsError reports the players GetPlayerStats couldn't fetch. The
+// players that were fetched are still returned alongside it.
+type PlayerStatsError struct {
+	GameID int
+	Failed []PlayerFetchFailure
+}
 
-	// Fetch rosters for both teams concurrently
-	for _, team := range teamInfo {
-		wg.Add(1)
-		go func(team models.Team) {
-			defer wg.Done()
+func (e *PlayerStatsError) Error() string {
+	failed := make([]string, len(e.Failed))
+	for i, failure := range e.Failed {
+		failed[i] = fmt.Sprintf("%d (%s): %v", failure.PlayerID, failure.TeamAbbrev, failure.Err)
+	}
+	return fmt.Sprintf("game %d: failed to fetch %d players: %s", e.GameID, len(e.Failed), strings.Join(failed, "; "))
+}
 
-			rosterURL := fmt.Sprintf("%s/roster/%s/current", models.NHL_API_BASE, team.Abbrev)
-			resp, err := httpGetAndCount(rosterURL)
-			if err != nil {
-				errorChan <- err
-				return
+// GetPlayerStats fetches the skaters on both teams of a game, in roster order
+// with teamInfo[0]'s forwards first. A roster that can't be fetched or a done
+// ctx fails the whole game; players that can't be fetched are left out and
+// listed in a *PlayerStatsError returned with the others.
+func GetPlayerStats(ctx context.Context, gameId int, teamInfo []models.Team) ([]models.PlayerDetail, error) {
+	rosters := make([]models.RosterResponse, len(teamInfo))
+	rosterGroup, rosterCtx := newGroup(ctx, len(teamInfo))
+	for i, team := range teamInfo {
+		rosterGroup.run(func() error {
+			rosterURL := defaultClient.webURL("/roster/%s/current", team.Abbrev)
+			if err := defaultClient.getJSON(rosterCtx, rosterURL, ROSTER_CACHE_TTL, &rosters[i]); err != nil {
+				return fmt.Errorf("roster for %s: %w", team.Abbrev, err)
+			}
+			return nil
+		})
+	}
+	if err := rosterGroup.wait(); err != nil {
+		return nil, err
+	}
+
+	type playerJob struct {
+		player   models.Player
+		team     models.Team
+		opponent models.Team
+	}
+	var jobs []playerJob
+	for i, team := range teamInfo {
+		opponent := teamInfo[len(teamInfo)-1-i]
+		for _, skaters := range [][]models.Player{rosters[i].Forwards, rosters[i].Defensemen} {
+			for _, player := range skaters {
+				jobs = append(jobs, playerJob{player: player, team: team, opponent: opponent})
 			}
-			defer resp.Body.Close()
+		}
+	}
 
-			var roster models.RosterResponse
-			if err := json.NewDecoder(resp.Body).Decode(&roster); err != nil {
-				errorChan <- err
-				return
+	// Each job writes only its own index so the results keep roster order
+	details := make([]models.PlayerDetail, len(jobs))
+	errs := make([]error, len(jobs))
+	playerGroup, playerCtx := newGroup(ctx, PLAYER_FETCH_CONCURRENCY)
+	for i, job := range jobs {
+		playerGroup.run(func() error {
+			if err := playerCtx.Err(); err != nil {
+				return err
 			}
 
-			// Combine forwards and defensemen
-			allSkaters := append(roster.Forwards, roster.Defensemen...)
-
-			// Create a WaitGroup for players within this team
-			var playerWg sync.WaitGroup
-			for _, player := range allSkaters {
-				playerWg.Add(1)
-				go func(p models.Player) {
-					defer playerWg.Done()
-
-					playerURL := fmt.Sprintf("%s/player/%d/landing", models.NHL_API_BASE, p.Id)
-					playerResp, err := httpGetAndCount(playerURL)
-					if err != nil {
-						errorChan <- err
-						return
-					}
-					defer playerResp.Body.Close()
-
-					var playerDetail models.PlayerDetail
-					if err := json.NewDecoder(playerResp.Body).Decode(&playerDetail); err != nil {
-						errorChan <- err
-						return
-					}
-					if team.Id == teamInfo[0].Id {
-						playerDetail.OpposingTeamId = teamInfo[1].Id
-						playerDetail.OpposingTeamAbbrev = teamInfo[1].Abbrev
-					} else {
-						playerDetail.OpposingTeamId = teamInfo[0].Id
-						playerDetail.OpposingTeamAbbrev = teamInfo[0].Abbrev
-					}
-
-					select {
-					case playerChan <- playerDetail:
-					default:
-						fmt.Printf("Warning: Could not send player %d to channel\n", p.Id)
-					}
-				}(player)
+			playerURL := defaultClient.webURL("/player/%d/landing", job.player.Id)
+			if err := defaultClient.getJSON(playerCtx, playerURL, PLAYER_CACHE_TTL, &details[i]); err != nil {
+				// Only cancellation stops the other players
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				errs[i] = err
+				return nil
 			}
-			playerWg.Wait()
-		}(team)
+			details[i].OpposingTeamId = job.opponent.Id
+			details[i].OpposingTeamAbbrev = job.opponent.Abbrev
+			return nil
+		})
+	}
+	if err := playerGroup.wait(); err != nil {
+		return nil, err
 	}
 
-	// Wait in a separate goroutine and close channels when done
-	go func() {
-		wg.Wait()
-		close(playerChan)
-		close(errorChan)
-	}()
-
-	// Check for errors first
-	select {
-	case err := <-errorChan:
-		if err != nil {
-			return nil, err
+	players := make([]models.PlayerDetail, 0, len(jobs))
+	var failed []PlayerFetchFailure
+	for i, job := range jobs {
+		if errs[i] != nil {
+			failed = append(failed, PlayerFetchFailure{PlayerID: job.player.Id, TeamAbbrev: job.team.Abbrev, Err: errs[i]})
+			continue
 		}
-	default:
+		players = append(players, details[i])
 	}
-
-	// Collect all players from channel
-	for player := range playerChan {
-		allPlayers = append(allPlayers, player)
+	if len(failed) > 0 {
+		return players, &PlayerStatsError{GameID: gameId, Failed: failed}
 	}
 
-	return allPlayers, nil
+	return players, nil
 }
 
-func GetUpcomingGames(date string) ([]models.Game, error) {
-	url := fmt.Sprintf("%s/schedule/%s", models.NHL_API_BASE, date)
-	resp, err := httpGetAndCount(url)
-	if err != nil {
-		fmt.Println("Error getting upcoming games:", err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
+func GetUpcomingGames(ctx context.Context, date string) ([]models.Game, error) {
+	url := defaultClient.webURL("/schedule/%s", date)
 	var schedule struct {
 		GameWeek []struct {
 			Date  string `json:"date"`
@@ -135,8 +136,8 @@ func GetUpcomingGames(date string) ([]models.Game, error) {
 		} `json:"gameWeek"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&schedule); err != nil {
-		fmt.Println("Error decoding upcoming games:", err)
+	if err := defaultClient.getJSON(ctx, url, SCHEDULE_CACHE_TTL, &schedule); err != nil {
+		fmt.Println("Error getting upcoming games:", err)
 		return nil, err
 	}
 
@@ -160,43 +161,83 @@ func GetUpcomingGames(date string) ([]models.Game, error) {
 	return games, nil
 }
 
-func GetAllTeamStats(season string) ([]models.TeamStats, error) {
-	url := fmt.Sprintf("%s/team/summary?cayenneExp=seasonId=%s", models.NHL_STATS_API_BASE, season)
-	resp, err := httpGetAndCount(url)
-	if err != nil {
+func GetAllTeamStats(ctx context.Context, season string) ([]models.TeamStats, error) {
+	url := defaultClient.statsURL("/team/summary?cayenneExp=seasonId=%s", season)
+	var teamStatsResponse struct {
+		Data []models.TeamStats `json:"data"`
+	}
+
+	if err := defaultClient.getJSON(ctx, url, TEAM_STATS_CACHE_TTL, &teamStatsResponse); err != nil {
 		fmt.Println("Error getting all team stats:", err)
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var teamStatsResponse struct {
+	return teamStatsResponse.Data, nil
+}
+
+// GetTeamStatsBefore returns each team's season stats, like "20242025", from
+// only the regular season games played before date (YYYY-MM-DD), summed from
+// the stats API's per game rows. Teams that haven't played yet are left out.
+func GetTeamStatsBefore(ctx context.Context, season string, date string) ([]models.TeamStats, error) {
+	filter := fmt.Sprintf(`gameTypeId=2 and seasonId=%s and gameDate<"%s"`, season, date)
+	url := defaultClient.statsURL("/team/summary?isAggregate=false&isGame=true&limit=-1&cayenneExp=%s", neturl.QueryEscape(filter))
+	var teamGames struct {
 		Data []models.TeamStats `json:"data"`
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&teamStatsResponse); err != nil {
-		fmt.Println("Error decoding team stats:", err)
+	if err := defaultClient.getJSON(ctx, url, TEAM_STATS_CACHE_TTL, &teamGames); err != nil {
 		return nil, err
 	}
+	return sumTeamGames(teamGames.Data), nil
+}
 
-	return teamStatsResponse.Data, nil
+// sumTeamGames totals per game rows, one game each, into a row per team in
+// order of first appearance
+func sumTeamGames(games []models.TeamStats) []models.TeamStats {
+	var teams []models.TeamStats
+	index := make(map[int]int)
+	var shotsFor, shotsAgainst []float64
+	for _, game := range games {
+		i, ok := index[game.TeamId]
+		if !ok {
+			i = len(teams)
+			index[game.TeamId] = i
+			teams = append(teams, models.TeamStats{TeamId: game.TeamId, TeamFullName: game.TeamFullName, SeasonId: game.SeasonId})
+			shotsFor = append(shotsFor, 0)
+			shotsAgainst = append(shotsAgainst, 0)
+		}
+		team := &teams[i]
+		team.GamesPlayed++
+		team.GoalsFor += game.GoalsFor
+		team.GoalsAgainst += game.GoalsAgainst
+		team.Wins += game.Wins
+		team.Losses += game.Losses
+		team.OTLosses += game.OTLosses
+		team.Points += game.Points
+		shotsFor[i] += game.ShotsForPerGame
+		shotsAgainst[i] += game.ShotsAgainstPerGame
+	}
+
+	for i := range teams {
+		team := &teams[i]
+		games := float64(team.GamesPlayed)
+		team.GoalsForPerGame = float64(team.GoalsFor) / games
+		team.GoalsAgainstPerGame = float64(team.GoalsAgainst) / games
+		team.ShotsForPerGame = shotsFor[i] / games
+		team.ShotsAgainstPerGame = shotsAgainst[i] / games
+		team.PointPct = float64(team.Points) / (2 * games)
+	}
+	return teams
 }
 
 // map[teamId]restDays
-func GetTeamsRest(currGameDay string, games []models.Game) (map[int]int, error) {
+func GetTeamsRest(ctx context.Context, currGameDay string, games []models.Game) (map[int]int, error) {
 	currGameDayTime, err := time.Parse("2006-01-02", currGameDay)
 	if err != nil {
 		fmt.Println("Error parsing curr game day time:", err)
 		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/schedule/%s", models.NHL_API_BASE, currGameDayTime.AddDate(0, 0, -6).Format("2006-01-02"))
-	resp, err := httpGetAndCount(url)
-	if err != nil {
-		fmt.Println("Error getting teams rest:", err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
+	url := defaultClient.webURL("/schedule/%s", currGameDayTime.AddDate(0, 0, -6).Format("2006-01-02"))
 	var schedule struct {
 		GameWeek []struct {
 			Date  string `json:"date"`
@@ -208,8 +249,8 @@ func GetTeamsRest(currGameDay string, games []models.Game) (map[int]int, error)
 		} `json:"gameWeek"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&schedule); err != nil {
-		fmt.Println("Error decoding teams rest:", err)
+	if err := defaultClient.getJSON(ctx, url, SCHEDULE_CACHE_TTL, &schedule); err != nil {
+		fmt.Println("Error getting teams rest:", err)
 		return nil, err
 	}
 
@@ -266,7 +307,7 @@ func GetTeamsRest(currGameDay string, games []models.Game) (map[int]int, error)
 }
 
 // FetchActualGameShots retrieves actual shot data from completed games
-func FetchActualGameShots(gameIDs []int) (map[int]int, error) {
+func FetchActualGameShots(ctx context.Context, gameIDs []int) (map[int]int, error) {
 	// Create map to store player shot results
 	results := make(map[int]int)
 
@@ -279,12 +320,7 @@ func FetchActualGameShots(gameIDs []int) (map[int]int, error) {
 	// Process each unique game
 	for gameID := range uniqueGameIDs {
 		// NHL API for game stats
-		url := fmt.Sprintf("%s/gamecenter/%d/boxscore", models.NHL_API_BASE, gameID)
-		resp, err := httpGetAndCount(url)
-		if err != nil {
-			return nil, err
-		}
-
+		url := defaultClient.webURL("/gamecenter/%d/boxscore", gameID)
 		type PlayerShotResult struct {
 			PlayerID int `json:"playerId"`
 			Sog      int `json:"sog"`
@@ -303,11 +339,10 @@ func FetchActualGameShots(gameIDs []int) (map[int]int, error) {
 			} `json:"playerByGameStats"`
 		}
 
-		if err := json.NewDecoder(resp.Body).Decode(&boxscore); err != nil {
-			resp.Body.Close()
+		// Boxscores aren't cached, a game in progress would otherwise look final
+		if err := defaultClient.getJSON(ctx, url, NO_CACHE, &boxscore); err != nil {
 			return nil, err
 		}
-		resp.Body.Close()
 
 		// Process away team
 		for _, player := range append(boxscore.PlayerByGameStats.AwayTeam.Forwards, boxscore.PlayerByGameStats.AwayTeam.Defense...) {
@@ -344,3 +379,211 @@ func calculateRestDays(teamId int, nextGameTime time.Time, lastGameDate map[int]
 		restDays[teamId] = 7
 	}
 }
+
+// GetSeasonRoster returns the skaters who were on a team's roster during a season, like "20242025"
+func GetSeasonRoster(ctx context.Context, teamAbbrev string, season string) ([]models.Player, error) {
+	url := defaultClient.webURL("/roster/%s/%s", teamAbbrev, season)
+	var roster models.RosterResponse
+	if err := defaultClient.getJSON(ctx, url, ROSTER_CACHE_TTL, &roster); err != nil {
+		return nil, err
+	}
+
+	skaters := make([]models.Player, 0, len(roster.Forwards)+len(roster.Defensemen))
+	skaters = append(skaters, roster.Forwards...)
+	skaters = append(skaters, roster.Defensemen...)
+	return skaters, nil
+}
+
+// GetPlayerGameLog returns a player's regular season games, most recent first
+func GetPlayerGameLog(ctx context.Context, playerID int, season string) ([]models.GameLogEntry, error) {
+	url := defaultClient.webURL("/player/%d/game-log/%s/2", playerID, season)
+	var gameLog struct {
+		GameLog []models.GameLogEntry `json:"gameLog"`
+	}
+	if err := defaultClient.getJSON(ctx, url, GAME_LOG_CACHE_TTL, &gameLog); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(gameLog.GameLog, func(i, j int) bool {
+		return gameLog.GameLog[i].GameDate > gameLog.GameLog[j].GameDate
+	})
+	return gameLog.GameLog, nil
+}
+
+// GetPlayerPowerPlayTOI returns a player's power play time on ice in seconds
+// for each regular season game they played, by game id
+func GetPlayerPowerPlayTOI(ctx context.Context, playerID int, season string) (map[int]int, error) {
+	filter := fmt.Sprintf("gameTypeId=2 and playerId=%d and seasonId=%s", playerID, season)
+	url := defaultClient.statsURL("/skater/timeonice?isAggregate=false&isGame=true&limit=-1&cayenneExp=%s", neturl.QueryEscape(filter))
+	var timeOnIce struct {
+		Data []struct {
+			GameID      int `json:"gameId"`
+			PPTimeOnIce int `json:"ppTimeOnIce"`
+		} `json:"data"`
+	}
+	if err := defaultClient.getJSON(ctx, url, GAME_LOG_CACHE_TTL, &timeOnIce); err != nil {
+		return nil, err
+	}
+
+	byGame := make(map[int]int, len(timeOnIce.Data))
+	for _, game := range timeOnIce.Data {
+		byGame[game.GameID] = game.PPTimeOnIce
+	}
+	return byGame, nil
+}
+
+// TEAM_FORM_GAMES is how many of a team's most recent games its form covers
+const TEAM_FORM_GAMES = 10
+
+// GetStartingGoalies returns each team's starting goalie for a game, by team
+// id. The boxscore's starters are used once the game has them; before that
+// it falls back to each team's goalie with the most games played, a guess
+// rather than a reported probable starter.
+func GetStartingGoalies(ctx context.Context, gameID int) (map[int]models.StartingGoalie, error) {
+	type goalieLeader struct {
+		PlayerID    int              `json:"playerId"`
+		Name        models.NameField `json:"name"`
+		GamesPlayed int              `json:"gamesPlayed"`
+		SavePctg    float64          `json:"savePctg"`
+	}
+	var landing struct {
+		AwayTeam models.Team `json:"awayTeam"`
+		HomeTeam models.Team `json:"homeTeam"`
+		Matchup  struct {
+			GoalieComparison struct {
+				AwayTeam struct {
+					Leaders []goalieLeader `json:"leaders"`
+				} `json:"awayTeam"`
+				HomeTeam struct {
+					Leaders []goalieLeader `json:"leaders"`
+				} `json:"homeTeam"`
+			} `json:"goalieComparison"`
+		} `json:"matchup"`
+	}
+	if err := defaultClient.getJSON(ctx, defaultClient.webURL("/gamecenter/%d/landing", gameID), MATCHUP_CACHE_TTL, &landing); err != nil {
+		return nil, err
+	}
+
+	type boxscoreGoalie struct {
+		PlayerID int              `json:"playerId"`
+		Name     models.NameField `json:"name"`
+		Starter  bool             `json:"starter"`
+	}
+	var boxscore struct {
+		PlayerByGameStats struct {
+			AwayTeam struct {
+				Goalies []boxscoreGoalie `json:"goalies"`
+			} `json:"awayTeam"`
+			HomeTeam struct {
+				Goalies []boxscoreGoalie `json:"goalies"`
+			} `json:"homeTeam"`
+		} `json:"playerByGameStats"`
+	}
+	// A game that hasn't started may not have a boxscore, which just means no confirmed starters
+	if err := defaultClient.getJSON(ctx, defaultClient.webURL("/gamecenter/%d/boxscore", gameID), NO_CACHE, &boxscore); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("No boxscore for game %d, using the goalies with the most games played: %v", gameID, err)
+	}
+
+	goalies := make(map[int]models.StartingGoalie)
+	teams := []struct {
+		team    models.Team
+		leaders []goalieLeader
+		dressed []boxscoreGoalie
+	}{
+		{landing.AwayTeam, landing.Matchup.GoalieComparison.AwayTeam.Leaders, boxscore.PlayerByGameStats.AwayTeam.Goalies},
+		{landing.HomeTeam, landing.Matchup.GoalieComparison.HomeTeam.Leaders, boxscore.PlayerByGameStats.HomeTeam.Goalies},
+	}
+	for _, team := range teams {
+		var starter *goalieLeader
+		for i, leader := range team.leaders {
+			if starter == nil || leader.GamesPlayed > starter.GamesPlayed {
+				starter = &team.leaders[i]
+			}
+		}
+		confirmed := helpers.Find(team.dressed, func(g boxscoreGoalie) bool { return g.Starter })
+
+		switch {
+		case confirmed != nil:
+			goalie := models.StartingGoalie{
+				PlayerID:  confirmed.PlayerID,
+				Name:      confirmed.Name.Default,
+				TeamID:    team.team.Id,
+				Confirmed: true,
+				Source:    models.GoalieFromBoxscore,
+			}
+			if leader := helpers.Find(team.leaders, func(l goalieLeader) bool { return l.PlayerID == confirmed.PlayerID }); leader != nil {
+				goalie.GamesPlayed = leader.GamesPlayed
+				goalie.SavePct = leader.SavePctg
+			}
+			goalies[team.team.Id] = goalie
+		case starter != nil:
+			goalies[team.team.Id] = models.StartingGoalie{
+				PlayerID:    starter.PlayerID,
+				Name:        starter.Name.Default,
+				TeamID:      team.team.Id,
+				Source:      models.GoalieFromGamesPlayed,
+				GamesPlayed: starter.GamesPlayed,
+				SavePct:     starter.SavePctg,
+			}
+		}
+	}
+
+	return goalies, nil
+}
+
+// GetTeamForm summarizes a team's last TEAM_FORM_GAMES completed games of a
+// season, like "20242025", played before date (YYYY-MM-DD)
+func GetTeamForm(ctx context.Context, team models.Team, season string, date string) (models.TeamForm, error) {
+	type scheduleTeam struct {
+		Id    int `json:"id"`
+		Score int `json:"score"`
+	}
+	var schedule struct {
+		Games []struct {
+			GameDate    string       `json:"gameDate"`
+			GameState   string       `json:"gameState"`
+			AwayTeam    scheduleTeam `json:"awayTeam"`
+			HomeTeam    scheduleTeam `json:"homeTeam"`
+			GameOutcome struct {
+				LastPeriodType string `json:"lastPeriodType"`
+			} `json:"gameOutcome"`
+		} `json:"games"`
+	}
+	url := defaultClient.webURL("/club-schedule-season/%s/%s", team.Abbrev, season)
+	if err := defaultClient.getJSON(ctx, url, SCHEDULE_CACHE_TTL, &schedule); err != nil {
+		return models.TeamForm{}, err
+	}
+
+	form := models.TeamForm{TeamID: team.Id}
+	// The schedule is in date order, so walk back from the latest game
+	for i := len(schedule.Games) - 1; i >= 0 && form.Games < TEAM_FORM_GAMES; i-- {
+		game := schedule.Games[i]
+		if game.GameDate >= date || (game.GameState != "OFF" && game.GameState != "FINAL") {
+			continue
+		}
+
+		us, them := game.HomeTeam, game.AwayTeam
+		if game.AwayTeam.Id == team.Id {
+			us, them = game.AwayTeam, game.HomeTeam
+		}
+		form.Games++
+		form.GoalsFor += us.Score
+		form.GoalsAgainst += them.Score
+		switch {
+		case us.Score > them.Score:
+			form.Wins++
+		case game.GameOutcome.LastPeriodType == "OT" || game.GameOutcome.LastPeriodType == "SO":
+			form.OTLosses++
+		default:
+			form.Losses++
+		}
+	}
+
+	if form.Games > 0 {
+		form.PointPct = float64(2*form.Wins+form.OTLosses) / float64(2*form.Games)
+	}
+	return form, nil
+}
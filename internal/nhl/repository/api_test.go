@@ -0,0 +1,322 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// useReplayClient serves NHL API requests from the fixtures recorded for date
+func useReplayClient(t *testing.T, date string) {
+	t.Helper()
+	useTransport(t, &ReplayTransport{Dir: "../testdata/" + date})
+}
+
+func useTransport(t *testing.T, transport http.RoundTripper) {
+	t.Helper()
+	previous := SetDefaultClient(NewClient(ClientConfig{
+		Transport:      transport,
+		Timeout:        time.Second,
+		MaxConcurrent:  4,
+		RetryBaseDelay: time.Millisecond,
+	}))
+	t.Cleanup(func() { SetDefaultClient(previous) })
+}
+
+func TestGetUpcomingGames(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	games, err := GetUpcomingGames(t.Context(), "2025-03-01")
+	if err != nil {
+		t.Fatalf("GetUpcomingGames: %v", err)
+	}
+
+	// The schedule covers the whole week, only games on the date are returned
+	want := []models.Game{{
+		GameID:       2024020901,
+		Title:        "TOR @ MTL",
+		AwayTeam:     models.Team{Abbrev: "TOR", Id: 10, Logo: "https://assets.nhle.com/logos/nhl/svg/TOR_light.svg"},
+		HomeTeam:     models.Team{Abbrev: "MTL", Id: 8, Logo: "https://assets.nhle.com/logos/nhl/svg/MTL_light.svg"},
+		Season:       "20242025",
+		StartTimeUTC: "2025-03-02T00:00:00Z",
+		EstDate:      "2025-03-01",
+	}}
+	if !reflect.DeepEqual(games, want) {
+		t.Errorf("GetUpcomingGames = %+v, want %+v", games, want)
+	}
+}
+
+func TestGetUpcomingGamesMissingFixture(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	_, err := GetUpcomingGames(t.Context(), "2025-03-05")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("GetUpcomingGames error = %v, want a 404 StatusError", err)
+	}
+}
+
+func TestGetTeamsRest(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	games, err := GetUpcomingGames(t.Context(), "2025-03-01")
+	if err != nil {
+		t.Fatalf("GetUpcomingGames: %v", err)
+	}
+
+	restDays, err := GetTeamsRest(t.Context(), "2025-03-01", games)
+	if err != nil {
+		t.Fatalf("GetTeamsRest: %v", err)
+	}
+
+	want := map[int]int{
+		10: 1, // TOR last played 02-27
+		8:  0, // MTL played the night before
+		6:  2, // BOS, TOR's and MTL's earlier opponent
+		9:  0, // OTT
+	}
+	if !reflect.DeepEqual(restDays, want) {
+		t.Errorf("GetTeamsRest = %v, want %v", restDays, want)
+	}
+}
+
+func TestFetchActualGameShots(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	// Duplicate ids are only fetched once
+	shots, err := FetchActualGameShots(t.Context(), []int{2024020901, 2024020901})
+	if err != nil {
+		t.Fatalf("FetchActualGameShots: %v", err)
+	}
+
+	want := map[int]int{
+		8479318: 4,
+		8478483: 2,
+		8480018: 1,
+		8481540: 5,
+		8483457: 2,
+	}
+	if !reflect.DeepEqual(shots, want) {
+		t.Errorf("FetchActualGameShots = %v, want %v", shots, want)
+	}
+}
+
+var testGameTeams = []models.Team{{Id: 10, Abbrev: "TOR"}, {Id: 8, Abbrev: "MTL"}}
+
+func playerIDs(players []models.PlayerDetail) []int {
+	ids := make([]int, len(players))
+	for i, player := range players {
+		ids[i] = player.PlayerId
+	}
+	return ids
+}
+
+func TestGetPlayerStats(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	players, err := GetPlayerStats(t.Context(), 2024020901, testGameTeams)
+	if err != nil {
+		t.Fatalf("GetPlayerStats: %v", err)
+	}
+
+	// Roster order, away forwards then defense, then the home team
+	want := []int{8479318, 8478483, 8476853, 8480018, 8481540, 8483457}
+	if got := playerIDs(players); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetPlayerStats players = %v, want %v", got, want)
+	}
+	for _, player := range players {
+		opponent := testGameTeams[0]
+		if player.CurrentTeamId == testGameTeams[0].Id {
+			opponent = testGameTeams[1]
+		}
+		if player.OpposingTeamId != opponent.Id || player.OpposingTeamAbbrev != opponent.Abbrev {
+			t.Errorf("player %d opponent = %d %s, want %d %s", player.PlayerId,
+				player.OpposingTeamId, player.OpposingTeamAbbrev, opponent.Id, opponent.Abbrev)
+		}
+	}
+}
+
+func TestGetPlayerStatsPartialFailure(t *testing.T) {
+	replay := &ReplayTransport{Dir: "../testdata/2025-03-01"}
+	useTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.Contains(req.URL.Path, "/player/8480018/") {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody, Request: req}, nil
+		}
+		return replay.RoundTrip(req)
+	}))
+
+	players, err := GetPlayerStats(t.Context(), 2024020901, testGameTeams)
+
+	var partial *PlayerStatsError
+	if !errors.As(err, &partial) {
+		t.Fatalf("GetPlayerStats error = %v, want a *PlayerStatsError", err)
+	}
+	if len(partial.Failed) != 1 || partial.Failed[0].PlayerID != 8480018 || partial.Failed[0].TeamAbbrev != "MTL" {
+		t.Errorf("failed players = %+v, want only 8480018 (MTL)", partial.Failed)
+	}
+
+	want := []int{8479318, 8478483, 8476853, 8481540, 8483457}
+	if got := playerIDs(players); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetPlayerStats players = %v, want %v", got, want)
+	}
+}
+
+func TestGetPlayerStatsRosterFailure(t *testing.T) {
+	replay := &ReplayTransport{Dir: "../testdata/2025-03-01"}
+	useTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.Contains(req.URL.Path, "/roster/MTL/") {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody, Request: req}, nil
+		}
+		return replay.RoundTrip(req)
+	}))
+
+	players, err := GetPlayerStats(t.Context(), 2024020901, testGameTeams)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || players != nil {
+		t.Fatalf("GetPlayerStats = %v, %v, want no players and a StatusError", playerIDs(players), err)
+	}
+}
+
+func TestGetPlayerStatsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	replay := &ReplayTransport{Dir: "../testdata/2025-03-01"}
+	useTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		// The request is canceled once the rosters are in
+		if strings.Contains(req.URL.Path, "/player/") {
+			cancel()
+			return nil, req.Context().Err()
+		}
+		return replay.RoundTrip(req)
+	}))
+
+	players, err := GetPlayerStats(ctx, 2024020901, testGameTeams)
+	if !errors.Is(err, context.Canceled) || players != nil {
+		t.Fatalf("GetPlayerStats = %v, %v, want no players and context.Canceled", playerIDs(players), err)
+	}
+}
+
+func TestGetStartingGoalies(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	// The boxscore has no starters, so each team's goalie with the most games is used
+	goalies, err := GetStartingGoalies(t.Context(), 2024020901)
+	if err != nil {
+		t.Fatalf("GetStartingGoalies: %v", err)
+	}
+	want := map[int]models.StartingGoalie{
+		10: {PlayerID: 8479361, Name: "J. Woll", TeamID: 10, Source: models.GoalieFromGamesPlayed, GamesPlayed: 32, SavePct: 0.908},
+		8:  {PlayerID: 8478470, Name: "S. Montembeault", TeamID: 8, Source: models.GoalieFromGamesPlayed, GamesPlayed: 45, SavePct: 0.902},
+	}
+	if !reflect.DeepEqual(goalies, want) {
+		t.Errorf("GetStartingGoalies = %+v, want %+v", goalies, want)
+	}
+}
+
+func TestGetStartingGoaliesConfirmed(t *testing.T) {
+	replay := &ReplayTransport{Dir: "../testdata/2025-03-01"}
+	useTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(req.URL.Path, "/boxscore") {
+			body := `{"playerByGameStats":{
+				"awayTeam":{"goalies":[{"playerId":8479361,"name":{"default":"J. Woll"},"starter":false},
+					{"playerId":8476932,"name":{"default":"A. Stolarz"},"starter":true}]},
+				"homeTeam":{"goalies":[]}}}`
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+		}
+		return replay.RoundTrip(req)
+	}))
+
+	goalies, err := GetStartingGoalies(t.Context(), 2024020901)
+	if err != nil {
+		t.Fatalf("GetStartingGoalies: %v", err)
+	}
+	want := models.StartingGoalie{PlayerID: 8476932, Name: "A. Stolarz", TeamID: 10, Confirmed: true, Source: models.GoalieFromBoxscore, GamesPlayed: 24, SavePct: 0.921}
+	if goalies[10] != want {
+		t.Errorf("TOR starter = %+v, want %+v", goalies[10], want)
+	}
+	if goalies[8].Confirmed || goalies[8].Source != models.GoalieFromGamesPlayed || goalies[8].PlayerID != 8478470 {
+		t.Errorf("MTL starter = %+v, want Montembeault by games played", goalies[8])
+	}
+}
+
+func TestGetTeamForm(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	// The game on the date itself isn't counted
+	form, err := GetTeamForm(t.Context(), models.Team{Abbrev: "TOR", Id: 10}, "20242025", "2025-03-01")
+	if err != nil {
+		t.Fatalf("GetTeamForm: %v", err)
+	}
+	want := models.TeamForm{TeamID: 10, Games: 6, Wins: 4, Losses: 1, OTLosses: 1, GoalsFor: 20, GoalsAgainst: 15, PointPct: 0.75}
+	if form != want {
+		t.Errorf("GetTeamForm = %+v, want %+v", form, want)
+	}
+}
+
+func TestGetPlayerGameLog(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	gameLog, err := GetPlayerGameLog(t.Context(), 8479318, "20242025")
+	if err != nil {
+		t.Fatalf("GetPlayerGameLog: %v", err)
+	}
+	if len(gameLog) != 12 {
+		t.Fatalf("got %d games, want 12", len(gameLog))
+	}
+	want := models.GameLogEntry{GameID: 2024020887, GameDate: "2025-02-27", TeamAbbrev: "TOR", OpponentAbbrev: "OTT", HomeRoadFlag: "H", Shots: 5, TOI: "21:10"}
+	if gameLog[0] != want {
+		t.Errorf("most recent game = %+v, want %+v", gameLog[0], want)
+	}
+}
+
+func TestGetPlayerPowerPlayTOI(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	// The two oldest games in the game log have no time on ice row
+	powerPlayTOI, err := GetPlayerPowerPlayTOI(t.Context(), 8479318, "20242025")
+	if err != nil {
+		t.Fatalf("GetPlayerPowerPlayTOI: %v", err)
+	}
+	if len(powerPlayTOI) != 10 || powerPlayTOI[2024020887] != 185 {
+		t.Errorf("GetPlayerPowerPlayTOI = %v, want 10 games with 185 seconds in 2024020887", powerPlayTOI)
+	}
+	if seconds, ok := powerPlayTOI[2024020758]; !ok || seconds != 0 {
+		t.Errorf("game without power play time = %d, %v, want 0, true", seconds, ok)
+	}
+}
+
+func TestSumTeamGames(t *testing.T) {
+	games := []models.TeamStats{
+		{TeamId: 10, GoalsFor: 3, GoalsAgainst: 2, ShotsForPerGame: 30, ShotsAgainstPerGame: 25, Wins: 1, Points: 2},
+		{TeamId: 8, GoalsFor: 2, GoalsAgainst: 3, ShotsForPerGame: 25, ShotsAgainstPerGame: 30, OTLosses: 1, Points: 1},
+		{TeamId: 10, GoalsFor: 1, GoalsAgainst: 4, ShotsForPerGame: 36, ShotsAgainstPerGame: 27, Losses: 1},
+	}
+
+	teams := sumTeamGames(games)
+	if len(teams) != 2 || teams[0].TeamId != 10 || teams[1].TeamId != 8 {
+		t.Fatalf("sumTeamGames = %+v, want teams 10 then 8", teams)
+	}
+	want := models.TeamStats{
+		TeamId: 10, GamesPlayed: 2, GoalsFor: 4, GoalsAgainst: 6, GoalsForPerGame: 2, GoalsAgainstPerGame: 3,
+		ShotsForPerGame: 33, ShotsAgainstPerGame: 26, Wins: 1, Losses: 1, Points: 2, PointPct: 0.5,
+	}
+	if teams[0] != want {
+		t.Errorf("team 10 = %+v, want %+v", teams[0], want)
+	}
+	if len(sumTeamGames(nil)) != 0 {
+		t.Error("no games should have no teams")
+	}
+}
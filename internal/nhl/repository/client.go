@@ -0,0 +1,315 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api.alexmontague.ca/internal/database"
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// How long each kind of NHL response is reused before it is fetched again.
+// Boxscores are never cached since validation needs final numbers.
+const (
+	ROSTER_CACHE_TTL     = 6 * time.Hour
+	PLAYER_CACHE_TTL     = 1 * time.Hour
+	TEAM_STATS_CACHE_TTL = 6 * time.Hour
+	SCHEDULE_CACHE_TTL   = 15 * time.Minute
+	GAME_LOG_CACHE_TTL   = 6 * time.Hour
+	MATCHUP_CACHE_TTL    = 15 * time.Minute // the goalie with the most games played can change up to puck drop
+	NO_CACHE             = time.Duration(0)
+)
+
+// ClientConfig tunes how the NHL client talks to the API
+type ClientConfig struct {
+	BaseURL           string            // NHL web API, models.NHL_API_BASE when empty
+	StatsBaseURL      string            // NHL stats API, models.NHL_STATS_API_BASE when empty
+	Transport         http.RoundTripper // nil uses http.DefaultTransport
+	Timeout           time.Duration     // per request, including reading the body
+	MaxConcurrent     int               // requests in flight at once
+	RequestsPerSecond float64           // token bucket refill rate
+	Burst             int               // token bucket size
+	MaxRetries        int               // retries after a 429, 5xx or network error
+	RetryBaseDelay    time.Duration     // first backoff, doubled on each retry
+	MaxRetryDelay     time.Duration
+}
+
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		BaseURL:           models.NHL_API_BASE,
+		StatsBaseURL:      models.NHL_STATS_API_BASE,
+		Timeout:           10 * time.Second,
+		MaxConcurrent:     8,
+		RequestsPerSecond: 10,
+		Burst:             20,
+		MaxRetries:        3,
+		RetryBaseDelay:    500 * time.Millisecond,
+		MaxRetryDelay:     10 * time.Second,
+	}
+}
+
+// StatusError is returned for NHL API responses that aren't 200 OK
+type StatusError struct {
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration // from the Retry-After header, zero when absent
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("nhl api %s: status %d", e.URL, e.StatusCode)
+}
+
+// Client is a rate limited NHL API client that caches responses in SQLite
+type Client struct {
+	config     ClientConfig
+	httpClient *http.Client
+	limiter    *tokenBucket
+	slots      chan struct{}
+}
+
+func NewClient(config ClientConfig) *Client {
+	if config.BaseURL == "" {
+		config.BaseURL = models.NHL_API_BASE
+	}
+	if config.StatsBaseURL == "" {
+		config.StatsBaseURL = models.NHL_STATS_API_BASE
+	}
+	if config.MaxConcurrent < 1 {
+		config.MaxConcurrent = 1
+	}
+	return &Client{
+		config:     config,
+		httpClient: &http.Client{Timeout: config.Timeout, Transport: config.Transport},
+		limiter:    newTokenBucket(config.RequestsPerSecond, config.Burst),
+		slots:      make(chan struct{}, config.MaxConcurrent),
+	}
+}
+
+// defaultClient is shared by the package level API functions so every request
+// and model draws from the same rate limit and cache
+var defaultClient = NewClient(DefaultClientConfig())
+
+// SetDefaultClient replaces the client used by the package level API functions
+// and returns the previous one. It isn't safe to call while requests are in flight.
+func SetDefaultClient(client *Client) *Client {
+	previous := defaultClient
+	defaultClient = client
+	return previous
+}
+
+// webURL builds a URL on the NHL web API
+func (c *Client) webURL(format string, args ...interface{}) string {
+	return c.config.BaseURL + fmt.Sprintf(format, args...)
+}
+
+// statsURL builds a URL on the NHL stats API
+func (c *Client) statsURL(format string, args ...interface{}) string {
+	return c.config.StatsBaseURL + fmt.Sprintf(format, args...)
+}
+
+// getJSON decodes the response for url into out, serving it from the cache
+// when a fresh copy exists. A zero ttl skips the cache.
+func (c *Client) getJSON(ctx context.Context, url string, ttl time.Duration, out interface{}) error {
+	if ttl > 0 {
+		if body, ok := cachedResponse(url); ok {
+			return json.Unmarshal(body, out)
+		}
+	}
+
+	body, err := c.get(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode %s: %w", url, err)
+	}
+
+	if ttl > 0 {
+		storeResponse(url, body, ttl)
+	}
+	return nil
+}
+
+// get fetches url, retrying rate limited, server error and network failures
+// with exponential backoff. It gives up as soon as ctx is done.
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.backoff(attempt, lastErr)
+			log.Printf("Retrying %s in %s after: %v", url, delay, lastErr)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+
+		body, err := c.do(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+		if !isRetryable(err) {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// do makes a single request once a concurrency slot and rate limit token are free
+func (c *Client) do(ctx context.Context, url string) ([]byte, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-c.slots }()
+
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	atomic.AddUint64(&RequestCount, 1)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, &StatusError{
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (c *Client) backoff(attempt int, lastErr error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(lastErr, &statusErr) && statusErr.RetryAfter > 0 {
+		return min(statusErr.RetryAfter, c.config.MaxRetryDelay)
+	}
+
+	delay := c.config.RetryBaseDelay << (attempt - 1)
+	// Up to 50% jitter so concurrent retries don't arrive together
+	delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return min(delay, c.config.MaxRetryDelay)
+}
+
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	// Timeouts, resets and other transport failures
+	return true
+}
+
+// sleepContext waits for delay, returning early with the context's error when it's done
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// cachedResponse reads the SQLite response cache, treating a missing database as a miss
+func cachedResponse(url string) ([]byte, bool) {
+	if database.DB == nil {
+		return nil, false
+	}
+	body, err := dbRepository.GetCachedNHLResponse(url)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error reading NHL response cache for %s: %v", url, err)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+func storeResponse(url string, body []byte, ttl time.Duration) {
+	if database.DB == nil {
+		return
+	}
+	if err := dbRepository.StoreNHLResponse(url, body, ttl); err != nil {
+		log.Printf("Error caching NHL response for %s: %v", url, err)
+	}
+}
+
+// tokenBucket allows bursts of up to capacity requests, refilling at rate per second
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	rate     float64
+	last     time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	capacity := float64(max(burst, 1))
+	return &tokenBucket{tokens: capacity, capacity: capacity, rate: rate, last: time.Now()}
+}
+
+// wait blocks until a token is available and takes it, or until ctx is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b.rate <= 0 {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
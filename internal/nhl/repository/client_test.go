@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const scheduleBody = `{"gameWeek":[{"date":"2025-03-01","games":[{"id":1,"season":20242025,"startTimeUTC":"2025-03-02T00:00:00Z","awayTeam":{"id":10,"abbrev":"TOR"},"homeTeam":{"id":8,"abbrev":"MTL"}}]}]}`
+
+// testClient talks to server with fast retries and no rate limit
+func testClient(t *testing.T, serverURL string, transport http.RoundTripper) {
+	t.Helper()
+	previous := SetDefaultClient(NewClient(ClientConfig{
+		BaseURL:        serverURL,
+		StatsBaseURL:   serverURL,
+		Transport:      transport,
+		Timeout:        time.Second,
+		MaxConcurrent:  2,
+		MaxRetries:     2,
+		RetryBaseDelay: time.Millisecond,
+		MaxRetryDelay:  10 * time.Millisecond,
+	}))
+	t.Cleanup(func() { SetDefaultClient(previous) })
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(scheduleBody))
+		}
+	}))
+	defer server.Close()
+	testClient(t, server.URL, nil)
+
+	games, err := GetUpcomingGames(t.Context(), "2025-03-01")
+	if err != nil {
+		t.Fatalf("GetUpcomingGames: %v", err)
+	}
+	if len(games) != 1 || games[0].Title != "TOR @ MTL" {
+		t.Errorf("GetUpcomingGames = %+v, want the TOR @ MTL game", games)
+	}
+	if calls != 3 {
+		t.Errorf("server called %d times, want 3", calls)
+	}
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	testClient(t, server.URL, nil)
+
+	_, err := GetUpcomingGames(t.Context(), "2025-03-01")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("GetUpcomingGames error = %v, want a 502 StatusError", err)
+	}
+	if calls != 3 {
+		t.Errorf("server called %d times, want 3", calls)
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	testClient(t, server.URL, nil)
+
+	if _, err := GetUpcomingGames(t.Context(), "2025-03-01"); err == nil {
+		t.Fatal("GetUpcomingGames succeeded, want an error")
+	}
+	if calls != 1 {
+		t.Errorf("server called %d times, want 1", calls)
+	}
+}
+
+func TestClientStopsWhenContextDone(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	testClient(t, server.URL, nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	if _, err := GetUpcomingGames(ctx, "2025-03-01"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetUpcomingGames error = %v, want context.Canceled", err)
+	}
+	if calls != 0 {
+		t.Errorf("server called %d times, want 0", calls)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(scheduleBody))
+	}))
+	dir := t.TempDir()
+	testClient(t, server.URL, &RecordingTransport{Dir: dir})
+
+	recorded, err := GetUpcomingGames(t.Context(), "2025-03-01")
+	if err != nil {
+		t.Fatalf("GetUpcomingGames while recording: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "schedule_2025-03-01.json")); err != nil {
+		t.Fatalf("fixture not recorded: %v", err)
+	}
+
+	// Replay with the server gone
+	server.Close()
+	testClient(t, server.URL, &ReplayTransport{Dir: dir})
+
+	replayed, err := GetUpcomingGames(t.Context(), "2025-03-01")
+	if err != nil {
+		t.Fatalf("GetUpcomingGames while replaying: %v", err)
+	}
+	if len(replayed) != 1 || replayed[0] != recorded[0] {
+		t.Errorf("replayed %+v, recorded %+v", replayed, recorded)
+	}
+}
+
+func TestFixtureName(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://api-web.nhle.com/v1/schedule/2025-03-01", "v1_schedule_2025-03-01.json"},
+		{"https://api-web.nhle.com/v1/player/8479318/landing", "v1_player_8479318_landing.json"},
+		{"https://api.nhle.com/stats/rest/en/team/summary?cayenneExp=seasonId=20242025", "stats_rest_en_team_summary_cayenneExp_seasonId_20242025.json"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		if got := FixtureName(req); got != tt.want {
+			t.Errorf("FixtureName(%s) = %s, want %s", tt.url, got, tt.want)
+		}
+	}
+}
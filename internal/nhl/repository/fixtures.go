@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// unsafeFixtureChars matches everything that can't appear in a fixture file name
+var unsafeFixtureChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FixtureName is the file a response for req is recorded to, built from its
+// path and query so "/v1/schedule/2025-03-01" becomes "v1_schedule_2025-03-01.json"
+func FixtureName(req *http.Request) string {
+	name := strings.Trim(req.URL.Path, "/")
+	if req.URL.RawQuery != "" {
+		name += "?" + req.URL.RawQuery
+	}
+	return strings.Trim(unsafeFixtureChars.ReplaceAllString(name, "_"), "_") + ".json"
+}
+
+// RecordingTransport passes requests through to Next and saves every 200 OK
+// response body in Dir so it can be served later by ReplayTransport
+type RecordingTransport struct {
+	Dir  string
+	Next http.RoundTripper // nil uses http.DefaultTransport
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(t.Dir, FixtureName(req)), body, 0644); err != nil {
+		return nil, fmt.Errorf("record fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// ReplayTransport serves responses recorded by RecordingTransport without
+// touching the network. Requests with no fixture get a 404.
+type ReplayTransport struct {
+	Dir string
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := FixtureName(req)
+	body, err := os.ReadFile(filepath.Join(t.Dir, name))
+	status := http.StatusOK
+	if os.IsNotExist(err) {
+		status = http.StatusNotFound
+		body = []byte(fmt.Sprintf(`{"error":"no fixture %s"}`, name))
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		StatusCode:    status,
+		Status:        http.StatusText(status),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"sync"
+)
+
+// group runs tasks on a bounded number of goroutines. The first task to fail
+// cancels the group's context and its error is returned by wait, like errgroup.
+type group struct {
+	cancel  context.CancelCauseFunc
+	wg      sync.WaitGroup
+	slots   chan struct{}
+	errOnce sync.Once
+	err     error
+}
+
+// newGroup returns a group running at most limit tasks at once, and the
+// context its tasks should use
+func newGroup(ctx context.Context, limit int) (*group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &group{cancel: cancel, slots: make(chan struct{}, max(limit, 1))}, ctx
+}
+
+// run starts task once a slot is free, blocking the caller until then
+func (g *group) run(task func() error) {
+	g.slots <- struct{}{}
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			<-g.slots
+			g.wg.Done()
+		}()
+
+		if err := task(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				g.cancel(err)
+			})
+		}
+	}()
+}
+
+// wait blocks until every task has finished and returns the first error
+func (g *group) wait() error {
+	g.wg.Wait()
+	g.cancel(g.err)
+	return g.err
+}
@@ -0,0 +1,487 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+	"api.alexmontague.ca/internal/nhl/models"
+	"api.alexmontague.ca/internal/nhl/repository"
+)
+
+const (
+	// MAX_BACKTEST_DAYS caps the date range a backtest request can replay
+	// while the client waits, longer ranges are run with cmd/backtest
+	MAX_BACKTEST_DAYS = 7
+
+	// BACKTEST_FETCH_CONCURRENCY bounds parallel game log requests when reconstructing a date
+	BACKTEST_FETCH_CONCURRENCY = 8
+)
+
+var (
+	ErrInvalidBacktestRange = errors.New("invalid backtest date range")
+	ErrInvalidBacktestModel = errors.New("invalid backtest model")
+)
+
+// BacktestRequest names the model to replay, either a registered model or an
+// unregistered strategy and parameter set
+type BacktestRequest struct {
+	ModelVersionID      *int                       `json:"modelId"`
+	CalculationStrategy models.CalculationStrategy `json:"calculationStrategy"`
+	Parameters          *models.ModelParameters    `json:"parameters"`
+	StartDate           string                     `json:"startDate"`
+	EndDate             string                     `json:"endDate"`
+}
+
+// Model resolves the model to replay. Unknown model ids return sql.ErrNoRows.
+func (req BacktestRequest) Model() (models.ModelVersion, error) {
+	if req.ModelVersionID != nil {
+		if req.Parameters != nil {
+			return models.ModelVersion{}, fmt.Errorf("%w: give either a model id or parameters", ErrInvalidBacktestModel)
+		}
+		InitializeModels()
+		model, err := dbRepository.GetModelVersion(*req.ModelVersionID)
+		if err != nil {
+			return models.ModelVersion{}, err
+		}
+		return *model, nil
+	}
+
+	if req.Parameters == nil {
+		return models.ModelVersion{}, fmt.Errorf("%w: a model id or parameters are required", ErrInvalidBacktestModel)
+	}
+	strategy := req.CalculationStrategy
+	if strategy == "" {
+		strategy = models.StandardCalculation
+	}
+	if !strategy.Valid() {
+		return models.ModelVersion{}, fmt.Errorf("%w: unknown calculation strategy", ErrInvalidBacktestModel)
+	}
+	if err := dbRepository.ValidateModelParameters(*req.Parameters); err != nil {
+		return models.ModelVersion{}, fmt.Errorf("%w: %v", ErrInvalidBacktestModel, err)
+	}
+	return models.ModelVersion{
+		Name:                "Unregistered parameters",
+		CalculationStrategy: strategy,
+		Parameters:          *req.Parameters,
+	}, nil
+}
+
+// Days returns how many dates the request covers, both ends included
+func (req BacktestRequest) Days() (int, error) {
+	start, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return 0, fmt.Errorf("%w: start date must be YYYY-MM-DD", ErrInvalidBacktestRange)
+	}
+	end, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		return 0, fmt.Errorf("%w: end date must be YYYY-MM-DD", ErrInvalidBacktestRange)
+	}
+	if end.Before(start) {
+		return 0, fmt.Errorf("%w: end date is before start date", ErrInvalidBacktestRange)
+	}
+	return int(end.Sub(start).Hours()/24) + 1, nil
+}
+
+// BacktestStats scores a set of backtested predictions
+type BacktestStats struct {
+	Predictions int     `json:"predictions"`
+	Hits        int     `json:"hits"`
+	HitRate     float64 `json:"hitRate"`
+	MAE         float64 `json:"mae"` // mean absolute error of predicted vs actual shots
+	LogLoss     float64 `json:"logLoss"`
+	Brier       float64 `json:"brier"`
+
+	absError float64
+	logLoss  float64
+	brier    float64
+}
+
+// ConfidenceBucket groups predictions by confidence score to check calibration
+type ConfidenceBucket struct {
+	MinConfidence float64 `json:"minConfidence"`
+	MaxConfidence float64 `json:"maxConfidence"`
+	Predictions   int     `json:"predictions"`
+	Hits          int     `json:"hits"`
+	HitRate       float64 `json:"hitRate"`
+	AvgPredicted  float64 `json:"avgPredicted"`
+	AvgActual     float64 `json:"avgActual"`
+}
+
+// BacktestSkip records a date that couldn't be replayed
+type BacktestSkip struct {
+	Date   string `json:"date"`
+	Reason string `json:"reason"`
+}
+
+type BacktestResult struct {
+	ModelVersionID      int                        `json:"modelVersionId,omitempty"` // 0 for an unregistered parameter set
+	ModelName           string                     `json:"modelName"`
+	CalculationStrategy models.CalculationStrategy `json:"calculationStrategy"`
+	StartDate           string                     `json:"startDate"`
+	EndDate             string                     `json:"endDate"`
+	Dates               int                        `json:"dates"`
+	SnapshotDates       int                        `json:"snapshotDates"`      // replayed from recorded inputs
+	ReconstructedDates  int                        `json:"reconstructedDates"` // rebuilt from game logs
+	SkippedDates        []BacktestSkip             `json:"skippedDates"`
+	Games               int                        `json:"games"`
+	Unscored            int                        `json:"unscored"` // predicted players missing from the boxscore
+	Overall             BacktestStats              `json:"overall"`
+	Calibration         []ConfidenceBucket         `json:"calibration"`
+	ByPosition          map[string]*BacktestStats  `json:"byPosition"`
+	ByDate              map[string]*BacktestStats  `json:"byDate"`
+}
+
+type confidenceAccumulator struct {
+	predictions    int
+	hits           int
+	predictedShots float64
+	actualShots    int
+}
+
+// backtester replays one model over a date range, caching the NHL data it
+// reconstructs so each roster and game log is only fetched once per run
+type backtester struct {
+	model    models.ModelVersion
+	result   *BacktestResult
+	mu       sync.Mutex
+	rosters  map[string][]models.Player
+	gameLogs map[string][]models.GameLogEntry
+
+	// calibration accumulates outcomes by whole confidence point
+	calibration map[int]*confidenceAccumulator
+}
+
+// RunBacktest replays a model against every date from startDate to endDate
+// (YYYY-MM-DD, inclusive) and scores it against boxscore results. Dates with
+// recorded prediction inputs are replayed as they were; other dates are
+// reconstructed from season rosters, player game logs and team stats summed
+// from the games before each date.
+func RunBacktest(ctx context.Context, model models.ModelVersion, startDate string, endDate string) (*BacktestResult, error) {
+	if _, err := (BacktestRequest{StartDate: startDate, EndDate: endDate}).Days(); err != nil {
+		return nil, err
+	}
+	start, _ := time.Parse("2006-01-02", startDate)
+	end, _ := time.Parse("2006-01-02", endDate)
+
+	b := &backtester{
+		model: model,
+		result: &BacktestResult{
+			ModelVersionID:      model.ID,
+			ModelName:           model.Name,
+			CalculationStrategy: model.CalculationStrategy,
+			StartDate:           startDate,
+			EndDate:             endDate,
+			SkippedDates:        []BacktestSkip{},
+			ByPosition:          make(map[string]*BacktestStats),
+			ByDate:              make(map[string]*BacktestStats),
+		},
+		rosters:     make(map[string][]models.Player),
+		gameLogs:    make(map[string][]models.GameLogEntry),
+		calibration: make(map[int]*confidenceAccumulator),
+	}
+
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		b.result.Dates++
+		if err := b.replayDate(ctx, date, day); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			fmt.Println("Backtest skipped", date, err)
+			b.result.SkippedDates = append(b.result.SkippedDates, BacktestSkip{Date: date, Reason: err.Error()})
+		}
+	}
+
+	b.finish()
+	return b.result, nil
+}
+
+// replayDate predicts every game on a date and scores the predictions
+func (b *backtester) replayDate(ctx context.Context, date string, day time.Time) error {
+	inputs, err := dbRepository.GetPredictionInputs(date)
+	switch {
+	case err == nil:
+		b.result.SnapshotDates++
+	case errors.Is(err, sql.ErrNoRows):
+		inputs, err = b.reconstructInputs(ctx, date)
+		if err != nil {
+			return fmt.Errorf("reconstruct inputs: %w", err)
+		}
+		if len(inputs.Games) > 0 {
+			b.result.ReconstructedDates++
+		}
+	default:
+		return fmt.Errorf("load recorded inputs: %w", err)
+	}
+
+	if len(inputs.Games) == 0 {
+		return nil
+	}
+
+	gameIDs := make([]int, 0, len(inputs.Games))
+	for _, game := range inputs.Games {
+		gameIDs = append(gameIDs, game.GameID)
+	}
+	actualShots, err := repository.FetchActualGameShots(ctx, gameIDs)
+	if err != nil {
+		return fmt.Errorf("fetch boxscores: %w", err)
+	}
+
+	b.result.Games += len(inputs.Games)
+	for _, game := range predictGames(inputs, b.model, day) {
+		for _, player := range game.Players {
+			actual, played := actualShots[player.PlayerId]
+			if !played {
+				b.result.Unscored++
+				continue
+			}
+			b.score(date, player, actual)
+		}
+	}
+	return nil
+}
+
+// score adds one prediction's outcome to every breakdown
+func (b *backtester) score(date string, player models.PlayerStats, actual int) {
+	hit, logLoss, brier := player.Distribution.Score(actual)
+	absError := math.Abs(player.PredictedGameShots - float64(actual))
+
+	for _, stats := range []*BacktestStats{
+		&b.result.Overall,
+		statsFor(b.result.ByPosition, player.Position),
+		statsFor(b.result.ByDate, date),
+	} {
+		stats.Predictions++
+		stats.absError += absError
+		stats.logLoss += logLoss
+		stats.brier += brier
+		if hit {
+			stats.Hits++
+		}
+	}
+
+	// Confidence is a 0-10 score, bucketed by whole point with 10 in the top bucket
+	bucket := int(math.Min(math.Max(player.Confidence, 0), 9.999))
+	acc, ok := b.calibration[bucket]
+	if !ok {
+		acc = &confidenceAccumulator{}
+		b.calibration[bucket] = acc
+	}
+	acc.predictions++
+	acc.predictedShots += player.PredictedGameShots
+	acc.actualShots += actual
+	if hit {
+		acc.hits++
+	}
+}
+
+// finish turns the running totals into rates and averages
+func (b *backtester) finish() {
+	result := b.result
+	result.Overall.summarize()
+	for _, stats := range result.ByPosition {
+		stats.summarize()
+	}
+	for _, stats := range result.ByDate {
+		stats.summarize()
+	}
+
+	result.Calibration = []ConfidenceBucket{}
+	for bucket := 0; bucket < 10; bucket++ {
+		acc, ok := b.calibration[bucket]
+		if !ok {
+			continue
+		}
+		result.Calibration = append(result.Calibration, ConfidenceBucket{
+			MinConfidence: float64(bucket),
+			MaxConfidence: float64(bucket + 1),
+			Predictions:   acc.predictions,
+			Hits:          acc.hits,
+			HitRate:       roundTo(float64(acc.hits)/float64(acc.predictions), 4),
+			AvgPredicted:  roundTo(acc.predictedShots/float64(acc.predictions), 2),
+			AvgActual:     roundTo(float64(acc.actualShots)/float64(acc.predictions), 2),
+		})
+	}
+}
+
+func (s *BacktestStats) summarize() {
+	if s.Predictions == 0 {
+		return
+	}
+	s.HitRate = roundTo(float64(s.Hits)/float64(s.Predictions), 4)
+	s.MAE = roundTo(s.absError/float64(s.Predictions), 3)
+	s.LogLoss = roundTo(s.logLoss/float64(s.Predictions), 4)
+	s.Brier = roundTo(s.brier/float64(s.Predictions), 4)
+}
+
+func statsFor(breakdown map[string]*BacktestStats, key string) *BacktestStats {
+	stats, ok := breakdown[key]
+	if !ok {
+		stats = &BacktestStats{}
+		breakdown[key] = stats
+	}
+	return stats
+}
+
+// reconstructInputs rebuilds a past date's inputs from the schedule, season
+// rosters and game logs, keeping only games played before the date. Players
+// are on the team they last played for before the date. Starting goalies are
+// the ones who started, without their season totals, which would include
+// games after the date, so the goalie factor is neutral.
+func (b *backtester) reconstructInputs(ctx context.Context, date string) (*models.PredictionInputs, error) {
+	games, err := repository.GetUpcomingGames(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := &models.PredictionInputs{
+		Date:    date,
+		Games:   games,
+		Players: make(map[int][]models.PlayerDetail),
+	}
+	if len(games) == 0 {
+		return inputs, nil
+	}
+
+	season := games[0].Season
+	if inputs.TeamStats, err = repository.GetTeamStatsBefore(ctx, season, date); err != nil {
+		return nil, err
+	}
+	if inputs.RestDays, err = repository.GetTeamsRest(ctx, date, games); err != nil {
+		return nil, err
+	}
+
+	for _, game := range games {
+		teams := []models.Team{game.AwayTeam, game.HomeTeam}
+		for i, team := range teams {
+			opponent := teams[1-i]
+			roster, err := b.roster(ctx, team.Abbrev, season)
+			if err != nil {
+				return nil, fmt.Errorf("roster for %s: %w", team.Abbrev, err)
+			}
+			b.prefetchGameLogs(ctx, roster, season)
+
+			for _, player := range roster {
+				gameLog, ok := b.cachedGameLog(player.Id, season)
+				if !ok {
+					continue
+				}
+				// The season roster has everyone who played for the team,
+				// including players who only joined after the date
+				if played := gameLogBefore(gameLog, date); len(played) == 0 || played[0].TeamAbbrev != team.Abbrev {
+					continue
+				}
+				detail := playerDetailAsOf(player, team, opponent, gameLog, date)
+				detail.IsHome = team.Id == game.HomeTeam.Id
+				inputs.Players[game.GameID] = append(inputs.Players[game.GameID], detail)
+			}
+		}
+		if err := attachMatchupInputs(ctx, game, inputs.Players[game.GameID]); err != nil {
+			return nil, err
+		}
+		for _, player := range inputs.Players[game.GameID] {
+			if goalie := player.OpposingGoalie; goalie != nil {
+				goalie.GamesPlayed, goalie.SavePct = 0, 0
+			}
+		}
+	}
+
+	return inputs, nil
+}
+
+// playerDetailAsOf builds the player landing data as it would have looked on
+// date, using only games from the log played before it
+func playerDetailAsOf(player models.Player, team models.Team, opponent models.Team, gameLog []models.GameLogEntry, date string) models.PlayerDetail {
+	detail := models.PlayerDetail{
+		PlayerId:           player.Id,
+		Position:           player.Position,
+		CurrentTeamId:      team.Id,
+		CurrentTeamAbbrev:  team.Abbrev,
+		OpposingTeamId:     opponent.Id,
+		OpposingTeamAbbrev: opponent.Abbrev,
+	}
+	detail.FirstName.Default = player.FirstName.Default
+	detail.LastName.Default = player.LastName.Default
+
+	detail.GameLog = gameLogBefore(gameLog, date)
+	season := &detail.FeaturedStats.RegularSeason.SubSeason
+	for _, game := range detail.GameLog {
+		season.Shots += game.Shots
+		season.GamesPlayed++
+		if len(detail.Last5Games) < 5 {
+			detail.Last5Games = append(detail.Last5Games, models.Last5Game{
+				Shots:    game.Shots,
+				TOI:      game.TOI,
+				GameDate: game.GameDate,
+			})
+		}
+	}
+	return detail
+}
+
+func (b *backtester) roster(ctx context.Context, teamAbbrev string, season string) ([]models.Player, error) {
+	key := teamAbbrev + ":" + season
+	if roster, ok := b.rosters[key]; ok {
+		return roster, nil
+	}
+	roster, err := repository.GetSeasonRoster(ctx, teamAbbrev, season)
+	if err != nil {
+		return nil, err
+	}
+	b.rosters[key] = roster
+	return roster, nil
+}
+
+func gameLogKey(playerID int, season string) string {
+	return fmt.Sprintf("%d:%s", playerID, season)
+}
+
+func (b *backtester) cachedGameLog(playerID int, season string) ([]models.GameLogEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	gameLog, ok := b.gameLogs[gameLogKey(playerID, season)]
+	return gameLog, ok
+}
+
+// prefetchGameLogs fetches the game logs missing from the cache, a few at a
+// time. Players whose log can't be fetched are left out of the replay.
+func (b *backtester) prefetchGameLogs(ctx context.Context, players []models.Player, season string) {
+	semaphore := make(chan struct{}, BACKTEST_FETCH_CONCURRENCY)
+	var wg sync.WaitGroup
+
+	for _, player := range players {
+		if _, ok := b.cachedGameLog(player.Id, season); ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(playerID int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			gameLog, err := ingestPlayerGameLog(ctx, playerID, season)
+			if err != nil {
+				fmt.Println("Error fetching game log for player", playerID, err)
+				return
+			}
+
+			b.mu.Lock()
+			b.gameLogs[gameLogKey(playerID, season)] = gameLog
+			b.mu.Unlock()
+		}(player.Id)
+	}
+
+	wg.Wait()
+}
+
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+)
+
+var (
+	ErrInvalidCalibration   = errors.New("invalid calibration method")
+	ErrNoCalibrationSamples = errors.New("no validated predictions with a line to calibrate against")
+)
+
+// plattMaxIterations bounds the Newton's method steps of a Platt fit
+const plattMaxIterations = 100
+
+// CalibrationMethod is how confidence scores are mapped to probabilities
+type CalibrationMethod string
+
+const (
+	// IsotonicCalibration fits the best non-decreasing step function of
+	// confidence to the realized outcomes (pool adjacent violators)
+	IsotonicCalibration CalibrationMethod = "isotonic"
+
+	// PlattCalibration fits a logistic curve of confidence to the realized outcomes
+	PlattCalibration CalibrationMethod = "platt"
+)
+
+// IsotonicStep is one block of an isotonic fit: every confidence from
+// MinConfidence to MaxConfidence maps to Probability
+type IsotonicStep struct {
+	MinConfidence float64 `json:"minConfidence"`
+	MaxConfidence float64 `json:"maxConfidence"`
+	Predictions   int     `json:"predictions"`
+	Probability   float64 `json:"probability"`
+}
+
+// PlattScaling maps a confidence score c to 1 / (1 + exp(-(Slope*c + Intercept)))
+type PlattScaling struct {
+	Slope     float64 `json:"slope"`
+	Intercept float64 `json:"intercept"`
+}
+
+// CalibrationBin is one point of a reliability diagram: predictions with a
+// confidence in [MinConfidence, MaxConfidence), with 10 in the top bin
+type CalibrationBin struct {
+	MinConfidence         float64 `json:"minConfidence"`
+	MaxConfidence         float64 `json:"maxConfidence"`
+	Predictions           int     `json:"predictions"`
+	Hits                  int     `json:"hits"`
+	HitRate               float64 `json:"hitRate"`
+	AvgConfidence         float64 `json:"avgConfidence"`
+	CalibratedProbability float64 `json:"calibratedProbability"` // mean calibrated probability of the bin's predictions
+}
+
+// CalibrationPoint is the calibrated probability of a confidence score
+type CalibrationPoint struct {
+	Confidence  float64 `json:"confidence"`
+	Probability float64 `json:"probability"`
+}
+
+// ConfidenceCalibration maps a model's 0-10 confidence scores to the
+// probability that a player goes over the prediction's line, fit on its
+// validated predictions that have one
+type ConfidenceCalibration struct {
+	ModelVersionID  int                `json:"modelVersionId"`
+	Method          CalibrationMethod  `json:"method"`
+	Samples         int                `json:"samples"`
+	HitRate         float64            `json:"hitRate"`
+	RawBrier        float64            `json:"rawBrier"` // Brier score of confidence / 10 read as a probability
+	CalibratedBrier float64            `json:"calibratedBrier"`
+	Isotonic        []IsotonicStep     `json:"isotonic,omitempty"`
+	Platt           *PlattScaling      `json:"platt,omitempty"`
+	Curve           []CalibrationPoint `json:"curve"` // calibrated probability at each whole confidence score
+	Reliability     []CalibrationBin   `json:"reliability"`
+}
+
+// CalibrateConfidence fits a calibration of a model's confidence scores
+// against its validated predictions made over a line
+func CalibrateConfidence(modelVersionID int, method CalibrationMethod) (*ConfidenceCalibration, error) {
+	if method != IsotonicCalibration && method != PlattCalibration {
+		return nil, fmt.Errorf("%w: method must be %s or %s", ErrInvalidCalibration, IsotonicCalibration, PlattCalibration)
+	}
+
+	InitializeModels()
+	if _, err := dbRepository.GetModelVersion(modelVersionID); err != nil {
+		return nil, err
+	}
+
+	outcomes, err := dbRepository.GetConfidenceOutcomes(modelVersionID)
+	if err != nil {
+		return nil, fmt.Errorf("load outcomes: %w", err)
+	}
+	if len(outcomes) == 0 {
+		return nil, ErrNoCalibrationSamples
+	}
+
+	calibration := fitCalibration(method, outcomes)
+	calibration.ModelVersionID = modelVersionID
+	return &calibration, nil
+}
+
+// Probability returns the calibrated probability that a player with the
+// given confidence goes over the prediction's line
+func (c *ConfidenceCalibration) Probability(confidence float64) float64 {
+	if c.Platt != nil {
+		return sigmoid(c.Platt.Slope*confidence + c.Platt.Intercept)
+	}
+
+	steps := c.Isotonic
+	if len(steps) == 0 {
+		return c.HitRate
+	}
+	// Index of the first step starting after confidence
+	i, _ := slices.BinarySearchFunc(steps, confidence, func(step IsotonicStep, target float64) int {
+		if step.MinConfidence <= target {
+			return -1
+		}
+		return 1
+	})
+	switch {
+	case i == 0:
+		return steps[0].Probability
+	case i == len(steps) || confidence <= steps[i-1].MaxConfidence:
+		return steps[i-1].Probability
+	}
+
+	// Between two steps, interpolate from the end of one to the start of the next
+	lower, upper := steps[i-1], steps[i]
+	t := (confidence - lower.MaxConfidence) / (upper.MinConfidence - lower.MaxConfidence)
+	return lower.Probability + t*(upper.Probability-lower.Probability)
+}
+
+// fitCalibration fits method to outcomes and scores the fit on them
+func fitCalibration(method CalibrationMethod, outcomes []dbRepository.ConfidenceOutcome) ConfidenceCalibration {
+	outcomes = slices.SortedFunc(slices.Values(outcomes), func(a, b dbRepository.ConfidenceOutcome) int {
+		return cmp.Compare(a.Confidence, b.Confidence)
+	})
+
+	calibration := ConfidenceCalibration{Method: method, Samples: len(outcomes)}
+	switch method {
+	case PlattCalibration:
+		calibration.Platt = fitPlatt(outcomes)
+	default:
+		calibration.Isotonic = fitIsotonic(outcomes)
+	}
+
+	var hits int
+	var rawBrier, calibratedBrier float64
+	bins := make([]CalibrationBin, 10)
+	calibratedSums := make([]float64, 10)
+	for _, outcome := range outcomes {
+		hit := 0.0
+		if outcome.Successful {
+			hit = 1
+			hits++
+		}
+		raw := math.Min(math.Max(outcome.Confidence/10, 0), 1)
+		calibrated := calibration.Probability(outcome.Confidence)
+		rawBrier += (raw - hit) * (raw - hit)
+		calibratedBrier += (calibrated - hit) * (calibrated - hit)
+
+		// Confidence is a 0-10 score, binned by whole point with 10 in the top bin
+		i := int(math.Min(math.Max(outcome.Confidence, 0), 9.999))
+		bins[i].Predictions++
+		bins[i].Hits += int(hit)
+		bins[i].AvgConfidence += outcome.Confidence
+		calibratedSums[i] += calibrated
+	}
+
+	n := float64(len(outcomes))
+	calibration.HitRate = roundTo(float64(hits)/n, 4)
+	calibration.RawBrier = roundTo(rawBrier/n, 4)
+	calibration.CalibratedBrier = roundTo(calibratedBrier/n, 4)
+
+	calibration.Reliability = []CalibrationBin{}
+	for i, bin := range bins {
+		if bin.Predictions == 0 {
+			continue
+		}
+		predictions := float64(bin.Predictions)
+		bin.MinConfidence = float64(i)
+		bin.MaxConfidence = float64(i + 1)
+		bin.HitRate = roundTo(float64(bin.Hits)/predictions, 4)
+		bin.AvgConfidence = roundTo(bin.AvgConfidence/predictions, 2)
+		bin.CalibratedProbability = roundTo(calibratedSums[i]/predictions, 4)
+		calibration.Reliability = append(calibration.Reliability, bin)
+	}
+
+	calibration.Curve = make([]CalibrationPoint, 0, 11)
+	for confidence := 0.0; confidence <= 10; confidence++ {
+		calibration.Curve = append(calibration.Curve, CalibrationPoint{
+			Confidence:  confidence,
+			Probability: roundTo(calibration.Probability(confidence), 4),
+		})
+	}
+
+	return calibration
+}
+
+// fitIsotonic pools adjacent violators over outcomes sorted by confidence.
+// Equal confidences always share a step.
+func fitIsotonic(outcomes []dbRepository.ConfidenceOutcome) []IsotonicStep {
+	type block struct {
+		min, max    float64
+		predictions int
+		hits        int
+	}
+	mean := func(b block) float64 { return float64(b.hits) / float64(b.predictions) }
+
+	var blocks []block
+	for _, outcome := range outcomes {
+		hit := 0
+		if outcome.Successful {
+			hit = 1
+		}
+		if n := len(blocks); n > 0 && blocks[n-1].max == outcome.Confidence {
+			blocks[n-1].predictions++
+			blocks[n-1].hits += hit
+		} else {
+			blocks = append(blocks, block{min: outcome.Confidence, max: outcome.Confidence, predictions: 1, hits: hit})
+		}
+
+		// Merge backwards until the hit rates are non-decreasing again
+		for n := len(blocks); n > 1 && mean(blocks[n-2]) >= mean(blocks[n-1]); n = len(blocks) {
+			last := blocks[n-1]
+			blocks = blocks[:n-1]
+			blocks[n-2].max = last.max
+			blocks[n-2].predictions += last.predictions
+			blocks[n-2].hits += last.hits
+		}
+	}
+
+	steps := make([]IsotonicStep, len(blocks))
+	for i, b := range blocks {
+		steps[i] = IsotonicStep{
+			MinConfidence: b.min,
+			MaxConfidence: b.max,
+			Predictions:   b.predictions,
+			Probability:   roundTo(mean(b), 4),
+		}
+	}
+	return steps
+}
+
+// fitPlatt fits a logistic curve by Newton's method, using Platt's smoothed
+// targets so a perfectly separated history still has a finite fit
+func fitPlatt(outcomes []dbRepository.ConfidenceOutcome) *PlattScaling {
+	var positives, negatives float64
+	for _, outcome := range outcomes {
+		if outcome.Successful {
+			positives++
+		} else {
+			negatives++
+		}
+	}
+	hitTarget := (positives + 1) / (positives + 2)
+	missTarget := 1 / (negatives + 2)
+	target := func(outcome dbRepository.ConfidenceOutcome) float64 {
+		if outcome.Successful {
+			return hitTarget
+		}
+		return missTarget
+	}
+
+	loss := func(slope, intercept float64) float64 {
+		var total float64
+		for _, outcome := range outcomes {
+			p := math.Min(math.Max(sigmoid(slope*outcome.Confidence+intercept), 1e-12), 1-1e-12)
+			t := target(outcome)
+			total -= t*math.Log(p) + (1-t)*math.Log(1-p)
+		}
+		return total
+	}
+
+	slope, intercept := 0.0, math.Log((positives+1)/(negatives+1))
+	current := loss(slope, intercept)
+	for range plattMaxIterations {
+		var gradSlope, gradIntercept, hessSlope, hessCross, hessIntercept float64
+		for _, outcome := range outcomes {
+			p := sigmoid(slope*outcome.Confidence + intercept)
+			residual := p - target(outcome)
+			weight := math.Max(p*(1-p), 1e-12)
+			gradSlope += residual * outcome.Confidence
+			gradIntercept += residual
+			hessSlope += weight * outcome.Confidence * outcome.Confidence
+			hessCross += weight * outcome.Confidence
+			hessIntercept += weight
+		}
+
+		determinant := hessSlope*hessIntercept - hessCross*hessCross
+		if determinant <= 0 {
+			break
+		}
+		stepSlope := (hessIntercept*gradSlope - hessCross*gradIntercept) / determinant
+		stepIntercept := (hessSlope*gradIntercept - hessCross*gradSlope) / determinant
+
+		// Halve the step until it improves the loss
+		improved := false
+		for scale := 1.0; scale > 1e-6; scale /= 2 {
+			nextSlope, nextIntercept := slope-scale*stepSlope, intercept-scale*stepIntercept
+			if next := loss(nextSlope, nextIntercept); next <= current {
+				slope, intercept, current = nextSlope, nextIntercept, next
+				improved = true
+				break
+			}
+		}
+		if !improved || math.Abs(stepSlope)+math.Abs(stepIntercept) < 1e-10 {
+			break
+		}
+	}
+
+	return &PlattScaling{Slope: roundTo(slope, 6), Intercept: roundTo(intercept, 6)}
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+)
+
+// outcomesAt returns predictions at confidence with the given number of hits and misses
+func outcomesAt(confidence float64, hits int, misses int) []dbRepository.ConfidenceOutcome {
+	var outcomes []dbRepository.ConfidenceOutcome
+	for i := 0; i < hits+misses; i++ {
+		outcomes = append(outcomes, dbRepository.ConfidenceOutcome{Confidence: confidence, Successful: i < hits})
+	}
+	return outcomes
+}
+
+func TestFitIsotonicPoolsViolators(t *testing.T) {
+	var outcomes []dbRepository.ConfidenceOutcome
+	outcomes = append(outcomes, outcomesAt(6, 3, 1)...) // 0.75 out of order with 0.25 below
+	outcomes = append(outcomes, outcomesAt(2, 1, 3)...)
+	outcomes = append(outcomes, outcomesAt(4, 1, 1)...)
+	outcomes = append(outcomes, outcomesAt(5, 0, 2)...)
+
+	calibration := fitCalibration(IsotonicCalibration, outcomes)
+
+	// 4 and 5 pool to 1 in 4, then pool with 2 for 2 in 8
+	want := []IsotonicStep{
+		{MinConfidence: 2, MaxConfidence: 5, Predictions: 8, Probability: 0.25},
+		{MinConfidence: 6, MaxConfidence: 6, Predictions: 4, Probability: 0.75},
+	}
+	if len(calibration.Isotonic) != len(want) {
+		t.Fatalf("steps = %+v, want %+v", calibration.Isotonic, want)
+	}
+	for i := range want {
+		if calibration.Isotonic[i] != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i, calibration.Isotonic[i], want[i])
+		}
+	}
+
+	for _, tt := range []struct{ confidence, probability float64 }{
+		{0, 0.25}, {3, 0.25}, {5.5, 0.5}, {9, 0.75},
+	} {
+		if p := calibration.Probability(tt.confidence); math.Abs(p-tt.probability) > 1e-9 {
+			t.Errorf("P(success | confidence %.1f) = %.4f, want %.4f", tt.confidence, p, tt.probability)
+		}
+	}
+
+	if len(calibration.Reliability) != 4 || calibration.Reliability[0].MinConfidence != 2 || calibration.Reliability[0].HitRate != 0.25 {
+		t.Errorf("reliability = %+v, want 4 bins starting at 2 with a 0.25 hit rate", calibration.Reliability)
+	}
+	if calibration.CalibratedBrier > calibration.RawBrier {
+		t.Errorf("calibrated Brier %.4f is worse than raw %.4f", calibration.CalibratedBrier, calibration.RawBrier)
+	}
+}
+
+func TestFitPlattIsIncreasing(t *testing.T) {
+	var outcomes []dbRepository.ConfidenceOutcome
+	outcomes = append(outcomes, outcomesAt(2, 2, 8)...)
+	outcomes = append(outcomes, outcomesAt(5, 5, 5)...)
+	outcomes = append(outcomes, outcomesAt(8, 8, 2)...)
+
+	calibration := fitCalibration(PlattCalibration, outcomes)
+	if calibration.Platt == nil || calibration.Platt.Slope <= 0 {
+		t.Fatalf("platt = %+v, want a positive slope", calibration.Platt)
+	}
+	if p := calibration.Probability(5); math.Abs(p-0.5) > 0.01 {
+		t.Errorf("P(success | confidence 5) = %.4f, want 0.5", p)
+	}
+	if low, high := calibration.Probability(2), calibration.Probability(8); low > 0.3 || high < 0.7 {
+		t.Errorf("P(success | confidence 2, 8) = %.4f, %.4f, want near 0.2 and 0.8", low, high)
+	}
+
+	// A perfectly separated history still has a finite fit
+	separated := append(outcomesAt(1, 0, 5), outcomesAt(9, 5, 0)...)
+	if platt := fitCalibration(PlattCalibration, separated).Platt; math.IsNaN(platt.Slope) || math.IsInf(platt.Slope, 0) {
+		t.Errorf("separated fit = %+v, want finite", platt)
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"math"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// newPredictionFeatures records a player's model inputs, with every
+// multiplicative factor neutral until the strategy sets it
+func newPredictionFeatures(
+	player models.PlayerDetail,
+	shotsLast5 []int,
+	avgShotsLast5 float64,
+	seasonShotsPerGame float64,
+	teamStats []models.TeamStats,
+	restDays map[int]int,
+	model models.ModelVersion,
+) *models.PredictionFeatures {
+	features := &models.PredictionFeatures{
+		ModelVersionID:      model.ID,
+		CalculationStrategy: model.CalculationStrategy,
+		Position:            player.Position,
+		ShotsLast5:          shotsLast5,
+		AvgShotsLast5:       avgShotsLast5,
+		SeasonShotsPerGame:  seasonShotsPerGame,
+		SeasonGamesPlayed:   player.FeaturedStats.RegularSeason.SubSeason.GamesPlayed,
+		AvgTOI:              calculateAvgTOIMinutes(player.Last5Games),
+		GamePaceFactor:      1,
+		TeamOffenseFactor:   1,
+		TeamDefenseFactor:   1,
+		PositionFactor:      1,
+		IcetimeFactor:       1,
+		RestFactor:          1,
+		HomeIceFactor:       1,
+		StreakFactor:        1,
+		GoalieFactor:        1,
+		VenueFactor:         1,
+	}
+	if features.ShotsLast5 == nil {
+		features.ShotsLast5 = []int{}
+	}
+
+	if days, ok := restDays[player.CurrentTeamId]; ok {
+		features.RestDays = &days
+	}
+
+	currentTeam := getTeamStatsById(player.CurrentTeamId, teamStats)
+	opposingTeam := getTeamStatsById(player.OpposingTeamId, teamStats)
+	if currentTeam != nil && opposingTeam != nil {
+		leagueShotAverage := getLeagueShotAverage(teamStats)
+		features.TeamShotsForPerGame = &currentTeam.ShotsForPerGame
+		features.OpponentShotsAgainstPerGame = &opposingTeam.ShotsAgainstPerGame
+		features.OpponentShotsForPerGame = &opposingTeam.ShotsForPerGame
+		features.LeagueShotAverage = &leagueShotAverage
+	}
+
+	if goalie := player.OpposingGoalie; goalie != nil {
+		features.OpponentGoalieID = &goalie.PlayerID
+		features.OpponentGoalieConfirmed = &goalie.Confirmed
+		features.OpponentGoalieGamesPlayed = &goalie.GamesPlayed
+		features.OpponentGoalieSavePct = &goalie.SavePct
+		if leagueSavePct := getLeagueSavePct(teamStats); leagueSavePct > 0 {
+			features.LeagueSavePct = &leagueSavePct
+		}
+	}
+	if form := player.TeamForm; form != nil {
+		features.TeamFormGames = &form.Games
+		features.TeamFormPointPct = &form.PointPct
+	}
+	if len(player.GameLog) > 0 {
+		rolling := newRollingShotStats(player.GameLog, model.Parameters.EWMAHalfLife)
+		venueShots, _ := rolling.venueShotsPerGame(player.IsHome)
+		features.GameLogGames = &rolling.games
+		features.ShotsLast10 = &rolling.shotsLast10
+		features.ShotsLast20 = &rolling.shotsLast20
+		features.ShotsEWMA = &rolling.shotsEWMA
+		features.VenueShotsPerGame = &venueShots
+		features.TOILast10 = &rolling.toiLast10
+		features.PowerPlayTOILast10 = rolling.powerPlayTOILast10
+	}
+
+	return features
+}
+
+// finishPrediction records the final prediction, rounded to one decimal when round is set
+func finishPrediction(features *models.PredictionFeatures, prediction float64, round bool) float64 {
+	features.UnroundedPrediction = prediction
+	if round {
+		prediction = math.Round(prediction*10) / 10
+	}
+	features.PredictedShots = prediction
+	return prediction
+}
+
+// joinFallback explains a fallback that led to another one
+func joinFallback(reason string, inner string) string {
+	if inner == "" {
+		return reason
+	}
+	return reason + "; " + inner
+}
+
+// DISPERSION_PRIOR_GAMES is how many games' worth of weight the Poisson
+// variance gets when estimating a player's shot variance from recent games
+const DISPERSION_PRIOR_GAMES = 5
+
+// shotDistribution models a player's shots around the predicted mean. The
+// variance is the recent games' sample variance shrunk toward the mean, so
+// five games can't make a player look wildly streaky; players more variable
+// than Poisson get a negative binomial with that variance.
+func shotDistribution(mean float64, recentShots []int) models.ShotDistribution {
+	if mean <= 0 || len(recentShots) < 2 {
+		return models.NewShotDistribution(mean, 0)
+	}
+
+	degreesOfFreedom := float64(len(recentShots) - 1)
+	variance := (degreesOfFreedom*sampleVariance(recentShots) + DISPERSION_PRIOR_GAMES*mean) /
+		(degreesOfFreedom + DISPERSION_PRIOR_GAMES)
+	if variance <= mean {
+		return models.NewShotDistribution(mean, 0)
+	}
+
+	dispersion := mean * mean / (variance - mean)
+	return models.NewShotDistribution(mean, math.Round(dispersion*1000)/1000)
+}
+
+// sampleVariance is the unbiased variance of at least two values
+func sampleVariance(values []int) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += float64(value)
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, value := range values {
+		squares += (float64(value) - mean) * (float64(value) - mean)
+	}
+	return squares / float64(len(values)-1)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+func TestShotDistribution(t *testing.T) {
+	tests := []struct {
+		name            string
+		mean            float64
+		recentShots     []int
+		family          models.DistributionFamily
+		line            float64
+		overProbability float64
+	}{
+		{"steady shooter is poisson", 2.9, []int{3, 2, 3, 4, 3}, models.PoissonDistribution, 2.5, 0.554},
+		{"low mean goes over 1.5", 2.1, []int{2, 2, 1, 3, 2}, models.PoissonDistribution, 1.5, 0.6204},
+		{"streaky shooter is negative binomial", 2.9, []int{0, 7, 1, 6, 0}, models.NegativeBinomialDistribution, 1.5, 0.6437},
+		{"no shots still has a line", 0, nil, models.PoissonDistribution, 0.5, 0},
+	}
+	for _, tt := range tests {
+		d := shotDistribution(tt.mean, tt.recentShots)
+		if d.Family != tt.family {
+			t.Errorf("%s: family = %s, want %s", tt.name, d.Family, tt.family)
+		}
+		if d.Line != tt.line || d.OverProbability != tt.overProbability {
+			t.Errorf("%s: over %.1f at %.4f, want over %.1f at %.4f",
+				tt.name, d.Line, d.OverProbability, tt.line, tt.overProbability)
+		}
+		if len(d.AtLeast) != models.MAX_SHOT_LINE {
+			t.Errorf("%s: %d shot probabilities, want %d", tt.name, len(d.AtLeast), models.MAX_SHOT_LINE)
+		}
+		for k := 2; k <= models.MAX_SHOT_LINE; k++ {
+			if d.AtLeast[k] > d.AtLeast[k-1] {
+				t.Errorf("%s: P(shots >= %d) = %.4f is above P(shots >= %d) = %.4f",
+					tt.name, k, d.AtLeast[k], k-1, d.AtLeast[k-1])
+			}
+		}
+	}
+}
+
+func TestNewShotDistributionNotFinite(t *testing.T) {
+	for _, mean := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		d := models.NewShotDistribution(mean, 2)
+		if d.Line != 0 || d.OverProbability != 0 || len(d.AtLeast) != 0 {
+			t.Errorf("mean %v: over %.1f at %.4f with %d shot probabilities, want an empty distribution",
+				mean, d.Line, d.OverProbability, len(d.AtLeast))
+		}
+	}
+
+	// An infinite size is the Poisson limit
+	if d := models.NewShotDistribution(2.9, math.Inf(1)); d.Family != models.PoissonDistribution || d.Line != 2.5 {
+		t.Errorf("infinite dispersion = %s over %.1f, want poisson over 2.5", d.Family, d.Line)
+	}
+	if d := shotDistribution(math.NaN(), []int{0, 7, 1, 6, 0}); d.Line != 0 {
+		t.Errorf("NaN mean with recent shots has line %.1f, want none", d.Line)
+	}
+}
+
+func TestNewShotDistributionHugeMean(t *testing.T) {
+	for _, mean := range []float64{800, 1e12, math.MaxFloat64} {
+		for _, dispersion := range []float64{0, 2} {
+			d := models.NewShotDistribution(mean, dispersion)
+			if want := float64(models.MAX_SHOT_COUNT) - 0.5; d.Line != want {
+				t.Errorf("mean %g dispersion %g: over %.1f, want over %.1f", mean, dispersion, d.Line, want)
+			}
+		}
+	}
+}
+
+func TestScoreLine(t *testing.T) {
+	over, logLoss, brier := models.ScoreLine(2.5, 0.6, 3)
+	if !over || math.Abs(logLoss-0.5108) > 1e-4 || math.Abs(brier-0.16) > 1e-9 {
+		t.Errorf("3 shots over 2.5 at 0.6 = %v, %.4f, %.4f, want true, 0.5108, 0.16", over, logLoss, brier)
+	}
+
+	over, logLoss, brier = models.ScoreLine(2.5, 0.6, 2)
+	if over || math.Abs(logLoss-0.9163) > 1e-4 || math.Abs(brier-0.36) > 1e-9 {
+		t.Errorf("2 shots over 2.5 at 0.6 = %v, %.4f, %.4f, want false, 0.9163, 0.36", over, logLoss, brier)
+	}
+
+	// A certain prediction that misses still has a finite log loss
+	if _, logLoss, _ := models.ScoreLine(0.5, 1, 0); math.IsInf(logLoss, 0) {
+		t.Errorf("log loss of a certain miss is infinite")
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"api.alexmontague.ca/internal/database"
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+	"api.alexmontague.ca/internal/nhl/models"
+	"api.alexmontague.ca/internal/nhl/repository"
+)
+
+// GAME_LOG_FETCH_CONCURRENCY bounds parallel game log requests for one game's players
+const GAME_LOG_FETCH_CONCURRENCY = 8
+
+// ingestPlayerGameLog fetches a player's season game log with power play TOI
+// and stores it. When the log can't be fetched the stored one is returned,
+// so only a player who was never ingested has no log. Without a database the
+// log is only fetched.
+func ingestPlayerGameLog(ctx context.Context, playerID int, season string) ([]models.GameLogEntry, error) {
+	gameLog, err := repository.GetPlayerGameLog(ctx, playerID, season)
+	if err != nil {
+		if ctx.Err() != nil || database.DB == nil {
+			return nil, err
+		}
+		stored, storedErr := dbRepository.GetStoredPlayerGameLog(playerID, season)
+		if storedErr != nil || len(stored) == 0 {
+			return nil, err
+		}
+		fmt.Println("Using stored game log for player", playerID, err)
+		return stored, nil
+	}
+
+	// The web API's game log has no power play TOI, it comes from the stats API
+	powerPlayTOI, err := repository.GetPlayerPowerPlayTOI(ctx, playerID, season)
+	if err != nil {
+		fmt.Println("Game log without power play TOI for player", playerID, err)
+	}
+	for i := range gameLog {
+		if seconds, ok := powerPlayTOI[gameLog[i].GameID]; ok {
+			gameLog[i].PowerPlayTOI = fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+		}
+	}
+
+	if database.DB == nil {
+		return gameLog, nil
+	}
+	if err := dbRepository.StorePlayerGameLog(playerID, season, gameLog); err != nil {
+		fmt.Println("Error storing game log for player", playerID, err)
+	}
+	return gameLog, nil
+}
+
+// gameLogBefore returns the games in a log played before date
+func gameLogBefore(gameLog []models.GameLogEntry, date string) []models.GameLogEntry {
+	var before []models.GameLogEntry
+	for _, game := range gameLog {
+		if game.GameDate < date {
+			before = append(before, game)
+		}
+	}
+	return before
+}
+
+// attachGameLogs gives each player their season game log before the game and
+// whether they're at home. A log that can't be fetched leaves the player
+// without one; only a done ctx is an error.
+func attachGameLogs(ctx context.Context, game models.Game, players []models.PlayerDetail) error {
+	semaphore := make(chan struct{}, GAME_LOG_FETCH_CONCURRENCY)
+	var wg sync.WaitGroup
+
+	for i := range players {
+		players[i].IsHome = players[i].CurrentTeamId == game.HomeTeam.Id
+
+		wg.Add(1)
+		go func(player *models.PlayerDetail) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			gameLog, err := ingestPlayerGameLog(ctx, player.PlayerId, game.Season)
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Println("Predicting without game log for player", player.PlayerId, err)
+				}
+				return
+			}
+			player.GameLog = gameLogBefore(gameLog, game.EstDate)
+		}(&players[i])
+	}
+
+	wg.Wait()
+	return ctx.Err()
+}
@@ -1,9 +1,13 @@
 package service
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 
 	dbRepository "api.alexmontague.ca/internal/database/repository"
 	"api.alexmontague.ca/internal/nhl/models"
@@ -16,21 +20,18 @@ const (
 )
 
 var (
-	// activeModelVersion is the currently active model version
+	// activeModelVersion is the currently active model version, loaded from the model registry
 	activeModelVersion = DEFAULT_MODEL_VERSION
 
-	// predictionModels contains all available models
-	predictionModels []models.ModelVersion
-
-	// mu prevents race conditions when accessing models
+	// mu prevents race conditions when accessing the active model version
 	mu sync.RWMutex
 
 	// initialized flag to prevent multiple initializations
 	initialized = false
 )
 
-// InitializeModels loads the default models on startup
-// This is called from main.go and ensures models are only initialized once
+// InitializeModels seeds the model registry with the default models and loads
+// the active model. This is called from main.go and only runs once.
 func InitializeModels() {
 	mu.Lock()
 	defer mu.Unlock()
@@ -39,13 +40,24 @@ func InitializeModels() {
 		return
 	}
 
-	// Load default models
-	predictionModels = models.GetDefaultModels()
+	if err := dbRepository.SeedModelVersions(models.GetDefaultModels()); err != nil {
+		fmt.Println("Failed to seed model registry:", err)
+		return
+	}
+
+	activeID, err := dbRepository.GetActiveModelVersionID()
+	if err != nil {
+		fmt.Println("Failed to load active model, using default:", err)
+	} else {
+		activeModelVersion = activeID
+	}
 	initialized = true
 }
 
 // GetActiveModelVersion returns the currently active model version ID
 func GetActiveModelVersion() int {
+	mu.RLock()
+	defer mu.RUnlock()
 	return activeModelVersion
 }
 
@@ -56,7 +68,17 @@ func SetActiveModelVersion(versionID int) {
 	activeModelVersion = versionID
 }
 
-// GetModelVersion returns a specific model version by ID
+// ActivateModelVersion activates a model in the registry and uses it for new predictions
+func ActivateModelVersion(versionID int) (*models.ModelVersion, error) {
+	model, err := dbRepository.ActivateModelVersion(versionID)
+	if err != nil {
+		return nil, err
+	}
+	SetActiveModelVersion(model.ID)
+	return model, nil
+}
+
+// GetModelVersion returns a specific model version from the registry
 // Falls back to default model if requested model is not found
 func GetModelVersion(versionID int) (*models.ModelVersion, error) {
 	// Initialize models if not already done
@@ -64,76 +86,62 @@ func GetModelVersion(versionID int) (*models.ModelVersion, error) {
 		InitializeModels()
 	}
 
-	mu.RLock()
-	defer mu.RUnlock()
-
-	// Try to find the requested model
-	for _, model := range predictionModels {
-		if model.ID == versionID {
-			return &model, nil
-		}
+	model, err := dbRepository.GetModelVersion(versionID)
+	if err == nil {
+		return model, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
 	}
 
 	// If model not found, return the default model (one we know exists)
-	for _, model := range predictionModels {
-		if model.ID == DEFAULT_MODEL_VERSION {
-			return &model, nil
-		}
+	model, err = dbRepository.GetModelVersion(DEFAULT_MODEL_VERSION)
+	if err == nil {
+		return model, nil
 	}
 
 	// Create a minimal default model if nothing else available
 	return createDefaultModel(), nil
 }
 
-// GetAllModels returns all available model versions
-func GetAllModels() []models.ModelVersion {
+// GetAllModels returns every model in the registry that hasn't been retired
+func GetAllModels() ([]models.ModelVersion, error) {
 	// Initialize models if not already done
 	if !initialized {
 		InitializeModels()
 	}
 
-	mu.RLock()
-	defer mu.RUnlock()
-
-	// Return a copy to prevent modification of internal state
-	modelsCopy := make([]models.ModelVersion, len(predictionModels))
-	copy(modelsCopy, predictionModels)
-
-	return modelsCopy
+	return dbRepository.GetModelVersions(false)
 }
 
-// CalculateWithAllModels runs predictions using all models for comparison
-func CalculateWithAllModels(date string) (map[int][]models.GameWithPlayers, error) {
-	// Initialize models if not already done
-	if !initialized {
-		InitializeModels()
+// CalculateWithAllModels runs predictions using all models for comparison. The
+// inputs are fetched once, shared by every model and recorded for backtesting.
+func CalculateWithAllModels(ctx context.Context, date string) (map[int][]models.GameWithPlayers, error) {
+	allModels, err := GetAllModels()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load models: %w", err)
 	}
 
-	mu.RLock()
-	allModels := make([]models.ModelVersion, len(predictionModels))
-	copy(allModels, predictionModels)
-	mu.RUnlock()
-
 	// Fetch game data only once for reuse
-	games, teamStats, restDays, err := fetchGameDataForDate(date)
+	inputs, err := fetchPredictionInputs(ctx, date)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(games) == 0 {
+	if len(inputs.Games) == 0 {
 		return map[int][]models.GameWithPlayers{}, nil
 	}
 
+	if err := dbRepository.StorePredictionInputs(*inputs); err != nil {
+		fmt.Println("Failed to store prediction inputs for", date, err)
+	}
+
 	// Calculate predictions with each model
 	results := make(map[int][]models.GameWithPlayers)
 
+	asOf := predictionDate(date)
 	for _, model := range allModels {
-		modelResults, err := ModelPredictionForGames(date, model, games, teamStats, restDays)
-		if err != nil {
-			fmt.Println("Failed to model prediction for model version:", model.ID, err)
-			continue // Skip failed models
-		}
-		results[model.ID] = modelResults
+		results[model.ID] = predictGames(inputs, model, asOf)
 	}
 
 	return results, nil
@@ -141,6 +149,7 @@ func CalculateWithAllModels(date string) (map[int][]models.GameWithPlayers, erro
 
 // ModelPredictionForGames gets predictions for games with a specific model, reusing data if provided
 func ModelPredictionForGames(
+	ctx context.Context,
 	date string,
 	model models.ModelVersion,
 	cachedGames []models.Game,
@@ -156,7 +165,7 @@ func ModelPredictionForGames(
 	if len(cachedGames) > 0 {
 		games = cachedGames
 	} else {
-		games, teamStats, restDays, err = fetchGameDataForDate(date)
+		games, teamStats, restDays, err = fetchGameDataForDate(ctx, date)
 		if err != nil {
 			return nil, err
 		}
@@ -169,7 +178,7 @@ func ModelPredictionForGames(
 	if cachedTeamStats != nil {
 		teamStats = cachedTeamStats
 	} else if teamStats == nil {
-		teamStats, err = repository.GetAllTeamStats(games[0].Season)
+		teamStats, err = repository.GetAllTeamStats(ctx, games[0].Season)
 		if err != nil {
 			return nil, err
 		}
@@ -178,33 +187,42 @@ func ModelPredictionForGames(
 	if cachedRestDays != nil {
 		restDays = cachedRestDays
 	} else if restDays == nil {
-		restDays, err = repository.GetTeamsRest(date, games)
+		restDays, err = repository.GetTeamsRest(ctx, date, games)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// Calculate predictions with the specified model
-	var allPlayers []models.PlayerStats
-	for _, game := range games {
-		players, err := repository.GetPlayerStats(game.GameID, []models.Team{game.AwayTeam, game.HomeTeam})
-		if err != nil {
-			continue
-		}
-		playerStats := CalculateShootingStatsWithModel(players, teamStats, restDays, model)
-		allPlayers = append(allPlayers, playerStats...)
+	players, err := fetchPlayersByGame(ctx, games)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := &models.PredictionInputs{
+		Date:      date,
+		Games:     games,
+		Players:   players,
+		TeamStats: teamStats,
+		RestDays:  restDays,
 	}
 
-	// Group players by game
+	return predictGames(inputs, model, predictionDate(date)), nil
+}
+
+// predictionDate is the day predictions are made as of, today if date isn't YYYY-MM-DD
+func predictionDate(date string) time.Time {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Now()
+	}
+	return day
+}
+
+// predictGames runs a model over a date's inputs, grouping players by game
+func predictGames(inputs *models.PredictionInputs, model models.ModelVersion, asOf time.Time) []models.GameWithPlayers {
 	var gamesWithPlayers []models.GameWithPlayers
-	for _, game := range games {
-		// Filter players for this game
-		var gamePlayers []models.PlayerStats
-		for _, player := range allPlayers {
-			if player.TeamId == game.AwayTeam.Id || player.TeamId == game.HomeTeam.Id {
-				gamePlayers = append(gamePlayers, player)
-			}
-		}
+	for _, game := range inputs.Games {
+		gamePlayers := calculateShootingStatsAsOf(inputs.Players[game.GameID], inputs.TeamStats, inputs.RestDays, model, asOf)
 
 		// Sort players by confidence (highest first)
 		sortPlayersByConfidence(gamePlayers)
@@ -215,7 +233,7 @@ func ModelPredictionForGames(
 		})
 	}
 
-	return gamesWithPlayers, nil
+	return gamesWithPlayers
 }
 
 // Helper to sort players by confidence
@@ -226,8 +244,8 @@ func sortPlayersByConfidence(players []models.PlayerStats) {
 }
 
 // Helper to fetch game data for a specific date
-func fetchGameDataForDate(date string) ([]models.Game, []models.TeamStats, map[int]int, error) {
-	games, err := repository.GetUpcomingGames(date)
+func fetchGameDataForDate(ctx context.Context, date string) ([]models.Game, []models.TeamStats, map[int]int, error) {
+	games, err := repository.GetUpcomingGames(ctx, date)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -236,12 +254,12 @@ func fetchGameDataForDate(date string) ([]models.Game, []models.TeamStats, map[i
 		return games, nil, nil, nil
 	}
 
-	teamStats, err := repository.GetAllTeamStats(games[0].Season)
+	teamStats, err := repository.GetAllTeamStats(ctx, games[0].Season)
 	if err != nil {
 		return games, nil, nil, err
 	}
 
-	restDays, err := repository.GetTeamsRest(date, games)
+	restDays, err := repository.GetTeamsRest(ctx, date, games)
 	if err != nil {
 		return games, teamStats, nil, err
 	}
@@ -249,6 +267,100 @@ func fetchGameDataForDate(date string) ([]models.Game, []models.TeamStats, map[i
 	return games, teamStats, restDays, nil
 }
 
+// fetchPredictionInputs fetches everything the models need to predict a date
+func fetchPredictionInputs(ctx context.Context, date string) (*models.PredictionInputs, error) {
+	games, teamStats, restDays, err := fetchGameDataForDate(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+
+	players, err := fetchPlayersByGame(ctx, games)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PredictionInputs{
+		Date:      date,
+		Games:     games,
+		Players:   players,
+		TeamStats: teamStats,
+		RestDays:  restDays,
+	}, nil
+}
+
+// fetchPlayersByGame fetches player details for both teams of each game.
+// Games whose rosters can't be fetched are left out, as are players whose
+// details can't be; only a done ctx fails the whole date.
+func fetchPlayersByGame(ctx context.Context, games []models.Game) (map[int][]models.PlayerDetail, error) {
+	players := make(map[int][]models.PlayerDetail)
+	for _, game := range games {
+		gamePlayers, err := getGamePlayers(ctx, game)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		players[game.GameID] = gamePlayers
+	}
+	return players, nil
+}
+
+// getGamePlayers fetches both teams' players for a game, logging and keeping
+// the players that were fetched when only some of them fail
+func getGamePlayers(ctx context.Context, game models.Game) ([]models.PlayerDetail, error) {
+	players, err := repository.GetPlayerStats(ctx, game.GameID, []models.Team{game.AwayTeam, game.HomeTeam})
+	var partial *repository.PlayerStatsError
+	if errors.As(err, &partial) {
+		fmt.Println("Predicting without some players:", partial)
+	} else if err != nil {
+		fmt.Println("Error fetching player stats:", err)
+		return nil, err
+	}
+
+	if err := attachMatchupInputs(ctx, game, players); err != nil {
+		return nil, err
+	}
+	if err := attachGameLogs(ctx, game, players); err != nil {
+		return nil, err
+	}
+	return players, nil
+}
+
+// attachMatchupInputs gives each player the opposing team's starting goalie
+// and their own team's recent form. Either can be missing, which leaves the
+// factors they feed neutral; only a done ctx is an error.
+func attachMatchupInputs(ctx context.Context, game models.Game, players []models.PlayerDetail) error {
+	goalies, err := repository.GetStartingGoalies(ctx, game.GameID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fmt.Println("Predicting without starting goalies:", game.GameID, err)
+	}
+
+	forms := make(map[int]*models.TeamForm)
+	for _, team := range []models.Team{game.AwayTeam, game.HomeTeam} {
+		form, err := repository.GetTeamForm(ctx, team, game.Season, game.EstDate)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Println("Predicting without team form:", team.Abbrev, err)
+			continue
+		}
+		forms[team.Id] = &form
+	}
+
+	for i := range players {
+		if goalie, ok := goalies[players[i].OpposingTeamId]; ok {
+			players[i].OpposingGoalie = &goalie
+		}
+		players[i].TeamForm = forms[players[i].CurrentTeamId]
+	}
+	return nil
+}
+
 // createDefaultModel provides a minimal default model when no others are available
 func createDefaultModel() *models.ModelVersion {
 	return &models.ModelVersion{
@@ -278,14 +390,14 @@ func createDefaultModel() *models.ModelVersion {
 }
 
 // RunAndStoreAllModelPredictions runs all models and stores their predictions in the database
-func RunAndStoreAllModelPredictions(date string) error {
+func RunAndStoreAllModelPredictions(ctx context.Context, date string) error {
 	// Initialize models if not already done
 	if !initialized {
 		InitializeModels()
 	}
 
 	// Get predictions from all models
-	modelPredictions, err := CalculateWithAllModels(date)
+	modelPredictions, err := CalculateWithAllModels(ctx, date)
 	if err != nil {
 		return fmt.Errorf("failed to calculate predictions: %w", err)
 	}
@@ -296,15 +408,5 @@ func RunAndStoreAllModelPredictions(date string) error {
 		return fmt.Errorf("failed to store model predictions: %w", err)
 	}
 
-	// Also store the active model's prediction in the original table for backward compatibility
-	if activeModelPredictions, ok := modelPredictions[activeModelVersion]; ok && len(activeModelPredictions) > 0 {
-		for _, game := range activeModelPredictions {
-			err = dbRepository.StoreGamePredictions(game)
-			if err != nil {
-				return fmt.Errorf("failed to store active model predictions: %w", err)
-			}
-		}
-	}
-
 	return nil
 }
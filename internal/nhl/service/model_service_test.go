@@ -0,0 +1,154 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"api.alexmontague.ca/internal/nhl/models"
+	"api.alexmontague.ca/internal/nhl/repository"
+)
+
+// useReplayClient serves NHL API requests from the fixtures recorded for date
+func useReplayClient(t *testing.T, date string) {
+	t.Helper()
+	previous := repository.SetDefaultClient(repository.NewClient(repository.ClientConfig{
+		Transport:      &repository.ReplayTransport{Dir: "../testdata/" + date},
+		Timeout:        time.Second,
+		MaxConcurrent:  4,
+		RetryBaseDelay: time.Millisecond,
+	}))
+	t.Cleanup(func() { repository.SetDefaultClient(previous) })
+}
+
+func TestModelPredictionForGamesReplay(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+	model := models.GetDefaultModels()[0]
+
+	games, err := ModelPredictionForGames(t.Context(), "2025-03-01", model, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ModelPredictionForGames: %v", err)
+	}
+	if len(games) != 1 || games[0].GameID != 2024020901 {
+		t.Fatalf("ModelPredictionForGames returned %+v, want game 2024020901", games)
+	}
+
+	// Rielly hasn't played in over a week, and Hutson is predicted from his
+	// four games but under the shot minimum
+	want := map[int]struct {
+		predicted float64
+		restDays  int
+	}{
+		8479318: {4.5, 1}, // Matthews
+		8478483: {2.6, 1}, // Marner
+		8480018: {2.1, 0}, // Suzuki
+		8481540: {2.5, 0}, // Caufield
+	}
+
+	players := games[0].Players
+	if len(players) != len(want) {
+		t.Fatalf("got %d players, want %d: %+v", len(players), len(want), players)
+	}
+	for _, player := range players {
+		expected, ok := want[player.PlayerId]
+		if !ok {
+			t.Errorf("unexpected prediction for %s (%d)", player.Name, player.PlayerId)
+			continue
+		}
+		if player.PredictedGameShots != expected.predicted {
+			t.Errorf("%s predicted %.1f shots, want %.1f", player.Name, player.PredictedGameShots, expected.predicted)
+		}
+		if player.RestDays != expected.restDays {
+			t.Errorf("%s rest days = %d, want %d", player.Name, player.RestDays, expected.restDays)
+		}
+		if player.ModelVersionID != model.ID {
+			t.Errorf("%s model = %d, want %d", player.Name, player.ModelVersionID, model.ID)
+		}
+	}
+
+	if !sort.SliceIsSorted(players, func(i, j int) bool { return players[i].Confidence > players[j].Confidence }) {
+		t.Error("players aren't sorted by confidence")
+	}
+}
+
+func TestModelPredictionForGamesEveryDefaultModel(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+
+	for _, model := range models.GetDefaultModels() {
+		games, err := ModelPredictionForGames(t.Context(), "2025-03-01", model, nil, nil, nil)
+		if err != nil {
+			t.Errorf("%s: %v", model.Name, err)
+			continue
+		}
+		if len(games) != 1 || len(games[0].Players) == 0 {
+			t.Errorf("%s made no predictions", model.Name)
+			continue
+		}
+		for _, player := range games[0].Players {
+			if player.Features == nil || player.Features.PredictedShots != player.PredictedGameShots {
+				t.Errorf("%s: %s features don't match the %.1f shot prediction: %+v",
+					model.Name, player.Name, player.PredictedGameShots, player.Features)
+			}
+			if model.CalculationStrategy == models.MatchupFocusedCalculation {
+				features := player.Features
+				if features.OpponentGoalieID == nil || features.TeamFormGames == nil || features.LeagueSavePct == nil {
+					t.Errorf("%s: %s is missing goalie or form inputs: %+v", model.Name, player.Name, features)
+				} else if features.GoalieFactor == 1 || features.GoalieFactor < 1/1.1 || features.GoalieFactor > 1.1 {
+					t.Errorf("%s: %s goalie factor %.4f isn't an adjustment within the model's 10%%",
+						model.Name, player.Name, features.GoalieFactor)
+				}
+			}
+			if player.PredictedGameShots < models.MIN_SHOTS {
+				t.Errorf("%s: %s predicted %.1f shots, below the %d shot minimum",
+					model.Name, player.Name, player.PredictedGameShots, models.MIN_SHOTS)
+			}
+		}
+	}
+}
+
+func TestModelPredictionForGamesRollingWindow(t *testing.T) {
+	useReplayClient(t, "2025-03-01")
+	model := models.GetDefaultModels()[0]
+	model.CalculationStrategy = models.RollingWindowCalculation
+	model.Parameters.Last10Weight = 0.5
+	model.Parameters.Last20Weight = 0.2
+	model.Parameters.EWMAWeight = 0.3
+	model.Parameters.EWMAHalfLife = 5
+	model.Parameters.VenueSplitWeight = 0.5
+
+	games, err := ModelPredictionForGames(t.Context(), "2025-03-01", model, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("ModelPredictionForGames: %v", err)
+	}
+	if len(games) != 1 || len(games[0].Players) == 0 {
+		t.Fatalf("ModelPredictionForGames returned %+v, want predictions for game 2024020901", games)
+	}
+
+	// Only Matthews has a recorded game log, the rest fall back to the standard calculation
+	var matthews *models.PredictionFeatures
+	for _, player := range games[0].Players {
+		if player.PlayerId == 8479318 {
+			matthews = player.Features
+		} else if player.Features.Fallback == "" || player.Features.GameLogGames != nil {
+			t.Errorf("%s has no game log but didn't fall back: %+v", player.Name, player.Features)
+		}
+	}
+	if matthews == nil {
+		t.Fatal("no prediction for Matthews")
+	}
+	if matthews.Fallback != "" {
+		t.Errorf("Matthews fell back: %s", matthews.Fallback)
+	}
+	if matthews.GameLogGames == nil || *matthews.GameLogGames != 12 || *matthews.ShotsLast10 != 4.2 {
+		t.Errorf("Matthews game log inputs = %+v, want 12 games at 4.2 shots over the last 10", matthews)
+	}
+
+	// TOR is away, where Matthews averages 4 against 3.83 overall
+	if *matthews.VenueShotsPerGame != 4 || math.Abs(matthews.VenueFactor-1.0119) > 1e-4 {
+		t.Errorf("Matthews venue %.2f shots, factor %.4f, want 4 and 1.0119", *matthews.VenueShotsPerGame, matthews.VenueFactor)
+	}
+	if matthews.PowerPlayTOILast10 == nil || math.Abs(*matthews.PowerPlayTOILast10-164.0/60) > 1e-9 {
+		t.Errorf("Matthews power play TOI = %v, want 2:44 a game", matthews.PowerPlayTOILast10)
+	}
+}
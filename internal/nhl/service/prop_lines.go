@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// MAX_PROP_LINE_UPLOAD_SIZE caps the bytes of an uploaded CSV or JSON file of lines
+const MAX_PROP_LINE_UPLOAD_SIZE = 1 << 20
+
+// PropLineSource reads sportsbook shots on goal lines. Uploaded files are
+// read by the CSV and JSON sources; a feed implements it to be imported the
+// same way.
+type PropLineSource interface {
+	PropLines(ctx context.Context) ([]models.PropLine, error)
+}
+
+// PropLineError points at the line of a source that couldn't be imported. Row
+// is 1-based, not counting a CSV header.
+type PropLineError struct {
+	Row int
+	Err error
+}
+
+func (e *PropLineError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *PropLineError) Unwrap() error {
+	return e.Err
+}
+
+// requiredPropLineColumns must be in an uploaded CSV's header, in any order.
+// under_odds and sportsbook columns are read when present.
+var requiredPropLineColumns = []string{"game_id", "player_id", "line", "over_odds"}
+
+// CSVPropLines reads lines from a CSV with a header row naming its columns
+type CSVPropLines struct {
+	Reader io.Reader
+}
+
+func (s CSVPropLines) PropLines(ctx context.Context) ([]models.PropLine, error) {
+	reader := csv.NewReader(s.Reader)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading the CSV header: %v", models.ErrInvalidPropLine, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range requiredPropLineColumns {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: the CSV has no %s column", models.ErrInvalidPropLine, required)
+		}
+	}
+
+	var lines []models.PropLine
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, &PropLineError{Row: row, Err: fmt.Errorf("%w: %v", models.ErrInvalidPropLine, err)}
+		}
+
+		line, err := parsePropLineRecord(record, columns)
+		if err != nil {
+			return nil, &PropLineError{Row: row, Err: err}
+		}
+		lines = append(lines, line)
+	}
+}
+
+// parsePropLineRecord reads one CSV row, blank optional columns are left unset
+func parsePropLineRecord(record []string, columns map[string]int) (models.PropLine, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	number := func(name string) (int, error) {
+		value, err := strconv.Atoi(strings.TrimPrefix(field(name), "+"))
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s %q isn't a whole number", models.ErrInvalidPropLine, name, field(name))
+		}
+		return value, nil
+	}
+
+	var line models.PropLine
+	var err error
+	if line.GameID, err = number("game_id"); err != nil {
+		return line, err
+	}
+	if line.PlayerID, err = number("player_id"); err != nil {
+		return line, err
+	}
+	if line.Line, err = strconv.ParseFloat(field("line"), 64); err != nil {
+		return line, fmt.Errorf("%w: line %q isn't a number", models.ErrInvalidPropLine, field("line"))
+	}
+	if line.OverOdds, err = number("over_odds"); err != nil {
+		return line, err
+	}
+	if field("under_odds") != "" {
+		underOdds, err := number("under_odds")
+		if err != nil {
+			return line, err
+		}
+		line.UnderOdds = &underOdds
+	}
+	line.Sportsbook = field("sportsbook")
+	return line, nil
+}
+
+// JSONPropLines reads lines from a JSON array of models.PropLine
+type JSONPropLines struct {
+	Reader io.Reader
+}
+
+func (s JSONPropLines) PropLines(ctx context.Context) ([]models.PropLine, error) {
+	decoder := json.NewDecoder(s.Reader)
+	decoder.DisallowUnknownFields()
+
+	var lines []models.PropLine
+	if err := decoder.Decode(&lines); err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidPropLine, err)
+	}
+	return lines, nil
+}
+
+// ImportPropLines validates and stores every line from source, storing none
+// when any is invalid. It returns how many lines were stored.
+func ImportPropLines(ctx context.Context, source PropLineSource) (int, error) {
+	lines, err := source.PropLines(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, fmt.Errorf("%w: no lines to import", models.ErrInvalidPropLine)
+	}
+
+	for i, line := range lines {
+		if err := line.Validate(); err != nil {
+			return 0, &PropLineError{Row: i + 1, Err: err}
+		}
+	}
+
+	if err := dbRepository.StorePropLines(lines); err != nil {
+		return 0, fmt.Errorf("store lines: %w", err)
+	}
+	return len(lines), nil
+}
+
+// attachPropLines compares each player's imported line for the game with their
+// shot distribution. Players without a line are left as they are.
+func attachPropLines(gameID int, players []models.PlayerStats) {
+	lines, err := dbRepository.GetPropLinesForGame(gameID)
+	if err != nil {
+		fmt.Println("Error fetching prop lines:", err)
+		return
+	}
+
+	for i := range players {
+		line, ok := lines[players[i].PlayerId]
+		if !ok {
+			continue
+		}
+		if edge, ok := players[i].Distribution.Edge(line); ok {
+			players[i].PropLine = &edge
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+func TestCSVPropLines(t *testing.T) {
+	csv := "player_id,game_id,line,over_odds,under_odds,sportsbook\n" +
+		"8479318,2024020901,3.5,+110,-140,Book\n" +
+		"8478483,2024020901,2.5,-120,,\n"
+	lines, err := CSVPropLines{Reader: strings.NewReader(csv)}.PropLines(t.Context())
+	if err != nil {
+		t.Fatalf("PropLines: %v", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+
+	matthews := lines[0]
+	if matthews.PlayerID != 8479318 || matthews.GameID != 2024020901 || matthews.Line != 3.5 ||
+		matthews.OverOdds != 110 || matthews.UnderOdds == nil || *matthews.UnderOdds != -140 || matthews.Sportsbook != "Book" {
+		t.Errorf("first line = %+v, want Matthews over 3.5 at +110/-140 from Book", matthews)
+	}
+	if lines[1].UnderOdds != nil || lines[1].Sportsbook != "" {
+		t.Errorf("second line = %+v, want no under odds or sportsbook", lines[1])
+	}
+}
+
+func TestCSVPropLinesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		row  int // 0 when the error isn't about a row
+	}{
+		{"missing column", "game_id,player_id,line\n1,2,2.5\n", 0},
+		{"bad odds", "game_id,player_id,line,over_odds\n1,2,2.5,-110\n1,2,2.5,even\n", 2},
+		{"bad line", "game_id,player_id,line,over_odds\n1,2,lots,-110\n", 1},
+	}
+	for _, tt := range tests {
+		_, err := CSVPropLines{Reader: strings.NewReader(tt.csv)}.PropLines(t.Context())
+		if !errors.Is(err, models.ErrInvalidPropLine) {
+			t.Errorf("%s: err = %v, want ErrInvalidPropLine", tt.name, err)
+			continue
+		}
+		var rowErr *PropLineError
+		if errors.As(err, &rowErr) != (tt.row > 0) || (tt.row > 0 && rowErr.Row != tt.row) {
+			t.Errorf("%s: err = %v, want it on row %d", tt.name, err, tt.row)
+		}
+	}
+}
+
+func TestPropLineValidate(t *testing.T) {
+	under := -110
+	valid := models.PropLine{GameID: 1, PlayerID: 2, Line: 2.5, OverOdds: -110, UnderOdds: &under}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate(%+v) = %v, want nil", valid, err)
+	}
+
+	for _, line := range []models.PropLine{
+		{PlayerID: 2, Line: 2.5, OverOdds: -110},
+		{GameID: 1, PlayerID: 2, Line: 2.25, OverOdds: -110},
+		{GameID: 1, PlayerID: 2, Line: 2.5, OverOdds: 50},
+	} {
+		if err := line.Validate(); !errors.Is(err, models.ErrInvalidPropLine) {
+			t.Errorf("Validate(%+v) = %v, want ErrInvalidPropLine", line, err)
+		}
+	}
+}
+
+func TestPropLineEdgeAndSettle(t *testing.T) {
+	under := -110
+	line := models.PropLine{Line: 2.5, OverOdds: -110, UnderOdds: &under}
+	distribution := models.ShotDistribution{AtLeast: map[int]float64{1: 0.9, 2: 0.75, 3: 0.6, 4: 0.4, 5: 0.2, 6: 0.1}}
+
+	// Both sides at -110 are a 50% market once the vig is removed
+	edge, ok := distribution.Edge(line)
+	if !ok || edge.OverProbability != 0.6 || edge.ImpliedProbability != 0.5 || edge.Edge != 0.1 || edge.Bet != models.BetOver {
+		t.Errorf("Edge = %+v, %v, want 0.6 against 0.5 for a 0.1 edge on the over", edge, ok)
+	}
+	if _, ok := distribution.Edge(models.PropLine{Line: 6.5, OverOdds: 300}); ok {
+		t.Error("Edge past the reported shot counts is ok, want false")
+	}
+
+	// 0.4 clears the under's 52.4% break-even, 0.5 clears neither side's
+	if side := line.Bet(0.4); side != models.BetUnder {
+		t.Errorf("Bet(0.4) = %q, want under", side)
+	}
+	if side := line.Bet(0.5); side != "" {
+		t.Errorf("Bet(0.5) = %q, want no bet", side)
+	}
+
+	for _, tt := range []struct {
+		line   models.PropLine
+		side   models.BetSide
+		shots  int
+		profit float64
+	}{
+		{line, models.BetOver, 3, 100.0 / 110},
+		{line, models.BetOver, 2, -1},
+		{line, models.BetUnder, 2, 100.0 / 110},
+		{models.PropLine{Line: 3, OverOdds: 150}, models.BetOver, 3, 0},
+		{models.PropLine{Line: 3, OverOdds: 150}, models.BetOver, 4, 1.5},
+	} {
+		if profit := tt.line.Settle(tt.side, tt.shots); math.Abs(profit-tt.profit) > 1e-9 {
+			t.Errorf("%s %.1f with %d shots = %.4f, want %.4f", tt.side, tt.line.Line, tt.shots, profit, tt.profit)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"math"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// Game log windows recorded for every prediction and blended by the rolling
+// window strategy
+const (
+	ROLLING_SHORT_WINDOW = 10
+	ROLLING_LONG_WINDOW  = 20
+
+	// DEFAULT_EWMA_HALF_LIFE is the EWMA half-life in games when a model doesn't set one
+	DEFAULT_EWMA_HALF_LIFE = 5.0
+
+	// VENUE_PRIOR_GAMES is how many games at the player's overall rate a home
+	// or away average is blended with, so a few road games can't swing it
+	VENUE_PRIOR_GAMES = 5
+)
+
+// rollingShotStats summarize a player's game log over windows of recent games
+type rollingShotStats struct {
+	games              int
+	shotsPerGame       float64
+	shotsLast10        float64
+	shotsLast20        float64
+	shotsEWMA          float64
+	homeGames          int
+	homeShotsPerGame   float64
+	awayGames          int
+	awayShotsPerGame   float64
+	toiLast10          float64  // minutes per game
+	powerPlayTOILast10 *float64 // minutes per game with power play TOI, nil when none had it
+}
+
+// newRollingShotStats summarizes a game log sorted most recent first. Windows
+// longer than the log average over the whole log.
+func newRollingShotStats(gameLog []models.GameLogEntry, halfLife float64) rollingShotStats {
+	stats := rollingShotStats{
+		games:       len(gameLog),
+		shotsLast10: averageShots(gameLog, ROLLING_SHORT_WINDOW),
+		shotsLast20: averageShots(gameLog, ROLLING_LONG_WINDOW),
+		shotsEWMA:   ewmaShots(gameLog, halfLife),
+	}
+	stats.shotsPerGame = averageShots(gameLog, len(gameLog))
+
+	var homeShots, awayShots int
+	for _, game := range gameLog {
+		if game.HomeRoadFlag == "H" {
+			stats.homeGames++
+			homeShots += game.Shots
+		} else {
+			stats.awayGames++
+			awayShots += game.Shots
+		}
+	}
+	if stats.homeGames > 0 {
+		stats.homeShotsPerGame = float64(homeShots) / float64(stats.homeGames)
+	}
+	if stats.awayGames > 0 {
+		stats.awayShotsPerGame = float64(awayShots) / float64(stats.awayGames)
+	}
+
+	recent := gameLog[:min(len(gameLog), ROLLING_SHORT_WINDOW)]
+	var toi, powerPlayTOI float64
+	var powerPlayGames int
+	for _, game := range recent {
+		toi += parseTimeOnIce(game.TOI)
+		if game.PowerPlayTOI != "" {
+			powerPlayTOI += parseTimeOnIce(game.PowerPlayTOI)
+			powerPlayGames++
+		}
+	}
+	if len(recent) > 0 {
+		stats.toiLast10 = toi / float64(len(recent))
+	}
+	if powerPlayGames > 0 {
+		average := powerPlayTOI / float64(powerPlayGames)
+		stats.powerPlayTOILast10 = &average
+	}
+
+	return stats
+}
+
+// venueShotsPerGame is the player's average at the game's venue
+func (s rollingShotStats) venueShotsPerGame(isHome bool) (float64, int) {
+	if isHome {
+		return s.homeShotsPerGame, s.homeGames
+	}
+	return s.awayShotsPerGame, s.awayGames
+}
+
+// averageShots averages the window most recent games of a log, 0 for an empty log
+func averageShots(gameLog []models.GameLogEntry, window int) float64 {
+	games := gameLog[:min(len(gameLog), window)]
+	if len(games) == 0 {
+		return 0
+	}
+	var total int
+	for _, game := range games {
+		total += game.Shots
+	}
+	return float64(total) / float64(len(games))
+}
+
+// ewmaShots weights each game by half for every halfLife games before the
+// most recent, with DEFAULT_EWMA_HALF_LIFE when halfLife isn't positive
+func ewmaShots(gameLog []models.GameLogEntry, halfLife float64) float64 {
+	if halfLife <= 0 {
+		halfLife = DEFAULT_EWMA_HALF_LIFE
+	}
+	var weighted, weights float64
+	for i, game := range gameLog {
+		weight := math.Pow(0.5, float64(i)/halfLife)
+		weighted += weight * float64(game.Shots)
+		weights += weight
+	}
+	if weights == 0 {
+		return 0
+	}
+	return weighted / weights
+}
+
+// getVenueFactor scales shots by the player's home or away split, shrunk
+// toward their overall rate and applied at VenueSplitWeight
+func getVenueFactor(stats rollingShotStats, isHome bool, params models.ModelParameters) float64 {
+	if stats.shotsPerGame == 0 || params.VenueSplitWeight == 0 {
+		return 1.0
+	}
+	venueShots, venueGames := stats.venueShotsPerGame(isHome)
+	games := float64(venueGames)
+	shrunk := (games*venueShots + VENUE_PRIOR_GAMES*stats.shotsPerGame) / (games + VENUE_PRIOR_GAMES)
+	return 1.0 + params.VenueSplitWeight*(shrunk/stats.shotsPerGame-1)
+}
+
+// Rolling window calculation that blends 10 and 20 game windows and an EWMA
+// of the season game log in place of the last five games
+func calculatePredictedShotsRollingWindow(
+	playerStats models.PlayerDetail,
+	avgShotsLast5 float64,
+	seasonShotsPerGame float64,
+	teamStats []models.TeamStats,
+	restDays map[int]int,
+	params models.ModelParameters,
+	features *models.PredictionFeatures,
+) float64 {
+	if len(playerStats.GameLog) == 0 {
+		prediction := calculatePredictedShotsStandard(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, params, features)
+		features.Fallback = joinFallback("no season game log, used the standard calculation", features.Fallback)
+		return prediction
+	}
+
+	rolling := newRollingShotStats(playerStats.GameLog, params.EWMAHalfLife)
+
+	// Blend the windows by their weights, the short window alone without any
+	windowWeights := params.Last10Weight + params.Last20Weight + params.EWMAWeight
+	recentShots := rolling.shotsLast10
+	if windowWeights > 0 {
+		recentShots = (rolling.shotsLast10*params.Last10Weight +
+			rolling.shotsLast20*params.Last20Weight +
+			rolling.shotsEWMA*params.EWMAWeight) / windowWeights
+	}
+	features.WeightedRecentShots = &recentShots
+
+	currentTeam := getTeamStatsById(playerStats.CurrentTeamId, teamStats)
+	opposingTeam := getTeamStatsById(playerStats.OpposingTeamId, teamStats)
+
+	if currentTeam == nil || opposingTeam == nil {
+		features.Fallback = "missing team stats, averaged rolling and season shots"
+		features.BasePrediction = (recentShots + seasonShotsPerGame) / 2
+		return finishPrediction(features, features.BasePrediction, false)
+	}
+
+	basePrediction := recentShots*params.RecentPerformanceWeight + seasonShotsPerGame*params.SeasonPerformanceWeight
+
+	// Get common factors
+	leagueShotAverage := getLeagueShotAverage(teamStats)
+	gamePaceFactor, teamOffenseFactor, teamDefenseFactor := getTeamFactors(currentTeam, opposingTeam, leagueShotAverage, params)
+	positionFactor := getPositionFactor(playerStats.Position, params)
+	icetimeFactor := math.Min(rolling.toiLast10/20.0, 1.0)
+	restFactor := getRestFactor(playerStats.CurrentTeamId, restDays, params)
+	venueFactor := getVenueFactor(rolling, playerStats.IsHome, params)
+
+	adjustedPrediction := basePrediction *
+		gamePaceFactor *
+		teamOffenseFactor *
+		teamDefenseFactor *
+		positionFactor *
+		icetimeFactor *
+		restFactor *
+		venueFactor
+
+	features.BasePrediction = basePrediction
+	features.GamePaceFactor = gamePaceFactor
+	features.TeamOffenseFactor = teamOffenseFactor
+	features.TeamDefenseFactor = teamDefenseFactor
+	features.PositionFactor = positionFactor
+	features.IcetimeFactor = icetimeFactor
+	features.RestFactor = restFactor
+	features.VenueFactor = venueFactor
+	return finishPrediction(features, adjustedPrediction, true)
+}
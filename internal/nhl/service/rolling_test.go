@@ -0,0 +1,62 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// gameLogOf builds a log, most recent first, alternating home and away from a home game
+func gameLogOf(shots ...int) []models.GameLogEntry {
+	gameLog := make([]models.GameLogEntry, len(shots))
+	for i, s := range shots {
+		gameLog[i] = models.GameLogEntry{Shots: s, TOI: "20:00", HomeRoadFlag: "R"}
+		if i%2 == 0 {
+			gameLog[i].HomeRoadFlag = "H"
+		}
+	}
+	return gameLog
+}
+
+func TestNewRollingShotStats(t *testing.T) {
+	// 10 games of 4 then 10 of 2, with 4 more games past the long window
+	shots := []int{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 0, 0, 0, 0}
+	stats := newRollingShotStats(gameLogOf(shots...), 5)
+
+	if stats.games != 24 || stats.shotsLast10 != 4 || stats.shotsLast20 != 3 {
+		t.Errorf("games %d, last 10 %.2f, last 20 %.2f, want 24, 4, 3", stats.games, stats.shotsLast10, stats.shotsLast20)
+	}
+	if stats.shotsEWMA <= stats.shotsLast20 || stats.shotsEWMA >= stats.shotsLast10 {
+		t.Errorf("EWMA %.4f isn't between the 20 and 10 game averages", stats.shotsEWMA)
+	}
+	if stats.homeGames != 12 || stats.awayGames != 12 || stats.toiLast10 != 20 {
+		t.Errorf("%d home, %d away, %.1f TOI, want 12, 12, 20", stats.homeGames, stats.awayGames, stats.toiLast10)
+	}
+	if stats.powerPlayTOILast10 != nil {
+		t.Errorf("power play TOI = %.2f without any in the log, want nil", *stats.powerPlayTOILast10)
+	}
+
+	// A short log averages what it has
+	short := newRollingShotStats(gameLogOf(3, 1), 5)
+	if short.shotsLast10 != 2 || short.shotsLast20 != 2 {
+		t.Errorf("two game log: last 10 %.2f, last 20 %.2f, want 2, 2", short.shotsLast10, short.shotsLast20)
+	}
+}
+
+func TestGetVenueFactor(t *testing.T) {
+	// Four shots a game at home, two on the road
+	stats := newRollingShotStats(gameLogOf(4, 2, 4, 2, 4, 2, 4, 2, 4, 2), 5)
+	params := models.ModelParameters{VenueSplitWeight: 1}
+
+	// Five home games shrunk halfway to the overall 3 is 3.5
+	if home := getVenueFactor(stats, true, params); math.Abs(home-3.5/3) > 1e-9 {
+		t.Errorf("home factor = %.4f, want %.4f", home, 3.5/3)
+	}
+	if away := getVenueFactor(stats, false, params); math.Abs(away-2.5/3) > 1e-9 {
+		t.Errorf("away factor = %.4f, want %.4f", away, 2.5/3)
+	}
+	if neutral := getVenueFactor(stats, true, models.ModelParameters{}); neutral != 1 {
+		t.Errorf("factor without a split weight = %.4f, want 1", neutral)
+	}
+}
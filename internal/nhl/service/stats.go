@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -120,6 +121,50 @@ func getRestFactor(currentTeamId int, restDays map[int]int, params models.ModelP
 	return restFactor
 }
 
+// GOALIE_PRIOR_GAMES is how many league average games a goalie's save
+// percentage is blended with, so a few hot starts don't make a backup elite
+const GOALIE_PRIOR_GAMES = 10
+
+// GOALIE_SAVE_PCT_SPREAD is how far from league average a goalie's save
+// percentage has to be for the full goalie adjustment
+const GOALIE_SAVE_PCT_SPREAD = 0.02
+
+// getLeagueSavePct is the league save percentage from team totals, 0 without any shots
+func getLeagueSavePct(allTeamStats []models.TeamStats) float64 {
+	var goalsAgainst, shotsAgainst float64
+	for _, stats := range allTeamStats {
+		goalsAgainst += stats.GoalsAgainstPerGame * float64(stats.GamesPlayed)
+		shotsAgainst += stats.ShotsAgainstPerGame * float64(stats.GamesPlayed)
+	}
+	if shotsAgainst == 0 {
+		return 0
+	}
+	return 1 - goalsAgainst/shotsAgainst
+}
+
+// getGoalieFactor scales shots by the opposing goalie's quality, from
+// OpposingGoalieQualityFactor against the weakest goalies to its inverse
+// against the best. A factor of 0 or an unknown goalie is neutral.
+func getGoalieFactor(goalie *models.StartingGoalie, leagueSavePct float64, params models.ModelParameters) float64 {
+	if goalie == nil || leagueSavePct == 0 || params.OpposingGoalieQualityFactor <= 0 {
+		return 1.0
+	}
+
+	games := float64(goalie.GamesPlayed)
+	savePct := (games*goalie.SavePct + GOALIE_PRIOR_GAMES*leagueSavePct) / (games + GOALIE_PRIOR_GAMES)
+	quality := math.Min(math.Max((savePct-leagueSavePct)/GOALIE_SAVE_PCT_SPREAD, -1), 1)
+	return math.Pow(params.OpposingGoalieQualityFactor, -quality)
+}
+
+// getStreakFactor scales shots by the team's recent form, a 1.000 point
+// percentage adding StreakImpactFactor and a .000 one taking it away
+func getStreakFactor(form *models.TeamForm, params models.ModelParameters) float64 {
+	if form == nil || form.Games == 0 {
+		return 1.0
+	}
+	return 1.0 + params.StreakImpactFactor*(form.PointPct-0.5)*2
+}
+
 func getPositionFactor(position string, params models.ModelParameters) float64 {
 	if position == "D" {
 		return params.DefensePositionFactor
@@ -135,12 +180,15 @@ func calculatePredictedShotsStandard(
 	teamStats []models.TeamStats,
 	restDays map[int]int,
 	params models.ModelParameters,
+	features *models.PredictionFeatures,
 ) float64 {
 	currentTeam := getTeamStatsById(playerStats.CurrentTeamId, teamStats)
 	opposingTeam := getTeamStatsById(playerStats.OpposingTeamId, teamStats)
 
 	if currentTeam == nil || opposingTeam == nil {
-		return (avgShotsLast5 + seasonShotsPerGame) / 2
+		features.Fallback = "missing team stats, averaged recent and season shots"
+		features.BasePrediction = (avgShotsLast5 + seasonShotsPerGame) / 2
+		return finishPrediction(features, features.BasePrediction, false)
 	}
 
 	// Weight recent performance more heavily
@@ -167,7 +215,14 @@ func calculatePredictedShotsStandard(
 	restFactor := getRestFactor(playerStats.CurrentTeamId, restDays, params)
 	adjustedPrediction = adjustedPrediction * restFactor
 
-	return math.Round(adjustedPrediction*10) / 10
+	features.BasePrediction = basePrediction
+	features.GamePaceFactor = gamePaceFactor
+	features.TeamOffenseFactor = teamOffenseFactor
+	features.TeamDefenseFactor = teamDefenseFactor
+	features.PositionFactor = positionFactor
+	features.IcetimeFactor = icetimeFactor
+	features.RestFactor = restFactor
+	return finishPrediction(features, adjustedPrediction, true)
 }
 
 // Weighted recency calculation method that uses individual game weighting
@@ -178,9 +233,12 @@ func calculatePredictedShotsWeightedRecency(
 	teamStats []models.TeamStats,
 	restDays map[int]int,
 	params models.ModelParameters,
+	features *models.PredictionFeatures,
 ) float64 {
 	if len(shotsLast5) < 5 {
-		return calculatePredictedShotsStandard(playerStats, 0, seasonShotsPerGame, teamStats, restDays, params)
+		prediction := calculatePredictedShotsStandard(playerStats, 0, seasonShotsPerGame, teamStats, restDays, params, features)
+		features.Fallback = joinFallback("fewer than 5 recent games, used the standard calculation on season shots", features.Fallback)
+		return prediction
 	}
 
 	// Apply specific weights to each of the last 5 games
@@ -190,13 +248,16 @@ func calculatePredictedShotsWeightedRecency(
 	weightedRecentPerformance += float64(shotsLast5[2]) * params.ThirdLastGameWeight
 	weightedRecentPerformance += float64(shotsLast5[3]) * params.FourthLastGameWeight
 	weightedRecentPerformance += float64(shotsLast5[4]) * params.FifthLastGameWeight
+	features.WeightedRecentShots = &weightedRecentPerformance
 
 	// Use weighted recent performance but blend with standard calculation
 	currentTeam := getTeamStatsById(playerStats.CurrentTeamId, teamStats)
 	opposingTeam := getTeamStatsById(playerStats.OpposingTeamId, teamStats)
 
 	if currentTeam == nil || opposingTeam == nil {
-		return (weightedRecentPerformance + seasonShotsPerGame) / 2
+		features.Fallback = "missing team stats, averaged weighted recent and season shots"
+		features.BasePrediction = (weightedRecentPerformance + seasonShotsPerGame) / 2
+		return finishPrediction(features, features.BasePrediction, false)
 	}
 
 	// Weight recent weighted performance more heavily than season stats
@@ -223,7 +284,14 @@ func calculatePredictedShotsWeightedRecency(
 	restFactor := getRestFactor(playerStats.CurrentTeamId, restDays, params)
 	adjustedPrediction = adjustedPrediction * restFactor
 
-	return math.Round(adjustedPrediction*10) / 10
+	features.BasePrediction = basePrediction
+	features.GamePaceFactor = gamePaceFactor
+	features.TeamOffenseFactor = teamOffenseFactor
+	features.TeamDefenseFactor = teamDefenseFactor
+	features.PositionFactor = positionFactor
+	features.IcetimeFactor = icetimeFactor
+	features.RestFactor = restFactor
+	return finishPrediction(features, adjustedPrediction, true)
 }
 
 // TOI-driven calculation method that prioritizes ice time
@@ -234,6 +302,7 @@ func calculatePredictedShotsTOIDriven(
 	teamStats []models.TeamStats,
 	restDays map[int]int,
 	params models.ModelParameters,
+	features *models.PredictionFeatures,
 ) float64 {
 	avgTOIMinutes := calculateAvgTOIMinutes(playerStats.Last5Games)
 
@@ -261,6 +330,8 @@ func calculatePredictedShotsTOIDriven(
 		}
 	}
 	baseTOIPrediction *= positionFactor
+	features.TOIBasePrediction = &baseTOIPrediction
+	features.PositionFactor = positionFactor
 
 	// Blend TOI prediction with actual shot history
 	toiWeight := 0.7         // 70% TOI-based prediction
@@ -269,13 +340,15 @@ func calculatePredictedShotsTOIDriven(
 	blendedBasePrediction := (baseTOIPrediction * toiWeight) +
 		((avgShotsLast5*params.RecentPerformanceWeight +
 			seasonShotsPerGame*params.SeasonPerformanceWeight) * shotHistoryWeight)
+	features.BasePrediction = blendedBasePrediction
 
 	// Apply team factors with reduced weight
 	currentTeam := getTeamStatsById(playerStats.CurrentTeamId, teamStats)
 	opposingTeam := getTeamStatsById(playerStats.OpposingTeamId, teamStats)
 
 	if currentTeam == nil || opposingTeam == nil {
-		return math.Round(blendedBasePrediction*10) / 10
+		features.Fallback = "missing team stats, used the TOI blend alone"
+		return finishPrediction(features, blendedBasePrediction, true)
 	}
 
 	// Get common factors with reduced impact
@@ -286,13 +359,17 @@ func calculatePredictedShotsTOIDriven(
 	restFactor := getRestFactor(playerStats.CurrentTeamId, restDays, params)
 
 	// Final prediction with team factors having less impact
+	features.GamePaceFactor = math.Pow(gamePaceFactor, 0.7)
+	features.TeamOffenseFactor = math.Pow(teamOffenseFactor, 0.7)
+	features.TeamDefenseFactor = math.Pow(teamDefenseFactor, 0.7)
+	features.RestFactor = math.Pow(restFactor, 0.8)
 	adjustedPrediction := blendedBasePrediction *
-		math.Pow(gamePaceFactor, 0.7) *
-		math.Pow(teamOffenseFactor, 0.7) *
-		math.Pow(teamDefenseFactor, 0.7) *
-		math.Pow(restFactor, 0.8)
+		features.GamePaceFactor *
+		features.TeamOffenseFactor *
+		features.TeamDefenseFactor *
+		features.RestFactor
 
-	return math.Round(adjustedPrediction*10) / 10
+	return finishPrediction(features, adjustedPrediction, true)
 }
 
 // Matchup-focused calculation that emphasizes team matchups and contextual factors
@@ -303,12 +380,15 @@ func calculatePredictedShotsMatchupFocused(
 	teamStats []models.TeamStats,
 	restDays map[int]int,
 	params models.ModelParameters,
+	features *models.PredictionFeatures,
 ) float64 {
 	currentTeam := getTeamStatsById(playerStats.CurrentTeamId, teamStats)
 	opposingTeam := getTeamStatsById(playerStats.OpposingTeamId, teamStats)
 
 	if currentTeam == nil || opposingTeam == nil {
-		return calculatePredictedShotsStandard(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, params)
+		prediction := calculatePredictedShotsStandard(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, params, features)
+		features.Fallback = joinFallback("missing team stats for the matchup, used the standard calculation", features.Fallback)
+		return prediction
 	}
 
 	// Start with standard calculation weights but emphasize matchup
@@ -342,24 +422,37 @@ func calculatePredictedShotsMatchupFocused(
 	// Enhanced rest day factors
 	restFactor := getRestFactor(playerStats.CurrentTeamId, restDays, params)
 
-	// Team streak factor (placeholder - would require additional data)
-	streakFactor := 1.0 + (params.StreakImpactFactor * 0) // Neutral for now
+	// Opposing starter and recent team results
+	goalieFactor := getGoalieFactor(playerStats.OpposingGoalie, getLeagueSavePct(teamStats), params)
+	streakFactor := getStreakFactor(playerStats.TeamForm, params)
 
 	// Combine all factors with enhanced matchup emphasis
+	features.BasePrediction = basePrediction
+	features.GamePaceFactor = math.Pow(gamePaceFactor, 1.2)       // Increased impact
+	features.TeamOffenseFactor = math.Pow(teamOffenseFactor, 1.1) // Increased impact
+	features.TeamDefenseFactor = math.Pow(teamDefenseFactor, 1.1) // Increased impact
+	features.PositionFactor = positionFactor
+	features.IcetimeFactor = icetimeFactor
+	features.RestFactor = restFactor
+	features.HomeIceFactor = homeIceFactor
+	features.StreakFactor = streakFactor
+	features.GoalieFactor = goalieFactor
 	adjustedPrediction := basePrediction *
-		math.Pow(gamePaceFactor, 1.2) * // Increased impact
-		math.Pow(teamOffenseFactor, 1.1) * // Increased impact
-		math.Pow(teamDefenseFactor, 1.1) * // Increased impact
+		features.GamePaceFactor *
+		features.TeamOffenseFactor *
+		features.TeamDefenseFactor *
 		positionFactor *
 		icetimeFactor *
 		restFactor *
 		homeIceFactor *
-		streakFactor
+		streakFactor *
+		goalieFactor
 
-	return math.Round(adjustedPrediction*10) / 10
+	return finishPrediction(features, adjustedPrediction, true)
 }
 
-// Strategy router that selects the appropriate calculation method based on model strategy
+// Strategy router that selects the appropriate calculation method based on
+// model strategy, returning the prediction with the features behind it
 func calculatePredictedShots(
 	playerStats models.PlayerDetail,
 	shotsLast5 []int,
@@ -367,7 +460,7 @@ func calculatePredictedShots(
 	teamStats []models.TeamStats,
 	restDays map[int]int,
 	model models.ModelVersion,
-) float64 {
+) (float64, *models.PredictionFeatures) {
 	// Calculate average shots for standard methods
 	var totalShots float64
 	for _, shots := range shotsLast5 {
@@ -378,20 +471,28 @@ func calculatePredictedShots(
 		avgShotsLast5 = totalShots / float64(len(shotsLast5))
 	}
 
+	features := newPredictionFeatures(playerStats, shotsLast5, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, model)
+	params := model.Parameters
+
 	// Route to appropriate calculation method based on strategy
+	var prediction float64
 	switch model.CalculationStrategy {
 	case models.StandardCalculation:
-		return calculatePredictedShotsStandard(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, model.Parameters)
+		prediction = calculatePredictedShotsStandard(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, params, features)
 	case models.WeightedRecencyCalculation:
-		return calculatePredictedShotsWeightedRecency(playerStats, shotsLast5, seasonShotsPerGame, teamStats, restDays, model.Parameters)
+		prediction = calculatePredictedShotsWeightedRecency(playerStats, shotsLast5, seasonShotsPerGame, teamStats, restDays, params, features)
 	case models.TOIDrivenCalculation:
-		return calculatePredictedShotsTOIDriven(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, model.Parameters)
+		prediction = calculatePredictedShotsTOIDriven(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, params, features)
 	case models.MatchupFocusedCalculation:
-		return calculatePredictedShotsMatchupFocused(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, model.Parameters)
+		prediction = calculatePredictedShotsMatchupFocused(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, params, features)
+	case models.RollingWindowCalculation:
+		prediction = calculatePredictedShotsRollingWindow(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, params, features)
 	default:
 		// Fall back to standard calculation if strategy is unknown
-		return calculatePredictedShotsStandard(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, model.Parameters)
+		prediction = calculatePredictedShotsStandard(playerStats, avgShotsLast5, seasonShotsPerGame, teamStats, restDays, params, features)
 	}
+
+	return prediction, features
 }
 
 // extractPlayerStats extracts common player statistics needed for prediction
@@ -429,45 +530,20 @@ func extractPlayerStats(player models.PlayerDetail) ([]int, float64, float64, []
 
 // CalculateShootingStatsWithModel calculates shooting stats using the specified model version
 func CalculateShootingStatsWithModel(players []models.PlayerDetail, teamStats []models.TeamStats, restDays map[int]int, model models.ModelVersion) []models.PlayerStats {
+	return calculateShootingStatsAsOf(players, teamStats, restDays, model, time.Now())
+}
+
+// calculateShootingStatsAsOf calculates shooting stats as they would have been
+// on asOf, which lets backtests replay past dates
+func calculateShootingStatsAsOf(players []models.PlayerDetail, teamStats []models.TeamStats, restDays map[int]int, model models.ModelVersion, asOf time.Time) []models.PlayerStats {
 	var stats []models.PlayerStats
-	params := model.Parameters
 
 	for _, player := range players {
-		if len(player.Last5Games) < 5 {
-			continue
-		}
-
-		// Only include players who have played in the last 7 days
-		if player.Last5Games[0].GameDate < time.Now().AddDate(0, 0, -7).Format("2006-01-02") {
-			continue
-		}
-
-		// Extract player stats
-		shotsLast5, avgShotsLast5, seasonShotsPerGame, shotTrend, avgTOI := extractPlayerStats(player)
-
-		// Calculate prediction using the specified model
-		predictedGameShots := calculatePredictedShots(player, shotsLast5, seasonShotsPerGame, teamStats, restDays, model)
+		playerStats, ok := predictPlayer(player, teamStats, restDays, model, asOf)
 
 		// Only include players meeting minimum shot threshold
-		if predictedGameShots >= models.MIN_SHOTS {
-			stats = append(stats, models.PlayerStats{
-				PlayerId:           player.PlayerId,
-				Name:               fmt.Sprintf("%s %s", player.FirstName.Default, player.LastName.Default),
-				Position:           player.Position,
-				TeamAbbrev:         player.CurrentTeamAbbrev,
-				TeamId:             player.CurrentTeamId,
-				ShotsLast5:         shotsLast5,
-				AvgShotsLast5:      avgShotsLast5,
-				ShotTrend:          shotTrend,
-				AvgTOI:             avgTOI,
-				SeasonShotsPerGame: seasonShotsPerGame,
-				PredictedGameShots: predictedGameShots,
-				Confidence:         calculateConfidence(predictedGameShots, avgTOI, shotTrend, player.Position, params),
-				RestDays:           restDays[player.CurrentTeamId],
-				Headshot:           player.Headshot,
-				// Record which model was used
-				ModelVersionID: model.ID,
-			})
+		if ok && playerStats.PredictedGameShots >= models.MIN_SHOTS {
+			stats = append(stats, playerStats)
 		}
 	}
 
@@ -479,6 +555,54 @@ func CalculateShootingStatsWithModel(players []models.PlayerDetail, teamStats []
 	return stats
 }
 
+// isPredictable reports whether a player has played recently enough to be
+// predicted on asOf. Players back from injury with fewer than five games are
+// predicted, the strategies fall back on season stats for what's missing. It
+// doesn't depend on the model.
+func isPredictable(player models.PlayerDetail, asOf time.Time) bool {
+	if len(player.Last5Games) == 0 {
+		return false
+	}
+
+	// Only include players who have played in the last 7 days
+	return player.Last5Games[0].GameDate >= asOf.AddDate(0, 0, -7).Format("2006-01-02")
+}
+
+// predictPlayer runs a model for one player, false when the player isn't
+// predictable. Predictions under MIN_SHOTS are returned.
+func predictPlayer(player models.PlayerDetail, teamStats []models.TeamStats, restDays map[int]int, model models.ModelVersion, asOf time.Time) (models.PlayerStats, bool) {
+	if !isPredictable(player, asOf) {
+		return models.PlayerStats{}, false
+	}
+
+	// Extract player stats
+	shotsLast5, avgShotsLast5, seasonShotsPerGame, shotTrend, avgTOI := extractPlayerStats(player)
+
+	// Calculate prediction using the specified model
+	predictedGameShots, features := calculatePredictedShots(player, shotsLast5, seasonShotsPerGame, teamStats, restDays, model)
+
+	return models.PlayerStats{
+		PlayerId:           player.PlayerId,
+		Name:               fmt.Sprintf("%s %s", player.FirstName.Default, player.LastName.Default),
+		Position:           player.Position,
+		TeamAbbrev:         player.CurrentTeamAbbrev,
+		TeamId:             player.CurrentTeamId,
+		ShotsLast5:         shotsLast5,
+		AvgShotsLast5:      avgShotsLast5,
+		ShotTrend:          shotTrend,
+		AvgTOI:             avgTOI,
+		SeasonShotsPerGame: seasonShotsPerGame,
+		PredictedGameShots: predictedGameShots,
+		Confidence:         calculateConfidence(predictedGameShots, avgTOI, shotTrend, player.Position, model.Parameters),
+		RestDays:           restDays[player.CurrentTeamId],
+		Headshot:           player.Headshot,
+		Features:           features,
+		Distribution:       shotDistribution(features.UnroundedPrediction, shotsLast5),
+		// Record which model was used
+		ModelVersionID: model.ID,
+	}, true
+}
+
 // CalculateShootingStats is the original function, now calling the versioned one with the active model
 func CalculateShootingStats(players []models.PlayerDetail, teamStats []models.TeamStats, restDays map[int]int) []models.PlayerStats {
 	model, err := GetModelVersion(GetActiveModelVersion())
@@ -556,13 +680,13 @@ func calculateVariance(numbers []int) float64 {
 	return variance
 }
 
-func GetPlayerShotStats(date string) ([]models.GameWithPlayers, error) {
+func GetPlayerShotStats(ctx context.Context, date string) ([]models.GameWithPlayers, error) {
 	// Ensure models are initialized
 	if !initialized {
 		InitializeModels()
 	}
 
-	games, err := repository.GetUpcomingGames(date)
+	games, err := repository.GetUpcomingGames(ctx, date)
 	if err != nil {
 		return nil, err
 	}
@@ -571,22 +695,24 @@ func GetPlayerShotStats(date string) ([]models.GameWithPlayers, error) {
 		return nil, fmt.Errorf("no NHL games found for date")
 	}
 
-	teamStats, err := repository.GetAllTeamStats(games[0].Season)
+	teamStats, err := repository.GetAllTeamStats(ctx, games[0].Season)
 	if err != nil {
 		return nil, err
 	}
 
 	var restDays map[int]int
-	restDays, err = repository.GetTeamsRest(date, games)
+	restDays, err = repository.GetTeamsRest(ctx, date, games)
 	if err != nil {
 		return nil, err
 	}
 
 	var allPlayers []models.PlayerStats
 	for _, game := range games {
-		players, err := repository.GetPlayerStats(game.GameID, []models.Team{game.AwayTeam, game.HomeTeam})
+		players, err := getGamePlayers(ctx, game)
 		if err != nil {
-			fmt.Println("Error fetching player stats:", err)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			continue
 		}
 		playerStats := CalculateShootingStats(players, teamStats, restDays)
@@ -601,12 +727,12 @@ func GetPlayerShotStats(date string) ([]models.GameWithPlayers, error) {
 		})
 
 		mappedPlayers := helpers.Map(filteredPlayers, func(player models.PlayerStats) models.PlayerStats {
-			player.PastPredictionAccuracy, err = dbRepository.GetPlayerPastPredictionAccuracy(player.PlayerId)
+			player.PastPredictionAccuracy, err = dbRepository.GetPlayerPastPredictionAccuracy(player.PlayerId, player.ModelVersionID)
 			if err != nil {
 				fmt.Println("Error fetching player past prediction accuracy:", err)
 			}
 
-			predictionRecord, err := dbRepository.GetPlayerPredictionRecord(player.PlayerId, &game.GameID)
+			predictionRecord, err := dbRepository.GetPlayerPredictionRecord(player.PlayerId, &game.GameID, player.ModelVersionID)
 			if err != nil {
 				fmt.Println("Error fetching player prediction record:", err)
 			}
@@ -614,6 +740,7 @@ func GetPlayerShotStats(date string) ([]models.GameWithPlayers, error) {
 			player.PredictionRecord = predictionRecord
 			return player
 		})
+		attachPropLines(game.GameID, mappedPlayers)
 
 		gamesWithPlayers = append(gamesWithPlayers, models.GameWithPlayers{
 			Game:    game,
@@ -0,0 +1,557 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"time"
+
+	dbRepository "api.alexmontague.ca/internal/database/repository"
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+// MAX_TUNING_GRID_EVALUATIONS caps how many parameter sets a grid search can try
+const MAX_TUNING_GRID_EVALUATIONS = 50000
+
+var (
+	ErrInvalidTuning   = errors.New("invalid tuning request")
+	ErrNoTuningSamples = errors.New("no validated predictions with recorded inputs")
+)
+
+// TuningLoss is the score a parameter search minimizes
+type TuningLoss string
+
+const (
+	// LossMAE is the mean absolute error of predicted shots
+	LossMAE TuningLoss = "mae"
+
+	// LossHitRate is one minus the share of players correctly called over or
+	// under Line shots
+	LossHitRate TuningLoss = "hit_rate"
+
+	// LossBrier is the Brier score of confidence, read as a 0-1 probability
+	// that the player goes over their shot distribution line
+	LossBrier TuningLoss = "brier"
+
+	// LossLogLoss is the log loss of each prediction's over probability at its
+	// own shot distribution line, as validated predictions are scored
+	LossLogLoss TuningLoss = "log_loss"
+)
+
+// SearchMethod is how a parameter search explores the space
+type SearchMethod string
+
+const (
+	SearchGrid       SearchMethod = "grid"
+	SearchRandom     SearchMethod = "random"
+	SearchCoordinate SearchMethod = "coordinate"
+)
+
+// tunableParameter is a ModelParameters field the tuner can search, within [min, max]
+type tunableParameter struct {
+	name       string // JSON name
+	min, max   float64
+	field      func(*models.ModelParameters) *float64
+	strategies []models.CalculationStrategy // nil when every strategy uses it
+	confidence bool                         // only changes confidence, so only the Brier loss sees it
+}
+
+var tunableParameters = []tunableParameter{
+	{name: "recentPerformanceWeight", min: 0, max: 1.5, field: func(p *models.ModelParameters) *float64 { return &p.RecentPerformanceWeight }},
+	{name: "seasonPerformanceWeight", min: 0, max: 1.5, field: func(p *models.ModelParameters) *float64 { return &p.SeasonPerformanceWeight }},
+	{name: "gamePaceExponent", min: 0, max: 2, field: func(p *models.ModelParameters) *float64 { return &p.GamePaceExponent }},
+	{name: "teamOffenseExponent", min: 0, max: 2, field: func(p *models.ModelParameters) *float64 { return &p.TeamOffenseExponent }},
+	{name: "teamDefenseExponent", min: 0, max: 2, field: func(p *models.ModelParameters) *float64 { return &p.TeamDefenseExponent }},
+	{name: "defensePositionFactor", min: 0.3, max: 1.2, field: func(p *models.ModelParameters) *float64 { return &p.DefensePositionFactor }},
+	{name: "backToBackFactor", min: 0.7, max: 1.1, field: func(p *models.ModelParameters) *float64 { return &p.BackToBackFactor }},
+	{name: "oneRestDayFactor", min: 0.8, max: 1.1, field: func(p *models.ModelParameters) *float64 { return &p.OneRestDayFactor }},
+	{name: "fourPlusRestDayFactor", min: 0.9, max: 1.3, field: func(p *models.ModelParameters) *float64 { return &p.FourPlusRestDayFactor }},
+
+	{name: "lastGameWeight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.LastGameWeight },
+		strategies: []models.CalculationStrategy{models.WeightedRecencyCalculation}},
+	{name: "secondLastGameWeight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.SecondLastGameWeight },
+		strategies: []models.CalculationStrategy{models.WeightedRecencyCalculation}},
+	{name: "thirdLastGameWeight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.ThirdLastGameWeight },
+		strategies: []models.CalculationStrategy{models.WeightedRecencyCalculation}},
+	{name: "fourthLastGameWeight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.FourthLastGameWeight },
+		strategies: []models.CalculationStrategy{models.WeightedRecencyCalculation}},
+	{name: "fifthLastGameWeight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.FifthLastGameWeight },
+		strategies: []models.CalculationStrategy{models.WeightedRecencyCalculation}},
+
+	{name: "opposingGoalieQualityFactor", min: 1, max: 1.3, field: func(p *models.ModelParameters) *float64 { return &p.OpposingGoalieQualityFactor },
+		strategies: []models.CalculationStrategy{models.MatchupFocusedCalculation}},
+	{name: "streakImpactFactor", min: 0, max: 0.2, field: func(p *models.ModelParameters) *float64 { return &p.StreakImpactFactor },
+		strategies: []models.CalculationStrategy{models.MatchupFocusedCalculation}},
+
+	{name: "last10Weight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.Last10Weight },
+		strategies: []models.CalculationStrategy{models.RollingWindowCalculation}},
+	{name: "last20Weight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.Last20Weight },
+		strategies: []models.CalculationStrategy{models.RollingWindowCalculation}},
+	{name: "ewmaWeight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.EWMAWeight },
+		strategies: []models.CalculationStrategy{models.RollingWindowCalculation}},
+	{name: "ewmaHalfLife", min: 1, max: 20, field: func(p *models.ModelParameters) *float64 { return &p.EWMAHalfLife },
+		strategies: []models.CalculationStrategy{models.RollingWindowCalculation}},
+	{name: "venueSplitWeight", min: 0, max: 1, field: func(p *models.ModelParameters) *float64 { return &p.VenueSplitWeight },
+		strategies: []models.CalculationStrategy{models.RollingWindowCalculation}},
+
+	{name: "shotScoreMultiplier", min: 0, max: 6, field: func(p *models.ModelParameters) *float64 { return &p.ShotScoreMultiplier }, confidence: true},
+	{name: "toiBaseMultiplier", min: 0, max: 6, field: func(p *models.ModelParameters) *float64 { return &p.TOIBaseMultiplier }, confidence: true},
+	{name: "toiBonusThreshold", min: 14, max: 24, field: func(p *models.ModelParameters) *float64 { return &p.TOIBonusThreshold }, confidence: true},
+	{name: "toiBonusMultiplier", min: 0, max: 3, field: func(p *models.ModelParameters) *float64 { return &p.TOIBonusMultiplier }, confidence: true},
+	{name: "trendUpwardScore", min: 0, max: 3, field: func(p *models.ModelParameters) *float64 { return &p.TrendUpwardScore }, confidence: true},
+	{name: "trendImprovementScore", min: 0, max: 2, field: func(p *models.ModelParameters) *float64 { return &p.TrendImprovementScore }, confidence: true},
+	{name: "defenseConfidenceFactor", min: 0.5, max: 1.2, field: func(p *models.ModelParameters) *float64 { return &p.DefenseConfidenceFactor }, confidence: true},
+}
+
+// TuningRequest describes a parameter search over validated history
+type TuningRequest struct {
+	// Start is the model the search starts from. Parameters that aren't tuned keep its values.
+	Start models.ModelVersion
+
+	// Parameters are the JSON names of the parameters to tune, empty for every
+	// parameter the strategy and loss depend on
+	Parameters []string
+
+	Search     SearchMethod
+	Loss       TuningLoss
+	Line       float64 // shot line players are called over or under for the hit rate
+	Iterations int     // samples for random search, passes for coordinate descent
+	GridPoints int     // values tried per parameter by grid search
+	Seed       int64   // random search seed
+
+	// HoldoutFraction of the most recent dates is kept out of the search and
+	// only scored, to show whether the tuned parameters generalize
+	HoldoutFraction float64
+
+	StartDate string
+	EndDate   string
+}
+
+// TuningScore is every metric for one parameter set on one set of samples
+type TuningScore struct {
+	Samples int     `json:"samples"`
+	Loss    float64 `json:"loss"`
+	MAE     float64 `json:"mae"`
+	HitRate float64 `json:"hitRate"`
+	Brier   float64 `json:"brier"`
+	LogLoss float64 `json:"logLoss"`
+}
+
+// ParameterChange is a tuned parameter's starting and final value
+type ParameterChange struct {
+	Name string  `json:"name"`
+	From float64 `json:"from"`
+	To   float64 `json:"to"`
+}
+
+// TuningResult is the best parameter set found, as a model ready to register
+type TuningResult struct {
+	Candidate    models.ModelVersion `json:"candidate"`
+	Search       SearchMethod        `json:"search"`
+	Loss         TuningLoss          `json:"loss"`
+	Line         float64             `json:"line"`
+	TrainDates   []string            `json:"trainDates"`
+	HoldoutDates []string            `json:"holdoutDates"`
+	Evaluations  int                 `json:"evaluations"`
+	Changes      []ParameterChange   `json:"changes"`
+
+	BaselineTrain   TuningScore  `json:"baselineTrain"`
+	TunedTrain      TuningScore  `json:"tunedTrain"`
+	BaselineHoldout *TuningScore `json:"baselineHoldout,omitempty"`
+	TunedHoldout    *TuningScore `json:"tunedHoldout,omitempty"`
+}
+
+// tuningSample is one validated player prediction with the inputs it was made from
+type tuningSample struct {
+	player    models.PlayerDetail
+	teamStats []models.TeamStats
+	restDays  map[int]int
+	asOf      time.Time
+	actual    int
+}
+
+// TuneParameters searches for the parameters that minimize req.Loss over the
+// validated predictions from req.StartDate to req.EndDate. Predictions are
+// replayed from each date's recorded inputs, and every predictable player with
+// a validated result is scored, including those under MIN_SHOTS, so a candidate
+// can't improve its loss by predicting fewer players.
+func TuneParameters(ctx context.Context, req TuningRequest) (*TuningResult, error) {
+	params, err := req.parameters()
+	if err != nil {
+		return nil, err
+	}
+
+	dates, err := dbRepository.GetPredictionInputDates(req.StartDate, req.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	samplesByDate, err := loadTuningSamples(dates, req.StartDate, req.EndDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dates are oldest first, so the holdout is the most recent stretch
+	var trainDates, holdoutDates []string
+	for _, date := range dates {
+		if len(samplesByDate[date]) > 0 {
+			trainDates = append(trainDates, date)
+		}
+	}
+	if len(trainDates) == 0 {
+		return nil, ErrNoTuningSamples
+	}
+	holdout := min(int(math.Round(float64(len(trainDates))*req.HoldoutFraction)), len(trainDates)-1)
+	trainDates, holdoutDates = trainDates[:len(trainDates)-holdout], trainDates[len(trainDates)-holdout:]
+
+	t := &tuner{req: req, params: params}
+	for _, date := range trainDates {
+		t.train = append(t.train, samplesByDate[date]...)
+	}
+	for _, date := range holdoutDates {
+		t.holdout = append(t.holdout, samplesByDate[date]...)
+	}
+
+	best, err := t.search(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TuningResult{
+		Search:        req.Search,
+		Loss:          req.Loss,
+		Line:          req.Line,
+		TrainDates:    trainDates,
+		HoldoutDates:  holdoutDates,
+		Evaluations:   t.evaluations,
+		Changes:       []ParameterChange{},
+		BaselineTrain: t.score(req.Start.Parameters, t.train),
+		TunedTrain:    t.score(best, t.train),
+	}
+	if result.HoldoutDates == nil {
+		result.HoldoutDates = []string{}
+	}
+	if len(t.holdout) > 0 {
+		baseline, tuned := t.score(req.Start.Parameters, t.holdout), t.score(best, t.holdout)
+		result.BaselineHoldout, result.TunedHoldout = &baseline, &tuned
+	}
+
+	start := req.Start.Parameters
+	for _, param := range params {
+		from, to := *param.field(&start), *param.field(&best)
+		if from != to {
+			result.Changes = append(result.Changes, ParameterChange{Name: param.name, From: from, To: to})
+		}
+	}
+
+	result.Candidate = models.ModelVersion{
+		Name: fmt.Sprintf("Tuned %s (%s, %s to %s)", req.Start.CalculationStrategy, req.Loss, trainDates[0], trainDates[len(trainDates)-1]),
+		Description: fmt.Sprintf("%s search from %q over %d validated predictions, %s loss %.4f to %.4f",
+			req.Search, req.Start.Name, len(t.train), req.Loss, result.BaselineTrain.Loss, result.TunedTrain.Loss),
+		CalculationStrategy: req.Start.CalculationStrategy,
+		Parameters:          best,
+	}
+	if req.Start.ID != 0 {
+		parentID := req.Start.ID
+		result.Candidate.ParentID = &parentID
+	}
+
+	return result, nil
+}
+
+// parameters validates the request and resolves the parameters to tune
+func (req TuningRequest) parameters() ([]tunableParameter, error) {
+	if !req.Start.CalculationStrategy.Valid() {
+		return nil, fmt.Errorf("%w: unknown calculation strategy", ErrInvalidTuning)
+	}
+	switch req.Loss {
+	case LossMAE, LossHitRate, LossBrier, LossLogLoss:
+	default:
+		return nil, fmt.Errorf("%w: loss must be %s, %s, %s or %s", ErrInvalidTuning, LossMAE, LossHitRate, LossBrier, LossLogLoss)
+	}
+	switch req.Search {
+	case SearchGrid:
+		if req.GridPoints < 2 {
+			return nil, fmt.Errorf("%w: grid search needs at least 2 points per parameter", ErrInvalidTuning)
+		}
+	case SearchRandom, SearchCoordinate:
+		if req.Iterations < 1 {
+			return nil, fmt.Errorf("%w: %s search needs at least 1 iteration", ErrInvalidTuning, req.Search)
+		}
+	default:
+		return nil, fmt.Errorf("%w: search must be %s, %s or %s", ErrInvalidTuning, SearchGrid, SearchRandom, SearchCoordinate)
+	}
+	if req.Line <= 0 {
+		return nil, fmt.Errorf("%w: the hit rate line must be a positive number of shots", ErrInvalidTuning)
+	}
+	if req.HoldoutFraction < 0 || req.HoldoutFraction >= 1 {
+		return nil, fmt.Errorf("%w: holdout fraction must be at least 0 and below 1", ErrInvalidTuning)
+	}
+	if _, err := (BacktestRequest{StartDate: req.StartDate, EndDate: req.EndDate}).Days(); err != nil {
+		return nil, err
+	}
+
+	usedBy := func(param tunableParameter) bool {
+		return (param.strategies == nil || slices.Contains(param.strategies, req.Start.CalculationStrategy)) &&
+			(!param.confidence || req.Loss == LossBrier)
+	}
+
+	var params []tunableParameter
+	for _, param := range tunableParameters {
+		if len(req.Parameters) == 0 && usedBy(param) {
+			params = append(params, param)
+		}
+	}
+	for _, name := range req.Parameters {
+		i := slices.IndexFunc(tunableParameters, func(param tunableParameter) bool { return param.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %q isn't a tunable parameter", ErrInvalidTuning, name)
+		}
+		if !usedBy(tunableParameters[i]) {
+			return nil, fmt.Errorf("%w: %q doesn't affect the %s loss for the %s strategy",
+				ErrInvalidTuning, name, req.Loss, req.Start.CalculationStrategy)
+		}
+		params = append(params, tunableParameters[i])
+	}
+
+	if req.Search == SearchGrid && math.Pow(float64(req.GridPoints), float64(len(params))) > MAX_TUNING_GRID_EVALUATIONS {
+		return nil, fmt.Errorf("%w: a %d point grid over %d parameters is more than %d evaluations, tune fewer parameters",
+			ErrInvalidTuning, req.GridPoints, len(params), MAX_TUNING_GRID_EVALUATIONS)
+	}
+	return params, nil
+}
+
+// loadTuningSamples pairs each date's recorded player inputs with their validated shots
+func loadTuningSamples(dates []string, startDate string, endDate string) (map[string][]tuningSample, error) {
+	validated, err := dbRepository.GetValidatedShots(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	type gamePlayer struct{ gameID, playerID int }
+	actualShots := make(map[string]map[gamePlayer]int)
+	for _, shot := range validated {
+		if actualShots[shot.GameDate] == nil {
+			actualShots[shot.GameDate] = make(map[gamePlayer]int)
+		}
+		actualShots[shot.GameDate][gamePlayer{shot.GameID, shot.PlayerID}] = shot.ActualShots
+	}
+
+	samples := make(map[string][]tuningSample)
+	for _, date := range dates {
+		if len(actualShots[date]) == 0 {
+			continue
+		}
+		inputs, err := dbRepository.GetPredictionInputs(date)
+		if err != nil {
+			return nil, err
+		}
+
+		asOf := predictionDate(date)
+		for _, game := range inputs.Games {
+			for _, player := range inputs.Players[game.GameID] {
+				actual, ok := actualShots[date][gamePlayer{game.GameID, player.PlayerId}]
+				if !ok || !isPredictable(player, asOf) {
+					continue
+				}
+				samples[date] = append(samples[date], tuningSample{
+					player:    player,
+					teamStats: inputs.TeamStats,
+					restDays:  inputs.RestDays,
+					asOf:      asOf,
+					actual:    actual,
+				})
+			}
+		}
+	}
+	return samples, nil
+}
+
+type tuner struct {
+	req         TuningRequest
+	params      []tunableParameter
+	train       []tuningSample
+	holdout     []tuningSample
+	evaluations int
+}
+
+// score runs the model with params over samples
+func (t *tuner) score(params models.ModelParameters, samples []tuningSample) TuningScore {
+	model := models.ModelVersion{CalculationStrategy: t.req.Start.CalculationStrategy, Parameters: params}
+
+	var absError, brier, logLoss float64
+	var correct int
+	for _, sample := range samples {
+		player, _ := predictPlayer(sample.player, sample.teamStats, sample.restDays, model, sample.asOf)
+		absError += math.Abs(player.PredictedGameShots - float64(sample.actual))
+
+		if (player.PredictedGameShots > t.req.Line) == (float64(sample.actual) > t.req.Line) {
+			correct++
+		}
+
+		over, sampleLogLoss, _ := player.Distribution.Score(sample.actual)
+		probability := math.Min(math.Max(player.Confidence/10, 0), 1)
+		outcome := 0.0
+		if over {
+			outcome = 1
+		}
+		brier += (probability - outcome) * (probability - outcome)
+		logLoss += sampleLogLoss
+	}
+
+	n := float64(max(len(samples), 1))
+	score := TuningScore{
+		Samples: len(samples),
+		MAE:     roundTo(absError/n, 4),
+		HitRate: roundTo(float64(correct)/n, 4),
+		Brier:   roundTo(brier/n, 4),
+		LogLoss: roundTo(logLoss/n, 4),
+	}
+	switch t.req.Loss {
+	case LossMAE:
+		score.Loss = absError / n
+	case LossHitRate:
+		score.Loss = 1 - float64(correct)/n
+	case LossBrier:
+		score.Loss = brier / n
+	case LossLogLoss:
+		score.Loss = logLoss / n
+	}
+	score.Loss = roundTo(score.Loss, 6)
+	return score
+}
+
+// loss scores params on the training samples, counting the evaluation
+func (t *tuner) loss(params models.ModelParameters) float64 {
+	t.evaluations++
+	return t.score(params, t.train).Loss
+}
+
+func (t *tuner) search(ctx context.Context) (models.ModelParameters, error) {
+	switch t.req.Search {
+	case SearchGrid:
+		return t.gridSearch(ctx)
+	case SearchRandom:
+		return t.randomSearch(ctx)
+	default:
+		return t.coordinateDescent(ctx)
+	}
+}
+
+// gridSearch tries every combination of GridPoints evenly spaced values per parameter
+func (t *tuner) gridSearch(ctx context.Context) (models.ModelParameters, error) {
+	best := t.req.Start.Parameters
+	bestLoss := t.loss(best)
+
+	indexes := make([]int, len(t.params))
+	for {
+		if err := ctx.Err(); err != nil {
+			return best, err
+		}
+
+		candidate := t.req.Start.Parameters
+		for i, param := range t.params {
+			step := (param.max - param.min) / float64(t.req.GridPoints-1)
+			*param.field(&candidate) = roundTo(param.min+step*float64(indexes[i]), 4)
+		}
+		if loss := t.loss(candidate); loss < bestLoss {
+			best, bestLoss = candidate, loss
+		}
+
+		// Advance the indexes like an odometer
+		i := 0
+		for ; i < len(indexes); i++ {
+			indexes[i]++
+			if indexes[i] < t.req.GridPoints {
+				break
+			}
+			indexes[i] = 0
+		}
+		if i == len(indexes) {
+			return best, nil
+		}
+	}
+}
+
+// randomSearch tries Iterations parameter sets drawn uniformly from each range
+func (t *tuner) randomSearch(ctx context.Context) (models.ModelParameters, error) {
+	random := rand.New(rand.NewSource(t.req.Seed))
+	best := t.req.Start.Parameters
+	bestLoss := t.loss(best)
+
+	for iteration := 0; iteration < t.req.Iterations; iteration++ {
+		if err := ctx.Err(); err != nil {
+			return best, err
+		}
+
+		candidate := t.req.Start.Parameters
+		for _, param := range t.params {
+			*param.field(&candidate) = roundTo(param.min+random.Float64()*(param.max-param.min), 4)
+		}
+		if loss := t.loss(candidate); loss < bestLoss {
+			best, bestLoss = candidate, loss
+		}
+	}
+	return best, nil
+}
+
+// coordinateDescent moves one parameter at a time by a step in whichever
+// direction lowers the loss, halving the steps after a pass with no
+// improvement. It stops after Iterations passes or once the steps are tiny.
+func (t *tuner) coordinateDescent(ctx context.Context) (models.ModelParameters, error) {
+	best := t.req.Start.Parameters
+	bestLoss := t.loss(best)
+
+	steps := make([]float64, len(t.params))
+	for i, param := range t.params {
+		steps[i] = (param.max - param.min) / 4
+	}
+
+	for pass := 0; pass < t.req.Iterations; pass++ {
+		improved := false
+		for i, param := range t.params {
+			if err := ctx.Err(); err != nil {
+				return best, err
+			}
+
+			current := *param.field(&best)
+			for _, value := range []float64{current - steps[i], current + steps[i]} {
+				value = roundTo(math.Min(math.Max(value, param.min), param.max), 4)
+				if value == current {
+					continue
+				}
+				candidate := best
+				*param.field(&candidate) = value
+				if loss := t.loss(candidate); loss < bestLoss {
+					best, bestLoss = candidate, loss
+					improved = true
+					break
+				}
+			}
+		}
+
+		if !improved {
+			done := true
+			for i, param := range t.params {
+				steps[i] /= 2
+				if steps[i] >= (param.max-param.min)/256 {
+					done = false
+				}
+			}
+			if done {
+				break
+			}
+		}
+	}
+	return best, nil
+}
+
+// TunableParameterNames lists the parameters the tuner can search
+func TunableParameterNames() []string {
+	names := make([]string, len(tunableParameters))
+	for i, param := range tunableParameters {
+		names[i] = param.name
+	}
+	return names
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"api.alexmontague.ca/internal/nhl/models"
+)
+
+func tuningRequest(strategy models.CalculationStrategy, loss TuningLoss) TuningRequest {
+	return TuningRequest{
+		Start:      models.ModelVersion{CalculationStrategy: strategy},
+		Search:     SearchGrid,
+		Loss:       loss,
+		Line:       2.5,
+		GridPoints: 3,
+		StartDate:  "2025-03-01",
+		EndDate:    "2025-03-31",
+	}
+}
+
+func parameterNames(params []tunableParameter) []string {
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.name
+	}
+	return names
+}
+
+func TestTuningRequestParameters(t *testing.T) {
+	req := tuningRequest(models.WeightedRecencyCalculation, LossMAE)
+	req.Search = SearchCoordinate
+	req.Iterations = 10
+	params, err := req.parameters()
+	if err != nil {
+		t.Fatalf("parameters: %v", err)
+	}
+	names := parameterNames(params)
+	if !slices.Contains(names, "lastGameWeight") {
+		t.Errorf("weighted recency parameters %v are missing lastGameWeight", names)
+	}
+	if slices.Contains(names, "shotScoreMultiplier") {
+		t.Errorf("MAE parameters %v include a confidence only parameter", names)
+	}
+
+	req = tuningRequest(models.StandardCalculation, LossBrier)
+	req.Parameters = []string{"shotScoreMultiplier", "gamePaceExponent"}
+	params, err = req.parameters()
+	if err != nil {
+		t.Fatalf("parameters: %v", err)
+	}
+	if names := parameterNames(params); !slices.Equal(names, req.Parameters) {
+		t.Errorf("parameters = %v, want %v", names, req.Parameters)
+	}
+
+	invalid := []struct {
+		name   string
+		modify func(*TuningRequest)
+	}{
+		{"unknown parameter", func(req *TuningRequest) { req.Parameters = []string{"bogus"} }},
+		{"unused by strategy", func(req *TuningRequest) { req.Parameters = []string{"lastGameWeight"} }},
+		{"unused by loss", func(req *TuningRequest) { req.Parameters = []string{"shotScoreMultiplier"} }},
+		{"grid too large", func(req *TuningRequest) { req.GridPoints = 10 }},
+		{"unknown loss", func(req *TuningRequest) { req.Loss = "accuracy" }},
+		{"no line", func(req *TuningRequest) { req.Line = 0 }},
+		{"bad dates", func(req *TuningRequest) { req.EndDate = "2025-02-01" }},
+	}
+	for _, tt := range invalid {
+		req := tuningRequest(models.StandardCalculation, LossMAE)
+		tt.modify(&req)
+		if _, err := req.parameters(); err == nil {
+			t.Errorf("%s: parameters succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestGridSearchTriesEveryCombination(t *testing.T) {
+	req := tuningRequest(models.StandardCalculation, LossMAE)
+	req.Parameters = []string{"gamePaceExponent", "teamOffenseExponent"}
+	params, err := req.parameters()
+	if err != nil {
+		t.Fatalf("parameters: %v", err)
+	}
+
+	tuner := &tuner{req: req, params: params}
+	if _, err := tuner.search(t.Context()); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	// The starting parameters, then a 3 by 3 grid
+	if tuner.evaluations != 1+3*3 {
+		t.Errorf("grid search made %d evaluations, want %d", tuner.evaluations, 1+3*3)
+	}
+}
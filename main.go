@@ -43,6 +43,21 @@ func handleRequests() {
 	router.HandleFunc("/nhl/shots", controllers.GetPlayerShotStats).Methods("GET")
 	router.HandleFunc("/nhl/shots/records", controllers.GetPlayerShotRecords).Methods("GET")
 	router.HandleFunc("/nhl/shots/seed", controllers.SeedAndValidatePredictions).Methods("GET")
+	router.HandleFunc("/nhl/predictions/{id}/features", controllers.GetPredictionFeatures).Methods("GET")
+
+	nhlRouter := router.PathPrefix("/nhl").Subrouter()
+	nhlRouter.Use(middleware.AuthMiddleware)
+
+	nhlRouter.HandleFunc("/models", controllers.GetModelVersions).Methods("GET")
+	nhlRouter.HandleFunc("/models", controllers.CreateModelVersion).Methods("POST")
+	nhlRouter.HandleFunc("/models/stats", controllers.GetModelStats).Methods("GET")
+	nhlRouter.HandleFunc("/models/{id}", controllers.GetModelVersion).Methods("GET")
+	nhlRouter.HandleFunc("/models/{id}/clone", controllers.CloneModelVersion).Methods("POST")
+	nhlRouter.HandleFunc("/models/{id}/activate", controllers.ActivateModelVersion).Methods("POST")
+	nhlRouter.HandleFunc("/models/{id}/retire", controllers.RetireModelVersion).Methods("POST")
+	nhlRouter.HandleFunc("/models/{id}/calibration", controllers.GetModelCalibration).Methods("GET")
+	nhlRouter.HandleFunc("/backtest", controllers.RunBacktest).Methods("POST")
+	nhlRouter.HandleFunc("/lines", controllers.ImportPropLines).Methods("POST")
 
 	router.HandleFunc("/auth/register", controllers.Register).Methods("POST")
 	router.HandleFunc("/auth/login", controllers.Login).Methods("POST")
@@ -52,35 +67,92 @@ func handleRequests() {
 
 	budgetRouter.HandleFunc("/me", controllers.GetCurrentUser).Methods("GET")
 
+	budgetRouter.HandleFunc("/households", controllers.GetHouseholds).Methods("GET")
+	budgetRouter.HandleFunc("/households", controllers.CreateHousehold).Methods("POST")
+	budgetRouter.HandleFunc("/households/members", controllers.GetHouseholdMembers).Methods("GET")
+	budgetRouter.HandleFunc("/households/members/{userId}", controllers.UpdateHouseholdMember).Methods("PUT")
+	budgetRouter.HandleFunc("/households/members/{userId}", controllers.RemoveHouseholdMember).Methods("DELETE")
+	budgetRouter.HandleFunc("/households/invitations", controllers.GetHouseholdInvitations).Methods("GET")
+	budgetRouter.HandleFunc("/households/invitations", controllers.CreateHouseholdInvitation).Methods("POST")
+	budgetRouter.HandleFunc("/households/invitations/{id}", controllers.RevokeHouseholdInvitation).Methods("DELETE")
+	budgetRouter.HandleFunc("/invitations", controllers.GetMyInvitations).Methods("GET")
+	budgetRouter.HandleFunc("/invitations/{token}/accept", controllers.AcceptHouseholdInvitation).Methods("POST")
+
 	budgetRouter.HandleFunc("/categories", controllers.GetCategories).Methods("GET")
 	budgetRouter.HandleFunc("/categories", controllers.CreateCategory).Methods("POST")
 	budgetRouter.HandleFunc("/categories/defaults", controllers.CreateDefaultCategories).Methods("POST")
-	budgetRouter.HandleFunc("/categories/{id}", controllers.UpdateCategory).Methods("PUT")
+	budgetRouter.HandleFunc("/categories/{id}", controllers.GetCategory).Methods("GET")
+	budgetRouter.HandleFunc("/categories/{id}", controllers.UpdateCategory).Methods("PUT", "PATCH")
 	budgetRouter.HandleFunc("/categories/{id}", controllers.DeleteCategory).Methods("DELETE")
 	budgetRouter.HandleFunc("/categories", controllers.DeleteAllCategories).Methods("DELETE")
 
 	budgetRouter.HandleFunc("/budgets", controllers.GetBudgets).Methods("GET")
 	budgetRouter.HandleFunc("/budgets", controllers.CreateBudget).Methods("POST")
-	budgetRouter.HandleFunc("/budgets/{id}", controllers.UpdateBudget).Methods("PUT")
+	budgetRouter.HandleFunc("/budgets/{id}", controllers.GetBudget).Methods("GET")
+	budgetRouter.HandleFunc("/budgets/{id}", controllers.UpdateBudget).Methods("PUT", "PATCH")
 	budgetRouter.HandleFunc("/budgets/{id}", controllers.DeleteBudget).Methods("DELETE")
 	budgetRouter.HandleFunc("/budgets", controllers.DeleteAllBudgets).Methods("DELETE")
+	budgetRouter.HandleFunc("/budgets/generate", controllers.GenerateBudget).Methods("POST")
+
+	budgetRouter.HandleFunc("/templates", controllers.GetBudgetTemplates).Methods("GET")
+	budgetRouter.HandleFunc("/templates", controllers.CreateBudgetTemplate).Methods("POST")
+	budgetRouter.HandleFunc("/templates/active", controllers.GetActiveBudgetTemplate).Methods("GET")
+	budgetRouter.HandleFunc("/templates/active", controllers.SetActiveBudgetTemplate).Methods("PUT")
+	budgetRouter.HandleFunc("/templates/{id}", controllers.UpdateBudgetTemplate).Methods("PUT")
+	budgetRouter.HandleFunc("/templates/{id}", controllers.DeleteBudgetTemplate).Methods("DELETE")
 
 	budgetRouter.HandleFunc("/transactions", controllers.GetTransactions).Methods("GET")
 	budgetRouter.HandleFunc("/transactions", controllers.CreateTransactions).Methods("POST")
-	budgetRouter.HandleFunc("/transactions/{id}", controllers.UpdateTransaction).Methods("PUT")
+	budgetRouter.HandleFunc("/transactions/{id}", controllers.GetTransaction).Methods("GET")
+	budgetRouter.HandleFunc("/transactions/{id}", controllers.UpdateTransaction).Methods("PUT", "PATCH")
 	budgetRouter.HandleFunc("/transactions/{id}", controllers.DeleteTransaction).Methods("DELETE")
 	budgetRouter.HandleFunc("/transactions", controllers.DeleteAllTransactions).Methods("DELETE")
+	budgetRouter.HandleFunc("/transactions/{id}/attachments", controllers.GetAttachments).Methods("GET")
+	budgetRouter.HandleFunc("/transactions/{id}/attachments", controllers.UploadAttachment).Methods("POST")
+
+	budgetRouter.HandleFunc("/attachments/{id}", controllers.DownloadAttachment).Methods("GET")
+	budgetRouter.HandleFunc("/attachments/{id}", controllers.DeleteAttachment).Methods("DELETE")
+
+	budgetRouter.HandleFunc("/merchants", controllers.GetMerchants).Methods("GET")
+	budgetRouter.HandleFunc("/merchants/relink", controllers.RelinkMerchants).Methods("POST")
+	budgetRouter.HandleFunc("/merchants/{id}", controllers.GetMerchantHistory).Methods("GET")
+	budgetRouter.HandleFunc("/merchants/{id}", controllers.UpdateMerchant).Methods("PUT")
+	budgetRouter.HandleFunc("/merchants/{id}/aliases", controllers.AddMerchantAlias).Methods("POST")
+
+	budgetRouter.HandleFunc("/tags", controllers.GetTags).Methods("GET")
+	budgetRouter.HandleFunc("/tags", controllers.CreateTag).Methods("POST")
+	budgetRouter.HandleFunc("/tags/{id}", controllers.UpdateTag).Methods("PUT")
+	budgetRouter.HandleFunc("/tags/{id}", controllers.DeleteTag).Methods("DELETE")
+	budgetRouter.HandleFunc("/reports/tags", controllers.GetTagReport).Methods("GET")
+	budgetRouter.HandleFunc("/reports/tax", controllers.GetTaxReport).Methods("GET")
+
+	budgetRouter.HandleFunc("/forecast", controllers.GetForecast).Methods("GET")
+	budgetRouter.HandleFunc("/forecast/backtest", controllers.BacktestForecast).Methods("GET")
+
+	budgetRouter.HandleFunc("/audit", controllers.GetAuditLog).Methods("GET")
+	budgetRouter.HandleFunc("/audit/{id}/undo", controllers.UndoAuditEntry).Methods("POST")
+
+	budgetRouter.HandleFunc("/trash", controllers.GetTrash).Methods("GET")
+	budgetRouter.HandleFunc("/trash/{id}/restore", controllers.RestoreTrash).Methods("POST")
+	budgetRouter.HandleFunc("/trash/{id}", controllers.DeleteTrash).Methods("DELETE")
+
+	budgetRouter.HandleFunc("/sync", controllers.GetSyncChanges).Methods("GET")
+	budgetRouter.HandleFunc("/sync", controllers.PushSyncChanges).Methods("POST")
 
 	budgetRouter.HandleFunc("/clear", controllers.ClearAllBudgetData).Methods("DELETE")
 	budgetRouter.HandleFunc("/export", controllers.ExportBudgetData).Methods("GET")
 	budgetRouter.HandleFunc("/import", controllers.ImportBudgetData).Methods("POST")
+	budgetRouter.HandleFunc("/imports", controllers.CreateImportSession).Methods("POST")
+	budgetRouter.HandleFunc("/imports/{token}", controllers.GetImportSession).Methods("GET")
+	budgetRouter.HandleFunc("/imports/{token}/transactions", controllers.StreamImportTransactions).Methods("POST")
+	budgetRouter.HandleFunc("/imports/{token}/complete", controllers.CompleteImportSession).Methods("POST")
 
 	// CORS middleware
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:5173"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match", controllers.HOUSEHOLD_HEADER},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -113,10 +185,8 @@ func main() {
 
 	// Initialize model prediction system
 	go func() {
-		// Ensure models are initialized on startup
+		// Seed the model registry and load the active model on startup
 		service.InitializeModels()
-		// Set the active model version to use for predictions
-		service.SetActiveModelVersion(1) // Using the original model as default
 	}()
 
 	handleRequests()